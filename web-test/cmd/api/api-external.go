@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"webapp/pkg/oidc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Clients of the api may log their users in with an external OpenID Connect
+// provider too. The client sends the user to the provider itself, with its
+// own state, nonce and PKCE code verifier, and hands the code it gets back
+// to the api, which exchanges it with the client secret it keeps.
+
+// IdentityProvider is an external provider, as the api lists it.
+type IdentityProvider struct {
+	Name     string `json:"name"`
+	Label    string `json:"label"`
+	Issuer   string `json:"issuer"`
+	ClientID string `json:"client_id"`
+}
+
+// ExternalLogin is what a client sends back from logging in at a provider.
+type ExternalLogin struct {
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+}
+
+// listIdentityProviders lists the providers users may log in with.
+func (app *application) listIdentityProviders(w http.ResponseWriter, r *http.Request) {
+	providers := []IdentityProvider{}
+	for _, p := range app.IdentityProviders {
+		providers = append(providers, IdentityProvider{Name: p.Name, Label: p.Label, Issuer: p.Issuer, ClientID: p.ClientID})
+	}
+	_ = app.writeJSON(w, http.StatusOK, providers)
+}
+
+// authenticateExternal sends a token pair to the user a provider logged in,
+// if their identity is linked to an account or, for providers trusted with
+// their email addresses, can be.
+func (app *application) authenticateExternal(w http.ResponseWriter, r *http.Request) {
+	p := oidc.FindProvider(app.IdentityProviders, chi.URLParam(r, "provider"))
+	if p == nil {
+		app.codeErrorJSON(w, r, http.StatusNotFound, codeNotFound)
+		return
+	}
+
+	var login ExternalLogin
+	err := app.readJSON(w, r, &login)
+	if err != nil || login.Code == "" || login.RedirectURI == "" || login.CodeVerifier == "" || login.Nonce == "" {
+		app.countLogin(r, false)
+		app.codeErrorJSON(w, r, http.StatusBadRequest, codeBadRequest)
+		return
+	}
+
+	claims, err := p.Exchange(r.Context(), login.Code, login.RedirectURI, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		app.logError(r, "could not log in with identity provider", err)
+		app.countLogin(r, false)
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
+		return
+	}
+
+	user, err := oidc.UserFor(app.DB, p, claims)
+	if err != nil {
+		if !errors.Is(err, oidc.ErrNoAccount) {
+			app.logError(r, "could not find user of external identity", err)
+		}
+		app.countLogin(r, false)
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
+		return
+	}
+	app.countLogin(r, true)
+
+	tokenPairs, err := app.generateTokenPair(user)
+	if err != nil {
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
+		return
+	}
+
+	http.SetCookie(w, app.refreshCookie(tokenPairs.RefreshToken))
+	_ = app.writeJSON(w, http.StatusOK, tokenPairs)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"webapp/pkg/config"
+	"webapp/pkg/data"
+	"webapp/pkg/oidc"
+	"webapp/pkg/oidc/oidctest"
+	"webapp/pkg/repository/dbrepo"
+)
+
+const testExternalRedirectURI = "https://spa.example/callback"
+
+func Test_app_authenticateExternal(t *testing.T) {
+	// the identities linked here are the test's own
+	db := app.DB
+	app.DB = &dbrepo.TestDBRepo{}
+	defer func() { app.DB = db }()
+
+	fake := oidctest.NewProvider(t)
+	corp := fake.Config("corp", "")
+	corp.TrustEmail = true
+	app.IdentityProviders = oidc.NewProviders([]config.IdentityProviderConfig{fake.Config("fake", ""), corp})
+	defer func() { app.IdentityProviders = nil }()
+
+	// the client of the api logs the user in at the provider, as the fake
+	// provider does for anyone who asks
+	login := func(provider string, change func(l *ExternalLogin)) ExternalLogin {
+		l := ExternalLogin{RedirectURI: testExternalRedirectURI}
+		l.Nonce, _ = oidc.RandomString()
+		l.CodeVerifier, _ = oidc.RandomString()
+
+		p := oidc.FindProvider(app.IdentityProviders, provider)
+		if p == nil {
+			p = app.IdentityProviders[0]
+		}
+		authURL, err := p.AuthURL(context.Background(), l.RedirectURI, "state", l.Nonce, l.CodeVerifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Code = fake.Login(t, authURL).Query().Get("code")
+		if change != nil {
+			change(&l)
+		}
+		return l
+	}
+
+	// the admin linked an identity from the web application before
+	_, _ = app.DB.InsertUserIdentity(data.UserIdentity{UserID: 1, Provider: "fake", Subject: "api-linked", Email: "admin@corp.example"})
+
+	var tests = []struct {
+		name           string
+		provider       string
+		subject        string
+		email          string
+		verified       bool
+		change         func(l *ExternalLogin)
+		expectedStatus int
+		expectedUser   string
+	}{
+		{"valid", "fake", "api-linked", "admin@corp.example", true, nil, http.StatusOK, "1"},
+		{"wrong verifier", "fake", "api-linked", "admin@corp.example", true, func(l *ExternalLogin) { l.CodeVerifier = l.Nonce }, http.StatusUnauthorized, ""},
+		{"wrong redirect uri", "fake", "api-linked", "admin@corp.example", true, func(l *ExternalLogin) { l.RedirectURI = "https://evil.example/" }, http.StatusUnauthorized, ""},
+		{"no nonce", "fake", "api-linked", "admin@corp.example", true, func(l *ExternalLogin) { l.Nonce = "" }, http.StatusBadRequest, ""},
+		{"verified email of an account", "fake", "api-new", "admin@example.com", true, nil, http.StatusUnauthorized, ""},
+		{"unknown email", "fake", "api-new", "nobody@example.com", true, nil, http.StatusUnauthorized, ""},
+		{"trusted verified email", "corp", "api-corp", "user@example.com", true, nil, http.StatusOK, "2"},
+		{"trusted unverified email", "corp", "api-unverified", "admin@example.com", false, nil, http.StatusUnauthorized, ""},
+		{"unknown provider", "unknown", "api-linked", "admin@corp.example", true, nil, http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		fake.Subject, fake.Email, fake.EmailVerified = e.subject, e.email, e.verified
+		body, _ := json.Marshal(login(e.provider, e.change))
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("provider", e.provider)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.authenticateExternal).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d: %s", e.name, e.expectedStatus, rr.Code, rr.Body)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		var tokens TokenPairs
+		_ = json.NewDecoder(rr.Body).Decode(&tokens)
+		check := httptest.NewRequest("GET", "/", nil)
+		check.Header.Set("Authorization", "Bearer "+tokens.Token)
+		if _, claims, err := app.getTokenFromHeaderAndVerify(httptest.NewRecorder(), check); err != nil || claims.Subject != e.expectedUser {
+			t.Errorf("%s: expected a valid token for user %s, got %v", e.name, e.expectedUser, err)
+		}
+		if len(rr.Result().Cookies()) == 0 {
+			t.Errorf("%s: expected the refresh token cookie", e.name)
+		}
+	}
+}
+
+func Test_app_listIdentityProviders(t *testing.T) {
+	fake := oidctest.NewProvider(t)
+	app.IdentityProviders = oidc.NewProviders([]config.IdentityProviderConfig{fake.Config("fake", "")})
+	defer func() { app.IdentityProviders = nil }()
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.listIdentityProviders).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	var providers []IdentityProvider
+	_ = json.NewDecoder(rr.Body).Decode(&providers)
+	if len(providers) != 1 || providers[0].Name != "fake" || providers[0].Issuer != fake.URL || providers[0].ClientID != fake.ClientID {
+		t.Errorf("expected the fake provider to be listed, got %+v", providers)
+	}
+	if strings.Contains(rr.Body.String(), fake.ClientSecret) {
+		t.Error("the client secret must not be listed")
+	}
+}
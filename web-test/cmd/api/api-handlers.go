@@ -1,11 +1,14 @@
 package main
 
 import (
+	"database/sql"
 	"errors"
 	"net/http"
 	"strconv"
 	"time"
 	"webapp/pkg/data"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v4"
@@ -27,42 +30,38 @@ func (app *application) authenticate(w http.ResponseWriter, r *http.Request) {
 	// read a json payload
 	err := app.readJSON(w, r, &creds)
 	if err != nil {
-		app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		app.countLogin(r, false)
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
 		return
 	}
 
-	// look up the user by email address
+	// look up the user by email address; without one, check the password
+	// anyway, so an unknown email takes as long as a wrong password
 	user, err := app.DB.GetUserByEmail(creds.Username)
 	if err != nil {
-		app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		data.ComparePasswordOfNoUser(creds.Password)
+		app.countLogin(r, false)
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
 		return
 	}
 
 	// check password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password))
 	if err != nil {
-		app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		app.countLogin(r, false)
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
 		return
 	}
+	app.countLogin(r, true)
 
 	// generate tokens
 	tokenPairs, err := app.generateTokenPair(user)
 	if err != nil {
-		app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name: "__Host-refresh_token",
-		Path: "/",
-		Value: tokenPairs.RefreshToken,
-		Expires: time.Now().Add(refreshTokenExpiry),
-		MaxAge: int(refreshTokenExpiry.Seconds()),
-		SameSite: http.SameSiteStrictMode,
-		Domain: "localhost",
-		HttpOnly: true,
-		Secure: true,
-	})
+	http.SetCookie(w, app.refreshCookie(tokenPairs.RefreshToken))
 
 	// send token to user
 	_ = app.writeJSON(w, http.StatusOK, tokenPairs)
@@ -94,7 +93,7 @@ func (app *application) refresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if time.Unix(claims.ExpiresAt.Unix(), 0).Sub(time.Now()) > 30 * time.Second {
-		app.errorJSON(w, errors.New("refresh token does not need renewed yet"), http.StatusTooEarly)
+		app.codeErrorJSON(w, r, http.StatusTooEarly, codeRefreshTooEarly)
 		return
 	}
 
@@ -107,7 +106,8 @@ func (app *application) refresh(w http.ResponseWriter, r *http.Request) {
 
 	user, err := app.DB.GetUser(userID)
 	if err != nil {
-		app.errorJSON(w, errors.New("unknown user"), http.StatusBadRequest)
+		app.logError(r, "could not get user for refresh token", err)
+		app.codeErrorJSON(w, r, http.StatusBadRequest, codeUnknownUser)
 		return
 	}
 
@@ -117,24 +117,14 @@ func (app *application) refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name: "__Host-refresh_token",
-		Path: "/",
-		Value: tokenPairs.RefreshToken,
-		Expires: time.Now().Add(refreshTokenExpiry),
-		MaxAge: int(refreshTokenExpiry.Seconds()),
-		SameSite: http.SameSiteStrictMode,
-		Domain: "localhost",
-		HttpOnly: true,
-		Secure: true,
-	})
+	http.SetCookie(w, app.refreshCookie(tokenPairs.RefreshToken))
 
 	_ = app.writeJSON(w, http.StatusOK, tokenPairs)
 }
 
 func (app *application) refreshUsingCookie(w http.ResponseWriter, r *http.Request) {
 	for _, cookie := range r.Cookies(){
-		if cookie.Name == "__Host-refresh_token" {
+		if cookie.Name == refreshCookieName {
 			claims := &Claims{}
 			refreshToken := cookie.Value
 
@@ -161,7 +151,8 @@ func (app *application) refreshUsingCookie(w http.ResponseWriter, r *http.Reques
 		
 			user, err := app.DB.GetUser(userID)
 			if err != nil {
-				app.errorJSON(w, errors.New("unknown user"), http.StatusBadRequest)
+				app.logError(r, "could not get user for refresh cookie", err)
+				app.codeErrorJSON(w, r, http.StatusBadRequest, codeUnknownUser)
 				return
 			}
 		
@@ -171,17 +162,7 @@ func (app *application) refreshUsingCookie(w http.ResponseWriter, r *http.Reques
 				return
 			}
 		
-			http.SetCookie(w, &http.Cookie{
-				Name: "__Host-refresh_token",
-				Path: "/",
-				Value: tokenPairs.RefreshToken,
-				Expires: time.Now().Add(refreshTokenExpiry),
-				MaxAge: int(refreshTokenExpiry.Seconds()),
-				SameSite: http.SameSiteStrictMode,
-				Domain: "localhost",
-				HttpOnly: true,
-				Secure: true,
-			})
+			http.SetCookie(w, app.refreshCookie(tokenPairs.RefreshToken))
 
 			// send back JSON
 			_ = app.writeJSON(w, http.StatusOK, tokenPairs)
@@ -190,16 +171,20 @@ func (app *application) refreshUsingCookie(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
-	app.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+	app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
 }
 
 // allUsers returns a list of all users as JSON
 func (app *application) allUsers(w http.ResponseWriter, r *http.Request) {
 	users, err := app.DB.AllUsers()
 	if err != nil {
+		app.logError(r, "could not list users", err)
 		app.errorJSON(w, err, http.StatusBadRequest)
 		return
 	}
+	for _, user := range users {
+		setProfilePicURL(user)
+	}
 
 	_ = app.writeJSON(w, http.StatusOK, users)
 }
@@ -214,9 +199,11 @@ func (app *application) getUser(w http.ResponseWriter, r *http.Request) {
 
 	user, err := app.DB.GetUser(userID)
 	if err != nil {
+		app.logError(r, "could not get user", err)
 		app.errorJSON(w, err, http.StatusBadRequest)
 		return
 	}
+	setProfilePicURL(user)
 
 	_ = app.writeJSON(w, http.StatusOK, user)
 }
@@ -230,8 +217,38 @@ func (app *application) updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !app.userWriteAllowed(w, r, user.ID) {
+		return
+	}
+	// the fields which may change depend on the stored user, so the
+	// request fails without one
+	existing, err := app.DB.GetUser(user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.codeErrorJSON(w, r, http.StatusNotFound, codeNotFound)
+		return
+	}
+	if err != nil {
+		app.logError(r, "could not get user", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+	if !app.allowedUserChanges(w, r, *existing, user) {
+		return
+	}
+
+	form, err := app.userForm(r, user)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	if !form.Valid() {
+		app.validationErrorJSON(w, r, form)
+		return
+	}
+
 	err = app.DB.UpdateUser(user)
 	if err != nil {
+		app.logError(r, "could not update user", err)
 		app.errorJSON(w, err, http.StatusBadRequest)
 		return
 	}
@@ -246,9 +263,13 @@ func (app *application) deleteUser(w http.ResponseWriter, r *http.Request) {
 		app.errorJSON(w, err, http.StatusBadRequest)
 		return
 	}
+	if !app.userWriteAllowed(w, r, userID) {
+		return
+	}
 
 	err = app.DB.DeleteUser(userID)
 	if err != nil {
+		app.logError(r, "could not delete user", err)
 		app.errorJSON(w, err, http.StatusBadRequest)
 		return
 	}
@@ -258,15 +279,37 @@ func (app *application) deleteUser(w http.ResponseWriter, r *http.Request) {
 
 // insertUser inserts a user using a JSON payload, and returns a header
 func (app *application) insertUser(w http.ResponseWriter, r *http.Request) {
+	if !app.adminRequired(w, r) {
+		return
+	}
+
 	var user data.User
 	err := app.readJSON(w, r, &user)
 	if err != nil {
 		app.errorJSON(w, err, http.StatusBadRequest)
 		return
 	}
+	if !app.allowedUserChanges(w, r, data.User{}, user) {
+		return
+	}
+
+	form, err := app.userForm(r, user)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	form.Unique("email", func(email string) bool {
+		_, err := app.DB.GetUserByEmail(email)
+		return err == nil
+	})
+	if !form.Valid() {
+		app.validationErrorJSON(w, r, form)
+		return
+	}
 
 	_, err = app.DB.InsertUser(user)
 	if err != nil {
+		app.logError(r, "could not insert user", err)
 		app.errorJSON(w, err, http.StatusBadRequest)
 		return
 	}
@@ -274,19 +317,27 @@ func (app *application) insertUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// userForm checks the fields of a user sent as JSON, with the same rules as
+// the web forms, reporting errors in the language of the request.
+func (app *application) userForm(r *http.Request, user data.User) (*forms.Form, error) {
+	form, err := forms.FromStruct(user)
+	if err != nil {
+		return nil, err
+	}
+	form.Messages = i18n.FromContext(r.Context()).FormMessages()
+
+	form.Required("first_name", "last_name", "email")
+	form.MaxLength("first_name", 255)
+	form.MaxLength("last_name", 255)
+	form.MaxLength("email", 255)
+	form.Email("email")
+	form.OneOf("is_admin", "0", "1")
+	form.OneOf("locale", app.I18n.Locales()...)
+
+	return form, nil
+}
+
 func (app *application) deleteRefreshCookie(w http.ResponseWriter, r * http.Request) {
-	delCookie := http.Cookie{
-		Name: "__Host-refresh_token",
-		Path: "/",
-		Value: "",
-		Expires: time.Unix(0,0),
-		MaxAge: -1,
-		SameSite: http.SameSiteStrictMode,
-		Domain: "localhost",
-		HttpOnly: true,
-		Secure: true,
-	}
-
-	http.SetCookie(w, &delCookie)
+	http.SetCookie(w, app.expiredRefreshCookie())
 	w.WriteHeader(http.StatusAccepted)
 }
\ No newline at end of file
@@ -1,18 +1,29 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	chi "github.com/go-chi/chi/v5"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 
+	"webapp/openapi"
+	"webapp/pkg/apiclient"
 	"webapp/pkg/data"
+	"webapp/pkg/oidc"
+	"webapp/pkg/repository/dbrepo"
 )
 
 func Test_app_authenticate(t *testing.T) {
@@ -135,7 +146,7 @@ func Test_app_userHandlers(t *testing.T) {
 			`{"id":100,"first_name":"Administrator","last_name":"User","email":"admin@example.com"}`,
 			"",
 			app.updateUser,
-			http.StatusBadRequest,
+			http.StatusNotFound,
 		},
 		{
 			"updateUser invalid json",
@@ -161,6 +172,38 @@ func Test_app_userHandlers(t *testing.T) {
 			app.insertUser,
 			http.StatusBadRequest,
 		},
+		{
+			"insertUser bad email",
+			"PUT",
+			`{"first_name":"Jack","last_name":"Smith","email":"jack"}`,
+			"",
+			app.insertUser,
+			http.StatusUnprocessableEntity,
+		},
+		{
+			"insertUser missing name",
+			"PUT",
+			`{"first_name":"","last_name":"Smith","email":"jack@example.com"}`,
+			"",
+			app.insertUser,
+			http.StatusUnprocessableEntity,
+		},
+		{
+			"insertUser email taken",
+			"PUT",
+			`{"first_name":"Jack","last_name":"Smith","email":"admin@example.com"}`,
+			"",
+			app.insertUser,
+			http.StatusUnprocessableEntity,
+		},
+		{
+			"updateUser bad is_admin",
+			"PATCH",
+			`{"id":1,"first_name":"Administrator","last_name":"User","email":"admin@example.com","is_admin":2}`,
+			"",
+			app.updateUser,
+			http.StatusUnprocessableEntity,
+		},
 		{
 			"insertUser invalid json",
 			"PUT",
@@ -184,6 +227,8 @@ func Test_app_userHandlers(t *testing.T) {
 			chiCtx.URLParams.Add("userID", e.paramID)
 			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
 		}
+		// as the admin, who may change every field
+		req = req.WithContext(context.WithValue(req.Context(), contextClaimsKey, &Claims{Admin: true}))
 
 		rr := httptest.NewRecorder()
 		handler := http.HandlerFunc(e.handler)
@@ -200,6 +245,31 @@ func Test_app_userHandlers(t *testing.T) {
 	}
 }
 
+// brokenDB fails to load any user, as a database which went away would.
+type brokenDB struct {
+	*dbrepo.TestDBRepo
+}
+
+func (m brokenDB) GetUser(id int) (*data.User, error) {
+	return nil, errors.New("connection refused")
+}
+
+func Test_app_updateUserLookupFails(t *testing.T) {
+	db := app.DB
+	app.DB = brokenDB{&dbrepo.TestDBRepo{}}
+	defer func() { app.DB = db }()
+
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`{"id":1,"first_name":"Administrator","last_name":"User","email":"admin@example.com"}`))
+	req = req.WithContext(context.WithValue(req.Context(), contextClaimsKey, &Claims{Admin: true}))
+	rr := httptest.NewRecorder()
+
+	app.updateUser(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d when the user cannot be loaded, but got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
 func Test_app_refreshUsingCookie(t *testing.T) {
 	testUser := data.User{
 		ID:        1,
@@ -294,3 +364,311 @@ func Test_app_deleteRefreshCookie(t *testing.T) {
 		t.Error("__Host-refresh_token cookie not found")
 	}
 }
+
+func Test_app_contract(t *testing.T) {
+	metricsToken := app.Config.Metrics.Token
+	app.Config.Metrics.Token = "scrape-token"
+	defer func() { app.Config.Metrics.Token = metricsToken }()
+
+	routes := app.routes()
+
+	tokens, _ := app.generateTokenPair(&data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", IsAdmin: 1})
+	refresh := url.Values{"refresh_token": {tokens.RefreshToken}}
+
+	dir := app.Config.Upload.Dir
+	app.Config.Upload.Dir = t.TempDir()
+	defer func() { app.Config.Upload.Dir = dir }()
+	picture, _ := json.Marshal(profilePicUpload{FileName: "img.png", Content: pngImage(t)})
+
+	secret := insertOAuthClient(t, "contract", false)
+	insertOAuthClient(t, "contract-spa", true)
+	var issued oauthTokenResponse
+	rr := postOAuthForm(t, app.oauthToken, "contract", secret, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {insertAuthCode(t, "contract", time.Now().Add(time.Minute))},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testVerifier},
+	})
+	if err := json.NewDecoder(rr.Body).Decode(&issued); err != nil || issued.AccessToken == "" {
+		t.Fatalf("could not exchange code: %d %v", rr.Code, err)
+	}
+	accessToken := issued.AccessToken
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"contract"},
+		"client_secret": {secret},
+		"code":          {insertAuthCode(t, "contract", time.Now().Add(time.Minute))},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testVerifier},
+	}
+	wrongSecret := url.Values{"grant_type": {"authorization_code"}, "client_id": {"contract"}, "client_secret": {"guess"}}
+	introspect := url.Values{"token": {accessToken}, "client_id": {"contract"}, "client_secret": {secret}}
+	publicIntrospect := url.Values{"token": {accessToken}, "client_id": {"contract-spa"}}
+	revoke := url.Values{"token": {accessToken}, "client_id": {"contract"}, "client_secret": {secret}}
+
+	var tests = []struct {
+		name   string
+		method string
+		url    string
+		route  string
+		body   string
+		auth   bool
+	}{
+		{"authenticate", "POST", "/v1/auth", "/v1/auth", `{"email":"admin@example.com","password":"secret"}`, false},
+		{"authenticate bad password", "POST", "/v1/auth", "/v1/auth", `{"email":"admin@example.com","password":"nope"}`, false},
+		{"refresh too early", "POST", "/v1/refresh-token", "/v1/refresh-token", refresh.Encode(), false},
+		{"list identity providers", "GET", "/v1/auth/providers", "/v1/auth/providers", "", false},
+		{"authenticate with unknown provider", "POST", "/v1/auth/providers/unknown", "/v1/auth/providers/{provider}", `{"code":"x","redirect_uri":"https://app.example/","code_verifier":"y","nonce":"z"}`, false},
+		{"passkey login options", "GET", "/v1/auth/passkey/options", "/v1/auth/passkey/options", "", false},
+		{"authenticate with unknown passkey", "POST", "/v1/auth/passkey", "/v1/auth/passkey", `{"id":"AQ","rawId":"AQ","type":"public-key","clientExtensionResults":{},"response":{"clientDataJSON":"e30","authenticatorData":"","signature":""}}`, false},
+		{"web authenticate", "POST", "/v1/web/auth", "/v1/web/auth", `{"email":"admin@example.com","password":"secret"}`, false},
+		{"web refresh without cookie", "GET", "/v1/web/refresh-token", "/v1/web/refresh-token", "", false},
+		{"web logout", "GET", "/v1/web/logout", "/v1/web/logout", "", false},
+		{"list users", "GET", "/v1/users", "/v1/users", "", true},
+		{"list users unauthorized", "GET", "/v1/users", "/v1/users", "", false},
+		{"create user", "POST", "/v1/users", "/v1/users", `{"first_name":"Jack","last_name":"Smith","email":"jack@example.com"}`, true},
+		{"create invalid user", "POST", "/v1/users", "/v1/users", `{"first_name":"","last_name":"Smith","email":"jack"}`, true},
+		{"get user", "GET", "/v1/users/1", "/v1/users/{userID}", "", true},
+		{"get unknown user", "GET", "/v1/users/100", "/v1/users/{userID}", "", true},
+		{"get user bad id", "GET", "/v1/users/Y", "/v1/users/{userID}", "", true},
+		{"replace user", "PUT", "/v1/users/2", "/v1/users/{userID}", `{"first_name":"Jane","last_name":"Doe","email":"user@example.com"}`, true},
+		{"replace user email taken", "PUT", "/v1/users/2", "/v1/users/{userID}", `{"first_name":"Jane","last_name":"Doe","email":"admin@example.com"}`, true},
+		{"update user", "PATCH", "/v1/users/1", "/v1/users/{userID}", `{"first_name":"Administrator"}`, true},
+		{"update unknown user", "PATCH", "/v1/users/100", "/v1/users/{userID}", `{"first_name":"Administrator"}`, true},
+		{"delete user", "DELETE", "/v1/users/2", "/v1/users/{userID}", "", true},
+		{"upload profile pic", "PUT", "/v1/users/1/profile-pic", "/v1/users/{userID}/profile-pic", string(picture), true},
+		{"upload invalid profile pic", "PUT", "/v1/users/1/profile-pic", "/v1/users/{userID}/profile-pic", `{"content":"dGV4dA=="}`, true},
+		{"get profile pic", "GET", "/v1/users/1/profile-pic", "/v1/users/{userID}/profile-pic", "", true},
+		{"get user with profile pic", "GET", "/v1/users/1", "/v1/users/{userID}", "", true},
+		{"delete profile pic", "DELETE", "/v1/users/1/profile-pic", "/v1/users/{userID}/profile-pic", "", true},
+		{"get missing profile pic", "GET", "/v1/users/1/profile-pic", "/v1/users/{userID}/profile-pic", "", true},
+		{"get me", "GET", "/v1/me", "/v1/me", "", true},
+		{"get me unauthorized", "GET", "/v1/me", "/v1/me", "", false},
+		{"update me", "PATCH", "/v1/me", "/v1/me", `{"first_name":"Administrator"}`, true},
+		{"update me forbidden field", "PATCH", "/v1/me", "/v1/me", `{"is_admin":0}`, true},
+		{"change password", "POST", "/v1/me/password", "/v1/me/password", `{"current_password":"secret","new_password":"a new secret"}`, true},
+		{"change password wrong current", "POST", "/v1/me/password", "/v1/me/password", `{"current_password":"guess","new_password":"a new secret"}`, true},
+		{"list api keys", "GET", "/v1/me/api-keys", "/v1/me/api-keys", "", true},
+		{"create api key", "POST", "/v1/me/api-keys", "/v1/me/api-keys", `{"name":"backup","scopes":["read"]}`, true},
+		{"create invalid api key", "POST", "/v1/me/api-keys", "/v1/me/api-keys", `{"name":"backup","scopes":["admin"]}`, true},
+		{"revoke unknown api key", "DELETE", "/v1/me/api-keys/1000", "/v1/me/api-keys/{keyID}", "", true},
+		{"list passkeys", "GET", "/v1/me/passkeys", "/v1/me/passkeys", "", true},
+		{"passkey options", "GET", "/v1/me/passkeys/options", "/v1/me/passkeys/options", "", true},
+		{"create passkey without name", "POST", "/v1/me/passkeys", "/v1/me/passkeys", `{"name":"","credential":{"id":"AQ","rawId":"AQ","type":"public-key","clientExtensionResults":{},"response":{"clientDataJSON":"e30","attestationObject":"oA"}}}`, true},
+		{"delete unknown passkey", "DELETE", "/v1/me/passkeys/1000", "/v1/me/passkeys/{passkeyID}", "", true},
+		{"delete me", "DELETE", "/v1/me", "/v1/me", "", true},
+		{"legacy authenticate", "POST", "/auth", "/auth", `{"email":"admin@example.com","password":"secret"}`, false},
+		{"legacy all users", "GET", "/users/", "/users/", "", true},
+		{"legacy get unknown user", "GET", "/users/100", "/users/{userID}", "", true},
+		{"legacy insert user", "PUT", "/users/", "/users/", `{"first_name":"Jack","last_name":"Smith","email":"jack@example.com"}`, true},
+		{"legacy update user", "PATCH", "/users/", "/users/", `{"id":1,"first_name":"Administrator","last_name":"User","email":"admin@example.com"}`, true},
+		{"healthz", "GET", "/healthz", "/healthz", "", false},
+		{"readyz", "GET", "/readyz", "/readyz", "", false},
+		{"metrics", "GET", "/metrics", "/metrics", "", true},
+		{"metrics without token", "GET", "/metrics", "/metrics", "", false},
+		{"openapi", "GET", "/openapi.json", "/openapi.json", "", false},
+		{"oidc discovery", "GET", oidc.DiscoveryPath, oidc.DiscoveryPath, "", false},
+		{"oidc keys", "GET", oidc.JWKSPath, oidc.JWKSPath, "", false},
+		{"oidc token", "POST", oidc.TokenPath, oidc.TokenPath, exchange.Encode(), false},
+		{"oidc token with a used code", "POST", oidc.TokenPath, oidc.TokenPath, exchange.Encode(), false},
+		{"oidc token with a wrong secret", "POST", oidc.TokenPath, oidc.TokenPath, wrongSecret.Encode(), false},
+		{"oidc userinfo", "GET", oidc.UserInfoPath, oidc.UserInfoPath, "", true},
+		{"oidc userinfo by post", "POST", oidc.UserInfoPath, oidc.UserInfoPath, "", true},
+		{"oidc userinfo without token", "GET", oidc.UserInfoPath, oidc.UserInfoPath, "", false},
+		{"oidc introspect", "POST", oidc.IntrospectionPath, oidc.IntrospectionPath, introspect.Encode(), false},
+		{"oidc introspect by a public client", "POST", oidc.IntrospectionPath, oidc.IntrospectionPath, publicIntrospect.Encode(), false},
+		{"oidc revoke", "POST", oidc.RevocationPath, oidc.RevocationPath, revoke.Encode(), false},
+		{"oidc revoke without client", "POST", oidc.RevocationPath, oidc.RevocationPath, "token=x", false},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.RemoteAddr = "192.0.2.42:1234"
+		if strings.HasSuffix(e.route, "/refresh-token") || strings.HasPrefix(e.route, "/oauth/") {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if strings.HasPrefix(e.route, "/oauth/") {
+			// the oauth endpoints share the auth rate limit with the rows above
+			req.RemoteAddr = "192.0.2.43:1234"
+		}
+		if strings.HasSuffix(e.route, "/profile-pic") && e.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if e.auth {
+			req.Header.Set("Authorization", "Bearer "+tokens.Token)
+		}
+		if e.auth && e.route == "/metrics" {
+			req.Header.Set("Authorization", "Bearer scrape-token")
+		}
+		if e.auth && e.route == oidc.UserInfoPath {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if err := checkContract(e.method, e.route, rr); err != nil {
+			t.Errorf("%s: %s", e.name, err)
+		}
+	}
+}
+
+func Test_app_apiClient(t *testing.T) {
+	srv := httptest.NewServer(app.routes())
+	defer srv.Close()
+
+	c := apiclient.New(srv.URL)
+	ctx := context.Background()
+
+	_, err := c.Authenticate(ctx, apiclient.Credentials{Email: "admin@example.com", Password: "wrong"})
+	if apiclient.ErrorCode(err) != codeUnauthorized {
+		t.Errorf("expected %s for a wrong password, got %v", codeUnauthorized, err)
+	}
+
+	tokens, err := c.Authenticate(ctx, apiclient.Credentials{Email: "admin@example.com", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Token = tokens.AccessToken
+	user, err := c.GetUser(ctx, 1)
+	if err != nil || user.Email != "admin@example.com" {
+		t.Errorf("expected the admin user, got %+v, %v", user, err)
+	}
+
+	_, err = c.CreateUser(ctx, apiclient.User{FirstName: "Jack", LastName: "Smith", Email: "jack"})
+	if apiclient.ErrorCode(err) != codeValidationFailed {
+		t.Errorf("expected %s for a bad email, got %v", codeValidationFailed, err)
+	}
+
+	created, err := c.CreateUser(ctx, apiclient.User{FirstName: "Jack", LastName: "Smith", Email: "jack@example.com"})
+	if err != nil || created.ID == 0 {
+		t.Errorf("expected the created user, got %+v, %v", created, err)
+	}
+
+	lastName := "Smith"
+	patched, err := c.UpdateUser(ctx, 2, apiclient.UserPatch{LastName: &lastName})
+	if err != nil || patched.LastName != "Smith" || patched.Email != "user@example.com" {
+		t.Errorf("expected only the last name to change, got %+v, %v", patched, err)
+	}
+
+	_, err = c.GetUser(ctx, 100)
+	if apiclient.ErrorCode(err) != codeNotFound {
+		t.Errorf("expected %s for an unknown user, got %v", codeNotFound, err)
+	}
+
+	me, err := c.GetMe(ctx)
+	if err != nil || me.ID != 1 {
+		t.Errorf("expected the user of the token, got %+v, %v", me, err)
+	}
+
+	dir := app.Config.Upload.Dir
+	app.Config.Upload.Dir = t.TempDir()
+	defer func() { app.Config.Upload.Dir = dir }()
+
+	img := pngImage(t)
+	withPic, err := c.UpdateProfilePic(ctx, 2, apiclient.ProfilePicUpload{Content: img})
+	if err != nil || withPic.ProfilePicURL == nil {
+		t.Errorf("expected the user with a picture url, got %+v, %v", withPic, err)
+	}
+	if pic, err := c.GetProfilePic(ctx, 2); err != nil || !bytes.Equal(pic, img) {
+		t.Errorf("expected the uploaded picture, got %d bytes, %v", len(pic), err)
+	}
+	if err := c.DeleteProfilePic(ctx, 2); err != nil {
+		t.Errorf("expected the picture to be deleted, got %v", err)
+	}
+
+	key, err := c.CreateAPIKey(ctx, apiclient.NewAPIKey{Name: "backup", Scopes: []string{"read"}})
+	if err != nil || key.Key == "" {
+		t.Fatalf("expected a new api key, got %+v, %v", key, err)
+	}
+	keyClient := apiclient.New(srv.URL)
+	keyClient.APIKey = key.Key
+	if me, err := keyClient.GetMe(ctx); err != nil || me.ID != 1 {
+		t.Errorf("expected the user of the api key, got %+v, %v", me, err)
+	}
+	if _, err := keyClient.UpdateMe(ctx, apiclient.UserPatch{LastName: &lastName}); apiclient.ErrorCode(err) != codeForbidden {
+		t.Errorf("expected %s for a read only key, got %v", codeForbidden, err)
+	}
+	if keys, err := c.ListAPIKeys(ctx); err != nil || len(keys) == 0 || keys[0].Prefix != key.APIKey.Prefix {
+		t.Errorf("expected the new key to be listed, got %+v, %v", keys, err)
+	}
+	if err := c.RevokeAPIKey(ctx, key.APIKey.ID); err != nil {
+		t.Errorf("expected the key to be revoked, got %v", err)
+	}
+	if _, err := keyClient.GetMe(ctx); apiclient.ErrorCode(err) != codeUnauthorized {
+		t.Errorf("expected %s for a revoked key, got %v", codeUnauthorized, err)
+	}
+}
+
+var (
+	specOnce sync.Once
+	spec     map[string]any
+)
+
+// checkContract checks that the status of a response is one the OpenAPI
+// document lists for the operation, and that a JSON body matches the schema
+// documented for it.
+func checkContract(method, route string, rr *httptest.ResponseRecorder) error {
+	specOnce.Do(func() {
+		if err := json.Unmarshal(openapi.Spec(), &spec); err != nil {
+			panic(err)
+		}
+	})
+
+	op, ok := lookup(spec, "paths", route, strings.ToLower(method)).(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s %s is not documented", method, route)
+	}
+
+	status := strconv.Itoa(rr.Code)
+	pointer := "#/paths/" + escapePointer(route) + "/" + strings.ToLower(method) + "/responses/" + status
+	resp, ok := lookup(op, "responses", status).(map[string]any)
+	if !ok {
+		return fmt.Errorf("status %d of %s %s is not documented", rr.Code, method, route)
+	}
+	if ref, ok := resp["$ref"].(string); ok {
+		pointer = ref
+		resp, _ = lookup(spec, strings.Split(strings.TrimPrefix(ref, "#/"), "/")...).(map[string]any)
+	}
+
+	if _, ok := lookup(resp, "content", "application/json", "schema").(map[string]any); !ok {
+		return nil
+	}
+	if ctype := rr.Header().Get("Content-Type"); !strings.HasPrefix(ctype, "application/json") {
+		return fmt.Errorf("expected a JSON body for status %d, but got %q", rr.Code, ctype)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	if err := compiler.AddResource("openapi.json", bytes.NewReader(openapi.Spec())); err != nil {
+		return err
+	}
+	schema, err := compiler.Compile("openapi.json" + pointer + "/content/application~1json/schema")
+	if err != nil {
+		return err
+	}
+
+	var body any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		return fmt.Errorf("status %d: %w", rr.Code, err)
+	}
+	if err := schema.Validate(body); err != nil {
+		return fmt.Errorf("status %d: %#v", rr.Code, err)
+	}
+	return nil
+}
+
+func lookup(v any, keys ...string) any {
+	for _, key := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// API keys let scripts call the api as a user without logging in. They are
+// sent as "Authorization: ApiKey <key>", or in the X-API-Key header, and
+// only allow what their scopes allow: reading with the read scope, and
+// anything else with the write scope. Keys cannot be used to create or
+// revoke keys, so a leaked key cannot be used to keep access.
+
+// apiKeyTouchInterval limits how often the last used time of a key is
+// updated, so a busy script does not write on every request.
+const apiKeyTouchInterval = time.Minute
+
+// apiKeyFromRequest returns the API key sent with r, if any.
+func apiKeyFromRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	w.Header().Add("Vary", "X-API-Key")
+
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key, true
+	}
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+		return key, true
+	}
+	return "", false
+}
+
+// claimsForAPIKey checks key, and returns claims for its user like those of
+// an access token, limited to the scopes of the key.
+func (app *application) claimsForAPIKey(key string) (*Claims, error) {
+	prefix, ok := data.APIKeyPrefix(key)
+	if !ok {
+		return nil, errors.New("malformed api key")
+	}
+
+	k, err := app.DB.GetAPIKeyByPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !k.Matches(key) {
+		return nil, errors.New("wrong api key")
+	}
+	if k.Expired(now) {
+		return nil, errors.New("expired api key")
+	}
+
+	user, err := app.DB.GetUser(k.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) > apiKeyTouchInterval {
+		if err := app.DB.TouchAPIKey(k.ID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Claims{
+		UserName: fmt.Sprintf("%s %s", user.FirstName, user.LastName),
+		Admin:    user.IsAdmin == 1,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: fmt.Sprint(user.ID),
+			Issuer:  app.Domain,
+		},
+		APIKeyID:     k.ID,
+		APIKeyPrefix: k.Prefix,
+		Scopes:       k.Scopes,
+	}, nil
+}
+
+// allows reports whether the request may use method. Access tokens may do
+// anything the user may; API keys what their scopes allow.
+func (c *Claims) allows(method string) bool {
+	if c.APIKeyID == 0 {
+		return true
+	}
+
+	scope := data.ScopeWrite
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		scope = data.ScopeRead
+	}
+	return slices.Contains(c.Scopes, scope)
+}
+
+// listAPIKeys returns the API keys of the current user, without the keys
+// themselves.
+func (app *application) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := app.DB.UserAPIKeys(user.ID)
+	if err != nil {
+		app.logError(r, "could not list api keys", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+	if keys == nil {
+		keys = []data.APIKey{}
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, keys)
+}
+
+// newAPIKey is the body of a request to create an API key.
+type newAPIKey struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// createdAPIKey is the answer to creating an API key, the only time the key
+// is shown.
+type createdAPIKey struct {
+	Key    string      `json:"key"`
+	APIKey data.APIKey `json:"api_key"`
+}
+
+// createAPIKey creates an API key for the current user, and answers 201
+// with the key. It lasts data.DefaultAPIKeyDays unless the body says
+// otherwise.
+func (app *application) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !app.accessTokenRequired(w, r) {
+		return
+	}
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	req := newAPIKey{ExpiresInDays: data.DefaultAPIKeyDays}
+	if err := app.readJSON(w, r, &req); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	form, err := forms.FromStruct(req)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	form.Messages = i18n.FromContext(r.Context()).FormMessages()
+	form.Required("name", "scopes")
+	form.MaxLength("name", 255)
+	form.OneOf("scopes", data.APIKeyScopes...)
+	form.Range("expires_in_days", 1, data.MaxAPIKeyDays)
+	if !form.Valid() {
+		app.validationErrorJSON(w, r, form)
+		return
+	}
+
+	expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays).UTC().Truncate(time.Second)
+	key, k, err := data.NewAPIKey(user.ID, strings.TrimSpace(req.Name), req.Scopes, expiresAt)
+	if err == nil {
+		k.ID, err = app.DB.InsertAPIKey(k)
+	}
+	if err != nil {
+		app.logError(r, "could not create api key", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+	k.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/me/api-keys/%d", k.ID))
+	_ = app.writeJSON(w, http.StatusCreated, createdAPIKey{Key: key, APIKey: k})
+}
+
+// revokeAPIKey deletes the API key of the current user with the id in the
+// url, so it can no longer be used.
+func (app *application) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !app.accessTokenRequired(w, r) {
+		return
+	}
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "keyID"))
+	if err != nil {
+		app.codeErrorJSON(w, r, http.StatusBadRequest, codeBadRequest)
+		return
+	}
+
+	err = app.DB.DeleteAPIKey(user.ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.codeErrorJSON(w, r, http.StatusNotFound, codeNotFound)
+		return
+	}
+	if err != nil {
+		app.logError(r, "could not revoke api key", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// accessTokenRequired answers 403 to requests made with an API key.
+func (app *application) accessTokenRequired(w http.ResponseWriter, r *http.Request) bool {
+	if claims, ok := claimsFromContext(r.Context()); ok && claims.APIKeyID != 0 {
+		app.codeErrorJSON(w, r, http.StatusForbidden, codeForbidden)
+		return false
+	}
+	return true
+}
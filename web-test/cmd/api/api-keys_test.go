@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+
+	"webapp/pkg/data"
+)
+
+// insertAPIKey stores a key for userID, and returns the key to send.
+func insertAPIKey(t *testing.T, userID int, scopes []string, expiresAt time.Time) (string, int) {
+	t.Helper()
+
+	key, k, err := data.NewAPIKey(userID, "test", scopes, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := app.DB.InsertAPIKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = app.DB.DeleteAPIKey(userID, id) })
+
+	return key, id
+}
+
+func Test_app_authRequiredWithAPIKey(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	later := time.Now().Add(time.Hour)
+	readWrite, _ := insertAPIKey(t, 2, []string{data.ScopeRead, data.ScopeWrite}, later)
+	readOnly, _ := insertAPIKey(t, 2, []string{data.ScopeRead}, later)
+	expired, _ := insertAPIKey(t, 2, []string{data.ScopeRead}, time.Now().Add(-time.Hour))
+	prefix, _ := data.APIKeyPrefix(readWrite)
+
+	var tests = []struct {
+		name           string
+		method         string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{"authorization header", "GET", "Authorization", "ApiKey " + readWrite, http.StatusOK},
+		{"x-api-key header", "GET", "X-API-Key", readWrite, http.StatusOK},
+		{"write with write scope", "DELETE", "X-API-Key", readWrite, http.StatusOK},
+		{"read only key reads", "GET", "X-API-Key", readOnly, http.StatusOK},
+		{"read only key writes", "PATCH", "X-API-Key", readOnly, http.StatusForbidden},
+		{"expired key", "GET", "X-API-Key", expired, http.StatusUnauthorized},
+		{"wrong secret", "GET", "X-API-Key", "wtk_" + prefix + "_guess", http.StatusUnauthorized},
+		{"unknown prefix", "GET", "X-API-Key", "wtk_000000000000_guess", http.StatusUnauthorized},
+		{"malformed key", "GET", "Authorization", "ApiKey secret", http.StatusUnauthorized},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, "/", nil)
+		req.Header.Set(e.header, e.value)
+		rr := httptest.NewRecorder()
+
+		app.authRequired(nextHandler).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status returned; expected %d but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+	}
+}
+
+func Test_app_authRequiredTouchesAPIKey(t *testing.T) {
+	key, id := insertAPIKey(t, 2, []string{data.ScopeRead}, time.Now().Add(time.Hour))
+
+	var claims *Claims
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = claimsFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", key)
+	app.authRequired(nextHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+	if claims == nil || claims.Subject != "2" || claims.APIKeyID != id {
+		t.Fatalf("expected the claims of user 2 and key %d, got %+v", id, claims)
+	}
+
+	keys, _ := app.DB.UserAPIKeys(2)
+	for _, k := range keys {
+		if k.ID == id && k.LastUsedAt == nil {
+			t.Error("expected the key to have been marked as used")
+		}
+	}
+}
+
+func Test_app_userKeyWithAPIKey(t *testing.T) {
+	later := time.Now().Add(time.Hour)
+	first, _ := insertAPIKey(t, 2, []string{data.ScopeRead}, later)
+	second, _ := insertAPIKey(t, 2, []string{data.ScopeRead}, later)
+	firstPrefix, _ := data.APIKeyPrefix(first)
+	secondPrefix, _ := data.APIKeyPrefix(second)
+	user, _ := app.DB.GetUser(2)
+	tokens, _ := app.generateTokenPair(user)
+
+	var key string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = app.userKey(r)
+	})
+
+	var tests = []struct {
+		name     string
+		header   string
+		value    string
+		expected string
+	}{
+		{"first key", "X-API-Key", first, "key:" + firstPrefix},
+		{"second key of the same user", "X-API-Key", second, "key:" + secondPrefix},
+		{"access token of the same user", "Authorization", "Bearer " + tokens.Token, "user:2"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(e.header, e.value)
+		key = ""
+
+		app.authRequired(nextHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+		if key != e.expected {
+			t.Errorf("%s: expected to be charged to %s, got %s", e.name, e.expected, key)
+		}
+	}
+}
+
+func Test_app_apiKeyHandlers(t *testing.T) {
+	_, id := insertAPIKey(t, 2, []string{data.ScopeRead}, time.Now().Add(time.Hour))
+	_, othersID := insertAPIKey(t, 1, []string{data.ScopeRead}, time.Now().Add(time.Hour))
+	keyID, othersKeyID := fmt.Sprint(id), fmt.Sprint(othersID)
+
+	var tests = []struct {
+		name           string
+		method         string
+		json           string
+		keyID          string
+		apiKeyID       int
+		handler        http.HandlerFunc
+		expectedStatus int
+		invalidField   string
+	}{
+		{"list", "GET", "", "", 0, app.listAPIKeys, http.StatusOK, ""},
+		{"list with api key", "GET", "", "", id, app.listAPIKeys, http.StatusOK, ""},
+		{"create", "POST", `{"name":"backup","scopes":["read"]}`, "", 0, app.createAPIKey, http.StatusCreated, ""},
+		{"create with expiry", "POST", `{"name":"backup","scopes":["read","write"],"expires_in_days":7}`, "", 0, app.createAPIKey, http.StatusCreated, ""},
+		{"create with api key", "POST", `{"name":"backup","scopes":["read"]}`, "", id, app.createAPIKey, http.StatusForbidden, ""},
+		{"create without name", "POST", `{"scopes":["read"]}`, "", 0, app.createAPIKey, http.StatusUnprocessableEntity, "name"},
+		{"create unknown scope", "POST", `{"name":"backup","scopes":["read","admin"]}`, "", 0, app.createAPIKey, http.StatusUnprocessableEntity, "scopes"},
+		{"create too long", "POST", `{"name":"backup","scopes":["read"],"expires_in_days":1000}`, "", 0, app.createAPIKey, http.StatusUnprocessableEntity, "expires_in_days"},
+		{"create invalid json", "POST", `{name:"backup"}`, "", 0, app.createAPIKey, http.StatusBadRequest, ""},
+		{"revoke with api key", "DELETE", "", keyID, id, app.revokeAPIKey, http.StatusForbidden, ""},
+		{"revoke another user's key", "DELETE", "", othersKeyID, 0, app.revokeAPIKey, http.StatusNotFound, ""},
+		{"revoke unknown key", "DELETE", "", "1000", 0, app.revokeAPIKey, http.StatusNotFound, ""},
+		{"revoke bad id", "DELETE", "", "X", 0, app.revokeAPIKey, http.StatusBadRequest, ""},
+		{"revoke", "DELETE", "", keyID, 0, app.revokeAPIKey, http.StatusNoContent, ""},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, "/", strings.NewReader(e.json))
+		claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "2"}, APIKeyID: e.apiKeyID}
+		ctx := context.WithValue(req.Context(), contextClaimsKey, claims)
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("keyID", e.keyID)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status returned; expected %d but got %d: %s", e.name, e.expectedStatus, rr.Code, rr.Body)
+			continue
+		}
+
+		switch {
+		case rr.Code == http.StatusCreated:
+			var created createdAPIKey
+			_ = json.NewDecoder(rr.Body).Decode(&created)
+			if created.APIKey.ID == 0 || !strings.HasPrefix(created.Key, "wtk_"+created.APIKey.Prefix+"_") {
+				t.Errorf("%s: expected the new key, got %+v", e.name, created)
+			}
+			if strings.Contains(rr.Body.String(), "hash") {
+				t.Errorf("%s: the hash of the key should not be returned", e.name)
+			}
+			_ = app.DB.DeleteAPIKey(2, created.APIKey.ID)
+		case rr.Code == http.StatusOK:
+			var keys []data.APIKey
+			_ = json.NewDecoder(rr.Body).Decode(&keys)
+			for _, k := range keys {
+				if k.UserID != 2 {
+					t.Errorf("%s: listed the key of another user: %+v", e.name, k)
+				}
+			}
+		case e.invalidField != "":
+			var resp struct {
+				Error jsonError `json:"error"`
+			}
+			_ = json.NewDecoder(rr.Body).Decode(&resp)
+			if len(resp.Error.Fields[e.invalidField]) == 0 {
+				t.Errorf("%s: expected an error for %s, got %+v", e.name, e.invalidField, resp.Error)
+			}
+		}
+	}
+}
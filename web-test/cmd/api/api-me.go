@@ -0,0 +1,134 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"webapp/pkg/data"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
+)
+
+// The /v1/me handlers let the holder of a token manage their own account,
+// which is the user named by the sub claim of the token.
+
+// minPasswordLength is the shortest password a user may choose.
+const minPasswordLength = 8
+
+// showMe returns the user the token was issued to.
+func (app *application) showMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, user)
+}
+
+// patchMe changes the fields of the current user the patch in the body
+// changes, like patchUser does for any user.
+func (app *application) patchMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.applyUserPatch(w, r, user)
+}
+
+// passwordChange is the body of a request to change one's password.
+type passwordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// changePassword sets a new password for the current user, who must send
+// their current one too. A wrong current password is answered with 422, as
+// an error of the current_password field.
+func (app *application) changePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var change passwordChange
+	if err := app.readJSON(w, r, &change); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	form, err := forms.FromStruct(change)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	form.Messages = i18n.FromContext(r.Context()).FormMessages()
+	form.Required("current_password", "new_password")
+	form.MinLength("new_password", minPasswordLength)
+	if form.Valid() {
+		matches, err := user.PasswordMatches(change.CurrentPassword)
+		if err != nil {
+			app.logError(r, "could not check password", err)
+		}
+		form.Check(matches, "current_password", i18n.T(r.Context(), "login.wrong_password"))
+	}
+	if !form.Valid() {
+		app.validationErrorJSON(w, r, form)
+		return
+	}
+
+	if err := app.DB.ResetPassword(user.ID, change.NewPassword); err != nil {
+		app.logError(r, "could not change password", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteMe deletes the account of the current user, and the refresh token
+// cookie of the browser, if any.
+func (app *application) deleteMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.deleteUserAndPic(w, r, user) {
+		return
+	}
+
+	http.SetCookie(w, app.expiredRefreshCookie())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentUser looks up the user named by the sub claim of the token which
+// authRequired verified. A token for a user who no longer exists is
+// answered with 401, like any other token which is no longer good.
+func (app *application) currentUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	claims, ok := claimsFromContext(r.Context())
+	if !ok {
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
+		return nil, false
+	}
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
+		return nil, false
+	}
+
+	user, err := app.DB.GetUser(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		app.logError(r, "could not get user", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return nil, false
+	}
+	setProfilePicURL(user)
+
+	return user, true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"webapp/pkg/data"
+)
+
+func Test_app_meHandlers(t *testing.T) {
+	var tests = []struct {
+		name           string
+		method         string
+		json           string
+		subject        string
+		handler        http.HandlerFunc
+		expectedStatus int
+		invalidField   string
+	}{
+		{"showMe", "GET", "", "2", app.showMe, http.StatusOK, ""},
+		{"showMe without claims", "GET", "", "", app.showMe, http.StatusUnauthorized, ""},
+		{"showMe deleted user", "GET", "", "100", app.showMe, http.StatusUnauthorized, ""},
+		{"showMe bad subject", "GET", "", "Y", app.showMe, http.StatusUnauthorized, ""},
+		{"patchMe", "PATCH", `{"last_name":"Smith"}`, "2", app.patchMe, http.StatusOK, ""},
+		{"patchMe makes themselves admin", "PATCH", `{"is_admin":1}`, "2", app.patchMe, http.StatusForbidden, "is_admin"},
+		{"patchMe bad email", "PATCH", `{"email":"user"}`, "2", app.patchMe, http.StatusUnprocessableEntity, "email"},
+		{"changePassword", "POST", `{"current_password":"secret","new_password":"a new secret"}`, "2", app.changePassword, http.StatusNoContent, ""},
+		{"changePassword wrong password", "POST", `{"current_password":"guess","new_password":"a new secret"}`, "2", app.changePassword, http.StatusUnprocessableEntity, "current_password"},
+		{"changePassword too short", "POST", `{"current_password":"secret","new_password":"short"}`, "2", app.changePassword, http.StatusUnprocessableEntity, "new_password"},
+		{"changePassword missing current", "POST", `{"new_password":"a new secret"}`, "2", app.changePassword, http.StatusUnprocessableEntity, "current_password"},
+		{"changePassword invalid json", "POST", `{current_password:"secret"}`, "2", app.changePassword, http.StatusBadRequest, ""},
+		{"changePassword without claims", "POST", `{"current_password":"secret","new_password":"a new secret"}`, "", app.changePassword, http.StatusUnauthorized, ""},
+		{"deleteMe", "DELETE", "", "2", app.deleteMe, http.StatusNoContent, ""},
+		{"deleteMe without claims", "DELETE", "", "", app.deleteMe, http.StatusUnauthorized, ""},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, "/", strings.NewReader(e.json))
+		if e.subject != "" {
+			claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: e.subject}}
+			req = req.WithContext(context.WithValue(req.Context(), contextClaimsKey, claims))
+		}
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status returned; expected %d but got %d: %s", e.name, e.expectedStatus, rr.Code, rr.Body)
+			continue
+		}
+
+		switch {
+		case rr.Code == http.StatusOK:
+			var user data.User
+			_ = json.NewDecoder(rr.Body).Decode(&user)
+			if user.ID != 2 || user.Email != "user@example.com" {
+				t.Errorf("%s: expected the user of the token, got %+v", e.name, user)
+			}
+		case e.invalidField != "":
+			var resp struct {
+				Error jsonError `json:"error"`
+			}
+			_ = json.NewDecoder(rr.Body).Decode(&resp)
+			if len(resp.Error.Fields[e.invalidField]) == 0 {
+				t.Errorf("%s: expected an error for %s, got %+v", e.name, e.invalidField, resp.Error)
+			}
+		}
+	}
+}
+
+func Test_app_deleteMeExpiresRefreshCookie(t *testing.T) {
+	req := httptest.NewRequest("DELETE", "/", nil)
+	claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "2"}}
+	req = req.WithContext(context.WithValue(req.Context(), contextClaimsKey, claims))
+
+	rr := httptest.NewRecorder()
+	app.deleteMe(rr, req)
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != refreshCookieName || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected the refresh cookie to be expired, got %v", cookies)
+	}
+}
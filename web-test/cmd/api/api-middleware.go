@@ -1,30 +1,121 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"time"
+	"webapp/pkg/clientip"
+	"webapp/pkg/cors"
+	"webapp/pkg/logging"
+	"webapp/pkg/ratelimit"
+)
 
+// enableCORS applies the cross-origin policy from the config. Preflight
+// requests are only approved for methods the matched route accepts.
 func (app *application) enableCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8090")
-		if r.Method == "OPTIONS" {
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, X-CSRF-Token, Authorization")
-			return
-		} else {
-			next.ServeHTTP(w, r)
-		}
-	})
+	c := app.Config.CORS
+
+	return cors.New(cors.Options{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		MaxAge:           time.Duration(c.MaxAge),
+		AllowCredentials: c.AllowCredentials,
+		Match:            cors.MatchChiRoute,
+	}).Handler(next)
 }
 
 func (app *application) authRequired(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
-		_, _, err := app.getTokenFromHeaderAndVerify(w, r)
+		var claims *Claims
+		var err error
+		if key, ok := apiKeyFromRequest(w, r); ok {
+			claims, err = app.claimsForAPIKey(key)
+		} else {
+			_, claims, err = app.getTokenFromHeaderAndVerify(w, r)
+		}
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
+			return
+		}
+		if !claims.allows(r.Method) {
+			app.codeErrorJSON(w, r, http.StatusForbidden, codeForbidden)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		logging.SetUserID(r.Context(), claims.Subject)
+		ctx := context.WithValue(r.Context(), contextClaimsKey, claims)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 		return
 	})
-}
\ No newline at end of file
+}
+
+type contextKey string
+
+const contextUserKey contextKey = "user_ip"
+const contextClaimsKey contextKey = "claims"
+
+// claimsFromContext returns the claims of the token verified by authRequired.
+func claimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextClaimsKey).(*Claims)
+	return claims, ok
+}
+
+// ipFromContext returns the client address stored by addIPToContext, or
+// "unknown" if the middleware did not run.
+func (app *application) ipFromContext(ctx context.Context) string {
+	ip, ok := ctx.Value(contextUserKey).(string)
+	if !ok || ip == "" {
+		return clientip.Unknown
+	}
+	return ip
+}
+
+// addIPToContext stores the address of the client in the request context,
+// looking through trusted reverse proxies.
+func (app *application) addIPToContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), contextUserKey, app.IPResolver.ClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// rateLimit returns middleware enforcing limit for the group of routes called
+// name, charging each request to the client identified by key.
+func (app *application) rateLimit(name string, limit ratelimit.Limit, key ratelimit.KeyFunc) func(http.Handler) http.Handler {
+	if !app.Config.RateLimit.Enabled {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	limiter := &ratelimit.Limiter{
+		Store:  app.RateLimitStore,
+		Name:   name,
+		Limit:  limit,
+		Key:    key,
+		Logger: app.Logger,
+	}
+
+	return limiter.Middleware
+}
+
+// clientKey charges a request to the address of the client.
+func (app *application) clientKey(r *http.Request) string {
+	return "ip:" + app.ipFromContext(r.Context())
+}
+
+// userKey charges a request to the API key it was made with, or else to the
+// authenticated user, falling back to the address of the client. Each key
+// has a bucket of its own, so a busy script does not use up the limit of
+// its user's other keys and browser.
+func (app *application) userKey(r *http.Request) string {
+	claims, ok := claimsFromContext(r.Context())
+	if ok && claims.APIKeyPrefix != "" {
+		return "key:" + claims.APIKeyPrefix
+	}
+	if ok && claims.Subject != "" {
+		return "user:" + claims.Subject
+	}
+	return app.clientKey(r)
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"webapp/pkg/data"
 )
@@ -14,16 +16,37 @@ func Test_app_enableCORS(t *testing.T) {
 	var tests = []struct{
 		name string
 		method string
+		origin string
+		requestMethod string
+		requestHeaders string
 		expectHeader bool
+		expectedOrigin string
+		expectedStatus int
 	}{
-		{"preflight", "OPTIONS", true},
-		{"get", "GET", false},
+		{"preflight", "OPTIONS", "http://localhost:8090", "POST", "", true, "http://localhost:8090", http.StatusNoContent},
+		{"preflight with allowed headers", "OPTIONS", "http://localhost:8090", "PATCH", "content-type, authorization", true, "http://localhost:8090", http.StatusNoContent},
+		{"preflight from unknown origin", "OPTIONS", "http://evil.example", "POST", "", false, "", http.StatusNoContent},
+		{"preflight for disallowed method", "OPTIONS", "http://localhost:8090", "TRACE", "", false, "", http.StatusNoContent},
+		{"preflight with disallowed header", "OPTIONS", "http://localhost:8090", "POST", "X-Something-Else", false, "", http.StatusNoContent},
+		{"options without preflight", "OPTIONS", "", "", "", false, "", http.StatusOK},
+		{"get", "GET", "", "", "", false, "", http.StatusOK},
+		{"get from allowed origin", "GET", "http://localhost:8090", "", "", true, "http://localhost:8090", http.StatusOK},
+		{"get from unknown origin", "GET", "http://evil.example", "", "", false, "", http.StatusOK},
 	}
 
 	for _, e := range tests {
 		handlerToTest := app.enableCORS(nextHandler)
 
 		req := httptest.NewRequest(e.method, "http://testing", nil)
+		if e.origin != "" {
+			req.Header.Set("Origin", e.origin)
+		}
+		if e.requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", e.requestMethod)
+		}
+		if e.requestHeaders != "" {
+			req.Header.Set("Access-Control-Request-Headers", e.requestHeaders)
+		}
 		rr := httptest.NewRecorder()
 
 		handlerToTest.ServeHTTP(rr, req)
@@ -35,6 +58,53 @@ func Test_app_enableCORS(t *testing.T) {
 		if !e.expectHeader && rr.Header().Get("Access-Control-Allow-Credentials") != "" {
 			t.Errorf("%s: expected no header, but got one", e.name)
 		}
+
+		if rr.Header().Get("Access-Control-Allow-Origin") != e.expectedOrigin {
+			t.Errorf("%s: expected allowed origin %q, but got %q", e.name, e.expectedOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
+		}
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+
+		if !strings.Contains(strings.Join(rr.Header().Values("Vary"), ","), "Origin") {
+			t.Errorf("%s: expected Vary: Origin", e.name)
+		}
+	}
+}
+
+func Test_app_enableCORSPerRoute(t *testing.T) {
+	routes := app.routes()
+
+	var tests = []struct{
+		name string
+		path string
+		requestMethod string
+		expectApproved bool
+		expectedMethods string
+	}{
+		{"users collection", "/users/", "GET", true, "GET, PUT, PATCH"},
+		{"single user", "/users/1", "DELETE", true, "GET, DELETE"},
+		{"method the route does not accept", "/auth", "DELETE", false, ""},
+		{"unknown route", "/nothing-here", "GET", false, ""},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("OPTIONS", e.path, nil)
+		req.Header.Set("Origin", "http://localhost:8090")
+		req.Header.Set("Access-Control-Request-Method", e.requestMethod)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		approved := rr.Header().Get("Access-Control-Allow-Origin") != ""
+		if approved != e.expectApproved {
+			t.Errorf("%s: expected approved %t, but got %t", e.name, e.expectApproved, approved)
+		}
+
+		if rr.Header().Get("Access-Control-Allow-Methods") != e.expectedMethods {
+			t.Errorf("%s: expected methods %q, but got %q", e.name, e.expectedMethods, rr.Header().Get("Access-Control-Allow-Methods"))
+		}
 	}
 }
 
@@ -79,4 +149,70 @@ func Test_app_authRequired(t *testing.T) {
 			t.Errorf("%s: did not get code 401, and should have", e.name)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func Test_app_rateLimitAuth(t *testing.T) {
+	routes := app.routes()
+	limit := app.Config.RateLimit.Auth.Requests
+
+	var rr *httptest.ResponseRecorder
+	for i := 0; i <= limit; i++ {
+		req := httptest.NewRequest("POST", "/auth", strings.NewReader("not json"))
+		req.RemoteAddr = "192.0.2.200:1234"
+		rr = httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+	}
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d after %d requests, but got %d", http.StatusTooManyRequests, limit+1, rr.Code)
+	}
+
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+
+	// another client is not affected
+	req := httptest.NewRequest("POST", "/auth", strings.NewReader("not json"))
+	req.RemoteAddr = "192.0.2.201:1234"
+	rr = httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d for another client, but got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func Test_app_localizedErrors(t *testing.T) {
+	routes := app.routes()
+
+	var tests = []struct {
+		name            string
+		acceptLanguage  string
+		expectedMessage string
+	}{
+		{"default", "", "unauthorized"},
+		{"portuguese", "pt-BR", "não autorizado"},
+		{"unsupported", "fr", "unauthorized"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/users/", nil)
+		req.Header.Set("Accept-Language", e.acceptLanguage)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		var resp struct {
+			Error jsonError `json:"error"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+
+		if rr.Code != http.StatusUnauthorized || resp.Error.Code != codeUnauthorized {
+			t.Errorf("%s: expected status 401 with code %s, got %d with %q", e.name, codeUnauthorized, rr.Code, resp.Error.Code)
+		}
+		if resp.Error.Message != e.expectedMessage {
+			t.Errorf("%s: expected message %q but got %q", e.name, e.expectedMessage, resp.Error.Message)
+		}
+	}
+}
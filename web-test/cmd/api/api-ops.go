@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"webapp/pkg/health"
+)
+
+// readyz reports whether the api can serve traffic: the database answers a
+// ping, and the upload directory is writable.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	health.Ready(map[string]health.Check{
+		"database": health.Database(app.DB.Connection),
+		"storage":  health.WritableDir(app.Config.Upload.Dir),
+	})(w, r)
+}
+
+// countLogin records the outcome of an attempt to authenticate.
+func (app *application) countLogin(r *http.Request, success bool) {
+	app.Metrics.CountLogin(r, app.Logger, app.ipFromContext(r.Context()), success)
+}
+
+// countTokens records that a token pair has been issued.
+func (app *application) countTokens() {
+	tokens := app.Metrics.Counter("tokens_issued_total", "Number of tokens issued by type.", "type")
+	tokens.Inc("access")
+	tokens.Inc("refresh")
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"webapp/pkg/data"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
+	"webapp/pkg/webauthn"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Clients of the api may log their users in with a passkey too, and let
+// them register passkeys. The api keeps no session to remember the
+// challenges it hands out in, so they are sealed instead: each carries its
+// purpose, expiry and, for registrations, its user, and is checked when the
+// client sends it back inside what the authenticator answered. Answered
+// challenges are recorded in the database, so each is only good once.
+
+// Purposes of passkey challenges.
+const (
+	passkeyLogin    = "login"
+	passkeyRegister = "register"
+)
+
+// NewPasskey is the body of a request to register a passkey.
+type NewPasskey struct {
+	Name       string                        `json:"name"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+// passkeyLoginOptions answers with the options for navigator.credentials.get
+// to log in with any passkey of the site.
+func (app *application) passkeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	challenge, err := app.Challenges.New(passkeyLogin, 0)
+	if err != nil {
+		app.logError(r, "could not start passkey login", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = app.writeJSON(w, http.StatusOK, app.WebAuthn.RequestOptions(challenge))
+}
+
+// authenticatePasskey sends a token pair to the user whose passkey signed a
+// challenge from passkeyLoginOptions.
+func (app *application) authenticatePasskey(w http.ResponseWriter, r *http.Request) {
+	var credential webauthn.AssertionResponse
+	if err := app.readJSON(w, r, &credential); err != nil {
+		app.countLogin(r, false)
+		app.codeErrorJSON(w, r, http.StatusBadRequest, codeBadRequest)
+		return
+	}
+
+	challenge, err := credential.Challenge()
+	if err == nil {
+		_, err = app.Challenges.Take(app.DB, challenge, passkeyLogin)
+	}
+	var user *data.User
+	if err == nil {
+		user, err = app.WebAuthn.Login(app.DB, credential, challenge)
+	}
+	if err != nil {
+		if !errors.Is(err, webauthn.ErrInvalid) && !errors.Is(err, webauthn.ErrChallenge) {
+			app.logError(r, "could not log in with passkey", err)
+		}
+		app.countLogin(r, false)
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
+		return
+	}
+	app.countLogin(r, true)
+
+	tokenPairs, err := app.generateTokenPair(user)
+	if err != nil {
+		app.codeErrorJSON(w, r, http.StatusUnauthorized, codeUnauthorized)
+		return
+	}
+
+	http.SetCookie(w, app.refreshCookie(tokenPairs.RefreshToken))
+	_ = app.writeJSON(w, http.StatusOK, tokenPairs)
+}
+
+// listPasskeys returns the passkeys of the current user, without their
+// keys.
+func (app *application) listPasskeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	passkeys, err := app.DB.UserPasskeys(user.ID)
+	if err != nil {
+		app.logError(r, "could not list passkeys", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+	if passkeys == nil {
+		passkeys = []data.Passkey{}
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, passkeys)
+}
+
+// passkeyOptions answers with the options for navigator.credentials.create
+// to register a passkey for the current user.
+func (app *application) passkeyOptions(w http.ResponseWriter, r *http.Request) {
+	if !app.accessTokenRequired(w, r) {
+		return
+	}
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	existing, err := app.DB.UserPasskeys(user.ID)
+	var challenge []byte
+	if err == nil {
+		challenge, err = app.Challenges.New(passkeyRegister, user.ID)
+	}
+	if err != nil {
+		app.logError(r, "could not start passkey registration", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = app.writeJSON(w, http.StatusOK, app.WebAuthn.CreationOptions(user, challenge, existing))
+}
+
+// createPasskey registers the passkey an authenticator made for the current
+// user with the options of passkeyOptions, and answers 201 with it.
+func (app *application) createPasskey(w http.ResponseWriter, r *http.Request) {
+	if !app.accessTokenRequired(w, r) {
+		return
+	}
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req NewPasskey
+	if err := app.readJSON(w, r, &req); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(url.Values{"name": {req.Name}})
+	form.Messages = i18n.FromContext(r.Context()).FormMessages()
+	form.Required("name")
+	form.MaxLength("name", 255)
+	if !form.Valid() {
+		app.validationErrorJSON(w, r, form)
+		return
+	}
+
+	// the challenge must have been handed to this user to register
+	challenge, err := req.Credential.Challenge()
+	if err == nil {
+		var userID int
+		userID, err = app.Challenges.Take(app.DB, challenge, passkeyRegister)
+		if err == nil && userID != user.ID {
+			err = webauthn.ErrChallenge
+		}
+	}
+	var p *data.Passkey
+	if err == nil {
+		p, err = app.WebAuthn.Register(app.DB, user, strings.TrimSpace(req.Name), req.Credential, challenge)
+	}
+	if errors.Is(err, webauthn.ErrInvalid) || errors.Is(err, webauthn.ErrChallenge) {
+		app.codeErrorJSON(w, r, http.StatusBadRequest, codeBadRequest)
+		return
+	}
+	if err != nil {
+		app.logError(r, "could not register passkey", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/me/passkeys/%d", p.ID))
+	_ = app.writeJSON(w, http.StatusCreated, p)
+}
+
+// deletePasskey deletes the passkey of the current user with the id in the
+// url, so it can no longer be logged in with.
+func (app *application) deletePasskey(w http.ResponseWriter, r *http.Request) {
+	if !app.accessTokenRequired(w, r) {
+		return
+	}
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "passkeyID"))
+	if err != nil {
+		app.codeErrorJSON(w, r, http.StatusBadRequest, codeBadRequest)
+		return
+	}
+
+	err = app.DB.DeletePasskey(user.ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.codeErrorJSON(w, r, http.StatusNotFound, codeNotFound)
+		return
+	}
+	if err != nil {
+		app.logError(r, "could not delete passkey", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+
+	"webapp/pkg/config"
+	"webapp/pkg/data"
+	"webapp/pkg/webauthn"
+	"webapp/pkg/webauthn/webauthntest"
+)
+
+const testPasskeyOrigin = "https://spa.example"
+
+// servePasskey calls handler with body, as the user with userID, or
+// anonymously for 0.
+func servePasskey(handler http.HandlerFunc, method string, body any, userID, apiKeyID int, passkeyID string) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	if s, ok := body.(string); ok {
+		b = []byte(s)
+	}
+	req := httptest.NewRequest(method, "/", strings.NewReader(string(b)))
+
+	ctx := req.Context()
+	if userID != 0 {
+		claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: fmt.Sprint(userID)}, APIKeyID: apiKeyID}
+		ctx = context.WithValue(ctx, contextClaimsKey, claims)
+	}
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("passkeyID", passkeyID)
+	req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, chiCtx))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func Test_app_passkeys(t *testing.T) {
+	rp := app.WebAuthn
+	app.WebAuthn = webauthn.New(config.WebAuthnConfig{RPID: "spa.example", RPName: "Web App", Origins: []string{testPasskeyOrigin}})
+	defer func() { app.WebAuthn = rp }()
+
+	a := webauthntest.New(t, testPasskeyOrigin)
+
+	// registration options, and challenges made for something else
+	creationOptions := func(userID int) webauthn.CreationOptions {
+		var opts webauthn.CreationOptions
+		rr := servePasskey(app.passkeyOptions, "GET", nil, userID, 0, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("options: expected status %d but got %d", http.StatusOK, rr.Code)
+		}
+		_ = json.NewDecoder(rr.Body).Decode(&opts)
+		return opts
+	}
+	requestOptions := func() webauthn.RequestOptions {
+		var opts webauthn.RequestOptions
+		_ = json.NewDecoder(servePasskey(app.passkeyLoginOptions, "GET", nil, 0, 0, "").Body).Decode(&opts)
+		return opts
+	}
+	otherUser := creationOptions(1)
+	forLogin := creationOptions(2)
+	forLogin.Challenge = requestOptions().Challenge
+	registered := creationOptions(2)
+
+	if rr := servePasskey(app.passkeyOptions, "GET", nil, 2, 1, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("options with api key: expected status %d but got %d", http.StatusForbidden, rr.Code)
+	}
+
+	var registrations = []struct {
+		name           string
+		passkeyName    string
+		opts           webauthn.CreationOptions
+		apiKeyID       int
+		expectedStatus int
+	}{
+		{"with api key", "Phone", creationOptions(2), 1, http.StatusForbidden},
+		{"without name", "", creationOptions(2), 0, http.StatusUnprocessableEntity},
+		{"challenge of another user", "Phone", otherUser, 0, http.StatusBadRequest},
+		{"challenge to log in", "Phone", forLogin, 0, http.StatusBadRequest},
+		{"register", "Phone", registered, 0, http.StatusCreated},
+		{"register again", "Phone", creationOptions(2), 0, http.StatusBadRequest},
+	}
+
+	var created data.Passkey
+	for _, e := range registrations {
+		body := NewPasskey{Name: e.passkeyName, Credential: a.Create(e.opts)}
+		rr := servePasskey(app.createPasskey, "POST", body, 2, e.apiKeyID, "")
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d: %s", e.name, e.expectedStatus, rr.Code, rr.Body)
+			continue
+		}
+		if rr.Code == http.StatusCreated {
+			_ = json.NewDecoder(rr.Body).Decode(&created)
+			if created.ID == 0 || created.UserID != 2 || rr.Header().Get("Location") != fmt.Sprintf("/v1/me/passkeys/%d", created.ID) {
+				t.Errorf("%s: unexpected passkey %+v at %s", e.name, created, rr.Header().Get("Location"))
+			}
+		}
+	}
+	if created.ID == 0 {
+		t.Fatal("no passkey was registered")
+	}
+	defer func() { _ = app.DB.DeletePasskey(2, created.ID) }()
+
+	// a challenge is only good once, even for another authenticator
+	again := NewPasskey{Name: "Tablet", Credential: webauthntest.New(t, testPasskeyOrigin).Create(registered)}
+	if rr := servePasskey(app.createPasskey, "POST", again, 2, 0, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("challenge answered again: expected status %d but got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr := servePasskey(app.listPasskeys, "GET", nil, 2, 0, "")
+	if body := rr.Body.String(); !strings.Contains(body, `"name":"Phone"`) || strings.Contains(body, "public_key") {
+		t.Errorf("expected the passkey to be listed without its key, got %s", body)
+	}
+
+	// logging in
+	clone := a.Clone()
+	registration := creationOptions(2)
+	answered := requestOptions()
+
+	var logins = []struct {
+		name           string
+		body           func() any
+		expectedStatus int
+	}{
+		{"invalid json", func() any { return `{"id":` }, http.StatusBadRequest},
+		{"challenge to register", func() any {
+			return a.Get(webauthn.RequestOptions{Challenge: registration.Challenge, RPID: "spa.example"})
+		}, http.StatusUnauthorized},
+		{"forged challenge", func() any {
+			return a.Get(webauthn.RequestOptions{Challenge: []byte("guess"), RPID: "spa.example"})
+		}, http.StatusUnauthorized},
+		{"valid", func() any { return a.Get(answered) }, http.StatusOK},
+		// signed anew, so the sign count of the passkey does not catch it
+		{"challenge answered again", func() any { return a.Get(answered) }, http.StatusUnauthorized},
+		{"cloned authenticator", func() any { return clone.Get(requestOptions()) }, http.StatusUnauthorized},
+	}
+
+	for _, e := range logins {
+		rr := servePasskey(app.authenticatePasskey, "POST", e.body(), 0, 0, "")
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d: %s", e.name, e.expectedStatus, rr.Code, rr.Body)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		var tokens TokenPairs
+		_ = json.NewDecoder(rr.Body).Decode(&tokens)
+		check := httptest.NewRequest("GET", "/", nil)
+		check.Header.Set("Authorization", "Bearer "+tokens.Token)
+		if _, claims, err := app.getTokenFromHeaderAndVerify(httptest.NewRecorder(), check); err != nil || claims.Subject != "2" {
+			t.Errorf("%s: expected a valid token for user 2, got %v", e.name, err)
+		}
+		if len(rr.Result().Cookies()) == 0 {
+			t.Errorf("%s: expected the refresh token cookie", e.name)
+		}
+	}
+
+	// deleting
+	id := fmt.Sprint(created.ID)
+	var deletes = []struct {
+		name           string
+		userID         int
+		apiKeyID       int
+		passkeyID      string
+		expectedStatus int
+	}{
+		{"with api key", 2, 1, id, http.StatusForbidden},
+		{"another user's passkey", 1, 0, id, http.StatusNotFound},
+		{"bad id", 2, 0, "X", http.StatusBadRequest},
+		{"delete", 2, 0, id, http.StatusNoContent},
+		{"delete again", 2, 0, id, http.StatusNotFound},
+	}
+
+	for _, e := range deletes {
+		if rr := servePasskey(app.deletePasskey, "DELETE", nil, e.userID, e.apiKeyID, e.passkeyID); rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+	}
+
+	if rr := servePasskey(app.authenticatePasskey, "POST", a.Get(requestOptions()), 0, 0, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("deleted passkey: expected status %d but got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
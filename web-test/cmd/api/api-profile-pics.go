@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"webapp/pkg/data"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
+	"webapp/pkg/uploads"
+)
+
+// The /v1/users/{userID}/profile-pic handlers. Pictures are stored like the
+// web application stores them, in the same directory, so a picture uploaded
+// with one shows in the other.
+
+// setProfilePicURL sets where the profile picture of user is served, if
+// they have one.
+func setProfilePicURL(user *data.User) {
+	user.ProfilePicURL = ""
+	if user.ProfilePic.FileName != "" {
+		user.ProfilePicURL = fmt.Sprintf("/v1/users/%d/profile-pic", user.ID)
+	}
+}
+
+// showProfilePic serves the profile picture of the user with the id in the
+// url, answering 404 if they have none.
+func (app *application) showProfilePic(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+	if user.ProfilePic.FileName == "" {
+		app.codeErrorJSON(w, r, http.StatusNotFound, codeNotFound)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(app.Config.Upload.Dir, filepath.Base(user.ProfilePic.FileName)))
+	if errors.Is(err, fs.ErrNotExist) {
+		app.codeErrorJSON(w, r, http.StatusNotFound, codeNotFound)
+		return
+	}
+	if err != nil {
+		app.logError(r, "could not open profile picture", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		app.logError(r, "could not open profile picture", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", uploads.ContentType(info.Name()))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// profilePicUpload is a picture sent as JSON, with its content base64
+// encoded.
+type profilePicUpload struct {
+	FileName string `json:"file_name"`
+	Content  []byte `json:"content"`
+}
+
+// updateProfilePic replaces the profile picture of the user with the id in
+// the url, and answers with the user. The picture is sent as the "image"
+// file of a multipart form, or as JSON with the file base64 encoded in
+// "content". It must be an image no bigger than the upload limit; anything
+// else is answered with 422, under the field it was sent as.
+func (app *application) updateProfilePic(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	field, hdr, ok := app.readProfilePic(w, r)
+	if !ok {
+		return
+	}
+
+	files := map[string][]*multipart.FileHeader{}
+	if hdr != nil {
+		files[field] = []*multipart.FileHeader{hdr}
+	}
+	form := forms.FromMultipart(&multipart.Form{File: files})
+	form.Messages = i18n.FromContext(r.Context()).FormMessages()
+	uploads.CheckImage(form, field, app.Config.Upload.MaxSize)
+	if !form.Valid() {
+		app.validationErrorJSON(w, r, form)
+		return
+	}
+
+	if err := uploads.SetProfilePic(app.DB, app.Config.Upload.Dir, user, hdr); err != nil {
+		app.logError(r, "could not save profile picture", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	setProfilePicURL(user)
+	_ = app.writeJSON(w, http.StatusOK, user)
+}
+
+// readProfilePic reads the picture in the body, returning the field it was
+// sent as and the file, which is nil if none was sent. Bodies which are too
+// big are answered with 413, and those which are neither multipart nor JSON
+// with 415.
+func (app *application) readProfilePic(w http.ResponseWriter, r *http.Request) (string, *multipart.FileHeader, bool) {
+	maxSize := app.Config.Upload.MaxSize
+	// room for base64, which is a third bigger, and the rest of the body
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize/3*4+64*1024)
+
+	var tooBig *http.MaxBytesError
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		err := r.ParseMultipartForm(maxSize)
+		if errors.As(err, &tooBig) {
+			app.errorJSON(w, err, http.StatusRequestEntityTooLarge)
+			return "", nil, false
+		}
+		if err != nil {
+			app.errorJSON(w, err, http.StatusBadRequest)
+			return "", nil, false
+		}
+		if files := r.MultipartForm.File["image"]; len(files) > 0 {
+			return "image", files[0], true
+		}
+		return "image", nil, true
+
+	case "application/json":
+		var upload profilePicUpload
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&upload)
+		if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+			err = errors.New("body must only contain a single JSON value")
+		}
+		if errors.As(err, &tooBig) {
+			app.errorJSON(w, err, http.StatusRequestEntityTooLarge)
+			return "", nil, false
+		}
+		if err != nil {
+			app.errorJSON(w, err, http.StatusBadRequest)
+			return "", nil, false
+		}
+		if len(upload.Content) == 0 {
+			return "content", nil, true
+		}
+
+		if upload.FileName == "" {
+			upload.FileName = "profile-pic"
+		}
+		hdr, err := uploads.FileHeader("content", upload.FileName, upload.Content)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusBadRequest)
+			return "", nil, false
+		}
+		return "content", hdr, true
+	}
+
+	app.errorJSON(w, errors.New("pictures must be sent as multipart/form-data or application/json"), http.StatusUnsupportedMediaType)
+	return "", nil, false
+}
+
+// removeProfilePic deletes the profile picture of the user with the id in
+// the url, answering 404 if they have none.
+func (app *application) removeProfilePic(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+	if user.ProfilePic.FileName == "" {
+		app.codeErrorJSON(w, r, http.StatusNotFound, codeNotFound)
+		return
+	}
+
+	if err := uploads.DeleteProfilePic(app.DB, app.Config.Upload.Dir, user); err != nil {
+		app.logError(r, "could not delete profile picture", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
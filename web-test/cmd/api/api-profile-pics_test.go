@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+
+	"webapp/pkg/data"
+)
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// multipartBody returns a form with content as its field file, and the form's
+// content type.
+func multipartBody(field string, content []byte) (*bytes.Buffer, string) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	if field != "" {
+		w, _ := mw.CreateFormFile(field, "img.png")
+		_, _ = w.Write(content)
+	}
+	mw.Close()
+	return body, mw.FormDataContentType()
+}
+
+func Test_app_profilePic(t *testing.T) {
+	dir := app.Config.Upload.Dir
+	app.Config.Upload.Dir = t.TempDir()
+	defer func() { app.Config.Upload.Dir = dir }()
+	defer func() { _ = app.DB.DeleteUserImage(2) }()
+
+	img := pngImage(t)
+	multipartImage, multipartType := multipartBody("image", img)
+	multipartText, textType := multipartBody("image", []byte("just some text"))
+	multipartEmpty, emptyType := multipartBody("", nil)
+	jsonImage, _ := json.Marshal(profilePicUpload{FileName: "img.png", Content: img})
+
+	var tests = []struct {
+		name           string
+		method         string
+		paramID        string
+		contentType    string
+		body           []byte
+		handler        http.HandlerFunc
+		admin          bool
+		expectedStatus int
+		invalidField   string
+	}{
+		{"no picture yet", "GET", "2", "", nil, app.showProfilePic, false, http.StatusNotFound, ""},
+		{"delete no picture", "DELETE", "2", "", nil, app.removeProfilePic, false, http.StatusNotFound, ""},
+		{"multipart upload", "PUT", "2", multipartType, multipartImage.Bytes(), app.updateProfilePic, false, http.StatusOK, ""},
+		{"show picture", "GET", "2", "", nil, app.showProfilePic, false, http.StatusOK, ""},
+		{"json upload", "PUT", "2", "application/json", jsonImage, app.updateProfilePic, false, http.StatusOK, ""},
+		{"multipart not an image", "PUT", "2", textType, multipartText.Bytes(), app.updateProfilePic, false, http.StatusUnprocessableEntity, "image"},
+		{"multipart without image", "PUT", "2", emptyType, multipartEmpty.Bytes(), app.updateProfilePic, false, http.StatusUnprocessableEntity, "image"},
+		{"json not an image", "PUT", "2", "application/json", []byte(`{"file_name":"a.png","content":"` + base64.StdEncoding.EncodeToString([]byte("text")) + `"}`), app.updateProfilePic, false, http.StatusUnprocessableEntity, "content"},
+		{"json without content", "PUT", "2", "application/json", []byte(`{"file_name":"a.png"}`), app.updateProfilePic, false, http.StatusUnprocessableEntity, "content"},
+		{"json not base64", "PUT", "2", "application/json", []byte(`{"content":"not base64!"}`), app.updateProfilePic, false, http.StatusBadRequest, ""},
+		{"unsupported body", "PUT", "2", "image/png", img, app.updateProfilePic, false, http.StatusUnsupportedMediaType, ""},
+		{"upload for unknown user", "PUT", "100", "application/json", jsonImage, app.updateProfilePic, true, http.StatusNotFound, ""},
+		{"upload for another user", "PUT", "1", "application/json", jsonImage, app.updateProfilePic, false, http.StatusForbidden, ""},
+		{"delete picture of another user", "DELETE", "1", "", nil, app.removeProfilePic, false, http.StatusForbidden, ""},
+		{"delete picture", "DELETE", "2", "", nil, app.removeProfilePic, false, http.StatusNoContent, ""},
+		{"deleted picture", "GET", "2", "", nil, app.showProfilePic, false, http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, "/", bytes.NewReader(e.body))
+		if e.contentType != "" {
+			req.Header.Set("Content-Type", e.contentType)
+		}
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("userID", e.paramID)
+		// as user 2, or the admin
+		claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "2"}, Admin: e.admin}
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx)
+		req = req.WithContext(context.WithValue(ctx, contextClaimsKey, claims))
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status returned; expected %d but got %d: %s", e.name, e.expectedStatus, rr.Code, rr.Body)
+			continue
+		}
+
+		switch {
+		case e.method == "PUT" && rr.Code == http.StatusOK:
+			var user data.User
+			_ = json.NewDecoder(rr.Body).Decode(&user)
+			if user.ID != 2 || user.ProfilePicURL != "/v1/users/2/profile-pic" {
+				t.Errorf("%s: expected the user with the picture url, got %+v", e.name, user)
+			}
+			// only the new picture is kept
+			if entries, _ := os.ReadDir(app.Config.Upload.Dir); len(entries) != 1 {
+				t.Errorf("%s: expected one stored picture, got %d", e.name, len(entries))
+			}
+		case e.method == "GET" && rr.Code == http.StatusOK:
+			if !bytes.Equal(rr.Body.Bytes(), img) || rr.Header().Get("Content-Type") != "image/png" {
+				t.Errorf("%s: expected the png, got %q", e.name, rr.Header().Get("Content-Type"))
+			}
+			if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Errorf("%s: expected browsers to be told not to sniff the type", e.name)
+			}
+		case e.invalidField != "":
+			var resp struct {
+				Error jsonError `json:"error"`
+			}
+			_ = json.NewDecoder(rr.Body).Decode(&resp)
+			if len(resp.Error.Fields[e.invalidField]) == 0 {
+				t.Errorf("%s: expected an error for %s, got %+v", e.name, e.invalidField, resp.Error)
+			}
+		}
+	}
+
+	if entries, _ := os.ReadDir(app.Config.Upload.Dir); len(entries) != 0 {
+		t.Errorf("expected the deleted picture to be removed, found %s", filepath.Join(app.Config.Upload.Dir, entries[0].Name()))
+	}
+}
+
+func Test_app_userJSONHasProfilePicURL(t *testing.T) {
+	_, _ = app.DB.InsertUserImage(data.UserImage{UserID: 1, FileName: "admin.png"})
+	defer func() { _ = app.DB.DeleteUserImage(1) }()
+
+	for _, id := range []string{"1", "2"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("userID", id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+
+		rr := httptest.NewRecorder()
+		app.showUser(rr, req)
+
+		var fields map[string]any
+		_ = json.NewDecoder(rr.Body).Decode(&fields)
+		url, ok := fields["profile_pic_url"]
+		if id == "1" && url != "/v1/users/1/profile-pic" {
+			t.Errorf("expected user 1 to have a picture url, got %v", url)
+		}
+		if id == "2" && ok {
+			t.Errorf("expected no picture url for user 2, got %v", url)
+		}
+	}
+}
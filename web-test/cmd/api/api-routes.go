@@ -2,6 +2,10 @@ package main
 
 import (
 	"net/http"
+	"webapp/openapi"
+	"webapp/pkg/health"
+	"webapp/pkg/logging"
+	"webapp/pkg/oidc"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -11,32 +15,74 @@ func (app *application) routes() http.Handler {
 	mux := chi.NewRouter()
 
 	// register middleware
+	mux.Use(logging.RequestID)
+	mux.Use(app.Metrics.Middleware)
+	mux.Use(app.addIPToContext)
+	mux.Use(logging.AccessLog(app.Logger, func(r *http.Request) string {
+		return app.ipFromContext(r.Context())
+	}))
 	mux.Use(middleware.Recoverer)
+	// api clients say which language they want messages in per request,
+	// with Accept-Language
+	mux.Use(app.I18n.Middleware(nil))
 	mux.Use(app.enableCORS)
+	mux.Use(app.rateLimit("default", app.Config.RateLimit.Default, app.clientKey))
 
-	mux.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir("./html/"))))
+	authLimit := app.rateLimit("auth", app.Config.RateLimit.Auth, app.clientKey)
 
-	mux.Route("/web", func(mux chi.Router) {
-		mux.Post("/auth", app.authenticate)
-		mux.Get("/refresh-token", app.refreshUsingCookie)
-		mux.Get("/logout", app.deleteRefreshCookie)
-	})
+	// operational endpoints
+	mux.Get("/healthz", health.Live)
+	mux.Get("/readyz", app.readyz)
+	mux.Method("GET", "/metrics", app.Metrics.ProtectedHandler(app.Config.Metrics.Token))
 
-	// authentication routes - auth handler, refresh
-	mux.Post("/auth", app.authenticate)
-	mux.Post("/refresh-token", app.refresh)
+	// api description, and a page to try it out
+	mux.Get("/openapi.json", openapi.SpecHandler)
+	mux.Get("/docs", openapi.DocsHandler)
 
-	// protected routes
-	mux.Route("/users", func(mux chi.Router) {
-		mux.Use(app.authRequired)
+	mux.Handle("/", app.HTML)
 
-		mux.Get("/", app.allUsers)
-		mux.Get("/{userID}", app.getUser)
-		mux.Delete("/{userID}", app.deleteUser)
-		mux.Put("/", app.insertUser)
-		mux.Patch("/", app.updateUser)
-	})
+	// OpenID Connect provider endpoints, for other applications logging
+	// their users in with this one
+	mux.Get(oidc.DiscoveryPath, app.oauthMetadata)
+	mux.Get(oidc.JWKSPath, app.oauthJWKS)
+	mux.Get(oidc.UserInfoPath, app.oauthUserInfo)
+	mux.Post(oidc.UserInfoPath, app.oauthUserInfo)
+	mux.With(authLimit).Post(oidc.TokenPath, app.oauthToken)
+	mux.With(authLimit).Post(oidc.RevocationPath, app.oauthRevoke)
+	mux.With(authLimit).Post(oidc.IntrospectionPath, app.oauthIntrospect)
+
+	for _, v := range app.apiVersions() {
+		app.mountVersion(mux, v)
+	}
+
+	// the unversioned routes of before /v1, kept for the clients still using
+	// them until legacySunset
+	mux.Group(func(mux chi.Router) {
+		mux.Use(deprecated("v1"))
 
+		mux.Route("/web", func(mux chi.Router) {
+			mux.Use(authLimit)
+			mux.Post("/auth", app.authenticate)
+			mux.Get("/refresh-token", app.refreshUsingCookie)
+			mux.Get("/logout", app.deleteRefreshCookie)
+		})
+
+		// authentication routes - auth handler, refresh
+		mux.With(authLimit).Post("/auth", app.authenticate)
+		mux.With(authLimit).Post("/refresh-token", app.refresh)
+
+		// protected routes
+		mux.Route("/users", func(mux chi.Router) {
+			mux.Use(app.authRequired)
+			mux.Use(app.rateLimit("api", app.Config.RateLimit.API, app.userKey))
+
+			mux.Get("/", app.allUsers)
+			mux.Get("/{userID}", app.getUser)
+			mux.Delete("/{userID}", app.deleteUser)
+			mux.Put("/", app.insertUser)
+			mux.Patch("/", app.updateUser)
+		})
+	})
 
 	return mux
 }
\ No newline at end of file
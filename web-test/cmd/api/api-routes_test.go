@@ -20,7 +20,47 @@ func Test_app_routes(t *testing.T) {
 		{"/users/{userID}", "DELETE"},
 		{"/users/", "PATCH"},
 		{"/users/", "PUT"},
-		
+		{"/v1/auth", "POST"},
+		{"/v1/refresh-token", "POST"},
+		{"/v1/auth/providers", "GET"},
+		{"/v1/auth/providers/{provider}", "POST"},
+		{"/v1/auth/passkey/options", "GET"},
+		{"/v1/auth/passkey", "POST"},
+		{"/v1/web/auth", "POST"},
+		{"/v1/web/refresh-token", "GET"},
+		{"/v1/web/logout", "GET"},
+		{"/v1/users/", "GET"},
+		{"/v1/users/", "POST"},
+		{"/v1/users/{userID}", "GET"},
+		{"/v1/users/{userID}", "PUT"},
+		{"/v1/users/{userID}", "PATCH"},
+		{"/v1/users/{userID}", "DELETE"},
+		{"/v1/users/{userID}/profile-pic", "GET"},
+		{"/v1/users/{userID}/profile-pic", "PUT"},
+		{"/v1/users/{userID}/profile-pic", "DELETE"},
+		{"/v1/me/", "GET"},
+		{"/v1/me/", "PATCH"},
+		{"/v1/me/", "DELETE"},
+		{"/v1/me/password", "POST"},
+		{"/v1/me/api-keys", "GET"},
+		{"/v1/me/api-keys", "POST"},
+		{"/v1/me/api-keys/{keyID}", "DELETE"},
+		{"/v1/me/passkeys", "GET"},
+		{"/v1/me/passkeys/options", "GET"},
+		{"/v1/me/passkeys", "POST"},
+		{"/v1/me/passkeys/{passkeyID}", "DELETE"},
+		{"/healthz", "GET"},
+		{"/readyz", "GET"},
+		{"/metrics", "GET"},
+		{"/openapi.json", "GET"},
+		{"/docs", "GET"},
+		{"/.well-known/openid-configuration", "GET"},
+		{"/oauth/jwks", "GET"},
+		{"/oauth/token", "POST"},
+		{"/oauth/userinfo", "GET"},
+		{"/oauth/userinfo", "POST"},
+		{"/oauth/revoke", "POST"},
+		{"/oauth/introspect", "POST"},
 	}
 
 	mux := app.routes()
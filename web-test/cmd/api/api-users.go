@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"webapp/pkg/data"
+	"webapp/pkg/jsonpatch"
+	"webapp/pkg/uploads"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// The /v1/users handlers. Unlike the unversioned ones they address a user by
+// the id in the url, answer 404 for users that do not exist, and send back
+// the user they created or changed.
+
+// createUser creates a user from a JSON payload, and answers 201 with the
+// user and its url in the Location header. Only admins may create users.
+func (app *application) createUser(w http.ResponseWriter, r *http.Request) {
+	if !app.adminRequired(w, r) {
+		return
+	}
+
+	var user data.User
+	if err := app.readJSON(w, r, &user); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	// the database picks the id
+	user.ID = 0
+	if !app.allowedUserChanges(w, r, data.User{}, user) || !app.validUser(w, r, user) {
+		return
+	}
+
+	id, err := app.DB.InsertUser(user)
+	if err != nil {
+		app.logError(r, "could not insert user", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+	user.ID = id
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/users/%d", id))
+	_ = app.writeJSON(w, http.StatusCreated, user)
+}
+
+// showUser returns the user with the id in the url.
+func (app *application) showUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, user)
+}
+
+// replaceUser replaces every field of the user with the id in the url with
+// those of the JSON payload. Fields left out are reset to their zero value.
+func (app *application) replaceUser(w http.ResponseWriter, r *http.Request) {
+	existing, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var user data.User
+	if err := app.readJSON(w, r, &user); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	if user.ID != 0 && user.ID != existing.ID {
+		app.errorJSON(w, errors.New("the id in the body does not match the url"), http.StatusBadRequest)
+		return
+	}
+	user.ID = existing.ID
+	if !app.allowedUserChanges(w, r, *existing, user) {
+		return
+	}
+	// the picture is changed on its own route
+	user.ProfilePic = existing.ProfilePic
+	setProfilePicURL(&user)
+
+	app.saveUser(w, r, user)
+}
+
+// patchUser changes the fields of the user with the id in the url which
+// the patch in the body changes, leaving the others as they are. The patch
+// is a JSON merge patch (RFC 7396), or a JSON Patch (RFC 6902) when sent as
+// application/json-patch+json. Only the changed columns are written.
+func (app *application) patchUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	app.applyUserPatch(w, r, user)
+}
+
+// applyUserPatch changes user with the patch in the body, as patchUser
+// describes, and answers with the user as saved.
+func (app *application) applyUserPatch(w http.ResponseWriter, r *http.Request, user *data.User) {
+	patched, ok := app.readPatch(w, r, user)
+	if !ok {
+		return
+	}
+	if patched.ID != user.ID {
+		app.errorJSON(w, errors.New("the id of a user cannot be changed"), http.StatusBadRequest)
+		return
+	}
+	if !app.allowedUserChanges(w, r, *user, patched) || !app.validUser(w, r, patched) {
+		return
+	}
+
+	if changes := data.UserChanges(*user, patched); !changes.Empty() {
+		err := app.DB.PatchUser(user.ID, changes)
+		if errors.Is(err, sql.ErrNoRows) {
+			app.codeErrorJSON(w, r, http.StatusNotFound, codeNotFound)
+			return
+		}
+		if err != nil {
+			app.logError(r, "could not patch user", err)
+			app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+			return
+		}
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, patched)
+}
+
+// removeUser deletes the user with the id in the url.
+func (app *application) removeUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.userFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.deleteUserAndPic(w, r, user) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUserAndPic deletes user, and the file of their profile picture.
+func (app *application) deleteUserAndPic(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	if err := app.DB.DeleteUser(user.ID); err != nil {
+		app.logError(r, "could not delete user", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return false
+	}
+	if err := uploads.Remove(app.Config.Upload.Dir, user.ProfilePic.FileName); err != nil {
+		app.logError(r, "could not remove profile picture", err)
+	}
+
+	return true
+}
+
+// userFromURL looks up the user with the id in the url, answering 400 for an
+// id which is not a number and 404 for a user who does not exist. Requests
+// changing the user answer 403 unless the client may write to them.
+func (app *application) userFromURL(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		app.codeErrorJSON(w, r, http.StatusBadRequest, codeBadRequest)
+		return nil, false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !app.userWriteAllowed(w, r, id) {
+		return nil, false
+	}
+
+	user, err := app.DB.GetUser(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.codeErrorJSON(w, r, http.StatusNotFound, codeNotFound)
+		return nil, false
+	}
+	if err != nil {
+		app.logError(r, "could not get user", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return nil, false
+	}
+	setProfilePicURL(user)
+
+	return user, true
+}
+
+// readPatch applies the patch in the body to user, and returns the result.
+// It answers 400 for a patch which cannot be applied or turns user into
+// something else, 409 when a JSON Patch "test" operation fails, and 415 for
+// a body which is not a patch.
+func (app *application) readPatch(w http.ResponseWriter, r *http.Request, user *data.User) (data.User, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1024*1024)
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return data.User{}, false
+	}
+
+	doc, err := json.Marshal(user)
+	if err != nil {
+		app.logError(r, "could not encode user", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return data.User{}, false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case jsonpatch.JSONPatchType:
+		doc, err = jsonpatch.Apply(doc, patch)
+	case jsonpatch.MergePatchType, "application/json", "":
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	default:
+		app.errorJSON(w, fmt.Errorf("patches must be sent as %s or %s", jsonpatch.MergePatchType, jsonpatch.JSONPatchType), http.StatusUnsupportedMediaType)
+		return data.User{}, false
+	}
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		app.codeErrorJSON(w, r, http.StatusConflict, codeConflict)
+		return data.User{}, false
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return data.User{}, false
+	}
+
+	var patched data.User
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patched); err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return data.User{}, false
+	}
+
+	return patched, true
+}
+
+// The fields of a user clients may set. Only admins may make someone an
+// admin, or take it away.
+var (
+	userFields      = []string{"email", "first_name", "last_name", "locale"}
+	adminUserFields = []string{"email", "first_name", "is_admin", "last_name", "locale"}
+)
+
+// writableUserFields returns the fields of a user the client may set.
+func writableUserFields(r *http.Request) []string {
+	if isAdmin(r) {
+		return adminUserFields
+	}
+	return userFields
+}
+
+// isAdmin reports whether the client is an admin.
+func isAdmin(r *http.Request) bool {
+	claims, ok := claimsFromContext(r.Context())
+	return ok && claims.Admin
+}
+
+// adminRequired answers 403 unless the client is an admin, and reports
+// whether it is.
+func (app *application) adminRequired(w http.ResponseWriter, r *http.Request) bool {
+	if !isAdmin(r) {
+		app.codeErrorJSON(w, r, http.StatusForbidden, codeForbidden)
+		return false
+	}
+	return true
+}
+
+// userWriteAllowed answers 403 unless the client may change the user with
+// id, and reports whether it may. Users may only change themselves; admins
+// may change anyone.
+func (app *application) userWriteAllowed(w http.ResponseWriter, r *http.Request, id int) bool {
+	claims, ok := claimsFromContext(r.Context())
+	if !ok || (!claims.Admin && claims.Subject != strconv.Itoa(id)) {
+		app.codeErrorJSON(w, r, http.StatusForbidden, codeForbidden)
+		return false
+	}
+	return true
+}
+
+// allowedUserChanges checks that the client may set every field which
+// differs between before and after, answering 403 with those it may not.
+func (app *application) allowedUserChanges(w http.ResponseWriter, r *http.Request, before, after data.User) bool {
+	b, a := jsonFields(before), jsonFields(after)
+
+	allowed := writableUserFields(r)
+	var forbidden []string
+	for field, value := range a {
+		if b[field] != value && !slices.Contains(allowed, field) {
+			forbidden = append(forbidden, field)
+		}
+	}
+	if len(forbidden) > 0 {
+		sort.Strings(forbidden)
+		app.forbiddenFieldsJSON(w, r, forbidden)
+		return false
+	}
+
+	return true
+}
+
+// jsonFields returns the fields of user as clients see them.
+func jsonFields(user data.User) map[string]any {
+	var fields map[string]any
+	doc, _ := json.Marshal(user)
+	_ = json.Unmarshal(doc, &fields)
+	return fields
+}
+
+// validUser checks user like userForm does, and that no other user has its
+// email address, answering 422 if it is not valid.
+func (app *application) validUser(w http.ResponseWriter, r *http.Request, user data.User) bool {
+	form, err := app.userForm(r, user)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return false
+	}
+	form.Unique("email", func(email string) bool {
+		other, err := app.DB.GetUserByEmail(email)
+		return err == nil && other.ID != user.ID
+	})
+	if !form.Valid() {
+		app.validationErrorJSON(w, r, form)
+		return false
+	}
+
+	return true
+}
+
+// saveUser validates and stores the changes to an existing user, answering
+// with the user as saved.
+func (app *application) saveUser(w http.ResponseWriter, r *http.Request, user data.User) {
+	if !app.validUser(w, r, user) {
+		return
+	}
+
+	if err := app.DB.UpdateUser(user); err != nil {
+		app.logError(r, "could not update user", err)
+		app.codeErrorJSON(w, r, http.StatusInternalServerError, codeInternal)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, user)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v4"
+
+	"webapp/pkg/data"
+)
+
+func Test_app_v1UserHandlers(t *testing.T) {
+	var tests = []struct {
+		name             string
+		method           string
+		json             string
+		paramID          string
+		handler          http.HandlerFunc
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"createUser valid", "POST", `{"first_name":"Jack","last_name":"Smith","email":"jack@example.com"}`, "", app.createUser, http.StatusCreated, "/v1/users/1"},
+		{"createUser email taken", "POST", `{"first_name":"Jack","last_name":"Smith","email":"admin@example.com"}`, "", app.createUser, http.StatusUnprocessableEntity, ""},
+		{"createUser invalid json", "POST", `{first_name:"Jack"}`, "", app.createUser, http.StatusBadRequest, ""},
+		{"showUser valid", "GET", "", "1", app.showUser, http.StatusOK, ""},
+		{"showUser unknown", "GET", "", "100", app.showUser, http.StatusNotFound, ""},
+		{"showUser bad URL param", "GET", "", "Y", app.showUser, http.StatusBadRequest, ""},
+		{"replaceUser valid", "PUT", `{"first_name":"Jane","last_name":"Doe","email":"user@example.com"}`, "2", app.replaceUser, http.StatusOK, ""},
+		{"replaceUser missing field", "PUT", `{"first_name":"Jane","email":"user@example.com"}`, "2", app.replaceUser, http.StatusUnprocessableEntity, ""},
+		{"replaceUser other id", "PUT", `{"id":1,"first_name":"Jane","last_name":"Doe","email":"user@example.com"}`, "2", app.replaceUser, http.StatusBadRequest, ""},
+		{"replaceUser email of another user", "PUT", `{"first_name":"Jane","last_name":"Doe","email":"admin@example.com"}`, "2", app.replaceUser, http.StatusUnprocessableEntity, ""},
+		{"replaceUser unknown", "PUT", `{"first_name":"Jane","last_name":"Doe","email":"jane@example.com"}`, "100", app.replaceUser, http.StatusNotFound, ""},
+		{"patchUser one field", "PATCH", `{"first_name":"Administrator"}`, "1", app.patchUser, http.StatusOK, ""},
+		{"patchUser change id", "PATCH", `{"id":2}`, "1", app.patchUser, http.StatusBadRequest, ""},
+		{"patchUser bad email", "PATCH", `{"email":"admin"}`, "1", app.patchUser, http.StatusUnprocessableEntity, ""},
+		{"removeUser valid", "DELETE", "", "2", app.removeUser, http.StatusNoContent, ""},
+		{"removeUser unknown", "DELETE", "", "100", app.removeUser, http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, "/", strings.NewReader(e.json))
+		if e.paramID != "" {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("userID", e.paramID)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+		}
+		// as the admin, who may change every user
+		req = req.WithContext(context.WithValue(req.Context(), contextClaimsKey, &Claims{Admin: true}))
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status returned; expected %d but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+		if rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("%s: expected location %q but got %q", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+	}
+}
+
+func Test_app_patchUserKeepsOtherFields(t *testing.T) {
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`{"first_name":"Administrator"}`))
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("userID", "1")
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx)
+	req = req.WithContext(context.WithValue(ctx, contextClaimsKey, &Claims{Admin: true}))
+
+	rr := httptest.NewRecorder()
+	app.patchUser(rr, req)
+
+	var user data.User
+	if err := json.NewDecoder(rr.Body).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.FirstName != "Administrator" || user.LastName != "User" || user.Email != "admin@example.com" || user.IsAdmin != 1 {
+		t.Errorf("expected only the first name to change, got %+v", user)
+	}
+}
+
+func Test_app_patchUser(t *testing.T) {
+	var tests = []struct {
+		name              string
+		contentType       string
+		body              string
+		admin             bool
+		expectedStatus    int
+		expectedLastName  string
+		expectedForbidden string
+	}{
+		{"merge patch", "application/merge-patch+json", `{"last_name":"Smith"}`, false, http.StatusOK, "Smith", ""},
+		{"plain json is a merge patch", "application/json", `{"last_name":"Smith"}`, false, http.StatusOK, "Smith", ""},
+		{"merge patch null", "application/merge-patch+json", `{"last_name":null}`, false, http.StatusUnprocessableEntity, "", ""},
+		{"merge patch unknown field", "application/merge-patch+json", `{"nickname":"Jo"}`, false, http.StatusBadRequest, "", ""},
+		{"json patch", "application/json-patch+json", `[{"op":"test","path":"/last_name","value":"User"},{"op":"replace","path":"/last_name","value":"Smith"}]`, false, http.StatusOK, "Smith", ""},
+		{"json patch test fails", "application/json-patch+json", `[{"op":"test","path":"/last_name","value":"Jones"},{"op":"replace","path":"/last_name","value":"Smith"}]`, false, http.StatusConflict, "", ""},
+		{"json patch bad path", "application/json-patch+json", `[{"op":"replace","path":"/nickname","value":"Jo"}]`, false, http.StatusBadRequest, "", ""},
+		{"json patch removes a field", "application/json-patch+json", `[{"op":"remove","path":"/id"}]`, false, http.StatusBadRequest, "", ""},
+		{"not a patch", "text/plain", `last_name=Smith`, false, http.StatusUnsupportedMediaType, "", ""},
+		{"user makes themselves admin", "application/merge-patch+json", `{"is_admin":1}`, false, http.StatusForbidden, "", "is_admin"},
+		{"user sends is_admin unchanged", "application/merge-patch+json", `{"is_admin":0,"last_name":"Smith"}`, false, http.StatusOK, "Smith", ""},
+		{"admin makes user admin", "application/merge-patch+json", `{"is_admin":1}`, true, http.StatusOK, "User", ""},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("PATCH", "/", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", e.contentType)
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("userID", "2")
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx)
+		// as user 2 themselves, or the admin
+		ctx = context.WithValue(ctx, contextClaimsKey, &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "2"}, Admin: e.admin})
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		app.patchUser(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status returned; expected %d but got %d: %s", e.name, e.expectedStatus, rr.Code, rr.Body)
+			continue
+		}
+
+		switch {
+		case rr.Code == http.StatusOK:
+			var user data.User
+			_ = json.NewDecoder(rr.Body).Decode(&user)
+			if user.LastName != e.expectedLastName || user.FirstName != "Regular" {
+				t.Errorf("%s: expected last name %q and the first name unchanged, got %+v", e.name, e.expectedLastName, user)
+			}
+		case e.expectedForbidden != "":
+			var resp struct {
+				Error jsonError `json:"error"`
+			}
+			_ = json.NewDecoder(rr.Body).Decode(&resp)
+			if resp.Error.Code != codeForbidden || len(resp.Error.Fields[e.expectedForbidden]) == 0 {
+				t.Errorf("%s: expected %s to be forbidden, got %+v", e.name, e.expectedForbidden, resp.Error)
+			}
+		}
+	}
+}
+
+func Test_app_userFieldAllowList(t *testing.T) {
+	var tests = []struct {
+		name           string
+		method         string
+		json           string
+		paramID        string
+		handler        http.HandlerFunc
+		admin          bool
+		expectedStatus int
+	}{
+		{"create admin as user", "POST", `{"first_name":"Jack","last_name":"Smith","email":"jack@example.com","is_admin":1}`, "", app.createUser, false, http.StatusForbidden},
+		{"create admin as admin", "POST", `{"first_name":"Jack","last_name":"Smith","email":"jack@example.com","is_admin":1}`, "", app.createUser, true, http.StatusCreated},
+		{"replace keeping is_admin as user", "PUT", `{"first_name":"Admin","last_name":"User","email":"admin@example.com","is_admin":1}`, "1", app.replaceUser, false, http.StatusOK},
+		{"replace dropping is_admin as user", "PUT", `{"first_name":"Admin","last_name":"User","email":"admin@example.com"}`, "1", app.replaceUser, false, http.StatusForbidden},
+		{"legacy insert admin as user", "PUT", `{"first_name":"Jack","last_name":"Smith","email":"jack@example.com","is_admin":1}`, "", app.insertUser, false, http.StatusForbidden},
+		{"legacy update to admin as user", "PATCH", `{"id":2,"first_name":"Regular","last_name":"User","email":"user@example.com","is_admin":1}`, "", app.updateUser, false, http.StatusForbidden},
+		{"legacy update to admin as admin", "PATCH", `{"id":2,"first_name":"Regular","last_name":"User","email":"user@example.com","is_admin":1}`, "", app.updateUser, true, http.StatusNoContent},
+	}
+
+	for _, e := range tests {
+		// as the user being changed, who is user 2 for the legacy routes
+		subject := e.paramID
+		if subject == "" {
+			subject = "2"
+		}
+		req := httptest.NewRequest(e.method, "/", strings.NewReader(e.json))
+		ctx := context.WithValue(req.Context(), contextClaimsKey, &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject}, Admin: e.admin})
+		if e.paramID != "" {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("userID", e.paramID)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+		}
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status returned; expected %d but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+	}
+}
+
+func Test_app_userOwnership(t *testing.T) {
+	var tests = []struct {
+		name           string
+		method         string
+		json           string
+		paramID        string
+		handler        http.HandlerFunc
+		admin          bool
+		expectedStatus int
+	}{
+		{"create", "POST", `{"first_name":"Jack","last_name":"Smith","email":"jack@example.com"}`, "", app.createUser, false, http.StatusForbidden},
+		{"show another user", "GET", "", "1", app.showUser, false, http.StatusOK},
+		{"replace another user", "PUT", `{"first_name":"Admin","last_name":"User","email":"mallory@example.com","is_admin":1}`, "1", app.replaceUser, false, http.StatusForbidden},
+		{"patch another user", "PATCH", `{"email":"mallory@example.com"}`, "1", app.patchUser, false, http.StatusForbidden},
+		{"patch unknown user", "PATCH", `{"email":"mallory@example.com"}`, "100", app.patchUser, false, http.StatusForbidden},
+		{"remove another user", "DELETE", "", "1", app.removeUser, false, http.StatusForbidden},
+		{"legacy insert", "PUT", `{"first_name":"Jack","last_name":"Smith","email":"jack@example.com"}`, "", app.insertUser, false, http.StatusForbidden},
+		{"legacy update another user", "PATCH", `{"id":1,"first_name":"Admin","last_name":"User","email":"mallory@example.com","is_admin":1}`, "", app.updateUser, false, http.StatusForbidden},
+		{"legacy delete another user", "DELETE", "", "1", app.deleteUser, false, http.StatusForbidden},
+		{"patch themselves", "PATCH", `{"last_name":"Smith"}`, "2", app.patchUser, false, http.StatusOK},
+		{"admin patches another user", "PATCH", `{"last_name":"Smith"}`, "1", app.patchUser, true, http.StatusOK},
+	}
+
+	for _, e := range tests {
+		// as user 2
+		req := httptest.NewRequest(e.method, "/", strings.NewReader(e.json))
+		ctx := context.WithValue(req.Context(), contextClaimsKey, &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "2"}, Admin: e.admin})
+		if e.paramID != "" {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("userID", e.paramID)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+		}
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: wrong status returned; expected %d but got %d: %s", e.name, e.expectedStatus, rr.Code, rr.Body)
+		}
+	}
+}
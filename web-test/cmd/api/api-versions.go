@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// The api is versioned by a path prefix, /v1, /v2 and so on. Every version
+// has the same routes, and each version lists the handlers serving them. A
+// new version starts as a copy of the one before it and swaps the handlers
+// whose behaviour changes, so both can be served side by side while clients
+// move over:
+//
+//	v2 := v1
+//	v2.name = "v2"
+//	v2.users.show = app.showUserV2
+
+// apiVersion is one version of the api.
+type apiVersion struct {
+	// name is the prefix of its routes, e.g. "v1".
+	name  string
+	users userHandlers
+	me    meHandlers
+}
+
+// userHandlers serve the /users routes of a version.
+type userHandlers struct {
+	list    http.HandlerFunc
+	create  http.HandlerFunc
+	show    http.HandlerFunc
+	replace http.HandlerFunc
+	update  http.HandlerFunc
+	remove  http.HandlerFunc
+
+	// the profile picture of a user
+	showPic   http.HandlerFunc
+	updatePic http.HandlerFunc
+	removePic http.HandlerFunc
+}
+
+// meHandlers serve the /me routes of a version, for the account of the
+// token holder.
+type meHandlers struct {
+	show     http.HandlerFunc
+	update   http.HandlerFunc
+	password http.HandlerFunc
+	remove   http.HandlerFunc
+
+	listKeys  http.HandlerFunc
+	createKey http.HandlerFunc
+	revokeKey http.HandlerFunc
+
+	listPasskeys   http.HandlerFunc
+	passkeyOptions http.HandlerFunc
+	createPasskey  http.HandlerFunc
+	deletePasskey  http.HandlerFunc
+}
+
+// apiVersions returns the versions of the api that are served, oldest first.
+func (app *application) apiVersions() []apiVersion {
+	v1 := apiVersion{
+		name: "v1",
+		users: userHandlers{
+			list:    app.allUsers,
+			create:  app.createUser,
+			show:    app.showUser,
+			replace: app.replaceUser,
+			update:  app.patchUser,
+			remove:  app.removeUser,
+
+			showPic:   app.showProfilePic,
+			updatePic: app.updateProfilePic,
+			removePic: app.removeProfilePic,
+		},
+		me: meHandlers{
+			show:     app.showMe,
+			update:   app.patchMe,
+			password: app.changePassword,
+			remove:   app.deleteMe,
+
+			listKeys:  app.listAPIKeys,
+			createKey: app.createAPIKey,
+			revokeKey: app.revokeAPIKey,
+
+			listPasskeys:   app.listPasskeys,
+			passkeyOptions: app.passkeyOptions,
+			createPasskey:  app.createPasskey,
+			deletePasskey:  app.deletePasskey,
+		},
+	}
+
+	return []apiVersion{v1}
+}
+
+// mountVersion registers the routes of v under its prefix.
+func (app *application) mountVersion(mux chi.Router, v apiVersion) {
+	authLimit := app.rateLimit("auth", app.Config.RateLimit.Auth, app.clientKey)
+
+	mux.Route("/"+v.name, func(mux chi.Router) {
+		mux.Group(func(mux chi.Router) {
+			mux.Use(authLimit)
+			mux.Post("/auth", app.authenticate)
+			mux.Post("/refresh-token", app.refresh)
+			mux.Post("/auth/providers/{provider}", app.authenticateExternal)
+			mux.Post("/auth/passkey", app.authenticatePasskey)
+			mux.Post("/web/auth", app.authenticate)
+			mux.Get("/web/refresh-token", app.refreshUsingCookie)
+			mux.Get("/web/logout", app.deleteRefreshCookie)
+		})
+
+		mux.Get("/auth/providers", app.listIdentityProviders)
+		mux.Get("/auth/passkey/options", app.passkeyLoginOptions)
+
+		mux.Route("/users", func(mux chi.Router) {
+			mux.Use(app.authRequired)
+			mux.Use(app.rateLimit("api", app.Config.RateLimit.API, app.userKey))
+
+			mux.Get("/", v.users.list)
+			mux.Post("/", v.users.create)
+			mux.Get("/{userID}", v.users.show)
+			mux.Put("/{userID}", v.users.replace)
+			mux.Patch("/{userID}", v.users.update)
+			mux.Delete("/{userID}", v.users.remove)
+
+			mux.Get("/{userID}/profile-pic", v.users.showPic)
+			mux.With(app.rateLimit("upload", app.Config.RateLimit.Upload, app.userKey)).Put("/{userID}/profile-pic", v.users.updatePic)
+			mux.Delete("/{userID}/profile-pic", v.users.removePic)
+		})
+
+		mux.Route("/me", func(mux chi.Router) {
+			mux.Use(app.authRequired)
+			mux.Use(app.rateLimit("api", app.Config.RateLimit.API, app.userKey))
+
+			mux.Get("/", v.me.show)
+			mux.Patch("/", v.me.update)
+			mux.Delete("/", v.me.remove)
+			// it checks the current password, so it is limited like logging in
+			mux.With(authLimit).Post("/password", v.me.password)
+
+			mux.Get("/api-keys", v.me.listKeys)
+			mux.Post("/api-keys", v.me.createKey)
+			mux.Delete("/api-keys/{keyID}", v.me.revokeKey)
+
+			mux.Get("/passkeys", v.me.listPasskeys)
+			mux.Get("/passkeys/options", v.me.passkeyOptions)
+			mux.Post("/passkeys", v.me.createPasskey)
+			mux.Delete("/passkeys/{passkeyID}", v.me.deletePasskey)
+		})
+	})
+}
+
+// When the unversioned routes were deprecated in favour of /v1, and when
+// they will be removed.
+var (
+	legacyDeprecation = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset      = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// deprecated marks the responses of the unversioned routes as deprecated
+// (RFC 9745), says when the routes go away (RFC 8594), and links to the
+// route replacing them in version successor.
+func deprecated(successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", legacyDeprecation.Unix()))
+			w.Header().Set("Sunset", legacySunset.Format(http.TimeFormat))
+			w.Header().Add("Link", fmt.Sprintf(`</%s%s>; rel="successor-version"`, successor, strings.TrimSuffix(r.URL.Path, "/")))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"webapp/pkg/data"
+)
+
+func Test_app_deprecatedRoutes(t *testing.T) {
+	routes := app.routes()
+	tokens, _ := app.generateTokenPair(&data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"})
+
+	var tests = []struct {
+		name              string
+		url               string
+		expectDeprecation bool
+		expectedLink      string
+	}{
+		{"legacy list", "/users/", true, `</v1/users>; rel="successor-version"`},
+		{"legacy get", "/users/1", true, `</v1/users/1>; rel="successor-version"`},
+		{"v1 list", "/v1/users", false, ""},
+		{"v1 get", "/v1/users/1", false, ""},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.url, nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.Token)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200 but got %d", e.name, rr.Code)
+		}
+
+		deprecation, sunset := rr.Header().Get("Deprecation"), rr.Header().Get("Sunset")
+		if e.expectDeprecation && (deprecation == "" || sunset != "Thu, 01 Apr 2027 00:00:00 GMT") {
+			t.Errorf("%s: expected Deprecation and Sunset headers, got %q and %q", e.name, deprecation, sunset)
+		}
+		if !e.expectDeprecation && (deprecation != "" || sunset != "") {
+			t.Errorf("%s: expected no Deprecation or Sunset header, got %q and %q", e.name, deprecation, sunset)
+		}
+		if link := rr.Header().Get("Link"); link != e.expectedLink {
+			t.Errorf("%s: expected link %q but got %q", e.name, e.expectedLink, link)
+		}
+	}
+}
+
+func Test_app_mountVersionSideBySide(t *testing.T) {
+	v1 := app.apiVersions()[0]
+	v2 := v1
+	v2.name = "v2"
+	v2.users.show = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+
+	mux := chi.NewRouter()
+	app.mountVersion(mux, v1)
+	app.mountVersion(mux, v2)
+
+	tokens, _ := app.generateTokenPair(&data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com"})
+
+	var tests = []struct {
+		url            string
+		expectedStatus int
+	}{
+		{"/v1/users/1", http.StatusOK},
+		{"/v2/users/1", http.StatusTeapot},
+		{"/v2/users", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.url, nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.Token)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.url, e.expectedStatus, rr.Code)
+		}
+	}
+}
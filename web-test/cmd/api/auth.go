@@ -14,6 +14,7 @@ import (
 var jwtTokenExpiry = time.Minute * 15
 var refreshTokenExpiry = time.Hour * 24
 
+const refreshCookieName = "__Host-refresh_token"
 
 type TokenPairs struct {
 	Token string `json:"access_token"`
@@ -22,7 +23,14 @@ type TokenPairs struct {
 
 type Claims struct {
 	UserName string `json:"name"`
+	Admin    bool   `json:"admin"`
 	jwt.RegisteredClaims
+
+	// APIKeyID is the id of the API key the request was made with, or 0
+	// for an access token. APIKeyPrefix and Scopes are those of the key.
+	APIKeyID     int      `json:"-"`
+	APIKeyPrefix string   `json:"-"`
+	Scopes       []string `json:"-"`
 }
 
 func (app *application) getTokenFromHeaderAndVerify(w http.ResponseWriter, r *http.Request) (string, *Claims, error) {
@@ -125,6 +133,33 @@ func (app *application) generateTokenPair(user *data.User) (TokenPairs, error) {
 		RefreshToken: signedRefreshToken,
 	}
 
+	app.countTokens()
+
 
 	return tokenPairs, nil
-}
\ No newline at end of file
+}
+
+// refreshCookie returns the http only cookie used to hand the refresh token
+// to the browser, using the cookie settings from the config.
+func (app *application) refreshCookie(refreshToken string) *http.Cookie {
+	return &http.Cookie{
+		Name:     refreshCookieName,
+		Path:     "/",
+		Value:    refreshToken,
+		Expires:  time.Now().Add(refreshTokenExpiry),
+		MaxAge:   int(refreshTokenExpiry.Seconds()),
+		SameSite: http.SameSiteStrictMode,
+		Domain:   app.Config.Cookie.Domain,
+		HttpOnly: true,
+		Secure:   app.Config.Cookie.Secure,
+	}
+}
+
+// expiredRefreshCookie returns a refresh cookie that tells the browser to delete it.
+func (app *application) expiredRefreshCookie() *http.Cookie {
+	cookie := app.refreshCookie("")
+	cookie.Expires = time.Unix(0, 0)
+	cookie.MaxAge = -1
+
+	return cookie
+}
@@ -1,42 +1,127 @@
 package main
 
 import (
-	"flag"
-	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
+	"os"
+	"time"
+	"webapp/html"
+	"webapp/pkg/assets"
+	"webapp/pkg/clientip"
+	"webapp/pkg/config"
+	"webapp/pkg/i18n"
+	"webapp/pkg/logging"
+	"webapp/pkg/metrics"
+	"webapp/pkg/oidc"
+	"webapp/pkg/ratelimit"
 	"webapp/pkg/repository"
 	"webapp/pkg/repository/dbrepo"
+	"webapp/pkg/server"
+	"webapp/pkg/webauthn"
 )
 
-const port = 8090
-
 type application struct {
-	DSN string
-	DB repository.DatabaseRepo
-	Domain string
-	JWTSecret string
+	Config         *config.Config
+	DSN            string
+	DB             repository.DatabaseRepo
+	Domain         string
+	JWTSecret      string
+	Metrics        *metrics.Registry
+	Logger         *slog.Logger
+	IPResolver     *clientip.Resolver
+	RateLimitStore ratelimit.Store
+	HTML           *assets.Assets
+	I18n           *i18n.Bundle
+	Signer         *oidc.Signer
+	// IdentityProviders are the external providers users may log in with.
+	IdentityProviders []*oidc.Provider
+	// WebAuthn checks the passkeys users register and log in with, and
+	// Challenges issues the challenges they answer.
+	WebAuthn   *webauthn.RelyingParty
+	Challenges *webauthn.Challenges
 }
 
 func main() {
-	var app application
-	flag.StringVar(&app.Domain, "domain", "example.com", "Domain for application, e.g. company.com")
-	flag.StringVar(&app.DSN, "dsn", "host=localhost port=5432 user=postgres password=postgres dbname=users sslmode=disable timezone=UTC connect_timeout=5", "Posgtres connection")
-	flag.StringVar(&app.JWTSecret, "jwt-secret", "2dce505d96a53c5768052ee90f3df2055657518dad489160df9913f66042e160", "signing secret")
-	flag.Parse()
+	cfg, err := config.Load("api", os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app := application{
+		Config:         cfg,
+		DSN:            cfg.DSN,
+		Domain:         cfg.Domain,
+		JWTSecret:      cfg.JWTSecret,
+		Metrics:        metrics.New(),
+		Logger:         logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level),
+		RateLimitStore: ratelimit.NewMemoryStore(),
+
+		IdentityProviders: oidc.NewProviders(cfg.IdentityProviders),
+		WebAuthn:          webauthn.New(cfg.WebAuthn),
+		Challenges:        webauthn.NewChallenges(cfg.JWTSecret),
+	}
+	slog.SetDefault(app.Logger)
+
+	app.IPResolver, err = clientip.NewResolver(cfg.ClientIPHeader, cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.HTML, err = app.loadHTML()
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.I18n, err = i18n.New(i18n.Catalogs, cfg.DefaultLocale)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.Signer, err = app.loadSigner()
+	if err != nil {
+		log.Fatal(err)
+	}
+	jwtTokenExpiry = time.Duration(cfg.Tokens.AccessTokenExpiry)
+	refreshTokenExpiry = time.Duration(cfg.Tokens.RefreshTokenExpiry)
 
 	conn, err := app.connectToDB()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer conn.Close()
 
 	app.DB = &dbrepo.PostgresDBRepo{DB: conn}
+	app.Metrics.RegisterDBStats(conn)
+
+	srv := server.New(cfg, cfg.APIPort, app.routes())
+
+	// print out a message
+	app.Logger.Info("starting api", "port", cfg.APIPort, "tls", cfg.TLS.Enabled())
+
+	// start the server; this blocks until SIGINT or SIGTERM has been
+	// received and in-flight requests have been drained
+	err = srv.Run()
 
-	log.Printf("Starting api on port %d\n", port)
+	app.Logger.Info("closing database pool")
+	_ = conn.Close()
 
-	err = http.ListenAndServe(fmt.Sprintf(":%d", port), app.routes())
 	if err != nil {
 		log.Fatal(err)
 	}
-}
\ No newline at end of file
+}
+
+// loadHTML returns the single page application embedded in the binary, or
+// the one on disk with assets.from_disk.
+func (app *application) loadHTML() (*assets.Assets, error) {
+	if app.Config.Assets.FromDisk {
+		return assets.New(os.DirFS(app.Config.Assets.HTMLDir), assets.Options{Disk: true})
+	}
+	return assets.New(html.FS, assets.Options{})
+}
+
+// loadSigner returns the signer of ID tokens, with the key in
+// oidc.signing_key_file. Without one, a key is generated, and ID tokens
+// cannot be verified once the api restarts.
+func (app *application) loadSigner() (*oidc.Signer, error) {
+	if app.Config.OIDC.SigningKeyFile != "" {
+		return oidc.LoadSigner(app.Config.OIDC.SigningKeyFile)
+	}
+	app.Logger.Warn("no oidc signing key file, generating a key for this run")
+	return oidc.GenerateSigner()
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/oidc"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// The api is the OpenID Connect provider of other applications: the web
+// application asks the user for consent and hands out an authorization
+// code, and these endpoints exchange it for tokens. Access tokens issued
+// here are opaque, kept hashed in the database, and only good for the
+// userinfo endpoint; they are not the JWTs the rest of the api takes.
+//
+// The endpoints follow the OAuth 2.0 specs rather than the rest of the api:
+// forms in, and errors as {"error", "error_description"}.
+
+// maxOAuthFormSize limits the form bodies of the oauth endpoints.
+const maxOAuthFormSize = 64 << 10
+
+func (app *application) oauthMetadata(w http.ResponseWriter, r *http.Request) {
+	_ = app.writeJSON(w, http.StatusOK, oidc.NewMetadata(app.Config.OIDC.Issuer, app.Config.OIDC.AuthorizeURL))
+}
+
+func (app *application) oauthJWKS(w http.ResponseWriter, r *http.Request) {
+	_ = app.writeJSON(w, http.StatusOK, app.Signer.JWKS())
+}
+
+// oauthErrorJSON answers with an OAuth 2.0 error.
+func (app *application) oauthErrorJSON(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, error=%q`, app.Config.OIDC.Issuer, code))
+	}
+	_ = app.writeJSON(w, status, oidc.Error{Code: code, Description: description})
+}
+
+// parseOAuthForm parses the form body of r, answering with an error if it
+// cannot.
+func (app *application) parseOAuthForm(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOAuthFormSize)
+	if err := r.ParseForm(); err != nil {
+		app.oauthErrorJSON(w, http.StatusBadRequest, oidc.ErrInvalidRequest, "the body is not a valid form")
+		return false
+	}
+	return true
+}
+
+// oauthClient returns the client calling, authenticated with HTTP Basic or
+// with client_id and client_secret in the form. Public clients only send
+// their client_id, and are turned away unless allowPublic.
+func (app *application) oauthClient(w http.ResponseWriter, r *http.Request, allowPublic bool) (*data.OAuthClient, bool) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 has both form encoded before they are put
+		// in the header
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := app.DB.GetOAuthClient(id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		app.logError(r, "could not get oauth client", err)
+		app.oauthErrorJSON(w, http.StatusInternalServerError, oidc.ErrServerError, "")
+		return nil, false
+	}
+
+	switch {
+	case err != nil:
+	case client.Public() && secret == "" && allowPublic:
+		return client, true
+	case client.SecretMatches(secret):
+		return client, true
+	}
+
+	app.oauthErrorJSON(w, http.StatusUnauthorized, oidc.ErrInvalidClient, "client authentication failed")
+	return nil, false
+}
+
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+// oauthToken exchanges an authorization code for an access token and an ID
+// token.
+func (app *application) oauthToken(w http.ResponseWriter, r *http.Request) {
+	if !app.parseOAuthForm(w, r) {
+		return
+	}
+	client, ok := app.oauthClient(w, r, true)
+	if !ok {
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		app.oauthErrorJSON(w, http.StatusBadRequest, oidc.ErrUnsupportedGrantType, "only the authorization_code grant is supported")
+		return
+	}
+
+	// the code is gone once taken, so it cannot be tried twice, even when
+	// the request turns out to be wrong
+	code, err := app.DB.TakeAuthCode(data.HashOAuthSecret(r.PostForm.Get("code")))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		app.logError(r, "could not take authorization code", err)
+		app.oauthErrorJSON(w, http.StatusInternalServerError, oidc.ErrServerError, "")
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case err != nil, code.ClientID != client.ID, !now.Before(code.ExpiresAt):
+		app.oauthErrorJSON(w, http.StatusBadRequest, oidc.ErrInvalidGrant, "the code is invalid or expired")
+		return
+	case r.PostForm.Get("redirect_uri") != code.RedirectURI:
+		app.oauthErrorJSON(w, http.StatusBadRequest, oidc.ErrInvalidGrant, "the redirect uri does not match the one the code was issued for")
+		return
+	case !oidc.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge):
+		app.oauthErrorJSON(w, http.StatusBadRequest, oidc.ErrInvalidGrant, "the code verifier does not match the code challenge")
+		return
+	}
+
+	user, err := app.DB.GetUser(code.UserID)
+	if err != nil {
+		app.logError(r, "could not get user for authorization code", err)
+		app.oauthErrorJSON(w, http.StatusInternalServerError, oidc.ErrServerError, "")
+		return
+	}
+
+	accessToken, hash, err := data.NewOAuthSecret()
+	if err != nil {
+		app.logError(r, "could not generate access token", err)
+		app.oauthErrorJSON(w, http.StatusInternalServerError, oidc.ErrServerError, "")
+		return
+	}
+	_, err = app.DB.InsertOAuthToken(data.OAuthToken{
+		Hash:      hash,
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		Scopes:    code.Scopes,
+		ExpiresAt: now.Add(jwtTokenExpiry),
+	})
+	if err != nil {
+		app.logError(r, "could not insert access token", err)
+		app.oauthErrorJSON(w, http.StatusInternalServerError, oidc.ErrServerError, "")
+		return
+	}
+
+	idToken, err := app.Signer.Sign(oidc.IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    app.Config.OIDC.Issuer,
+			Subject:   fmt.Sprint(user.ID),
+			Audience:  jwt.ClaimStrings{client.ID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(jwtTokenExpiry)),
+		},
+		Nonce:      code.Nonce,
+		UserClaims: oidc.ClaimsFor(user, code.Scopes),
+	})
+	if err != nil {
+		app.logError(r, "could not sign id token", err)
+		app.oauthErrorJSON(w, http.StatusInternalServerError, oidc.ErrServerError, "")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = app.writeJSON(w, http.StatusOK, oauthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(jwtTokenExpiry.Seconds()),
+		IDToken:     idToken,
+		Scope:       strings.Join(code.Scopes, " "),
+	})
+}
+
+// oauthUserInfo answers with the claims about the user an access token was
+// issued for.
+func (app *application) oauthUserInfo(w http.ResponseWriter, r *http.Request) {
+	invalid := func() {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error=%q`, oidc.ErrInvalidToken))
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		invalid()
+		return
+	}
+
+	token, err := app.DB.GetOAuthToken(data.HashOAuthSecret(accessToken))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		app.logError(r, "could not get access token", err)
+		app.oauthErrorJSON(w, http.StatusInternalServerError, oidc.ErrServerError, "")
+		return
+	}
+	if err != nil || token.Expired(time.Now()) {
+		invalid()
+		return
+	}
+
+	user, err := app.DB.GetUser(token.UserID)
+	if err != nil {
+		app.logError(r, "could not get user for access token", err)
+		app.oauthErrorJSON(w, http.StatusInternalServerError, oidc.ErrServerError, "")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = app.writeJSON(w, http.StatusOK, oidc.UserInfo{
+		Subject:    fmt.Sprint(user.ID),
+		UserClaims: oidc.ClaimsFor(user, token.Scopes),
+	})
+}
+
+// oauthRevoke revokes an access token of the calling client. As RFC 7009
+// asks, it answers the same whether or not there was such a token, so it
+// cannot be used to probe for tokens.
+func (app *application) oauthRevoke(w http.ResponseWriter, r *http.Request) {
+	if !app.parseOAuthForm(w, r) {
+		return
+	}
+	client, ok := app.oauthClient(w, r, true)
+	if !ok {
+		return
+	}
+
+	token, err := app.DB.GetOAuthToken(data.HashOAuthSecret(r.PostForm.Get("token")))
+	if err == nil && token.ClientID == client.ID {
+		err = app.DB.DeleteOAuthToken(token.ID)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		app.logError(r, "could not revoke access token", err)
+		app.oauthErrorJSON(w, http.StatusInternalServerError, oidc.ErrServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type oauthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// oauthIntrospect tells a confidential client whether one of its access
+// tokens is still active. Tokens of other clients look inactive, so a
+// client cannot learn about the users of another.
+func (app *application) oauthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if !app.parseOAuthForm(w, r) {
+		return
+	}
+	client, ok := app.oauthClient(w, r, false)
+	if !ok {
+		return
+	}
+
+	token, err := app.DB.GetOAuthToken(data.HashOAuthSecret(r.PostForm.Get("token")))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		app.logError(r, "could not get access token", err)
+		app.oauthErrorJSON(w, http.StatusInternalServerError, oidc.ErrServerError, "")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err != nil || token.ClientID != client.ID || token.Expired(time.Now()) {
+		_ = app.writeJSON(w, http.StatusOK, oauthIntrospection{})
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, oauthIntrospection{
+		Active:    true,
+		Scope:     strings.Join(token.Scopes, " "),
+		ClientID:  token.ClientID,
+		Subject:   fmt.Sprint(token.UserID),
+		TokenType: "Bearer",
+		Issuer:    app.Config.OIDC.Issuer,
+		ExpiresAt: token.ExpiresAt.Unix(),
+		IssuedAt:  token.CreatedAt.Unix(),
+	})
+}
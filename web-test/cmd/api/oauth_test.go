@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"webapp/pkg/data"
+	"webapp/pkg/oidc"
+)
+
+const (
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testRedirectURI = "https://app.example/callback"
+)
+
+// insertOAuthClient registers a client with id, and returns its secret;
+// public clients have none.
+func insertOAuthClient(t *testing.T, id string, public bool) string {
+	t.Helper()
+
+	c, secret, err := data.NewOAuthClient("Test app", []string{testRedirectURI}, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ID = id
+	if err := app.DB.InsertOAuthClient(c); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = app.DB.DeleteOAuthClient(id) })
+
+	return secret
+}
+
+// insertAuthCode stores a code like the consent page hands out, for the
+// admin user, and returns it.
+func insertAuthCode(t *testing.T, clientID string, expiresAt time.Time) string {
+	t.Helper()
+
+	code, hash, err := data.NewOAuthSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.DB.InsertAuthCode(data.AuthCode{
+		Hash:          hash,
+		ClientID:      clientID,
+		UserID:        1,
+		RedirectURI:   testRedirectURI,
+		Scopes:        []string{oidc.ScopeOpenID, oidc.ScopeProfile, oidc.ScopeEmail},
+		Nonce:         "n-0S6",
+		CodeChallenge: oidc.S256Challenge(testVerifier),
+		ExpiresAt:     expiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+// postOAuthForm posts form to handler, with the credentials of a client in
+// HTTP Basic unless secret is empty.
+func postOAuthForm(t *testing.T, handler http.HandlerFunc, clientID, secret string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(secret))
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	return rr
+}
+
+func Test_app_oauthMetadata(t *testing.T) {
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, httptest.NewRequest("GET", oidc.DiscoveryPath, nil))
+
+	var meta oidc.Metadata
+	if err := json.NewDecoder(rr.Body).Decode(&meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Issuer != app.Config.OIDC.Issuer || meta.AuthorizationEndpoint != app.Config.OIDC.AuthorizeURL {
+		t.Errorf("wrong issuer or authorization endpoint in %+v", meta)
+	}
+	if meta.TokenEndpoint != app.Config.OIDC.Issuer+oidc.TokenPath {
+		t.Errorf("wrong token endpoint %s", meta.TokenEndpoint)
+	}
+
+	rr = httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, httptest.NewRequest("GET", oidc.JWKSPath, nil))
+
+	var jwks oidc.JWKS
+	if err := json.NewDecoder(rr.Body).Decode(&jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != "RSA" || jwks.Keys[0].Kid == "" {
+		t.Errorf("wrong key set %+v", jwks)
+	}
+}
+
+func Test_app_oauthToken(t *testing.T) {
+	secret := insertOAuthClient(t, "confidential", false)
+	insertOAuthClient(t, "public", true)
+	insertOAuthClient(t, "other", true)
+
+	later := time.Now().Add(time.Minute)
+	var tests = []struct {
+		name           string
+		clientID       string
+		secret         string
+		codeFor        string
+		expiresAt      time.Time
+		change         func(form url.Values)
+		expectedStatus int
+		expectedError  string
+	}{
+		{"confidential", "confidential", secret, "confidential", later, nil, http.StatusOK, ""},
+		{"public", "public", "", "public", later, nil, http.StatusOK, ""},
+		{"secret in form", "confidential", "", "confidential", later, func(f url.Values) { f.Set("client_secret", secret) }, http.StatusOK, ""},
+		{"wrong secret", "confidential", "guess", "confidential", later, nil, http.StatusUnauthorized, oidc.ErrInvalidClient},
+		{"confidential without secret", "confidential", "", "confidential", later, nil, http.StatusUnauthorized, oidc.ErrInvalidClient},
+		{"unknown client", "unknown", "", "confidential", later, nil, http.StatusUnauthorized, oidc.ErrInvalidClient},
+		{"code of another client", "other", "", "public", later, nil, http.StatusBadRequest, oidc.ErrInvalidGrant},
+		{"expired code", "public", "", "public", time.Now().Add(-time.Second), nil, http.StatusBadRequest, oidc.ErrInvalidGrant},
+		{"wrong verifier", "public", "", "public", later, func(f url.Values) { f.Set("code_verifier", strings.Repeat("a", 43)) }, http.StatusBadRequest, oidc.ErrInvalidGrant},
+		{"no verifier", "public", "", "public", later, func(f url.Values) { f.Del("code_verifier") }, http.StatusBadRequest, oidc.ErrInvalidGrant},
+		{"other redirect uri", "public", "", "public", later, func(f url.Values) { f.Set("redirect_uri", "https://evil.example/") }, http.StatusBadRequest, oidc.ErrInvalidGrant},
+		{"unknown code", "public", "", "public", later, func(f url.Values) { f.Set("code", "guess") }, http.StatusBadRequest, oidc.ErrInvalidGrant},
+		{"password grant", "public", "", "public", later, func(f url.Values) { f.Set("grant_type", "password") }, http.StatusBadRequest, oidc.ErrUnsupportedGrantType},
+	}
+
+	for _, e := range tests {
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {insertAuthCode(t, e.codeFor, e.expiresAt)},
+			"redirect_uri":  {testRedirectURI},
+			"code_verifier": {testVerifier},
+		}
+		if e.secret == "" {
+			form.Set("client_id", e.clientID)
+		}
+		if e.change != nil {
+			e.change(form)
+		}
+
+		rr := postOAuthForm(t, app.oauthToken, e.clientID, e.secret, form)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d: %s", e.name, e.expectedStatus, rr.Code, rr.Body)
+			continue
+		}
+		if rr.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: token responses must not be cached", e.name)
+		}
+		if e.expectedError != "" {
+			var oauthErr oidc.Error
+			_ = json.NewDecoder(rr.Body).Decode(&oauthErr)
+			if oauthErr.Code != e.expectedError {
+				t.Errorf("%s: expected error %s but got %s", e.name, e.expectedError, oauthErr.Code)
+			}
+			continue
+		}
+
+		// a code can only be used once
+		if again := postOAuthForm(t, app.oauthToken, e.clientID, e.secret, form); again.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected a used code to be refused, got %d", e.name, again.Code)
+		}
+	}
+}
+
+// exchangeCode runs the token endpoint for a new code of the public client
+// clientID, and returns its answer.
+func exchangeCode(t *testing.T, clientID string) oauthTokenResponse {
+	t.Helper()
+
+	rr := postOAuthForm(t, app.oauthToken, clientID, "", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {clientID},
+		"code":          {insertAuthCode(t, clientID, time.Now().Add(time.Minute))},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testVerifier},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("could not exchange code: %d %s", rr.Code, rr.Body)
+	}
+
+	var tokens oauthTokenResponse
+	if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func Test_app_oauthIDToken(t *testing.T) {
+	insertOAuthClient(t, "spa", true)
+	tokens := exchangeCode(t, "spa")
+
+	if tokens.TokenType != "Bearer" || tokens.Scope != "openid profile email" || tokens.ExpiresIn <= 0 {
+		t.Errorf("wrong token response %+v", tokens)
+	}
+
+	var claims oidc.IDTokenClaims
+	if err := app.Signer.Verify(tokens.IDToken, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != app.Config.OIDC.Issuer || !claims.VerifyAudience("spa", true) || claims.Subject != "1" {
+		t.Errorf("wrong registered claims %+v", claims.RegisteredClaims)
+	}
+	if claims.Nonce != "n-0S6" || claims.Name != "Admin User" || claims.Email != "admin@example.com" {
+		t.Errorf("wrong claims %+v", claims)
+	}
+}
+
+func Test_app_oauthUserInfo(t *testing.T) {
+	insertOAuthClient(t, "spa", true)
+	tokens := exchangeCode(t, "spa")
+
+	var tests = []struct {
+		name           string
+		method         string
+		authorization  string
+		expectedStatus int
+	}{
+		{"get", "GET", "Bearer " + tokens.AccessToken, http.StatusOK},
+		{"post", "POST", "Bearer " + tokens.AccessToken, http.StatusOK},
+		{"unknown token", "GET", "Bearer guess", http.StatusUnauthorized},
+		{"id token", "GET", "Bearer " + tokens.IDToken, http.StatusUnauthorized},
+		{"no token", "GET", "", http.StatusUnauthorized},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, oidc.UserInfoPath, nil)
+		if e.authorization != "" {
+			req.Header.Set("Authorization", e.authorization)
+		}
+		rr := httptest.NewRecorder()
+		app.routes().ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, rr.Code)
+			continue
+		}
+		if rr.Code == http.StatusUnauthorized {
+			if !strings.Contains(rr.Header().Get("WWW-Authenticate"), "invalid_token") {
+				t.Errorf("%s: expected an invalid_token challenge", e.name)
+			}
+			continue
+		}
+
+		var info oidc.UserInfo
+		_ = json.NewDecoder(rr.Body).Decode(&info)
+		if info.Subject != "1" || info.Email != "admin@example.com" || info.GivenName != "Admin" {
+			t.Errorf("%s: wrong user info %+v", e.name, info)
+		}
+	}
+}
+
+func Test_app_oauthIntrospectAndRevoke(t *testing.T) {
+	secret := insertOAuthClient(t, "server", false)
+	otherSecret := insertOAuthClient(t, "other-server", false)
+	insertOAuthClient(t, "spa", true)
+
+	// exchange a code of the confidential client
+	rr := postOAuthForm(t, app.oauthToken, "server", secret, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {insertAuthCode(t, "server", time.Now().Add(time.Minute))},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testVerifier},
+	})
+	var tokens oauthTokenResponse
+	_ = json.NewDecoder(rr.Body).Decode(&tokens)
+
+	introspect := func(clientID, secret string) (int, oauthIntrospection) {
+		rr := postOAuthForm(t, app.oauthIntrospect, clientID, secret, url.Values{"token": {tokens.AccessToken}, "client_id": {clientID}})
+		var answer oauthIntrospection
+		_ = json.NewDecoder(rr.Body).Decode(&answer)
+		return rr.Code, answer
+	}
+
+	status, answer := introspect("server", secret)
+	if status != http.StatusOK || !answer.Active || answer.Subject != "1" || answer.ClientID != "server" || answer.Scope != "openid profile email" {
+		t.Errorf("expected the token to be active, got %d %+v", status, answer)
+	}
+	if _, answer := introspect("other-server", otherSecret); answer.Active {
+		t.Error("a token should look inactive to other clients")
+	}
+	if status, _ := introspect("spa", ""); status != http.StatusUnauthorized {
+		t.Errorf("public clients cannot introspect, got %d", status)
+	}
+
+	// other clients cannot revoke the token, and are not told so
+	rr = postOAuthForm(t, app.oauthRevoke, "other-server", otherSecret, url.Values{"token": {tokens.AccessToken}})
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected revoking with another client to look fine, got %d", rr.Code)
+	}
+	if _, answer := introspect("server", secret); !answer.Active {
+		t.Error("another client revoked the token")
+	}
+
+	rr = postOAuthForm(t, app.oauthRevoke, "server", secret, url.Values{"token": {tokens.AccessToken}})
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the token to be revoked, got %d", rr.Code)
+	}
+	if _, answer := introspect("server", secret); answer.Active {
+		t.Error("expected a revoked token to be inactive")
+	}
+
+	// revoking again, or an unknown token, is fine too
+	rr = postOAuthForm(t, app.oauthRevoke, "server", secret, url.Values{"token": {tokens.AccessToken}})
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected revoking a revoked token to succeed, got %d", rr.Code)
+	}
+	rr = postOAuthForm(t, app.oauthRevoke, "server", "guess", url.Values{"token": {tokens.AccessToken}})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected a wrong secret to be refused, got %d", rr.Code)
+	}
+}
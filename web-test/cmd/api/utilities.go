@@ -5,6 +5,10 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"strings"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
+	"webapp/pkg/logging"
 )
 
 func (app *application) writeJSON(w http.ResponseWriter, status int, data interface{}, wrap ...string) error {
@@ -42,23 +46,81 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data interf
 	return nil
 }
 
+// Error codes the api answers with. Clients should go by the code, which
+// stays the same, rather than by the message, which is translated.
+const (
+	codeBadRequest       = "bad_request"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeRefreshTooEarly  = "refresh_too_early"
+	codeUnknownUser      = "unknown_user"
+	codeValidationFailed = "validation_failed"
+	codeInternal         = "internal"
+)
+
+type jsonError struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Fields  map[string][]string `json:"fields,omitempty"`
+}
+
+// errorJSON answers with err as the message, and a code derived from the
+// status, e.g. "bad_request". Meant for errors without a code of their own,
+// such as a body which is not valid JSON.
 func (app *application) errorJSON(w http.ResponseWriter, err error, status ...int) {
 	statusCode := http.StatusBadRequest
 	if len(status) > 0 {
 		statusCode = status[0]
 	}
 
-	type jsonError struct {
-		Message string `json:"message"`
-	}
-
 	theError := jsonError{
+		Code:    strings.ReplaceAll(strings.ToLower(http.StatusText(statusCode)), " ", "_"),
 		Message: err.Error(),
 	}
 
 	_ = app.writeJSON(w, statusCode, theError, "error")
 }
 
+// codeErrorJSON answers with the error code, and its message in the language
+// of the request: {"error": {"code": "unauthorized", "message": "..."}}.
+func (app *application) codeErrorJSON(w http.ResponseWriter, r *http.Request, status int, code string) {
+	theError := jsonError{
+		Code:    code,
+		Message: i18n.T(r.Context(), "error."+code),
+	}
+
+	_ = app.writeJSON(w, status, theError, "error")
+}
+
+// validationErrorJSON answers 422 with the errors of form, by field:
+// {"error": {"code": "validation_failed", "message": "...", "fields": {"email": ["..."]}}}.
+func (app *application) validationErrorJSON(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	theError := jsonError{
+		Code:    codeValidationFailed,
+		Message: i18n.T(r.Context(), "error."+codeValidationFailed),
+		Fields:  form.Errors,
+	}
+
+	_ = app.writeJSON(w, http.StatusUnprocessableEntity, theError, "error")
+}
+
+// forbiddenFieldsJSON answers 403 with the fields the client may not set:
+// {"error": {"code": "forbidden", "message": "...", "fields": {"is_admin": ["..."]}}}.
+func (app *application) forbiddenFieldsJSON(w http.ResponseWriter, r *http.Request, fields []string) {
+	theError := jsonError{
+		Code:    codeForbidden,
+		Message: i18n.T(r.Context(), "error."+codeForbidden),
+		Fields:  make(map[string][]string),
+	}
+	for _, field := range fields {
+		theError.Fields[field] = []string{i18n.T(r.Context(), "error.field_forbidden")}
+	}
+
+	_ = app.writeJSON(w, http.StatusForbidden, theError, "error")
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	maxBytes := 1024 * 1024 // one megabyte
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
@@ -79,3 +141,9 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data in
 
 	return nil
 }
+
+// logError logs err together with the id of the request that caused it, so
+// that a failed response can be matched with its cause.
+func (app *application) logError(r *http.Request, msg string, err error) {
+	logging.FromContext(r.Context(), app.Logger).Error(msg, "error", err)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/golang-jwt/jwt/v4"
 	"log"
+	"os"
 	"time"
 )
 
@@ -20,9 +21,12 @@ type application struct {
 
 func main() {
 	var app application
-	flag.StringVar(&app.JWTSecret, "jwt-secret", "2dce505d96a53c5768052ee90f3df2055657518dad489160df9913f66042e160", "secret")
+	flag.StringVar(&app.JWTSecret, "jwt-secret", os.Getenv("JWT_SECRET"), "secret, the api's JWT_SECRET by default")
 	flag.StringVar(&app.Action, "action", "valid", "action: valid|expired")
 	flag.Parse()
+	if app.JWTSecret == "" {
+		log.Fatal("set JWT_SECRET or -jwt-secret to the secret of the api")
+	}
 
 	// generate a token
 	token := jwt.New(jwt.SigningMethodHS256)
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"webapp/pkg/data"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// adminPageSize is the number of users listed per page.
+const adminPageSize = 20
+
+// minPasswordLength is the shortest password an admin may set.
+const minPasswordLength = 8
+
+// maxNameLength is the longest name or email address a user may have.
+const maxNameLength = 255
+
+// AdminUsers lists users, optionally filtered by a search for q, a page at a time.
+func (app *application) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	users, total, err := app.DB.SearchUsers(q, page, adminPageSize)
+	if err != nil {
+		app.serverError(w, r, "could not list users", err)
+		return
+	}
+
+	pages := (total + adminPageSize - 1) / adminPageSize
+	td := map[string]any{
+		"users": users,
+		"q":     q,
+		"page":  page,
+		"pages": pages,
+		"total": total,
+	}
+	if page > 1 {
+		td["prev"] = page - 1
+	}
+	if page < pages {
+		td["next"] = page + 1
+	}
+
+	_ = app.render(w, r, "admin-users.page.gohtml", &TemplateData{Data: td})
+}
+
+// AdminNewUser shows the form to create a user.
+func (app *application) AdminNewUser(w http.ResponseWriter, r *http.Request) {
+	_ = app.render(w, r, "admin-user.page.gohtml", &TemplateData{Form: forms.New(url.Values{})})
+}
+
+// AdminCreateUser creates a user from the new user form.
+func (app *application) AdminCreateUser(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := newForm(r, r.PostForm)
+	app.validateUserForm(form, 0)
+	app.validatePasswordForm(form)
+
+	if !form.Valid() {
+		_ = app.renderWithStatus(w, r, http.StatusUnprocessableEntity, "admin-user.page.gohtml", &TemplateData{Form: form})
+		return
+	}
+
+	user := data.User{
+		FirstName: strings.TrimSpace(form.Data.Get("first_name")),
+		LastName:  strings.TrimSpace(form.Data.Get("last_name")),
+		Email:     strings.TrimSpace(form.Data.Get("email")),
+		Password:  form.Data.Get("password"),
+	}
+	if form.Has("is_admin") {
+		user.IsAdmin = 1
+	}
+
+	id, err := app.DB.InsertUser(user)
+	if err != nil {
+		app.serverError(w, r, "could not create user", err)
+		return
+	}
+
+	app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.user_created"))
+	http.Redirect(w, r, "/admin/users/"+strconv.Itoa(id), http.StatusSeeOther)
+}
+
+// AdminEditUser shows the form to edit a user, and the actions available on them.
+func (app *application) AdminEditUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	_ = app.render(w, r, "admin-user.page.gohtml", &TemplateData{Form: userForm(user), Data: map[string]any{"user": user}})
+}
+
+// AdminUpdateUser saves the name and email of a user.
+func (app *application) AdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := newForm(r, r.PostForm)
+	app.validateUserForm(form, user.ID)
+
+	if !form.Valid() {
+		_ = app.renderWithStatus(w, r, http.StatusUnprocessableEntity, "admin-user.page.gohtml", &TemplateData{Form: form, Data: map[string]any{"user": user}})
+		return
+	}
+
+	user.FirstName = strings.TrimSpace(form.Data.Get("first_name"))
+	user.LastName = strings.TrimSpace(form.Data.Get("last_name"))
+	user.Email = strings.TrimSpace(form.Data.Get("email"))
+
+	app.saveAdminChange(w, r, user, i18n.T(r.Context(), "flash.user_updated"))
+}
+
+// AdminResetPassword sets a new password for a user, and logs them out everywhere else.
+func (app *application) AdminResetPassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := newForm(r, r.PostForm)
+	app.validatePasswordForm(form)
+
+	if !form.Valid() {
+		// show the errors next to the password fields of the edit page
+		editForm := userForm(user)
+		editForm.Errors = form.Errors
+		_ = app.renderWithStatus(w, r, http.StatusUnprocessableEntity, "admin-user.page.gohtml", &TemplateData{Form: editForm, Data: map[string]any{"user": user}})
+		return
+	}
+
+	if err := app.DB.ResetPassword(user.ID, form.Data.Get("password")); err != nil {
+		app.serverError(w, r, "could not reset password", err)
+		return
+	}
+
+	if err := app.revokeUserSessions(r.Context(), user.ID, app.Session.Token(r.Context())); err != nil {
+		app.logError(r, "could not revoke sessions after password reset", err)
+	}
+
+	app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.password_reset"))
+	http.Redirect(w, r, adminUserURL(user.ID), http.StatusSeeOther)
+}
+
+// AdminPromoteUser makes a user an admin.
+func (app *application) AdminPromoteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	user.IsAdmin = 1
+	app.saveAdminChange(w, r, user, i18n.T(r.Context(), "flash.user_promoted"))
+}
+
+// AdminDemoteUser takes admin rights away from a user. Admins cannot demote
+// themselves, so there is always someone left to manage users.
+func (app *application) AdminDemoteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.ID == app.currentUser(r).ID {
+		app.flash(r.Context(), FlashError, i18n.T(r.Context(), "flash.cannot_demote_self"))
+		http.Redirect(w, r, adminUserURL(user.ID), http.StatusSeeOther)
+		return
+	}
+
+	user.IsAdmin = 0
+	app.saveAdminChange(w, r, user, i18n.T(r.Context(), "flash.user_demoted"))
+}
+
+// AdminDeleteUser deletes a user and ends their sessions.
+func (app *application) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.ID == app.currentUser(r).ID {
+		app.flash(r.Context(), FlashError, i18n.T(r.Context(), "flash.cannot_delete_self"))
+		http.Redirect(w, r, adminUserURL(user.ID), http.StatusSeeOther)
+		return
+	}
+
+	if err := app.revokeUserSessions(r.Context(), user.ID, ""); err != nil {
+		app.logError(r, "could not revoke sessions of deleted user", err)
+	}
+
+	if err := app.DB.DeleteUser(user.ID); err != nil {
+		app.serverError(w, r, "could not delete user", err)
+		return
+	}
+	app.UserCache.forget(user.ID)
+
+	app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.user_deleted"))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// saveAdminChange stores user, and makes sure their next request sees the change.
+func (app *application) saveAdminChange(w http.ResponseWriter, r *http.Request, user *data.User, flash string) {
+	if err := app.DB.UpdateUser(*user); err != nil {
+		app.serverError(w, r, "could not update user", err)
+		return
+	}
+	app.UserCache.forget(user.ID)
+
+	app.flash(r.Context(), FlashSuccess, flash)
+	http.Redirect(w, r, adminUserURL(user.ID), http.StatusSeeOther)
+}
+
+// adminTargetUser loads the user named in the URL, answering 404 if there is none.
+func (app *application) adminTargetUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	user, err := app.DB.GetUser(id)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		app.serverError(w, r, "could not load user", err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// validateUserForm checks the name and email fields. The email must not
+// belong to anyone but the user with id.
+func (app *application) validateUserForm(form *forms.Form, id int) {
+	form.Required("first_name", "last_name", "email")
+	form.MaxLength("first_name", maxNameLength)
+	form.MaxLength("last_name", maxNameLength)
+	form.MaxLength("email", maxNameLength)
+	form.Email("email")
+	form.Unique("email", func(email string) bool {
+		existing, err := app.DB.GetUserByEmail(email)
+		return err == nil && existing.ID != id
+	})
+}
+
+// validatePasswordForm checks the password and its confirmation.
+func (app *application) validatePasswordForm(form *forms.Form) {
+	form.Required("password")
+	form.MinLength("password", minPasswordLength)
+	form.Equal("password_confirm", "password")
+}
+
+// userForm returns the edit form filled in with the details of user.
+func userForm(user *data.User) *forms.Form {
+	return forms.New(url.Values{
+		"first_name": {user.FirstName},
+		"last_name":  {user.LastName},
+		"email":      {user.Email},
+	})
+}
+
+func adminUserURL(id int) string {
+	return "/admin/users/" + strconv.Itoa(id)
+}
+
+// revokeUserSessions ends every session of a user, except the one with the
+// token except.
+func (app *application) revokeUserSessions(ctx context.Context, userID int, except string) error {
+	sessions, err := app.SessionStore.UserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		if s.Token == except {
+			continue
+		}
+		if err := app.SessionStore.DeleteCtx(ctx, s.Token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
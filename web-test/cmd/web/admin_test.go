@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func Test_app_adminPages(t *testing.T) {
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	admin := loggedInClient(t, ts)
+	user := loggedInClientAs(t, ts, "user@example.com")
+
+	var tests = []struct {
+		name           string
+		client         *http.Client
+		page           string
+		expectedStatus int
+	}{
+		{"list", admin, "/admin/users", http.StatusOK},
+		{"search", admin, "/admin/users?q=regular&page=1", http.StatusOK},
+		{"new", admin, "/admin/users/new", http.StatusOK},
+		{"edit", admin, "/admin/users/2", http.StatusOK},
+		{"unknown user", admin, "/admin/users/99", http.StatusNotFound},
+		{"not an admin", user, "/admin/users", http.StatusForbidden},
+		{"not logged in", ts.Client(), "/admin/users", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		if status := getStatus(t, e.client, ts.URL+e.page); status != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, status)
+		}
+	}
+}
+
+func Test_app_adminActions(t *testing.T) {
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	admin := loggedInClient(t, ts)
+
+	var tests = []struct {
+		name             string
+		page             string
+		form             url.Values
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"create", "/admin/users", url.Values{
+			"first_name": {"New"}, "last_name": {"User"}, "email": {"new@example.com"},
+			"password": {"password"}, "password_confirm": {"password"},
+		}, http.StatusSeeOther, "/admin/users/1"},
+		{"create invalid", "/admin/users", url.Values{"email": {"admin@example.com"}, "password": {"short"}}, http.StatusUnprocessableEntity, ""},
+		{"update", "/admin/users/2", url.Values{"first_name": {"Regular"}, "last_name": {"User"}, "email": {"user@example.com"}}, http.StatusSeeOther, "/admin/users/2"},
+		{"update taken email", "/admin/users/2", url.Values{"first_name": {"Regular"}, "last_name": {"User"}, "email": {"admin@example.com"}}, http.StatusUnprocessableEntity, ""},
+		{"reset password", "/admin/users/2/password", url.Values{"password": {"password"}, "password_confirm": {"password"}}, http.StatusSeeOther, "/admin/users/2"},
+		{"reset password mismatch", "/admin/users/2/password", url.Values{"password": {"password"}, "password_confirm": {"other"}}, http.StatusUnprocessableEntity, ""},
+		{"promote", "/admin/users/2/promote", url.Values{}, http.StatusSeeOther, "/admin/users/2"},
+		{"demote self", "/admin/users/1/demote", url.Values{}, http.StatusSeeOther, "/admin/users/1"},
+		{"delete self", "/admin/users/1/delete", url.Values{}, http.StatusSeeOther, "/admin/users/1"},
+		{"delete", "/admin/users/2/delete", url.Values{}, http.StatusSeeOther, "/admin/users"},
+		{"unknown user", "/admin/users/99/promote", url.Values{}, http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		e.form.Set("csrf_token", csrfTokenFrom(t, admin, ts.URL+"/admin/users/new"))
+
+		resp, err := admin.PostForm(ts.URL+e.page, e.form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, resp.StatusCode)
+		}
+		if e.expectedLocation != "" && resp.Header.Get("Location") != e.expectedLocation {
+			t.Errorf("%s: expected redirect to %s but got %s", e.name, e.expectedLocation, resp.Header.Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"webapp/pkg/data"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminClients lists the applications registered to log users in with the
+// OpenID Connect provider, and the form to register one.
+func (app *application) AdminClients(w http.ResponseWriter, r *http.Request) {
+	app.renderClients(w, r, http.StatusOK, &TemplateData{Form: forms.New(url.Values{})})
+}
+
+// renderClients renders the client list with td.
+func (app *application) renderClients(w http.ResponseWriter, r *http.Request, status int, td *TemplateData) {
+	clients, err := app.DB.AllOAuthClients()
+	if err != nil {
+		app.serverError(w, r, "could not list oauth clients", err)
+		return
+	}
+
+	if td.Data == nil {
+		td.Data = map[string]any{}
+	}
+	td.Data["clients"] = clients
+
+	_ = app.renderWithStatus(w, r, status, "admin-clients.page.gohtml", td)
+}
+
+// AdminCreateClient registers a client, and shows its id and secret. Like
+// API keys, the secret is only shown this once.
+func (app *application) AdminCreateClient(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := newForm(r, r.PostForm)
+	form.Required("name", "redirect_uris")
+	form.MaxLength("name", maxNameLength)
+
+	uris := strings.Fields(form.Value("redirect_uris"))
+	for _, uri := range uris {
+		if !validRedirectURI(uri) {
+			form.Errors.Add("redirect_uris", i18n.T(r.Context(), "admin.invalid_redirect_uri", uri))
+			break
+		}
+	}
+
+	if !form.Valid() {
+		app.renderClients(w, r, http.StatusUnprocessableEntity, &TemplateData{Form: form})
+		return
+	}
+
+	client, secret, err := data.NewOAuthClient(strings.TrimSpace(form.Value("name")), uris, form.Has("public"))
+	if err == nil {
+		err = app.DB.InsertOAuthClient(client)
+	}
+	if err != nil {
+		app.serverError(w, r, "could not create oauth client", err)
+		return
+	}
+
+	// the page holds the secret, so it must not be kept by the browser
+	w.Header().Set("Cache-Control", "no-store")
+	app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.client_created"))
+	app.renderClients(w, r, http.StatusOK, &TemplateData{
+		Form: forms.New(url.Values{}),
+		Data: map[string]any{"new_client": client, "new_client_secret": secret},
+	})
+}
+
+// AdminDeleteClient removes a client, with the codes and tokens issued to
+// it.
+func (app *application) AdminDeleteClient(w http.ResponseWriter, r *http.Request) {
+	err := app.DB.DeleteOAuthClient(chi.URLParam(r, "clientID"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, "could not delete oauth client", err)
+		return
+	}
+
+	app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.client_deleted"))
+	http.Redirect(w, r, "/admin/clients", http.StatusSeeOther)
+}
+
+// validRedirectURI reports whether uri can be registered as a redirect uri:
+// an absolute http or https url without a fragment, as OAuth 2.0 asks.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" || strings.Contains(uri, "#") {
+		return false
+	}
+	return u.Scheme == "https" || u.Scheme == "http"
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/oidc"
+)
+
+// apiKeyLifetimes are the lifetimes, in days, users can choose between for
+// a new API key.
+var apiKeyLifetimes = []int{30, data.DefaultAPIKeyDays, data.MaxAPIKeyDays}
+
+// renderProfile renders the profile page with the API keys of the logged
+// in user, the form to create one, their passkeys, and the external
+// accounts linked.
+func (app *application) renderProfile(w http.ResponseWriter, r *http.Request, status int, td *TemplateData) {
+	keys, err := app.DB.UserAPIKeys(app.sessionUserID(r))
+	if err != nil {
+		app.logError(r, "could not list api keys", err)
+		http.Error(w, "could not list api keys", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	var rows []map[string]any
+	for _, k := range keys {
+		rows = append(rows, map[string]any{
+			"ID":         k.ID,
+			"Name":       k.Name,
+			"Prefix":     k.Prefix,
+			"Scopes":     k.Scopes,
+			"ExpiresAt":  k.ExpiresAt,
+			"Expired":    k.Expired(now),
+			"LastUsedAt": k.LastUsedAt,
+		})
+	}
+
+	// the scopes of a form sent back with errors stay checked; a new form
+	// starts with only read
+	checked := []string{data.ScopeRead}
+	if td.Form != nil {
+		checked = td.Form.Data["scopes"]
+	}
+	var scopes []map[string]any
+	for _, s := range data.APIKeyScopes {
+		scopes = append(scopes, map[string]any{"Name": s, "Checked": slices.Contains(checked, s)})
+	}
+
+	// the external accounts the user linked; the label of a provider no
+	// longer configured is its name
+	identities, err := app.DB.UserIdentities(app.sessionUserID(r))
+	if err != nil {
+		app.logError(r, "could not list user identities", err)
+		http.Error(w, "could not list user identities", http.StatusInternalServerError)
+		return
+	}
+	var linked []map[string]any
+	for _, i := range identities {
+		label := i.Provider
+		if p := oidc.FindProvider(app.IdentityProviders, i.Provider); p != nil {
+			label = p.Label
+		}
+		linked = append(linked, map[string]any{"Label": label, "Email": i.Email, "CreatedAt": i.CreatedAt})
+	}
+	// and the providers they can still link an account of
+	var linkable []*oidc.Provider
+	for _, p := range app.IdentityProviders {
+		if !slices.ContainsFunc(identities, func(i data.UserIdentity) bool { return i.Provider == p.Name }) {
+			linkable = append(linkable, p)
+		}
+	}
+
+	passkeys, err := app.DB.UserPasskeys(app.sessionUserID(r))
+	if err != nil {
+		app.logError(r, "could not list passkeys", err)
+		http.Error(w, "could not list passkeys", http.StatusInternalServerError)
+		return
+	}
+
+	if td.Data == nil {
+		td.Data = map[string]any{}
+	}
+	td.Data["identities"] = linked
+	td.Data["linkable_providers"] = linkable
+	td.Data["passkeys"] = passkeys
+	td.Data["api_keys"] = rows
+	td.Data["api_key_scopes"] = scopes
+	td.Data["api_key_lifetimes"] = apiKeyLifetimes
+	td.Data["default_api_key_lifetime"] = data.DefaultAPIKeyDays
+
+	_ = app.renderWithStatus(w, r, status, "profile.page.gohtml", td)
+}
+
+// CreateAPIKey creates an API key for the logged in user, and shows the
+// profile page with the key. The page is not redirected to, since the key
+// is only shown this once; it is never stored, so it cannot be shown again.
+func (app *application) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.logError(r, "could not parse api key form", err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := newForm(r, r.PostForm)
+	form.Required("name", "scopes", "expires_in_days")
+	form.MaxLength("name", 255)
+	form.OneOf("scopes", data.APIKeyScopes...)
+	form.Range("expires_in_days", 1, data.MaxAPIKeyDays)
+	if !form.Valid() {
+		app.renderProfile(w, r, http.StatusUnprocessableEntity, &TemplateData{Form: form})
+		return
+	}
+
+	days, _ := strconv.Atoi(form.Value("expires_in_days"))
+	expiresAt := time.Now().AddDate(0, 0, days).UTC().Truncate(time.Second)
+	key, k, err := data.NewAPIKey(app.sessionUserID(r), strings.TrimSpace(form.Value("name")), r.PostForm["scopes"], expiresAt)
+	if err == nil {
+		_, err = app.DB.InsertAPIKey(k)
+	}
+	if err != nil {
+		app.serverError(w, r, "could not create api key", err)
+		return
+	}
+
+	// the page holds the key, so it must not be kept by the browser
+	w.Header().Set("Cache-Control", "no-store")
+	app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.api_key_created"))
+	app.renderProfile(w, r, http.StatusOK, &TemplateData{Data: map[string]any{"new_api_key": key}})
+}
+
+// RevokeAPIKey deletes one of the API keys of the logged in user, so it can
+// no longer be used. The form names the key by its id.
+func (app *application) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PostFormValue("key"))
+	if err == nil {
+		err = app.DB.DeleteAPIKey(app.sessionUserID(r), id)
+	}
+
+	var numErr *strconv.NumError
+	switch {
+	case errors.As(err, &numErr), errors.Is(err, sql.ErrNoRows):
+		app.flash(r.Context(), FlashWarning, i18n.T(r.Context(), "flash.no_api_key_revoked"))
+	case err != nil:
+		app.serverError(w, r, "could not revoke api key", err)
+		return
+	default:
+		app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.api_key_revoked"))
+	}
+
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func Test_app_apiKeys(t *testing.T) {
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	client := loggedInClient(t, ts)
+
+	var tests = []struct {
+		name           string
+		form           url.Values
+		expectedStatus int
+		expectKey      bool
+	}{
+		{"create", url.Values{"name": {"backup"}, "scopes": {"read", "write"}, "expires_in_days": {"30"}}, http.StatusOK, true},
+		{"no name", url.Values{"scopes": {"read"}, "expires_in_days": {"30"}}, http.StatusUnprocessableEntity, false},
+		{"no scopes", url.Values{"name": {"backup"}, "expires_in_days": {"30"}}, http.StatusUnprocessableEntity, false},
+		{"unknown scope", url.Values{"name": {"backup"}, "scopes": {"read", "admin"}, "expires_in_days": {"30"}}, http.StatusUnprocessableEntity, false},
+		{"too long", url.Values{"name": {"backup"}, "scopes": {"read"}, "expires_in_days": {"1000"}}, http.StatusUnprocessableEntity, false},
+	}
+
+	keyPattern := regexp.MustCompile(`wtk_([0-9a-f]{12})_[A-Za-z0-9_-]+`)
+	var created []string
+
+	for _, e := range tests {
+		e.form.Set("csrf_token", csrfTokenFrom(t, client, ts.URL+"/user/profile"))
+		resp, err := client.PostForm(ts.URL+"/user/api-keys", e.form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, resp.StatusCode)
+			continue
+		}
+
+		key := keyPattern.FindStringSubmatch(string(body))
+		if e.expectKey != (key != nil) {
+			t.Errorf("%s: expected the key shown to be %v, got %v", e.name, e.expectKey, key)
+		}
+		if key != nil {
+			created = append(created, key[1])
+			if resp.Header.Get("Cache-Control") != "no-store" {
+				t.Errorf("%s: the page with the key should not be cached", e.name)
+			}
+		}
+	}
+
+	// the key is listed by its prefix, and is not shown again
+	page := getBody(t, client, ts.URL+"/user/profile")
+	if len(created) != 1 || !strings.Contains(page, "wtk_"+created[0]) {
+		t.Fatalf("expected the new key to be listed, created %v", created)
+	}
+	if keyPattern.MatchString(page) {
+		t.Error("the key should only be shown when it is created")
+	}
+
+	ids := regexp.MustCompile(`name="key" value="(\d+)"`).FindAllStringSubmatch(page, -1)
+	if len(ids) != 1 {
+		t.Fatalf("expected one key to revoke, found %d", len(ids))
+	}
+
+	var revokes = []struct {
+		name string
+		key  string
+	}{
+		{"revoke", ids[0][1]},
+		{"revoke again", ids[0][1]},
+		{"revoke bad id", "X"},
+	}
+
+	for _, e := range revokes {
+		resp, err := client.PostForm(ts.URL+"/user/api-keys/revoke", url.Values{
+			"csrf_token": {csrfTokenFrom(t, client, ts.URL+"/user/profile")},
+			"key":        {e.key},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/user/profile" {
+			t.Errorf("%s: expected a redirect to the profile, got %d to %s", e.name, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+
+	if page := getBody(t, client, ts.URL+"/user/profile"); strings.Contains(page, "wtk_"+created[0]) {
+		t.Error("expected the revoked key to be gone")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strings"
+	"webapp/pkg/logging"
+)
+
+const (
+	// csrfSessionKey is where the token of a session is kept.
+	csrfSessionKey = "csrf_token"
+	// csrfFieldName is the name of the hidden form field carrying the token.
+	csrfFieldName = "csrf_token"
+	// csrfHeaderName lets scripts send the token without a form.
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// csrfToken returns the CSRF token of the current session, creating one the
+// first time it is asked for.
+func (app *application) csrfToken(ctx context.Context) string {
+	if token := app.Session.GetString(ctx, csrfSessionKey); token != "" {
+		return token
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	app.Session.Put(ctx, csrfSessionKey, token)
+
+	return token
+}
+
+// csrf rejects requests with unsafe methods unless they carry the token of
+// the session, either in the X-CSRF-Token header or in the csrf_token form
+// field. Multipart forms are parsed with the upload size limit, so handlers
+// reading files afterwards see the same form.
+func (app *application) csrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sent := r.Header.Get(csrfHeaderName)
+		if sent == "" {
+			var err error
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+				err = r.ParseMultipartForm(app.Config.Upload.MaxSize)
+			} else {
+				err = r.ParseForm()
+			}
+			if err != nil {
+				app.logError(r, "could not parse form", err)
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			sent = r.PostFormValue(csrfFieldName)
+		}
+
+		expected := app.Session.GetString(r.Context(), csrfSessionKey)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) != 1 {
+			logging.FromContext(r.Context(), app.Logger).Warn("csrf token mismatch",
+				"method", r.Method, "path", r.URL.Path, "ip", app.ipFromContext(r.Context()))
+			app.Metrics.Counter("csrf_failures_total", "Number of requests rejected for a missing or invalid CSRF token.").Inc()
+			http.Error(w, "invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSRFField renders the hidden input every form posting back to the
+// application must include.
+func (td *TemplateData) CSRFField() template.HTML {
+	return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` + template.HTMLEscapeString(td.CSRFToken) + `">`)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+	"webapp/pkg/data"
+)
+
+const contextCurrentUserKey contextKey = "current_user"
+
+// userCacheSize bounds the number of users kept by a userCache.
+const userCacheSize = 1024
+
+type cachedUser struct {
+	user    *data.User
+	expires time.Time
+}
+
+// userCache keeps recently loaded users for a short while, so pages making
+// several requests do not each hit the database. Changes made through the web
+// application remove the user from the cache straight away; changes made
+// elsewhere show up once the entry expires.
+type userCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	users map[int]cachedUser
+}
+
+func newUserCache(ttl time.Duration) *userCache {
+	return &userCache{ttl: ttl, users: make(map[int]cachedUser)}
+}
+
+func (c *userCache) get(id int) (*data.User, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.users[id]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.user, true
+}
+
+func (c *userCache) put(user *data.User) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.users) >= userCacheSize {
+		for id, entry := range c.users {
+			if now.After(entry.expires) {
+				delete(c.users, id)
+			}
+		}
+	}
+	if len(c.users) >= userCacheSize {
+		// still full of live entries; forget an arbitrary one
+		for id := range c.users {
+			delete(c.users, id)
+			break
+		}
+	}
+
+	c.users[user.ID] = cachedUser{user: user, expires: now.Add(c.ttl)}
+}
+
+// forget drops a user from the cache, so the next request loads it afresh.
+func (c *userCache) forget(id int) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.users, id)
+}
+
+// loadUser puts the user whose id is stored in the session in the request
+// context. A user who no longer exists is logged out.
+func (app *application) loadUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := app.Session.GetInt(r.Context(), data.SessionUserIDKey)
+		if id == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, ok := app.UserCache.get(id)
+		if !ok {
+			var err error
+			user, err = app.DB.GetUser(id)
+			switch {
+			case err == sql.ErrNoRows:
+				_ = app.Session.RenewToken(r.Context())
+				app.Session.Remove(r.Context(), data.SessionUserIDKey)
+				next.ServeHTTP(w, r)
+				return
+			case err != nil:
+				app.logError(r, "could not load the current user", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			app.UserCache.put(user)
+		}
+
+		ctx := context.WithValue(r.Context(), contextCurrentUserKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// currentUser returns the logged in user loaded by loadUser, or nil.
+func (app *application) currentUser(r *http.Request) *data.User {
+	user, _ := r.Context().Value(contextCurrentUserKey).(*data.User)
+	return user
+}
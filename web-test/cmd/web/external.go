@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/oidc"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Users may also log in with an external OpenID Connect provider, such as
+// their company's, once they have linked the identity they have there to
+// their account from their profile. Providers trusted with trust_email link
+// it the first time by the email address they verified. Accounts are not
+// created.
+
+const externalLoginSessionKey = "external_login"
+
+// externalLogin is what the session remembers about a login started at an
+// external provider, to check the user who comes back is the one who left.
+type externalLogin struct {
+	Provider string
+	State    string
+	Nonce    string
+	Verifier string
+	// LinkUserID is the logged in user linking the identity to their
+	// account, rather than logging in with it.
+	LinkUserID int
+}
+
+func init() {
+	gob.Register(externalLogin{})
+}
+
+// ExternalLogin sends the user to log in at the provider in the url.
+func (app *application) ExternalLogin(w http.ResponseWriter, r *http.Request) {
+	app.startExternalLogin(w, r, 0, "/")
+}
+
+// LinkIdentity sends the logged in user to log in at the provider in the
+// url, to link the identity they have there to their account.
+func (app *application) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	app.startExternalLogin(w, r, app.sessionUserID(r), "/user/profile")
+}
+
+// startExternalLogin sends the user to log in at the provider in the url,
+// for linkUserID if they are linking an identity. If the provider cannot be
+// reached they are sent back to failTo.
+func (app *application) startExternalLogin(w http.ResponseWriter, r *http.Request, linkUserID int, failTo string) {
+	p := oidc.FindProvider(app.IdentityProviders, chi.URLParam(r, "provider"))
+	if p == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	login := externalLogin{Provider: p.Name, LinkUserID: linkUserID}
+	var err error
+	for _, s := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		if *s, err = oidc.RandomString(); err != nil {
+			app.serverError(w, r, "could not start external login", err)
+			return
+		}
+	}
+
+	authURL, err := p.AuthURL(r.Context(), p.RedirectURL, login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		app.logError(r, "could not reach identity provider", err)
+		app.flash(r.Context(), FlashError, i18n.T(r.Context(), "flash.external_login_failed", p.Label))
+		http.Redirect(w, r, failTo, http.StatusSeeOther)
+		return
+	}
+
+	app.Session.Put(r.Context(), externalLoginSessionKey, login)
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// ExternalLoginCallback logs in the user the provider sent back, if their
+// identity is linked to an account, or links it to the account of the user
+// who asked to link it.
+func (app *application) ExternalLoginCallback(w http.ResponseWriter, r *http.Request) {
+	p := oidc.FindProvider(app.IdentityProviders, chi.URLParam(r, "provider"))
+	if p == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the login must have been started in this session, at this provider,
+	// and the user must not have cancelled it there
+	q := r.URL.Query()
+	login, ok := app.Session.Pop(r.Context(), externalLoginSessionKey).(externalLogin)
+
+	back := "/"
+	if login.LinkUserID != 0 {
+		back = "/user/profile"
+	}
+	fail := func(key string) {
+		app.flash(r.Context(), FlashError, i18n.T(r.Context(), key, p.Label))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+
+	if !ok || login.Provider != p.Name || q.Get("state") != login.State || q.Get("error") != "" {
+		app.countLogin(r, false)
+		fail("flash.external_login_failed")
+		return
+	}
+
+	claims, err := p.Exchange(r.Context(), q.Get("code"), p.RedirectURL, login.Verifier, login.Nonce)
+	if err != nil {
+		app.logError(r, "could not log in with identity provider", err)
+		app.countLogin(r, false)
+		fail("flash.external_login_failed")
+		return
+	}
+
+	if login.LinkUserID != 0 {
+		app.linkIdentity(w, r, p, claims, login.LinkUserID, fail)
+		return
+	}
+
+	user, err := oidc.UserFor(app.DB, p, claims)
+	if errors.Is(err, oidc.ErrNoAccount) {
+		app.countLogin(r, false)
+		fail("flash.no_linked_account")
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, "could not find user of external identity", err)
+		return
+	}
+
+	app.countLogin(r, true)
+	app.Session.Put(r.Context(), data.SessionUserIDKey, user.ID)
+	app.finishLogin(w, r)
+}
+
+// linkIdentity links the identity in claims to the account of userID, who
+// must still be the one logged in.
+func (app *application) linkIdentity(w http.ResponseWriter, r *http.Request, p *oidc.Provider, claims *oidc.IDTokenClaims, userID int, fail func(key string)) {
+	user := app.currentUser(r)
+	if user == nil || user.ID != userID {
+		fail("flash.external_login_failed")
+		return
+	}
+
+	err := oidc.Link(app.DB, p.Name, claims, user)
+	if errors.Is(err, oidc.ErrIdentityTaken) {
+		fail("flash.identity_taken")
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, "could not link external identity", err)
+		return
+	}
+
+	app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.identity_linked", p.Label))
+	http.Redirect(w, r, "/user/profile#linked-accounts", http.StatusSeeOther)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"webapp/pkg/config"
+	"webapp/pkg/data"
+	"webapp/pkg/oidc"
+	"webapp/pkg/oidc/oidctest"
+	"webapp/pkg/repository/dbrepo"
+)
+
+// providerClient returns a client for ts which keeps cookies and does not
+// follow redirects, as a browser coming back from the provider would.
+func providerClient(ts *httptest.Server) *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Transport: ts.Client().Transport,
+		Jar:       jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// followToProvider sends resp, which should redirect to fake, on to log in
+// there, and returns the response of ts to the user sent back.
+func followToProvider(t *testing.T, client *http.Client, fake *oidctest.Provider, resp *http.Response) *http.Response {
+	t.Helper()
+
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || !strings.HasPrefix(resp.Header.Get("Location"), fake.URL) {
+		t.Fatalf("expected to be sent to the provider, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	resp, err := client.Get(fake.Login(t, resp.Header.Get("Location")).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// useTestDB gives the test a database of its own, so the identities it
+// links are not seen by other tests.
+func useTestDB(t *testing.T) *dbrepo.TestDBRepo {
+	db := app.DB
+	t.Cleanup(func() { app.DB = db })
+
+	testDB := &dbrepo.TestDBRepo{}
+	app.DB = testDB
+	return testDB
+}
+
+func Test_app_externalLogin(t *testing.T) {
+	db := useTestDB(t)
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	fake := oidctest.NewProvider(t)
+	corp := fake.Config("corp", ts.URL+"/login/corp/callback")
+	corp.TrustEmail = true
+	app.IdentityProviders = oidc.NewProviders([]config.IdentityProviderConfig{fake.Config("fake", ts.URL+"/login/fake/callback"), corp})
+	defer func() { app.IdentityProviders = nil }()
+
+	// the admin linked an identity before; the others are new
+	_, _ = db.InsertUserIdentity(data.UserIdentity{UserID: 1, Provider: "fake", Subject: "web-linked", Email: "admin@corp.example"})
+
+	var tests = []struct {
+		name             string
+		provider         string
+		subject          string
+		email            string
+		verified         bool
+		change           func(back *url.URL)
+		expectedLoggedIn bool
+	}{
+		{"linked identity", "fake", "web-linked", "admin@corp.example", true, nil, true},
+		{"linked identity, email changed", "fake", "web-linked", "someone@example.com", false, nil, true},
+		// anyone can type the address of someone else's external account
+		// into their own account here; it must not let that identity in
+		{"verified email of an account", "fake", "", "user@example.com", true, nil, false},
+		{"unverified email", "fake", "", "user@example.com", false, nil, false},
+		{"unknown email", "fake", "", "nobody@example.com", true, nil, false},
+		// unless the provider is trusted with the addresses it verifies
+		{"trusted verified email", "corp", "web-corp", "user@example.com", true, nil, true},
+		{"trusted unverified email", "corp", "", "admin@example.com", false, nil, false},
+		{"wrong state", "fake", "web-linked", "admin@corp.example", true, func(back *url.URL) {
+			q := back.Query()
+			q.Set("state", "guess")
+			back.RawQuery = q.Encode()
+		}, false},
+		{"cancelled", "fake", "web-linked", "admin@corp.example", true, func(back *url.URL) {
+			back.RawQuery = url.Values{"error": {oidc.ErrAccessDenied}, "state": {back.Query().Get("state")}}.Encode()
+		}, false},
+	}
+
+	for i, e := range tests {
+		fake.Subject = e.subject
+		if fake.Subject == "" {
+			fake.Subject = "web-" + string(rune('a'+i))
+		}
+		fake.Email, fake.EmailVerified = e.email, e.verified
+
+		client := providerClient(ts)
+
+		if !strings.Contains(getBody(t, client, ts.URL+"/"), `href="/login/`+e.provider+`"`) {
+			t.Fatal("expected the home page to offer to sign in with the provider")
+		}
+
+		resp, err := client.Get(ts.URL + "/login/" + e.provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther || !strings.HasPrefix(resp.Header.Get("Location"), fake.URL) {
+			t.Fatalf("%s: expected to be sent to the provider, got %d %s", e.name, resp.StatusCode, resp.Header.Get("Location"))
+		}
+
+		back := fake.Login(t, resp.Header.Get("Location"))
+		if e.change != nil {
+			e.change(back)
+		}
+
+		resp, err = client.Get(back.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		expected := "/"
+		if e.expectedLoggedIn {
+			expected = "/user/profile"
+		}
+		if to := resp.Header.Get("Location"); resp.StatusCode != http.StatusSeeOther || to != expected {
+			t.Errorf("%s: expected to be sent to %s, got %d %s", e.name, expected, resp.StatusCode, to)
+		}
+
+		status := getStatus(t, client, ts.URL+"/user/profile")
+		if e.expectedLoggedIn != (status == http.StatusOK) {
+			t.Errorf("%s: expected logged in to be %v, got status %d", e.name, e.expectedLoggedIn, status)
+		}
+		if status == http.StatusOK && !strings.Contains(getBody(t, client, ts.URL+"/user/profile"), "Fake "+e.provider) {
+			t.Errorf("%s: expected the profile to list the linked account", e.name)
+		}
+	}
+
+	if identities, _ := db.UserIdentities(2); len(identities) != 1 || identities[0].Provider != "corp" {
+		t.Errorf("expected only the identity of the trusted provider linked by email, got %+v", identities)
+	}
+
+	// the callback only works once, in the session which started the login
+	client := loggedInClientAs(t, ts, "user@example.com")
+	if status := getStatus(t, client, ts.URL+"/login/fake/callback?code=x&state=y"); status != http.StatusSeeOther {
+		t.Errorf("expected a callback without a login started to be turned away, got %d", status)
+	}
+
+	if status := getStatus(t, client, ts.URL+"/login/unknown"); status != http.StatusNotFound {
+		t.Errorf("expected an unknown provider to be not found, got %d", status)
+	}
+}
+
+func Test_app_linkIdentity(t *testing.T) {
+	db := useTestDB(t)
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	fake := oidctest.NewProvider(t)
+	fake.Subject, fake.Email = "link-user", "user@corp.example"
+	app.IdentityProviders = oidc.NewProviders([]config.IdentityProviderConfig{fake.Config("fake", ts.URL+"/login/fake/callback")})
+	defer func() { app.IdentityProviders = nil }()
+
+	// before linking, the identity logs no one in
+	anonymous := providerClient(ts)
+	resp, err := anonymous.Get(ts.URL + "/login/fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp = followToProvider(t, anonymous, fake, resp); resp.Header.Get("Location") != "/" {
+		t.Errorf("expected an identity not linked to be turned away, got %s", resp.Header.Get("Location"))
+	}
+
+	// only logged in users can link an identity
+	if status := getStatus(t, anonymous, ts.URL+"/user/profile"); status != http.StatusTemporaryRedirect {
+		t.Errorf("expected the profile to ask to log in, got %d", status)
+	}
+
+	client := loggedInClientAs(t, ts, "user@example.com")
+	if !strings.Contains(getBody(t, client, ts.URL+"/user/profile"), `action="/user/identities/fake"`) {
+		t.Fatal("expected the profile to offer to link an account of the provider")
+	}
+
+	resp, err = client.PostForm(ts.URL+"/user/identities/fake", url.Values{"csrf_token": {csrfTokenFrom(t, client, ts.URL+"/user/profile")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp = followToProvider(t, client, fake, resp); resp.Header.Get("Location") != "/user/profile#linked-accounts" {
+		t.Errorf("expected to be sent back to the linked accounts, got %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	identities, _ := db.UserIdentities(2)
+	if len(identities) != 1 || identities[0].Subject != "link-user" {
+		t.Fatalf("expected the identity to be linked, got %+v", identities)
+	}
+	if body := getBody(t, client, ts.URL+"/user/profile"); !strings.Contains(body, "user@corp.example") || strings.Contains(body, `action="/user/identities/fake"`) {
+		t.Error("expected the profile to list the linked account, and not offer to link another")
+	}
+
+	// the identity now logs the user in
+	anonymous = providerClient(ts)
+	resp, err = anonymous.Get(ts.URL + "/login/fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp = followToProvider(t, anonymous, fake, resp); resp.Header.Get("Location") != "/user/profile" {
+		t.Errorf("expected the linked identity to log in, got %s", resp.Header.Get("Location"))
+	}
+	if !strings.Contains(getBody(t, anonymous, ts.URL+"/user/profile"), "user@corp.example") {
+		t.Error("expected to be logged in as the user who linked the identity")
+	}
+
+	// another user cannot take it over
+	admin := loggedInClient(t, ts)
+	resp, err = admin.PostForm(ts.URL+"/user/identities/fake", url.Values{"csrf_token": {csrfTokenFrom(t, admin, ts.URL+"/user/profile")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp = followToProvider(t, admin, fake, resp); resp.Header.Get("Location") != "/user/profile" {
+		t.Errorf("expected linking a taken identity to fail, got %s", resp.Header.Get("Location"))
+	}
+	if !strings.Contains(getBody(t, admin, ts.URL+"/user/profile"), "is linked to another account here") {
+		t.Error("expected to be told the identity is linked to another account")
+	}
+	if identities, _ := db.UserIdentities(1); slices.ContainsFunc(identities, func(i data.UserIdentity) bool { return i.Subject == "link-user" }) {
+		t.Error("expected the identity to stay linked to the user who linked it")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/gob"
+	"net/url"
+	"strings"
+	"webapp/pkg/forms"
+)
+
+// FlashLevel says how a flash message is shown: success, info, warning or
+// error, which is also the suffix of its alert class.
+type FlashLevel string
+
+const (
+	FlashSuccess FlashLevel = "success"
+	FlashInfo    FlashLevel = "info"
+	FlashWarning FlashLevel = "warning"
+	FlashError   FlashLevel = "error"
+)
+
+// Flash is a message shown once, on the next page the user sees.
+type Flash struct {
+	Level   FlashLevel
+	Message string
+}
+
+// AlertClass returns the bootstrap alert class for the level of the message.
+func (f Flash) AlertClass() string {
+	if f.Level == FlashError {
+		return "alert-danger"
+	}
+	return "alert-" + string(f.Level)
+}
+
+const (
+	flashSessionKey = "flashes"
+	formSessionKey  = "form"
+)
+
+// formState is what is kept of a submitted form across a redirect.
+type formState struct {
+	Data   url.Values
+	Errors map[string][]string
+}
+
+func init() {
+	// the session codec stores values as interfaces, so gob needs to know
+	// the types we put there
+	gob.Register([]Flash{})
+	gob.Register(formState{})
+}
+
+// flash queues a message for the next page rendered in this session.
+func (app *application) flash(ctx context.Context, level FlashLevel, message string) {
+	flashes, _ := app.Session.Get(ctx, flashSessionKey).([]Flash)
+	app.Session.Put(ctx, flashSessionKey, append(flashes, Flash{Level: level, Message: message}))
+}
+
+// popFlashes returns the queued messages, and removes them from the session.
+func (app *application) popFlashes(ctx context.Context) []Flash {
+	flashes, _ := app.Session.Pop(ctx, flashSessionKey).([]Flash)
+	return flashes
+}
+
+// keepForm stores the data and errors of form in the session, so the page
+// a failed submission redirects to can show them again. Passwords and the
+// CSRF token are left out.
+func (app *application) keepForm(ctx context.Context, form *forms.Form) {
+	state := formState{Data: url.Values{}, Errors: form.Errors}
+	for field, values := range form.Data {
+		if field == csrfFieldName || strings.Contains(field, "password") {
+			continue
+		}
+		state.Data[field] = values
+	}
+
+	app.Session.Put(ctx, formSessionKey, state)
+}
+
+// popForm returns the form kept by keepForm, if any, and removes it from the
+// session.
+func (app *application) popForm(ctx context.Context) *forms.Form {
+	state, ok := app.Session.Pop(ctx, formSessionKey).(formState)
+	if !ok {
+		return nil
+	}
+
+	form := forms.New(state.Data)
+	form.Errors = state.Errors
+	return form
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"webapp/pkg/forms"
+)
+
+func Test_app_flash(t *testing.T) {
+	req := addContextAndSessionToRequest(httptest.NewRequest("GET", "/", nil), app)
+	ctx := req.Context()
+
+	app.flash(ctx, FlashSuccess, "Saved.")
+	app.flash(ctx, FlashWarning, "Check your email.")
+
+	flashes := app.popFlashes(ctx)
+	if len(flashes) != 2 || flashes[0].Message != "Saved." || flashes[1].Level != FlashWarning {
+		t.Fatalf("expected both messages in order, got %v", flashes)
+	}
+	if flashes[1].AlertClass() != "alert-warning" || (Flash{Level: FlashError}).AlertClass() != "alert-danger" {
+		t.Error("wrong alert class for flash level")
+	}
+	if len(app.popFlashes(ctx)) != 0 {
+		t.Error("flashes should only be shown once")
+	}
+}
+
+func Test_app_keepForm(t *testing.T) {
+	req := addContextAndSessionToRequest(httptest.NewRequest("GET", "/", nil), app)
+	ctx := req.Context()
+
+	form := forms.New(url.Values{
+		"email":            {"me@here.com"},
+		"password":         {"secret"},
+		"password_confirm": {"secret"},
+		csrfFieldName:      {"token"},
+	})
+	form.Errors.Add("email", "This email address is already in use")
+	app.keepForm(ctx, form)
+
+	kept := app.popForm(ctx)
+	if kept == nil {
+		t.Fatal("expected the form to be kept")
+	}
+	if kept.Value("email") != "me@here.com" || !kept.Invalid("email") {
+		t.Error("expected the email and its error to be kept")
+	}
+	for _, field := range []string{"password", "password_confirm", csrfFieldName} {
+		if kept.Has(field) {
+			t.Errorf("%s should not be kept", field)
+		}
+	}
+	if app.popForm(ctx) != nil {
+		t.Error("a kept form should only be shown once")
+	}
+}
+
+func Test_app_LoginKeepsForm(t *testing.T) {
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	// a wrong password and an unknown email look the same, so the page does
+	// not tell which accounts exist
+	for _, email := range []string{"admin@example.com", "nobody@example.com"} {
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Transport: ts.Client().Transport, Jar: jar}
+
+		resp, err := client.PostForm(ts.URL+"/login", url.Values{
+			"email":      {email},
+			"password":   {"wrong"},
+			"csrf_token": {csrfTokenFrom(t, client, ts.URL+"/")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		page := string(body)
+
+		for _, expected := range []string{`value="` + email + `"`, "Invalid login!", "alert-danger"} {
+			if !strings.Contains(page, expected) {
+				t.Errorf("%s: expected %q on the page after a failed login", email, expected)
+			}
+		}
+		for _, unexpected := range []string{`value="wrong"`, "Wrong password", "is-invalid"} {
+			if strings.Contains(page, unexpected) {
+				t.Errorf("%s: did not expect %q on the page after a failed login", email, unexpected)
+			}
+		}
+	}
+}
@@ -2,18 +2,16 @@ package main
 
 import (
 	"fmt"
-	"html/template"
-	"io"
-	"log"
 	"net/http"
-	"os"
-	"path"
-	"path/filepath"
+	"strings"
 	"time"
 	"webapp/pkg/data"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
+	"webapp/pkg/logging"
+	"webapp/pkg/uploads"
 )
 
-var pathToTemplates = "./templates/"
 var uploadPath = "./static/img"
 
 func (app *application) Home(w http.ResponseWriter, r *http.Request) {
@@ -25,63 +23,33 @@ func (app *application) Home(w http.ResponseWriter, r *http.Request) {
 	} else {
 		app.Session.Put(r.Context(), "test", "Hit this page at "+time.Now().UTC().String())
 	}
+	td["identity_providers"] = app.IdentityProviders
 	_ = app.render(w, r, "home.page.gohtml", &TemplateData{Data: td})
 }
 
 func (app *application) Profile(w http.ResponseWriter, r *http.Request) {
 
-	_ = app.render(w, r, "profile.page.gohtml", &TemplateData{})
-}
-
-type TemplateData struct {
-	IP    string
-	Data  map[string]any
-	Error string
-	Flash string
-	User  data.User
-}
-
-func (app *application) render(w http.ResponseWriter, r *http.Request, t string, td *TemplateData) error {
-	// parse the template from disk.
-	parsedTemplate, err := template.ParseFiles(path.Join(pathToTemplates, t), path.Join(pathToTemplates, "base.layout.gohtml"))
-	if err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
-		return err
-	}
-
-	td.IP = app.ipFromContext(r.Context())
-
-	td.Error = app.Session.PopString(r.Context(), "error")
-	td.Flash = app.Session.PopString(r.Context(), "flash")
-
-	if app.Session.Exists(r.Context(), "user") {
-		td.User = app.Session.Get(r.Context(), "user").(data.User)
-	}
-
-	// execute the template, passing it data, if any
-	err = parsedTemplate.Execute(w, td)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	app.renderProfile(w, r, http.StatusOK, &TemplateData{})
 }
 
 func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		log.Println(err)
+		app.logError(r, "could not parse login form", err)
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
 	// validate data
-	form := NewForm(r.PostForm)
+	form := newForm(r, r.PostForm)
 	form.Required("email", "password")
 
 	if !form.Valid() {
-		// redirect to the login page with error message
-		app.Session.Put(r.Context(), "error", "Invalid login credentials")
+		app.countLogin(r, false)
+		// redirect to the login page with error message, and show what
+		// was typed and which fields are missing
+		app.flash(r.Context(), FlashError, i18n.T(r.Context(), "flash.invalid_credentials"))
+		app.keepForm(r.Context(), form)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -89,26 +57,52 @@ func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 	email := r.Form.Get("email")
 	password := r.Form.Get("password")
 
+	// an unknown email and a wrong password get the same answer, in the
+	// same time, so the page does not tell which accounts exist
 	user, err := app.DB.GetUserByEmail(email)
 	if err != nil {
-		// redirect to the login page with error message
-		app.Session.Put(r.Context(), "error", "Invalid login!")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		data.ComparePasswordOfNoUser(password)
 	}
-
-	if !app.authenticate(r, user, password) {
-		app.Session.Put(r.Context(), "error", "Invalid login!")
+	if err != nil || !app.authenticate(r, user, password) {
+		app.countLogin(r, false)
+		app.flash(r.Context(), FlashError, i18n.T(r.Context(), "flash.invalid_login"))
+		app.keepForm(r.Context(), form)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	// prevent fixation attack
+	app.countLogin(r, true)
+	app.finishLogin(w, r)
+}
+
+// finishLogin completes the login of the user whose id was just put in the
+// session, whichever way they logged in.
+func (app *application) finishLogin(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, app.startLoggedInSession(r), http.StatusSeeOther)
+}
+
+// startLoggedInSession sets up the session of the user who just logged in,
+// and returns where to send them: the page that asked them to log in first,
+// or the profile.
+func (app *application) startLoggedInSession(r *http.Request) string {
+	// prevent fixation attack, and hand out a fresh CSRF token with the
+	// new session
 	_ = app.Session.RenewToken(r.Context())
+	app.Session.Remove(r.Context(), csrfSessionKey)
+	app.touchSession(r)
 
-	// redirect to some other page
-	app.Session.Put(r.Context(), "flash", "Successfully logged in!")
-	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+	to := app.Session.PopString(r.Context(), returnToSessionKey)
+	if !localPath(to) {
+		to = "/user/profile"
+	}
+	app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.logged_in"))
+	return to
+}
+
+// localPath reports whether to is a path on this site, and not a url
+// browsers would take to another one, such as "//evil.example".
+func localPath(to string) bool {
+	return strings.HasPrefix(to, "/") && !strings.HasPrefix(to, "//") && !strings.HasPrefix(to, "/\\")
 }
 
 func (app *application) authenticate(r *http.Request, user *data.User, password string) bool {
@@ -116,94 +110,59 @@ func (app *application) authenticate(r *http.Request, user *data.User, password
 		return false
 	}
 
-	app.Session.Put(r.Context(), "user", user)
+	app.Session.Put(r.Context(), data.SessionUserIDKey, user.ID)
 	return true
 }
 
 func (app *application) UploadProfilePic(w http.ResponseWriter, r *http.Request) {
-	// call a function that extracts a file from an upload (request)
-	files, err := app.UploadFiles(r, uploadPath)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	maxSize := app.Config.Upload.MaxSize
+	if err := r.ParseMultipartForm(maxSize); err != nil {
+		http.Error(w, fmt.Sprintf("the uploaded file is too big, and must be less than %d bytes", maxSize), http.StatusBadRequest)
 		return
 	}
 
-	// get the user from the session
-	user := app.Session.Get(r.Context(), "user").(data.User)
-
-	// create a var of type data.UserImage
-	var i = data.UserImage{
-		UserID: user.ID,
-		FileName: files[0].OriginalFileName,
-	}
-
-	// insert the user image into user_images
-	_, err = app.DB.InsertUserImage(i)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// only keep images, whatever the browser says the file is
+	form := forms.FromMultipart(r.MultipartForm)
+	form.Messages = i18n.FromContext(r.Context()).FormMessages()
+	uploads.CheckImage(form, "image", maxSize)
+	if !form.Valid() {
+		app.flash(r.Context(), FlashError, form.Errors.Get("image"))
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
 		return
 	}
 
-	// refresh the sessional variable "user"
-	updatedUser, err := app.DB.GetUser(user.ID)
+	// store the picture under a new name, and replace the old one
+	user := *app.currentUser(r)
+	err := uploads.SetProfilePic(app.DB, uploadPath, &user, r.MultipartForm.File["image"][0])
 	if err != nil {
+		app.logError(r, "could not save profile picture", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	app.Session.Put(r.Context(), "user", updatedUser)
+	// make the next request load the user with the new picture
+	app.UserCache.forget(user.ID)
 
 	// redirect back to profile page
 	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
 }
 
-type UploadedFile struct {
-	OriginalFileName string
-	FileSize         int64
-}
+// UploadedFile is a file stored by UploadFiles.
+type UploadedFile = uploads.File
 
+// UploadFiles stores the files uploaded with r in uploadDir, each under a
+// new name.
 func (app *application) UploadFiles(r *http.Request, uploadDir string) ([]*UploadedFile, error) {
-	var uploadedFiles []*UploadedFile
-
-	err := r.ParseMultipartForm(int64(1024 * 1024 * 5))
+	maxSize := app.Config.Upload.MaxSize
+	err := r.ParseMultipartForm(maxSize)
 	if err != nil {
-		return nil, fmt.Errorf("the uploaded file is too big, and must be less than %d bytes", 1024*1024*5)
+		return nil, fmt.Errorf("the uploaded file is too big, and must be less than %d bytes", maxSize)
 	}
 
-	for _, fHeaders := range r.MultipartForm.File {
-		for _, hdr := range fHeaders {
-			uploadedFiles, err = func(uploadedFiles []*UploadedFile) ([]*UploadedFile, error) {
-				var uploadedFile UploadedFile
-				infile, err := hdr.Open()
-				if err != nil {
-					return nil, err
-				}
-				defer infile.Close()
-
-				uploadedFile.OriginalFileName = hdr.Filename
-
-				var outfile *os.File
-				defer outfile.Close()
-
-				if outfile, err = os.Create(filepath.Join(uploadDir, uploadedFile.OriginalFileName)); nil != err {
-					return nil, err
-				} else {
-					fileSize, err := io.Copy(outfile, infile)
-					if err != nil {
-						return nil, err
-					}
-					uploadedFile.FileSize = fileSize
-				}
-
-				uploadedFiles = append(uploadedFiles, &uploadedFile)
-
-				return uploadedFiles, nil
-			}(uploadedFiles)
-			if err != nil {
-				return uploadedFiles, err
-			}
-		}
-	}
+	return uploads.SaveAll(uploadDir, r.MultipartForm.File)
+}
 
-	return uploadedFiles, nil
+// logError logs err together with the id of the request that caused it.
+func (app *application) logError(r *http.Request, msg string, err error) {
+	logging.FromContext(r.Context(), app.Logger).Error(msg, "error", err)
 }
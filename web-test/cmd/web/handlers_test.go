@@ -10,14 +10,19 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"testing"
 	"webapp/pkg/data"
+	"webapp/pkg/render"
+	"webapp/pkg/repository/dbrepo"
 )
 
 func Test_application_handlers(t *testing.T) {
@@ -122,8 +127,12 @@ func TestAppHome(t *testing.T) {
 }
 
 func TestApp_renderWithBadTemplate(t *testing.T) {
-	// set pathToTemplates to a location with a bad template
-	pathToTemplates = "./testdata/"
+	// use templates from a location with a bad template
+	templates := app.Templates
+	app.Templates = render.New(os.DirFS("./testdata/"), render.Options{Reload: true})
+	defer func() {
+		app.Templates = templates
+	}()
 
 	req, _ := http.NewRequest("GET", "/", nil)
 	req = addContextAndSessionToRequest(req, app)
@@ -134,7 +143,9 @@ func TestApp_renderWithBadTemplate(t *testing.T) {
 		t.Error("expected error from bad template, but did not get one")
 	}
 
-	pathToTemplates = "./../../templates/"
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d for a bad template, but got %d", http.StatusInternalServerError, rr.Code)
+	}
 }
 
 func getCtx(req *http.Request) context.Context {
@@ -244,12 +255,15 @@ func Test_app_UploadFiles(t *testing.T) {
 	}
 
 	// perform our tests
-	if _, err := os.Stat(fmt.Sprintf("./testdata/uploads/%s", uploadedFiles[0].OriginalFileName)); os.IsNotExist(err) {
+	if _, err := os.Stat(fmt.Sprintf("./testdata/uploads/%s", uploadedFiles[0].FileName)); os.IsNotExist(err) {
 		t.Errorf("expected file to exist: %s", err.Error())
 	}
+	if uploadedFiles[0].OriginalFileName != "img.png" || !strings.HasSuffix(uploadedFiles[0].FileName, ".png") || uploadedFiles[0].FileName == "img.png" {
+		t.Errorf("expected img.png to be stored under a new name, got %q", uploadedFiles[0].FileName)
+	}
 
 	// clean up
-	_ = os.Remove(fmt.Sprintf("./testdata/uploads/%s", uploadedFiles[0].OriginalFileName))
+	_ = os.Remove(fmt.Sprintf("./testdata/uploads/%s", uploadedFiles[0].FileName))
 
 	wg.Wait()
 }
@@ -286,11 +300,12 @@ func simulatePNGUpload(fileToUpload string, writer *multipart.Writer, t *testing
 }
 
 func Test_app_UploadProfilePic(t *testing.T) {
-	uploadPath = "./testdata/uploads"
+	uploadPath = t.TempDir()
+	defer func() { uploadPath = "./testdata/uploads" }()
 	filePath := "./testdata/img.png"
 
 	// specify a field name for the form
-	fieldName := "file"
+	fieldName := "image"
 
 	// create a bytes.Buffer to act as the request body
 	body := new(bytes.Buffer)
@@ -316,7 +331,7 @@ func Test_app_UploadProfilePic(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodPost, "/upload", body)
 	req = addContextAndSessionToRequest(req, app)
-	app.Session.Put(req.Context(), "user", data.User{ID: 1})
+	req = req.WithContext(context.WithValue(req.Context(), contextCurrentUserKey, &data.User{ID: 1}))
 	req.Header.Add("Content-Type", mw.FormDataContentType())
 
 	rr := httptest.NewRecorder()
@@ -329,5 +344,283 @@ func Test_app_UploadProfilePic(t *testing.T) {
 		t.Errorf("wrong status code")
 	}
 
-	_ = os.Remove("./testdata/uploads/img.png")
-}
\ No newline at end of file
+	user, _ := app.DB.GetUser(1)
+	if _, err := os.Stat(filepath.Join(uploadPath, user.ProfilePic.FileName)); user.ProfilePic.FileName == "" || err != nil {
+		t.Errorf("expected the picture to be saved as %q: %v", user.ProfilePic.FileName, err)
+	}
+	_ = app.DB.DeleteUserImage(1)
+}
+
+func Test_app_UploadProfilePicRejectsNonImages(t *testing.T) {
+	uploadPath = t.TempDir()
+	defer func() { uploadPath = "./testdata/uploads" }()
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	w, _ := mw.CreateFormFile("image", "notes.png")
+	_, _ = w.Write([]byte("just some text, whatever the name says"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req = addContextAndSessionToRequest(req, app)
+	req = req.WithContext(context.WithValue(req.Context(), contextCurrentUserKey, &data.User{ID: 1}))
+	req.Header.Add("Content-Type", mw.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.UploadProfilePic).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("wrong status code %d", rr.Code)
+	}
+	if flashes := app.popFlashes(req.Context()); len(flashes) != 1 || flashes[0].Level != FlashError {
+		t.Errorf("expected an error message, got %v", flashes)
+	}
+	if entries, _ := os.ReadDir(uploadPath); len(entries) != 0 {
+		t.Error("a file which is not an image should not be saved")
+	}
+}
+
+func Test_app_csrf(t *testing.T) {
+	uploadPath = t.TempDir()
+	defer func() { uploadPath = "./testdata/uploads" }()
+
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	// a client which keeps the session cookie, and does not follow redirects
+	jar, _ := cookiejar.New(nil)
+	client := ts.Client()
+	client.Jar = jar
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	token := csrfTokenFrom(t, client, ts.URL+"/")
+
+	login := url.Values{"email": {"admin@example.com"}, "password": {"secret"}}
+
+	// posting the login form without a token is rejected
+	resp, err := client.PostForm(ts.URL+"/login", login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("login without token: expected status %d but got %d", http.StatusForbidden, resp.StatusCode)
+	}
+
+	// and so is a wrong one
+	login.Set("csrf_token", "not-the-token")
+	resp, err = client.PostForm(ts.URL+"/login", login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("login with wrong token: expected status %d but got %d", http.StatusForbidden, resp.StatusCode)
+	}
+
+	// the token rendered in the form lets the login through
+	login.Set("csrf_token", token)
+	resp, err = client.PostForm(ts.URL+"/login", login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("login with token: expected status %d but got %d", http.StatusSeeOther, resp.StatusCode)
+	}
+
+	// logging in starts a new session with a new token
+	newToken := csrfTokenFrom(t, client, ts.URL+"/user/profile")
+	if newToken == token {
+		t.Error("expected a new csrf token after logging in")
+	}
+
+	var tests = []struct {
+		name               string
+		token              string
+		header             bool
+		expectedStatusCode int
+	}{
+		{"upload without token", "", false, http.StatusForbidden},
+		{"upload with old token", token, false, http.StatusForbidden},
+		{"upload with token in form", newToken, false, http.StatusSeeOther},
+		{"upload with token in header", newToken, true, http.StatusSeeOther},
+	}
+
+	for _, e := range tests {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		if e.token != "" && !e.header {
+			_ = mw.WriteField("csrf_token", e.token)
+		}
+		part, _ := mw.CreateFormFile("image", "img.png")
+		f, err := os.Open("./testdata/img.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(part, f)
+		f.Close()
+		mw.Close()
+
+		req, _ := http.NewRequest("POST", ts.URL+"/user/upload-profile-pic", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		if e.header {
+			req.Header.Set("X-CSRF-Token", e.token)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != e.expectedStatusCode {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatusCode, resp.StatusCode)
+		}
+	}
+
+	_ = app.DB.DeleteUserImage(1)
+}
+
+var csrfFieldPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// csrfTokenFrom fetches page and returns the CSRF token of its form.
+func csrfTokenFrom(t *testing.T, client *http.Client, page string) string {
+	t.Helper()
+
+	resp, err := client.Get(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	m := csrfFieldPattern.FindSubmatch(body)
+	if m == nil {
+		t.Fatalf("no csrf token found on %s", page)
+	}
+
+	return string(m[1])
+}
+
+func Test_app_sessions(t *testing.T) {
+	// start from an empty store, so sessions of other tests are not listed
+	store := app.SessionStore
+	app.SessionStore = &dbrepo.TestSessionStore{}
+	app.Session.Store = app.SessionStore
+	defer func() {
+		app.SessionStore = store
+		app.Session.Store = store
+	}()
+
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	// log in from two devices
+	laptop := loggedInClient(t, ts)
+	phone := loggedInClient(t, ts)
+
+	resp, err := laptop.Get(ts.URL + "/user/sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	ids := regexp.MustCompile(`name="session" value="([0-9a-f]+)"`).FindAllSubmatch(body, -1)
+	if len(ids) != 1 {
+		t.Fatalf("expected one other session to revoke, found %d", len(ids))
+	}
+	if !strings.Contains(string(body), "This session") {
+		t.Error("current session is not marked on the sessions page")
+	}
+
+	// revoke the phone's session from the laptop
+	token := csrfTokenFrom(t, laptop, ts.URL+"/user/sessions")
+	resp, err = laptop.PostForm(ts.URL+"/user/sessions/revoke", url.Values{
+		"csrf_token": {token},
+		"session":    {string(ids[0][1])},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("revoke: expected status %d but got %d", http.StatusSeeOther, resp.StatusCode)
+	}
+
+	if status := getStatus(t, phone, ts.URL+"/user/profile"); status != http.StatusTemporaryRedirect {
+		t.Errorf("revoked session: expected status %d but got %d", http.StatusTemporaryRedirect, status)
+	}
+	if status := getStatus(t, laptop, ts.URL+"/user/profile"); status != http.StatusOK {
+		t.Errorf("current session: expected status %d but got %d", http.StatusOK, status)
+	}
+
+	// log out of the laptop
+	token = csrfTokenFrom(t, laptop, ts.URL+"/user/profile")
+	resp, err = laptop.PostForm(ts.URL+"/logout", url.Values{"csrf_token": {token}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("logout: expected status %d but got %d", http.StatusSeeOther, resp.StatusCode)
+	}
+
+	if status := getStatus(t, laptop, ts.URL+"/user/profile"); status != http.StatusTemporaryRedirect {
+		t.Errorf("after logout: expected status %d but got %d", http.StatusTemporaryRedirect, status)
+	}
+}
+
+// loggedInClient returns a client for ts which keeps cookies, does not follow
+// redirects, and is logged in as the admin user.
+func loggedInClient(t *testing.T, ts *httptest.Server) *http.Client {
+	t.Helper()
+
+	return loggedInClientAs(t, ts, "admin@example.com")
+}
+
+// loggedInClientAs is loggedInClient for the user with email, whose password
+// must be "secret".
+func loggedInClientAs(t *testing.T, ts *httptest.Server, email string) *http.Client {
+	t.Helper()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Transport: ts.Client().Transport,
+		Jar:       jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.PostForm(ts.URL+"/login", url.Values{
+		"email":      {email},
+		"password":   {"secret"},
+		"csrf_token": {csrfTokenFrom(t, client, ts.URL+"/")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("login: expected status %d but got %d", http.StatusSeeOther, resp.StatusCode)
+	}
+
+	return client
+}
+
+func getStatus(t *testing.T, client *http.Client, page string) int {
+	t.Helper()
+
+	resp, err := client.Get(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
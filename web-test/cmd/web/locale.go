@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
+)
+
+// preferredLocale returns the language the logged in user chose on their
+// profile, or "" to go by the browser's Accept-Language.
+func (app *application) preferredLocale(r *http.Request) string {
+	if user := app.currentUser(r); user != nil {
+		return user.Locale
+	}
+	return ""
+}
+
+// newForm returns a form for data which reports errors in the language of
+// the request.
+func newForm(r *http.Request, data url.Values) *forms.Form {
+	form := forms.New(data)
+	form.Messages = i18n.FromContext(r.Context()).FormMessages()
+	return form
+}
+
+// localeOption is a language users can choose, named in that language.
+type localeOption struct {
+	Tag  string
+	Name string
+}
+
+// localeOptions lists the languages there is a catalog for.
+func (app *application) localeOptions() []localeOption {
+	var options []localeOption
+	for _, tag := range app.I18n.Locales() {
+		options = append(options, localeOption{Tag: tag, Name: app.I18n.Translator(tag).T("locale.name")})
+	}
+	return options
+}
+
+// SaveLocale stores the language the logged in user wants pages in. An empty
+// choice goes back to following the browser.
+func (app *application) SaveLocale(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	form := newForm(r, r.PostForm)
+	form.OneOf("locale", app.I18n.Locales()...)
+	if !form.Valid() {
+		app.flash(r.Context(), FlashError, form.Errors.Get("locale"))
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+		return
+	}
+
+	user := *app.currentUser(r)
+	user.Locale = form.Value("locale")
+	if err := app.DB.UpdateUser(user); err != nil {
+		app.serverError(w, r, "could not save language", err)
+		return
+	}
+	app.UserCache.forget(user.ID)
+
+	// the message is shown on the next page, which is in the new language
+	wanted := append([]string{user.Locale}, i18n.ParseAcceptLanguage(r.Header.Get("Accept-Language"))...)
+	t := app.I18n.Translator(app.I18n.Match(wanted...))
+	app.flash(r.Context(), FlashSuccess, t.T("flash.language_saved"))
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// acceptLanguage sets the Accept-Language header on every request.
+type acceptLanguage struct {
+	lang string
+	next http.RoundTripper
+}
+
+func (a acceptLanguage) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.Header.Set("Accept-Language", a.lang)
+	return a.next.RoundTrip(r)
+}
+
+func Test_app_locale(t *testing.T) {
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Transport: acceptLanguage{"pt-BR,en;q=0.5", ts.Client().Transport},
+		Jar:       jar,
+	}
+
+	page := getBody(t, client, ts.URL+"/")
+	for _, expected := range []string{`<html lang="pt-BR">`, "Página inicial"} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected %q on the home page", expected)
+		}
+	}
+
+	// a failed login comes back with messages in Portuguese
+	resp, err := client.PostForm(ts.URL+"/login", url.Values{
+		"email":      {"admin@example.com"},
+		"csrf_token": {csrfTokenFrom(t, client, ts.URL+"/")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	for _, expected := range []string{"Credenciais de login inválidas", "Este campo não pode ficar em branco"} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected %q after a failed login", expected)
+		}
+	}
+}
+
+func Test_app_SaveLocale(t *testing.T) {
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	client := loggedInClient(t, ts)
+
+	if page := getBody(t, client, ts.URL+"/user/profile"); !strings.Contains(page, `value="pt-BR"`) {
+		t.Error("expected the languages to choose from on the profile page")
+	}
+
+	var tests = []struct {
+		name   string
+		locale string
+	}{
+		{"supported", "pt-BR"},
+		{"browser", ""},
+		{"unsupported", "xx"},
+	}
+
+	for _, e := range tests {
+		resp, err := client.PostForm(ts.URL+"/user/locale", url.Values{
+			"locale":     {e.locale},
+			"csrf_token": {csrfTokenFrom(t, client, ts.URL+"/user/profile")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/user/profile" {
+			t.Errorf("%s: expected a redirect to the profile, got %d to %s", e.name, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+}
+
+func getBody(t *testing.T, client *http.Client, page string) string {
+	t.Helper()
+
+	resp, err := client.Get(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
@@ -2,47 +2,118 @@ package main
 
 import (
 	"encoding/gob"
-	"flag"
 	"log"
-	"net/http"
-	"webapp/pkg/data"
+	"log/slog"
+	"os"
+	"time"
+	"webapp/pkg/assets"
+	"webapp/pkg/clientip"
+	"webapp/pkg/config"
+	"webapp/pkg/i18n"
+	"webapp/pkg/logging"
+	"webapp/pkg/metrics"
+	"webapp/pkg/oidc"
+	"webapp/pkg/ratelimit"
+	"webapp/pkg/render"
 	"webapp/pkg/repository"
 	"webapp/pkg/repository/dbrepo"
+	"webapp/pkg/server"
+	"webapp/pkg/webauthn"
 
 	"github.com/alexedwards/scs/v2"
 )
 
 type application struct {
-	DSN     string
-	DB      repository.DatabaseRepo
-	Session *scs.SessionManager
+	Config         *config.Config
+	DSN            string
+	DB             repository.DatabaseRepo
+	Session        *scs.SessionManager
+	UserCache      *userCache
+	Templates      *render.Engine
+	Static         *assets.Assets
+	I18n           *i18n.Bundle
+	SessionStore   repository.SessionStore
+	Metrics        *metrics.Registry
+	Logger         *slog.Logger
+	IPResolver     *clientip.Resolver
+	RateLimitStore ratelimit.Store
+	// IdentityProviders are the external providers users may log in with.
+	IdentityProviders []*oidc.Provider
+	// WebAuthn checks the passkeys users register and log in with.
+	WebAuthn *webauthn.RelyingParty
 }
 
 func main() {
-	gob.Register(data.User{})
+	gob.Register(time.Time{})
 
 	// set up an app config
-	app := application{}
+	cfg, err := config.Load("web", os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	flag.StringVar(&app.DSN, "dsn", "host=localhost port=5432 user=postgres password=postgres dbname=users sslmode=disable timezone=UTC connect_timeout=5", "Posgtres connection")
-	flag.Parse()
+	app := application{
+		Config:         cfg,
+		DSN:            cfg.DSN,
+		Metrics:        metrics.New(),
+		Logger:         logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level),
+		RateLimitStore: ratelimit.NewMemoryStore(),
+
+		IdentityProviders: oidc.NewProviders(cfg.IdentityProviders),
+		WebAuthn:          webauthn.New(cfg.WebAuthn),
+	}
+	slog.SetDefault(app.Logger)
+
+	app.IPResolver, err = clientip.NewResolver(cfg.ClientIPHeader, cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+	uploadPath = cfg.Upload.Dir
+
+	app.I18n, err = i18n.New(i18n.Catalogs, cfg.DefaultLocale)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = app.loadAssets()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	conn, err := app.connectToDB()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer conn.Close()
 
 	app.DB = &dbrepo.PostgresDBRepo{DB: conn}
+	app.Metrics.RegisterDBStats(conn)
+
+	// get a session manager, keeping sessions in postgres unless configured otherwise
+	if cfg.Session.Store == "memory" {
+		store := dbrepo.NewMemorySessionStore(time.Duration(cfg.Session.CleanupInterval))
+		defer store.StopCleanup()
+		app.SessionStore = store
+	} else {
+		store := &dbrepo.PostgresSessionStore{DB: conn}
+		stopCleanup := store.StartCleanup(time.Duration(cfg.Session.CleanupInterval), app.Logger)
+		defer stopCleanup()
+		app.SessionStore = store
+	}
+	app.Session = getSession(cfg, app.SessionStore)
+	app.UserCache = newUserCache(time.Duration(cfg.Session.UserCacheTTL))
 
-	// get a session manager
-	app.Session = getSession()
+	srv := server.New(cfg, cfg.WebPort, app.routes())
 
 	// print out a message
-	log.Println("Starting server on port 8080...")
+	app.Logger.Info("starting server", "port", cfg.WebPort, "tls", cfg.TLS.Enabled())
+
+	// start the server; this blocks until SIGINT or SIGTERM has been
+	// received and in-flight requests have been drained
+	err = srv.Run()
+
+	app.Logger.Info("closing database pool")
+	_ = conn.Close()
 
-	// start the server
-	err = http.ListenAndServe(":8080", app.routes())
 	if err != nil {
 		log.Fatal(err)
 	}
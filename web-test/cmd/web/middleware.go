@@ -2,67 +2,113 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"net"
 	"net/http"
+	"strconv"
+	"webapp/pkg/clientip"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/logging"
+	"webapp/pkg/ratelimit"
 )
 
 type contextKey string
 
 const contextUserKey contextKey = "user_ip"
 
+// ipFromContext returns the client address stored by addIPToContext, or
+// "unknown" if the middleware did not run.
 func (app *application) ipFromContext(ctx context.Context) string {
-	return ctx.Value(contextUserKey).(string)
+	ip, ok := ctx.Value(contextUserKey).(string)
+	if !ok || ip == "" {
+		return clientip.Unknown
+	}
+	return ip
 }
 
+// addIPToContext stores the address of the client in the request context,
+// looking through trusted reverse proxies.
 func (app *application) addIPToContext(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var ctx = context.Background()
-		// get the ip (as accurately as possible)
-		ip, err := getIP(r)
-		if err != nil {
-			ip, _, _ = net.SplitHostPort(r.RemoteAddr)
-			if len(ip) == 0 {
-				ip = "unknown"
+		ctx := context.WithValue(r.Context(), contextUserKey, app.IPResolver.ClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// returnToSessionKey is where auth keeps the page a logged out user asked
+// for, so Login can send them back to it.
+const returnToSessionKey = "return_to"
+
+func (app *application) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.currentUser(r) == nil {
+			if r.Method == http.MethodGet {
+				app.Session.Put(r.Context(), returnToSessionKey, r.URL.RequestURI())
 			}
-			ctx = context.WithValue(r.Context(), contextUserKey, ip)
-		} else {
-			ctx = context.WithValue(r.Context(), contextUserKey, ip)
+			app.flash(r.Context(), FlashWarning, i18n.T(r.Context(), "flash.login_first"))
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
 		}
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r)
 	})
 }
 
-func getIP(r *http.Request) (string, error) {
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return "unknown", err
-	}
+// admin lets only admins through. It must run after auth.
+func (app *application) admin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := app.currentUser(r); user == nil || user.IsAdmin != 1 {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-	userIP := net.ParseIP(ip)
-	if userIP == nil {
-		return "", fmt.Errorf("userip: %q is not IP:port", r.RemoteAddr)
-	}
+// logSessionUser records the id of the logged in user, if any, for the access
+// log. It looks at the session after the handler ran, so a user who has just
+// logged in is reported too.
+func (app *application) logSessionUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		if id := app.sessionUserID(r); id != 0 {
+			logging.SetUserID(r.Context(), strconv.Itoa(id))
+		}
+	})
+}
+
+// sessionUserID returns the id of the user in the session, or 0.
+func (app *application) sessionUserID(r *http.Request) int {
+	return app.Session.GetInt(r.Context(), data.SessionUserIDKey)
+}
 
-	forward := r.Header.Get("X-Forwarded-For")
-	if len(forward) > 0 {
-		ip = forward
+// rateLimit returns middleware enforcing limit for the group of routes called
+// name, charging each request to the client identified by key.
+func (app *application) rateLimit(name string, limit ratelimit.Limit, key ratelimit.KeyFunc) func(http.Handler) http.Handler {
+	if !app.Config.RateLimit.Enabled {
+		return func(next http.Handler) http.Handler { return next }
 	}
 
-	if len(ip) == 0 {
-		ip = "forward"
+	limiter := &ratelimit.Limiter{
+		Store:  app.RateLimitStore,
+		Name:   name,
+		Limit:  limit,
+		Key:    key,
+		Logger: app.Logger,
 	}
 
-	return ip, nil
+	return limiter.Middleware
 }
 
-func (app *application) auth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !app.Session.Exists(r.Context(), "user") {
-			app.Session.Put(r.Context(), "error", "Log in first!")
-			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
\ No newline at end of file
+// clientKey charges a request to the address of the client.
+func (app *application) clientKey(r *http.Request) string {
+	return "ip:" + app.ipFromContext(r.Context())
+}
+
+// userKey charges a request to the logged in user, falling back to the
+// address of the client.
+func (app *application) userKey(r *http.Request) string {
+	if id := app.sessionUserID(r); id != 0 {
+		return "user:" + strconv.Itoa(id)
+	}
+	return app.clientKey(r)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 	"webapp/pkg/data"
 )
 
@@ -76,6 +77,14 @@ func Test_application_ipFromContext(t *testing.T) {
 	}
 }
 
+func Test_application_ipFromContextWithoutMiddleware(t *testing.T) {
+	ip := app.ipFromContext(context.Background())
+
+	if ip != "unknown" {
+		t.Errorf("expected unknown, but got %s", ip)
+	}
+}
+
 func Test_app_auth(t *testing.T) {
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
 
@@ -94,7 +103,7 @@ func Test_app_auth(t *testing.T) {
 		req := httptest.NewRequest("GET", "http://testing", nil)
 		req = addContextAndSessionToRequest(req, app)
 		if e.isAuth {
-			app.Session.Put(req.Context(), "user", data.User{ID: 1})
+			req = req.WithContext(context.WithValue(req.Context(), contextCurrentUserKey, &data.User{ID: 1}))
 		}
 		rr := httptest.NewRecorder()
 		handlerToTest.ServeHTTP(rr, req)
@@ -107,4 +116,93 @@ func Test_app_auth(t *testing.T) {
 			t.Errorf("%s: expected status code 307, but got %d", e.name, rr.Code)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func Test_app_loadUser(t *testing.T) {
+	var tests = []struct {
+		name           string
+		userID         int
+		expectedUser   bool
+		expectLoggedIn bool
+	}{
+		{"not logged in", 0, false, false},
+		{"logged in", 1, true, true},
+		{"deleted user", 99, false, false},
+	}
+
+	for _, e := range tests {
+		var loaded *data.User
+		nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			loaded = app.currentUser(r)
+		})
+
+		req := httptest.NewRequest("GET", "http://testing", nil)
+		req = addContextAndSessionToRequest(req, app)
+		if e.userID != 0 {
+			app.Session.Put(req.Context(), data.SessionUserIDKey, e.userID)
+		}
+
+		app.loadUser(nextHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+		if e.expectedUser && (loaded == nil || loaded.ID != e.userID) {
+			t.Errorf("%s: expected user %d in the context, got %v", e.name, e.userID, loaded)
+		}
+		if !e.expectedUser && loaded != nil {
+			t.Errorf("%s: expected no user in the context, got %d", e.name, loaded.ID)
+		}
+		if loggedIn := app.Session.Exists(req.Context(), data.SessionUserIDKey); loggedIn != e.expectLoggedIn {
+			t.Errorf("%s: expected session logged in to be %v", e.name, e.expectLoggedIn)
+		}
+	}
+}
+
+func Test_userCache(t *testing.T) {
+	c := newUserCache(time.Minute)
+
+	c.put(&data.User{ID: 1, IsAdmin: 1})
+	if u, ok := c.get(1); !ok || u.IsAdmin != 1 {
+		t.Error("expected cached user")
+	}
+
+	// a change made through the web application is seen on the next request
+	c.forget(1)
+	if _, ok := c.get(1); ok {
+		t.Error("forgotten user should not be cached")
+	}
+
+	c = newUserCache(0)
+	c.put(&data.User{ID: 1})
+	if _, ok := c.get(1); ok {
+		t.Error("a cache without ttl should not keep users")
+	}
+}
+
+func Test_app_loadUser_cached(t *testing.T) {
+	cache := app.UserCache
+	app.UserCache = newUserCache(time.Minute)
+	defer func() { app.UserCache = cache }()
+
+	var loaded *data.User
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loaded = app.currentUser(r)
+	})
+
+	load := func() *data.User {
+		req := httptest.NewRequest("GET", "http://testing", nil)
+		req = addContextAndSessionToRequest(req, app)
+		app.Session.Put(req.Context(), data.SessionUserIDKey, 1)
+		app.loadUser(nextHandler).ServeHTTP(httptest.NewRecorder(), req)
+		return loaded
+	}
+
+	first := load()
+	if second := load(); second != first {
+		t.Error("expected the next request to get the cached user")
+	}
+
+	// demoting or deleting the user through the web application drops it
+	app.UserCache.forget(1)
+	if third := load(); third == first {
+		t.Error("expected the user to be loaded afresh once forgotten")
+	}
+}
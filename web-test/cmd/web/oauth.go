@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/oidc"
+)
+
+// The web application is where users of the OpenID Connect provider log in
+// and say whether a client may know who they are. Once they do, the client
+// gets an authorization code, which it exchanges for tokens with the api.
+
+// Authorize asks the logged in user whether the client of an authorization
+// request may log them in.
+func (app *application) Authorize(w http.ResponseWriter, r *http.Request) {
+	req, client, ok := app.authRequest(w, r, r.URL.Query())
+	if !ok {
+		return
+	}
+
+	var scopes []string
+	for _, s := range req.Scopes {
+		scopes = append(scopes, i18n.T(r.Context(), "oauth.scope_"+s))
+	}
+
+	// the page must not be shown in a frame, so no one can trick users into
+	// clicking allow
+	w.Header().Set("X-Frame-Options", "DENY")
+	_ = app.render(w, r, "consent.page.gohtml", &TemplateData{Data: map[string]any{
+		"client": client,
+		"scopes": scopes,
+		"params": req.Params(),
+	}})
+}
+
+// AuthorizeDecision sends the user back to the client, with an
+// authorization code if they allowed it, or an access_denied error.
+func (app *application) AuthorizeDecision(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	req, _, ok := app.authRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+
+	if r.PostForm.Get("decision") != "allow" {
+		http.Redirect(w, r, req.ErrorURL(&oidc.Error{Code: oidc.ErrAccessDenied, Description: "the user denied the request"}), http.StatusSeeOther)
+		return
+	}
+
+	code, hash, err := data.NewOAuthSecret()
+	if err == nil {
+		err = app.DB.InsertAuthCode(data.AuthCode{
+			Hash:          hash,
+			ClientID:      req.ClientID,
+			UserID:        app.sessionUserID(r),
+			RedirectURI:   req.RedirectURI,
+			Scopes:        req.Scopes,
+			Nonce:         req.Nonce,
+			CodeChallenge: req.CodeChallenge,
+			ExpiresAt:     time.Now().Add(oidc.CodeLifetime),
+		})
+	}
+	if err != nil {
+		app.serverError(w, r, "could not create authorization code", err)
+		return
+	}
+
+	http.Redirect(w, r, req.CodeURL(code), http.StatusSeeOther)
+}
+
+// authRequest checks the authorization request in params. Errors the client
+// can be told about send the user back to it; the others are shown here,
+// since there is no telling whether the redirect uri is the client's.
+func (app *application) authRequest(w http.ResponseWriter, r *http.Request, params url.Values) (*oidc.AuthRequest, *data.OAuthClient, bool) {
+	req, client, err := oidc.ParseAuthRequest(app.DB, params)
+
+	var oauthErr *oidc.Error
+	switch {
+	case err == nil:
+		return req, client, true
+	case errors.As(err, &oauthErr):
+		http.Redirect(w, r, req.ErrorURL(oauthErr), http.StatusSeeOther)
+	case errors.Is(err, oidc.ErrUnknownClient):
+		_ = app.renderWithStatus(w, r, http.StatusBadRequest, "consent.page.gohtml", &TemplateData{Data: map[string]any{"error": i18n.T(r.Context(), "oauth.unknown_client")}})
+	case errors.Is(err, oidc.ErrBadRedirectURI):
+		_ = app.renderWithStatus(w, r, http.StatusBadRequest, "consent.page.gohtml", &TemplateData{Data: map[string]any{"error": i18n.T(r.Context(), "oauth.bad_redirect_uri")}})
+	default:
+		app.serverError(w, r, "could not check authorization request", err)
+	}
+	return nil, nil, false
+}
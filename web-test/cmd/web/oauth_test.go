@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"webapp/pkg/data"
+	"webapp/pkg/oidc"
+)
+
+const testRedirectURI = "https://app.example/callback"
+
+// authorizeQuery returns a valid authorization request of the client with
+// id.
+func authorizeQuery(id string) url.Values {
+	return url.Values{
+		"client_id":             {id},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6"},
+		"code_challenge":        {oidc.S256Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func insertOAuthClient(t *testing.T, id string) {
+	t.Helper()
+
+	err := app.DB.InsertOAuthClient(data.OAuthClient{ID: id, Name: "Test app", RedirectURIs: []string{testRedirectURI}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = app.DB.DeleteOAuthClient(id) })
+}
+
+func Test_app_authorize(t *testing.T) {
+	insertOAuthClient(t, "consent-app")
+
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	client := loggedInClient(t, ts)
+	authorizeURL := ts.URL + "/oauth/authorize?" + authorizeQuery("consent-app").Encode()
+
+	page := getBody(t, client, authorizeURL)
+	if !strings.Contains(page, "Log in to Test app") || !strings.Contains(page, "Your email address") {
+		t.Fatal("expected the consent page to name the client and the scopes")
+	}
+	if strings.Contains(page, "Your name and language") {
+		t.Error("the consent page lists a scope that was not asked for")
+	}
+
+	var tests = []struct {
+		name     string
+		decision string
+		expected []string
+	}{
+		{"allow", "allow", []string{"code", "state"}},
+		{"deny", "deny", []string{"error", "state"}},
+	}
+
+	for _, e := range tests {
+		form := authorizeQuery("consent-app")
+		form.Set("decision", e.decision)
+		form.Set("csrf_token", csrfTokenFrom(t, client, authorizeURL))
+
+		resp, err := client.PostForm(ts.URL+"/oauth/authorize", form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Errorf("%s: expected status %d but got %d", e.name, http.StatusSeeOther, resp.StatusCode)
+			continue
+		}
+		to, _ := url.Parse(resp.Header.Get("Location"))
+		if !strings.HasPrefix(to.String(), testRedirectURI+"?") {
+			t.Errorf("%s: expected a redirect to the client, got %s", e.name, to)
+		}
+		for _, param := range e.expected {
+			if to.Query().Get(param) == "" {
+				t.Errorf("%s: expected %s in %s", e.name, param, to)
+			}
+		}
+
+		if code := to.Query().Get("code"); code != "" {
+			c, err := app.DB.TakeAuthCode(data.HashOAuthSecret(code))
+			if err != nil {
+				t.Fatalf("%s: the code was not stored: %v", e.name, err)
+			}
+			if c.UserID != 1 || c.Nonce != "n-0S6" || c.RedirectURI != testRedirectURI {
+				t.Errorf("%s: wrong code stored %+v", e.name, c)
+			}
+		}
+	}
+}
+
+func Test_app_authorizeErrors(t *testing.T) {
+	insertOAuthClient(t, "error-app")
+
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	client := loggedInClient(t, ts)
+
+	var tests = []struct {
+		name           string
+		change         func(q url.Values)
+		expectedStatus int
+		expectedError  string
+	}{
+		{"unknown client", func(q url.Values) { q.Set("client_id", "unknown") }, http.StatusBadRequest, ""},
+		{"unregistered redirect uri", func(q url.Values) { q.Set("redirect_uri", "https://evil.example/") }, http.StatusBadRequest, ""},
+		{"no pkce", func(q url.Values) { q.Del("code_challenge") }, http.StatusSeeOther, oidc.ErrInvalidRequest},
+		{"no openid scope", func(q url.Values) { q.Set("scope", "email") }, http.StatusSeeOther, oidc.ErrInvalidScope},
+	}
+
+	for _, e := range tests {
+		q := authorizeQuery("error-app")
+		e.change(q)
+
+		resp, err := client.Get(ts.URL + "/oauth/authorize?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, resp.StatusCode)
+			continue
+		}
+		if e.expectedError != "" {
+			to, _ := url.Parse(resp.Header.Get("Location"))
+			if to.Query().Get("error") != e.expectedError || to.Query().Get("state") != "xyz" {
+				t.Errorf("%s: wrong error redirect %s", e.name, to)
+			}
+		}
+	}
+}
+
+func Test_app_authorizeLogsInFirst(t *testing.T) {
+	insertOAuthClient(t, "login-app")
+
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Transport: ts.Client().Transport,
+		Jar:       jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	authorizePath := "/oauth/authorize?" + authorizeQuery("login-app").Encode()
+	if status := getStatus(t, client, ts.URL+authorizePath); status != http.StatusTemporaryRedirect {
+		t.Fatalf("expected to be sent to log in, got %d", status)
+	}
+
+	resp, err := client.PostForm(ts.URL+"/login", url.Values{
+		"email":      {"admin@example.com"},
+		"password":   {"secret"},
+		"csrf_token": {csrfTokenFrom(t, client, ts.URL+"/")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if to := resp.Header.Get("Location"); to != authorizePath {
+		t.Errorf("expected to be sent back to %s after logging in, got %s", authorizePath, to)
+	}
+}
+
+func Test_localPath(t *testing.T) {
+	var tests = []struct {
+		to       string
+		expected bool
+	}{
+		{"/user/profile", true},
+		{"/oauth/authorize?client_id=app", true},
+		{"", false},
+		{"https://evil.example/", false},
+		{"//evil.example/", false},
+		{`/\evil.example/`, false},
+	}
+
+	for _, e := range tests {
+		if got := localPath(e.to); got != e.expected {
+			t.Errorf("%q: expected %v but got %v", e.to, e.expected, got)
+		}
+	}
+}
+
+func Test_app_adminClients(t *testing.T) {
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	client := loggedInClient(t, ts)
+
+	var tests = []struct {
+		name           string
+		form           url.Values
+		expectedStatus int
+		expectSecret   bool
+	}{
+		{"confidential", url.Values{"name": {"Backend"}, "redirect_uris": {"https://backend.example/cb\nhttp://localhost:9000/cb"}}, http.StatusOK, true},
+		{"public", url.Values{"name": {"SPA"}, "redirect_uris": {"https://spa.example/"}, "public": {"1"}}, http.StatusOK, false},
+		{"no name", url.Values{"redirect_uris": {"https://spa.example/"}}, http.StatusUnprocessableEntity, false},
+		{"no redirect uris", url.Values{"name": {"SPA"}}, http.StatusUnprocessableEntity, false},
+		{"relative redirect uri", url.Values{"name": {"SPA"}, "redirect_uris": {"/cb"}}, http.StatusUnprocessableEntity, false},
+		{"redirect uri with fragment", url.Values{"name": {"SPA"}, "redirect_uris": {"https://spa.example/#cb"}}, http.StatusUnprocessableEntity, false},
+		{"custom scheme", url.Values{"name": {"SPA"}, "redirect_uris": {"javascript://spa.example/"}}, http.StatusUnprocessableEntity, false},
+	}
+
+	secretPattern := regexp.MustCompile(`<code>([A-Za-z0-9_-]{43})</code>`)
+
+	for _, e := range tests {
+		e.form.Set("csrf_token", csrfTokenFrom(t, client, ts.URL+"/admin/clients"))
+		resp, err := client.PostForm(ts.URL+"/admin/clients", e.form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body bytes.Buffer
+		_, _ = body.ReadFrom(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, resp.StatusCode)
+			continue
+		}
+
+		secret := secretPattern.FindStringSubmatch(body.String())
+		if e.expectSecret != (secret != nil) {
+			t.Errorf("%s: expected the secret shown to be %v", e.name, e.expectSecret)
+		}
+		if secret != nil && resp.Header.Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: the page with the secret should not be cached", e.name)
+		}
+	}
+
+	clients, _ := app.DB.AllOAuthClients()
+	if len(clients) != 2 {
+		t.Fatalf("expected 2 clients, got %d", len(clients))
+	}
+	if clients[0].Public() || !clients[1].Public() || len(clients[0].RedirectURIs) != 2 {
+		t.Errorf("wrong clients stored %+v", clients)
+	}
+
+	for _, c := range clients {
+		form := url.Values{"csrf_token": {csrfTokenFrom(t, client, ts.URL+"/admin/clients")}}
+		resp, err := client.PostForm(ts.URL+"/admin/clients/"+c.ID+"/delete", form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Errorf("delete %s: expected status %d but got %d", c.Name, http.StatusSeeOther, resp.StatusCode)
+		}
+	}
+
+	if clients, _ := app.DB.AllOAuthClients(); len(clients) != 0 {
+		t.Errorf("expected the clients to be deleted, got %d", len(clients))
+	}
+
+	// regular users cannot manage clients
+	if status := getStatus(t, loggedInClientAs(t, ts, "user@example.com"), ts.URL+"/admin/clients"); status != http.StatusForbidden {
+		t.Errorf("expected regular users to be turned away, got %d", status)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+	"webapp/pkg/health"
+)
+
+// readyz reports whether the web application can serve traffic: the database
+// answers a ping, and uploaded profile pictures can be written.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	health.Ready(map[string]health.Check{
+		"database": health.Database(app.DB.Connection),
+		"storage":  health.WritableDir(uploadPath),
+	})(w, r)
+}
+
+// countLogin records the outcome of an attempt to log in.
+func (app *application) countLogin(r *http.Request, success bool) {
+	app.Metrics.CountLogin(r, app.Logger, app.ipFromContext(r.Context()), success)
+}
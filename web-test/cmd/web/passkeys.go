@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/webauthn"
+)
+
+// Users may register passkeys on their profile, and log in with one instead
+// of their password. The browser talks to the authenticator; the pages ask
+// it to with static/js/passkeys.js, which posts what it answers here as
+// JSON.
+
+const passkeyChallengeSessionKey = "passkey_challenge"
+
+// maxPasskeyBody limits the JSON posted with a passkey, which is at most a
+// few kilobytes.
+const maxPasskeyBody = 64 << 10
+
+// passkeyChallenge is the challenge the session was last handed, either to
+// register a passkey or to log in with one.
+type passkeyChallenge struct {
+	Purpose   string
+	Challenge []byte
+	Expires   time.Time
+}
+
+func init() {
+	gob.Register(passkeyChallenge{})
+}
+
+// newPasskeyChallenge returns a challenge for purpose, which the session
+// remembers until it is answered, or another one is asked for.
+func (app *application) newPasskeyChallenge(r *http.Request, purpose string) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	app.Session.Put(r.Context(), passkeyChallengeSessionKey, passkeyChallenge{
+		Purpose:   purpose,
+		Challenge: challenge,
+		Expires:   time.Now().Add(webauthn.Timeout),
+	})
+	return challenge, nil
+}
+
+// popPasskeyChallenge returns the challenge of the session for purpose, or
+// nil if it has none or it expired. Either way it is forgotten, so it can
+// only be answered once.
+func (app *application) popPasskeyChallenge(r *http.Request, purpose string) []byte {
+	c, ok := app.Session.Pop(r.Context(), passkeyChallengeSessionKey).(passkeyChallenge)
+	if !ok || c.Purpose != purpose || time.Now().After(c.Expires) {
+		return nil
+	}
+	return c.Challenge
+}
+
+// PasskeyOptions starts the registration of a passkey for the logged in
+// user, answering with the options for navigator.credentials.create.
+func (app *application) PasskeyOptions(w http.ResponseWriter, r *http.Request) {
+	user := app.currentUser(r)
+	existing, err := app.DB.UserPasskeys(user.ID)
+	if err != nil {
+		app.serverError(w, r, "could not list passkeys", err)
+		return
+	}
+
+	challenge, err := app.newPasskeyChallenge(r, "register")
+	if err != nil {
+		app.serverError(w, r, "could not start passkey registration", err)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, app.WebAuthn.CreationOptions(user, challenge, existing))
+}
+
+// RegisterPasskey stores the passkey the authenticator made for the logged
+// in user, under the name they gave it.
+func (app *application) RegisterPasskey(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name       string                        `json:"name"`
+		Credential webauthn.RegistrationResponse `json:"credential"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPasskeyBody)).Decode(&payload); err != nil {
+		app.writeJSONError(w, r, http.StatusBadRequest, "flash.passkey_not_added")
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		name = i18n.T(r.Context(), "profile.passkey_default_name")
+	}
+	if utf8.RuneCountInString(name) > 255 {
+		app.writeJSONError(w, r, http.StatusBadRequest, "flash.passkey_name_too_long")
+		return
+	}
+
+	challenge := app.popPasskeyChallenge(r, "register")
+	_, err := app.WebAuthn.Register(app.DB, app.currentUser(r), name, payload.Credential, challenge)
+	if errors.Is(err, webauthn.ErrInvalid) {
+		app.logError(r, "passkey not registered", err)
+		app.writeJSONError(w, r, http.StatusBadRequest, "flash.passkey_not_added")
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, "could not register passkey", err)
+		return
+	}
+
+	app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.passkey_added"))
+	app.writeJSON(w, http.StatusCreated, map[string]string{"redirect": "/user/profile#passkeys"})
+}
+
+// DeletePasskey deletes one of the passkeys of the logged in user, so it
+// can no longer be logged in with. The form names the passkey by its id.
+func (app *application) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PostFormValue("passkey"))
+	if err == nil {
+		err = app.DB.DeletePasskey(app.sessionUserID(r), id)
+	}
+
+	var numErr *strconv.NumError
+	switch {
+	case errors.As(err, &numErr), errors.Is(err, sql.ErrNoRows):
+		app.flash(r.Context(), FlashWarning, i18n.T(r.Context(), "flash.no_passkey_deleted"))
+	case err != nil:
+		app.serverError(w, r, "could not delete passkey", err)
+		return
+	default:
+		app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.passkey_deleted"))
+	}
+
+	http.Redirect(w, r, "/user/profile#passkeys", http.StatusSeeOther)
+}
+
+// PasskeyLoginOptions starts a login with a passkey, answering with the
+// options for navigator.credentials.get. Any passkey of the site will do;
+// the one chosen tells who logs in.
+func (app *application) PasskeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	challenge, err := app.newPasskeyChallenge(r, "login")
+	if err != nil {
+		app.serverError(w, r, "could not start passkey login", err)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, app.WebAuthn.RequestOptions(challenge))
+}
+
+// PasskeyLogin logs in the user whose passkey signed the challenge, and
+// answers with where the page should go next.
+func (app *application) PasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var credential webauthn.AssertionResponse
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPasskeyBody)).Decode(&credential); err != nil {
+		app.countLogin(r, false)
+		app.writeJSONError(w, r, http.StatusBadRequest, "flash.invalid_passkey")
+		return
+	}
+
+	challenge := app.popPasskeyChallenge(r, "login")
+	user, err := app.WebAuthn.Login(app.DB, credential, challenge)
+	if errors.Is(err, webauthn.ErrInvalid) {
+		app.logError(r, "passkey login refused", err)
+		app.countLogin(r, false)
+		app.writeJSONError(w, r, http.StatusUnauthorized, "flash.invalid_passkey")
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, "could not log in with passkey", err)
+		return
+	}
+
+	app.countLogin(r, true)
+	app.Session.Put(r.Context(), data.SessionUserIDKey, user.ID)
+	app.writeJSON(w, http.StatusOK, map[string]string{"redirect": app.startLoggedInSession(r)})
+}
+
+// writeJSON answers the scripts of the pages.
+func (app *application) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError answers the scripts of the pages with the message of key,
+// for them to show.
+func (app *application) writeJSONError(w http.ResponseWriter, r *http.Request, status int, key string) {
+	app.writeJSON(w, status, map[string]string{"error": i18n.T(r.Context(), key)})
+}
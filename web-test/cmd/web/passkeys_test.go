@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"webapp/pkg/config"
+	"webapp/pkg/webauthn"
+	"webapp/pkg/webauthn/webauthntest"
+)
+
+// postJSON posts body to page as the scripts of the pages do, decodes the
+// answer into out, and returns its status.
+func postJSON(t *testing.T, client *http.Client, page, csrfToken string, body, out any) int {
+	t.Helper()
+
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, page, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(csrfHeaderName, csrfToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s: %v", page, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// loginWithPasskey logs in a new client with the passkey of a, and returns
+// the status of the login and the client.
+func loginWithPasskey(t *testing.T, ts *httptest.Server, a *webauthntest.Authenticator) (int, *http.Client) {
+	t.Helper()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Transport: ts.Client().Transport, Jar: jar}
+	token := csrfTokenFrom(t, client, ts.URL+"/")
+
+	var opts webauthn.RequestOptions
+	if status := postJSON(t, client, ts.URL+"/login/passkey/options", token, struct{}{}, &opts); status != http.StatusOK {
+		t.Fatalf("login options: expected status %d but got %d", http.StatusOK, status)
+	}
+
+	var next struct{ Redirect string }
+	status := postJSON(t, client, ts.URL+"/login/passkey", token, a.Get(opts), &next)
+	if status == http.StatusOK && next.Redirect != "/user/profile" {
+		t.Errorf("expected to be sent to the profile but got %q", next.Redirect)
+	}
+	return status, client
+}
+
+func Test_app_passkeys(t *testing.T) {
+	ts := httptest.NewTLSServer(app.routes())
+	defer ts.Close()
+
+	rp := app.WebAuthn
+	app.WebAuthn = webauthn.New(config.WebAuthnConfig{RPID: "127.0.0.1", RPName: "Web App", Origins: []string{ts.URL}})
+	defer func() { app.WebAuthn = rp }()
+
+	client := loggedInClient(t, ts)
+	a := webauthntest.New(t, ts.URL)
+
+	// the profile offers to add a passkey
+	if page := getBody(t, client, ts.URL+"/user/profile"); !strings.Contains(page, `data-passkey="register"`) {
+		t.Fatal("expected the profile to offer to add a passkey")
+	}
+	token := csrfTokenFrom(t, client, ts.URL+"/user/profile")
+
+	// each attempt asks for options of its own, as the page does
+	var tests = []struct {
+		name           string
+		body           func(credential webauthn.RegistrationResponse) any
+		expectedStatus int
+	}{
+		{"not json", func(webauthn.RegistrationResponse) any { return "laptop" }, http.StatusBadRequest},
+		{"name too long", func(c webauthn.RegistrationResponse) any {
+			return map[string]any{"name": strings.Repeat("a", 256), "credential": c}
+		}, http.StatusBadRequest},
+		{"register", func(c webauthn.RegistrationResponse) any { return map[string]any{"name": "Laptop", "credential": c} }, http.StatusCreated},
+		{"register again", func(c webauthn.RegistrationResponse) any { return map[string]any{"name": "Laptop", "credential": c} }, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		var opts webauthn.CreationOptions
+		if status := postJSON(t, client, ts.URL+"/user/passkeys/options", token, struct{}{}, &opts); status != http.StatusOK {
+			t.Fatalf("%s: options: expected status %d but got %d", e.name, http.StatusOK, status)
+		}
+		if opts.RP.ID != "127.0.0.1" || opts.User.Name != "admin@example.com" {
+			t.Errorf("%s: unexpected options %+v", e.name, opts)
+		}
+
+		if status := postJSON(t, client, ts.URL+"/user/passkeys", token, e.body(a.Create(opts)), nil); status != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, status)
+		}
+	}
+
+	page := getBody(t, client, ts.URL+"/user/profile")
+	ids := regexp.MustCompile(`name="passkey" value="(\d+)"`).FindAllStringSubmatch(page, -1)
+	if len(ids) != 1 || !strings.Contains(page, "Laptop") {
+		t.Fatalf("expected the passkey to be listed, found %d", len(ids))
+	}
+
+	// log in with it
+	if page := getBody(t, &http.Client{Transport: ts.Client().Transport}, ts.URL+"/"); !strings.Contains(page, `data-passkey="login"`) {
+		t.Error("expected the home page to offer to sign in with a passkey")
+	}
+	clone := a.Clone()
+	status, other := loginWithPasskey(t, ts, a)
+	if status != http.StatusOK {
+		t.Fatalf("login: expected status %d but got %d", http.StatusOK, status)
+	}
+	if page := getBody(t, other, ts.URL+"/user/profile"); !strings.Contains(page, "Laptop") {
+		t.Error("expected to be logged in as the owner of the passkey")
+	}
+
+	// a copy of the authenticator is refused, and so is a login with a
+	// challenge the session was not given
+	if status, _ := loginWithPasskey(t, ts, clone); status != http.StatusUnauthorized {
+		t.Errorf("cloned: expected status %d but got %d", http.StatusUnauthorized, status)
+	}
+	jar, _ := cookiejar.New(nil)
+	stranger := &http.Client{Transport: ts.Client().Transport, Jar: jar}
+	guess := a.Get(webauthn.RequestOptions{Challenge: []byte("guess"), RPID: "127.0.0.1"})
+	if status := postJSON(t, stranger, ts.URL+"/login/passkey", csrfTokenFrom(t, stranger, ts.URL+"/"), guess, nil); status != http.StatusUnauthorized {
+		t.Errorf("no challenge: expected status %d but got %d", http.StatusUnauthorized, status)
+	}
+
+	// once deleted, it no longer logs in
+	for _, expected := range []string{"Passkey deleted.", "No passkey was deleted."} {
+		resp, err := client.PostForm(ts.URL+"/user/passkeys/delete", url.Values{
+			"csrf_token": {csrfTokenFrom(t, client, ts.URL+"/user/profile")},
+			"passkey":    {ids[0][1]},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther {
+			t.Errorf("delete: expected status %d but got %d", http.StatusSeeOther, resp.StatusCode)
+		}
+		if page := getBody(t, client, ts.URL+"/user/profile"); !strings.Contains(page, expected) {
+			t.Errorf("delete: expected %q to be flashed", expected)
+		}
+	}
+	if status, _ := loginWithPasskey(t, ts, a); status != http.StatusUnauthorized {
+		t.Errorf("deleted: expected status %d but got %d", http.StatusUnauthorized, status)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"webapp/pkg/assets"
+	"webapp/pkg/data"
+	"webapp/pkg/forms"
+	"webapp/pkg/i18n"
+	"webapp/pkg/render"
+	"webapp/static"
+	"webapp/templates"
+)
+
+type TemplateData struct {
+	IP        string
+	Data      map[string]any
+	Flashes   []Flash
+	User      data.User
+	CSRFToken string
+	Form      *forms.Form
+	// Locale is the language the page is in
+	Locale     string
+	translator *i18n.Translator
+}
+
+// T translates key into the language of the page; templates call it as
+// {{ t . "key" }}.
+func (td *TemplateData) T(key string, args ...any) string {
+	if td.translator == nil {
+		return i18n.Default().Translator("").T(key, args...)
+	}
+	return td.translator.T(key, args...)
+}
+
+// loadAssets sets up the templates and static files embedded in the binary,
+// or, with assets.from_disk, the ones on disk. Templates read from disk are
+// parsed again on every request; either way they are all parsed once here,
+// so broken templates stop the server from starting.
+func (app *application) loadAssets() error {
+	cfg := app.Config.Assets
+
+	var templateFS, staticFS fs.FS = templates.FS, static.FS
+	if cfg.FromDisk {
+		templateFS, staticFS = os.DirFS(cfg.TemplatesDir), os.DirFS(cfg.StaticDir)
+	}
+
+	var err error
+	app.Static, err = assets.New(staticFS, assets.Options{Prefix: "/static", Disk: cfg.FromDisk})
+	if err != nil {
+		return err
+	}
+
+	app.Templates = render.New(templateFS, render.Options{
+		Reload: cfg.FromDisk,
+		Funcs: template.FuncMap{
+			"csrfField": func(td *TemplateData) template.HTML { return td.CSRFField() },
+			"asset":     app.Static.Path,
+			"t":         func(td *TemplateData, key string, args ...any) string { return td.T(key, args...) },
+			"locales":   app.localeOptions,
+		},
+	})
+
+	return app.Templates.Load()
+}
+
+func (app *application) render(w http.ResponseWriter, r *http.Request, t string, td *TemplateData) error {
+	return app.renderWithStatus(w, r, http.StatusOK, t, td)
+}
+
+// renderWithStatus renders the page t with the given status, for example to
+// show a form again with its errors.
+func (app *application) renderWithStatus(w http.ResponseWriter, r *http.Request, status int, t string, td *TemplateData) error {
+	td.IP = app.ipFromContext(r.Context())
+
+	td.translator = i18n.FromContext(r.Context())
+	td.Locale = td.translator.Locale()
+	td.Flashes = app.popFlashes(r.Context())
+	td.CSRFToken = app.csrfToken(r.Context())
+
+	// a form kept from a failed submission only belongs to the page right
+	// after it, so drop it even when the handler has a form of its own
+	kept := app.popForm(r.Context())
+	if td.Form == nil {
+		td.Form = kept
+	}
+	if td.Form == nil {
+		td.Form = forms.New(url.Values{})
+	}
+
+	if user := app.currentUser(r); user != nil {
+		td.User = *user
+		td.User.Password = ""
+	}
+
+	// render into a buffer first, so a broken template ends in a proper
+	// error page rather than half a page
+	var buf bytes.Buffer
+	if err := app.Templates.Render(&buf, t, td); err != nil {
+		app.serverError(w, r, "could not render template", err)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// serverError logs err and answers with a generic 500 page.
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	app.logError(r, msg, err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"net/http"
+	"webapp/pkg/health"
+	"webapp/pkg/logging"
+	"webapp/pkg/uploads"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -11,23 +14,87 @@ func (app *application) routes() http.Handler {
 	mux := chi.NewRouter()
 
 	// register middleware
-	mux.Use(middleware.Recoverer)
+	mux.Use(logging.RequestID)
+	mux.Use(app.Metrics.Middleware)
 	mux.Use(app.addIPToContext)
+	mux.Use(logging.AccessLog(app.Logger, func(r *http.Request) string {
+		return app.ipFromContext(r.Context())
+	}))
+	mux.Use(middleware.Recoverer)
 	mux.Use(app.Session.LoadAndSave)
+	mux.Use(app.loadUser)
+	mux.Use(app.I18n.Middleware(app.preferredLocale))
+	mux.Use(app.logSessionUser)
+	mux.Use(app.trackSession)
+	mux.Use(app.rateLimit("default", app.Config.RateLimit.Default, app.clientKey))
+	mux.Use(app.csrf)
+
+	// operational endpoints
+	mux.Get("/healthz", health.Live)
+	mux.Get("/readyz", app.readyz)
+	mux.Method("GET", "/metrics", app.Metrics.ProtectedHandler(app.Config.Metrics.Token))
 
 	// register routes
 	mux.Get("/", app.Home)
-	mux.Post("/login", app.Login)
+	mux.Group(func(mux chi.Router) {
+		mux.Use(app.rateLimit("auth", app.Config.RateLimit.Auth, app.clientKey))
+		mux.Post("/login", app.Login)
+		mux.Get("/login/{provider}", app.ExternalLogin)
+		mux.Get("/login/{provider}/callback", app.ExternalLoginCallback)
+		mux.Post("/login/passkey", app.PasskeyLogin)
+	})
+	mux.Post("/login/passkey/options", app.PasskeyLoginOptions)
+	mux.Post("/logout", app.Logout)
 
 	mux.Route("/user", func(mux chi.Router){
 		mux.Use(app.auth)
 		mux.Get("/profile", app.Profile)
-		mux.Post("/upload-profile-pic", app.UploadProfilePic)
+		mux.Post("/locale", app.SaveLocale)
+		mux.Get("/sessions", app.Sessions)
+		mux.Post("/sessions/revoke", app.RevokeSession)
+		mux.Post("/sessions/revoke-others", app.RevokeOtherSessions)
+		mux.Post("/api-keys", app.CreateAPIKey)
+		mux.Post("/api-keys/revoke", app.RevokeAPIKey)
+		mux.Post("/passkeys/options", app.PasskeyOptions)
+		mux.Post("/passkeys", app.RegisterPasskey)
+		mux.Post("/passkeys/delete", app.DeletePasskey)
+		mux.Post("/identities/{provider}", app.LinkIdentity)
+		mux.With(app.rateLimit("upload", app.Config.RateLimit.Upload, app.userKey)).Post("/upload-profile-pic", app.UploadProfilePic)
 	})
 
+	// where users of the OpenID Connect provider consent to log in to other
+	// applications
+	mux.Route("/oauth", func(mux chi.Router) {
+		mux.Use(app.auth)
+		mux.Get("/authorize", app.Authorize)
+		mux.Post("/authorize", app.AuthorizeDecision)
+	})
+
+	mux.Route("/admin", func(mux chi.Router) {
+		mux.Use(app.auth)
+		mux.Use(app.admin)
+		mux.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		})
+		mux.Get("/users", app.AdminUsers)
+		mux.Get("/users/new", app.AdminNewUser)
+		mux.Post("/users", app.AdminCreateUser)
+		mux.Get("/users/{userID}", app.AdminEditUser)
+		mux.Post("/users/{userID}", app.AdminUpdateUser)
+		mux.Post("/users/{userID}/password", app.AdminResetPassword)
+		mux.Post("/users/{userID}/promote", app.AdminPromoteUser)
+		mux.Post("/users/{userID}/demote", app.AdminDemoteUser)
+		mux.Post("/users/{userID}/delete", app.AdminDeleteUser)
+		mux.Get("/clients", app.AdminClients)
+		mux.Post("/clients", app.AdminCreateClient)
+		mux.Post("/clients/{clientID}/delete", app.AdminDeleteClient)
+	})
+
+	// uploaded files are kept on disk, next to the static assets
+	mux.Handle("/static/img/*", http.StripPrefix("/static/img", uploads.Serve(uploadPath)))
+
 	// static assets
-	fileServer := http.FileServer(http.Dir("./static/"))
-	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+	mux.Handle("/static/*", http.StripPrefix("/static", app.Static))
 
 	return mux
 }
\ No newline at end of file
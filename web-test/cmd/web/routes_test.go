@@ -15,8 +15,39 @@ func Test_application_routes(t *testing.T) {
 	}{
 		{"/", "GET"},
 		{"/login", "POST"},
+		{"/logout", "POST"},
 		{"/user/profile", "GET"},
+		{"/user/locale", "POST"},
+		{"/user/sessions", "GET"},
+		{"/user/sessions/revoke", "POST"},
+		{"/user/sessions/revoke-others", "POST"},
+		{"/user/api-keys", "POST"},
+		{"/user/api-keys/revoke", "POST"},
+		{"/user/passkeys/options", "POST"},
+		{"/user/passkeys", "POST"},
+		{"/user/passkeys/delete", "POST"},
+		{"/user/identities/{provider}", "POST"},
+		{"/login/passkey/options", "POST"},
+		{"/login/passkey", "POST"},
+		{"/admin/users", "GET"},
+		{"/admin/users/new", "GET"},
+		{"/admin/users", "POST"},
+		{"/admin/users/{userID}", "GET"},
+		{"/admin/users/{userID}", "POST"},
+		{"/admin/users/{userID}/password", "POST"},
+		{"/admin/users/{userID}/promote", "POST"},
+		{"/admin/users/{userID}/demote", "POST"},
+		{"/admin/users/{userID}/delete", "POST"},
+		{"/admin/clients", "GET"},
+		{"/admin/clients", "POST"},
+		{"/admin/clients/{clientID}/delete", "POST"},
+		{"/oauth/authorize", "GET"},
+		{"/oauth/authorize", "POST"},
 		{"/static/*", "GET"},
+		{"/static/img/*", "GET"},
+		{"/healthz", "GET"},
+		{"/readyz", "GET"},
+		{"/metrics", "GET"},
 	}
 
 	mux := app.routes()
@@ -3,17 +3,140 @@ package main
 import (
 	"net/http"
 	"time"
+	"webapp/pkg/config"
+	"webapp/pkg/data"
+	"webapp/pkg/i18n"
+	"webapp/pkg/repository"
 
 	"github.com/alexedwards/scs/v2"
 )
 
+// lastSeenResolution limits how often the last seen time of a session is
+// updated, so that browsing does not rewrite the session on every request.
+const lastSeenResolution = time.Minute
 
-func getSession() *scs.SessionManager {
+func getSession(cfg *config.Config, store repository.SessionStore) *scs.SessionManager {
 	session := scs.New()
-	session.Lifetime = 24 * time.Hour
+	session.Store = store
+	session.Lifetime = time.Duration(cfg.Session.Lifetime)
 	session.Cookie.Persist = true
-	session.Cookie.SameSite = http.SameSiteLaxMode
-	session.Cookie.Secure = true
+	session.Cookie.SameSite = cfg.Cookie.SameSiteMode()
+	session.Cookie.Secure = cfg.Cookie.Secure
 
 	return session
-}
\ No newline at end of file
+}
+
+// trackSession records the device, address and time a logged in session was
+// last used from, for the sessions page.
+func (app *application) trackSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.Session.Exists(r.Context(), data.SessionUserIDKey) {
+			app.touchSession(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) touchSession(r *http.Request) {
+	ctx := r.Context()
+
+	if ua := r.UserAgent(); app.Session.GetString(ctx, data.SessionUserAgentKey) != ua {
+		app.Session.Put(ctx, data.SessionUserAgentKey, ua)
+	}
+
+	if ip := app.ipFromContext(ctx); app.Session.GetString(ctx, data.SessionIPKey) != ip {
+		app.Session.Put(ctx, data.SessionIPKey, ip)
+	}
+
+	if now := time.Now(); now.Sub(app.Session.GetTime(ctx, data.SessionLastSeenKey)) > lastSeenResolution {
+		app.Session.Put(ctx, data.SessionLastSeenKey, now.UTC().Truncate(time.Second))
+	}
+}
+
+// Logout destroys the session, and starts a fresh one to carry the flash message.
+func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := app.Session.Destroy(r.Context()); err != nil {
+		app.logError(r, "could not destroy session", err)
+		http.Error(w, "could not log out", http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.Session.RenewToken(r.Context())
+	app.flash(r.Context(), FlashInfo, i18n.T(r.Context(), "flash.logged_out"))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Sessions lists the active sessions of the logged in user.
+func (app *application) Sessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.SessionStore.UserSessions(r.Context(), app.sessionUserID(r))
+	if err != nil {
+		app.logError(r, "could not list sessions", err)
+		http.Error(w, "could not list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	current := app.Session.Token(r.Context())
+
+	var rows []map[string]any
+	for _, s := range sessions {
+		rows = append(rows, map[string]any{
+			"ID":        s.ID(),
+			"UserAgent": s.UserAgent,
+			"IP":        s.IP,
+			"LastSeen":  s.LastSeen,
+			"Current":   s.Token == current,
+		})
+	}
+
+	_ = app.render(w, r, "sessions.page.gohtml", &TemplateData{Data: map[string]any{"sessions": rows}})
+}
+
+// RevokeSession logs the user out of one of their other sessions. The form
+// names the session by its public id.
+func (app *application) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PostFormValue("session")
+
+	app.revokeSessions(w, r, func(s data.Session) bool {
+		return s.ID() == id
+	})
+}
+
+// RevokeOtherSessions logs the user out everywhere but here.
+func (app *application) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	app.revokeSessions(w, r, func(data.Session) bool {
+		return true
+	})
+}
+
+func (app *application) revokeSessions(w http.ResponseWriter, r *http.Request, match func(data.Session) bool) {
+	sessions, err := app.SessionStore.UserSessions(r.Context(), app.sessionUserID(r))
+	if err != nil {
+		app.logError(r, "could not list sessions", err)
+		http.Error(w, "could not list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	current := app.Session.Token(r.Context())
+	revoked := 0
+
+	for _, s := range sessions {
+		if s.Token == current || !match(s) {
+			continue
+		}
+
+		if err := app.SessionStore.DeleteCtx(r.Context(), s.Token); err != nil {
+			app.logError(r, "could not revoke session", err)
+			http.Error(w, "could not revoke session", http.StatusInternalServerError)
+			return
+		}
+		revoked++
+	}
+
+	if revoked == 0 {
+		app.flash(r.Context(), FlashWarning, i18n.T(r.Context(), "flash.no_session_revoked"))
+	} else {
+		app.flash(r.Context(), FlashSuccess, i18n.T(r.Context(), "flash.sessions_revoked"))
+	}
+
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
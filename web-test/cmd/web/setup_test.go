@@ -1,18 +1,44 @@
 package main
 
 import (
+	"encoding/gob"
+	"log"
 	"os"
 	"testing"
+	"time"
+	"webapp/pkg/clientip"
+	"webapp/pkg/config"
+	"webapp/pkg/i18n"
+	"webapp/pkg/logging"
+	"webapp/pkg/metrics"
+	"webapp/pkg/ratelimit"
 	"webapp/pkg/repository/dbrepo"
+	"webapp/pkg/webauthn"
 )
 
 var app application
 
 func TestMain(m *testing.M) {
-	pathToTemplates = "./../../templates/"
+	gob.Register(time.Time{})
 
-	app.Session = getSession()
+	app.Config = config.Default()
+	// the tests log in over and over from the same address, which the
+	// default limit on logins would soon stop
+	app.Config.RateLimit.Auth.Requests = 1000
+	app.Metrics = metrics.New()
+	app.Logger = logging.Discard()
+	app.IPResolver, _ = clientip.NewResolver(clientip.XForwardedFor, []string{"10.0.0.0/8"})
+	app.RateLimitStore = ratelimit.NewMemoryStore()
+	app.SessionStore = &dbrepo.TestSessionStore{}
+	app.Session = getSession(app.Config, app.SessionStore)
+	app.UserCache = newUserCache(time.Duration(app.Config.Session.UserCacheTTL))
 	app.DB = &dbrepo.TestDBRepo{}
+	app.I18n = i18n.Default()
+	app.WebAuthn = webauthn.New(app.Config.WebAuthn)
+
+	if err := app.loadAssets(); err != nil {
+		log.Fatal(err)
+	}
 
 	os.Exit(m.Run())
 }
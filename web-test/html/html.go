@@ -0,0 +1,9 @@
+// Package html embeds the single page application served by the api.
+package html
+
+import "embed"
+
+// FS holds index.html.
+//
+//go:embed index.html
+var FS embed.FS
@@ -0,0 +1,31 @@
+// Package openapi embeds the OpenAPI description of the api, and a page
+// which renders it with Swagger UI.
+package openapi
+
+import (
+	"embed"
+	"net/http"
+)
+
+//go:embed openapi.json docs.html
+var files embed.FS
+
+// Spec returns the OpenAPI 3.1 document, as JSON.
+func Spec() []byte {
+	b, _ := files.ReadFile("openapi.json")
+	return b
+}
+
+// SpecHandler serves the OpenAPI document.
+func SpecHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(Spec())
+}
+
+// DocsHandler serves a page for browsing and trying out the api, which loads
+// the document from /openapi.json.
+func DocsHandler(w http.ResponseWriter, r *http.Request) {
+	b, _ := files.ReadFile("docs.html")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,593 @@
+// Code generated by gen from the OpenAPI document; DO NOT EDIT.
+
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// APIKey is a personal API key, without the key itself.
+type APIKey struct {
+	CreatedAt  string `json:"created_at"`
+	ExpiresAt  string `json:"expires_at"`
+	ID         int    `json:"id"`
+	LastUsedAt string `json:"last_used_at"`
+	Name       string `json:"name"`
+	// The start of the key after wtk_, to tell keys apart.
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	UserID int      `json:"user_id"`
+}
+
+// AuthenticationResponse is the signature navigator.credentials.get made, as PublicKeyCredential.toJSON writes it.
+type AuthenticationResponse struct {
+	AuthenticatorAttachment *string                        `json:"authenticatorAttachment,omitempty"`
+	ClientExtensionResults  map[string]any                 `json:"clientExtensionResults"`
+	ID                      string                         `json:"id"`
+	RawId                   string                         `json:"rawId"`
+	Response                AuthenticatorAssertionResponse `json:"response"`
+	Type                    string                         `json:"type"`
+}
+
+// AuthenticatorAssertionResponse is what an authenticator answers when it signs a challenge.
+type AuthenticatorAssertionResponse struct {
+	AuthenticatorData string  `json:"authenticatorData"`
+	ClientDataJSON    string  `json:"clientDataJSON"`
+	Signature         string  `json:"signature"`
+	UserHandle        *string `json:"userHandle,omitempty"`
+}
+
+// AuthenticatorAttestationResponse is what an authenticator answers when it makes a passkey.
+type AuthenticatorAttestationResponse struct {
+	AttestationObject  string   `json:"attestationObject"`
+	AuthenticatorData  *string  `json:"authenticatorData,omitempty"`
+	ClientDataJSON     string   `json:"clientDataJSON"`
+	PublicKey          *string  `json:"publicKey,omitempty"`
+	PublicKeyAlgorithm *int     `json:"publicKeyAlgorithm,omitempty"`
+	Transports         []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelectionCriteria is what is asked of authenticators.
+type AuthenticatorSelectionCriteria struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreatedAPIKey is a new API key, the only time the key is shown.
+type CreatedAPIKey struct {
+	APIKey APIKey `json:"api_key"`
+	Key    string `json:"key"`
+}
+
+// Credentials is the email address and password a user logs in with.
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Error is an error reported by the api.
+type Error struct {
+	// Stable, machine-readable code, e.g. unauthorized or validation_failed.
+	Code string `json:"code"`
+	// Error messages by field, for validation_failed.
+	Fields map[string][]string `json:"fields,omitempty"`
+	// Message in the language of the request.
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the body of responses with an error status.
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// ExternalLogin is what a client got back from logging a user in at an external provider.
+type ExternalLogin struct {
+	// The authorization code the provider sent back.
+	Code string `json:"code"`
+	// The PKCE code verifier of the code_challenge the user was sent with.
+	CodeVerifier string `json:"code_verifier"`
+	// The nonce the user was sent with.
+	Nonce string `json:"nonce"`
+	// The redirect_uri the user was sent to the provider with.
+	RedirectUri string `json:"redirect_uri"`
+}
+
+// Health is the result of a health check.
+type Health struct {
+	Checks map[string]string `json:"checks,omitempty"`
+	Status string            `json:"status"`
+}
+
+// IdentityProvider is an external OpenID Connect provider users may log in with.
+type IdentityProvider struct {
+	// The client id to send users to the provider with.
+	ClientID string `json:"client_id"`
+	// Where to find the discovery document of the provider.
+	Issuer string `json:"issuer"`
+	// What to show users.
+	Label string `json:"label"`
+	// Identifies the provider in urls.
+	Name string `json:"name"`
+}
+
+// JSONPatch is a list of JSON Patch operations.
+type JSONPatch []JSONPatchOperation
+
+// JSONPatchOperation is one JSON Patch operation.
+type JSONPatchOperation struct {
+	From *string `json:"from,omitempty"`
+	Op   string  `json:"op"`
+	// JSON Pointer to the field, e.g. /last_name.
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// JWK is a public key in JSON Web Key form.
+type JWK struct {
+	Alg string `json:"alg"`
+	E   string `json:"e"`
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	Use string `json:"use"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewAPIKey is the name, scopes and lifetime of a new API key.
+type NewAPIKey struct {
+	ExpiresInDays *int     `json:"expires_in_days,omitempty"`
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+}
+
+// NewPasskey is the name of a new passkey, and the credential an authenticator made for it.
+type NewPasskey struct {
+	Credential RegistrationResponse `json:"credential"`
+	Name       string               `json:"name"`
+}
+
+// OAuthError is an error of the OpenID Connect provider, as OAuth 2.0 reports them.
+type OAuthError struct {
+	Error            string  `json:"error"`
+	ErrorDescription *string `json:"error_description,omitempty"`
+}
+
+// OIDCIntrospection is whether an access token is active, and what it grants when it is.
+type OIDCIntrospection struct {
+	Active    bool    `json:"active"`
+	ClientID  *string `json:"client_id,omitempty"`
+	Exp       *int    `json:"exp,omitempty"`
+	Iat       *int    `json:"iat,omitempty"`
+	Iss       *string `json:"iss,omitempty"`
+	Scope     *string `json:"scope,omitempty"`
+	Sub       *string `json:"sub,omitempty"`
+	TokenType *string `json:"token_type,omitempty"`
+}
+
+// OIDCMetadata is the discovery document of the OpenID Connect provider.
+type OIDCMetadata struct {
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	Issuer                            string   `json:"issuer"`
+	JwksUri                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+}
+
+// OIDCTokens is the tokens an authorization code is exchanged for.
+type OIDCTokens struct {
+	// Opaque, and only good for the userinfo endpoint.
+	AccessToken string `json:"access_token"`
+	// Seconds until the access token expires.
+	ExpiresIn int `json:"expires_in"`
+	// A JWT signed with RS256 by a key of /oauth/jwks.
+	IDToken   string `json:"id_token"`
+	Scope     string `json:"scope"`
+	TokenType string `json:"token_type"`
+}
+
+// Passkey is a passkey registered to log in with, without its key.
+type Passkey struct {
+	CreatedAt  string `json:"created_at"`
+	ID         int    `json:"id"`
+	LastUsedAt string `json:"last_used_at"`
+	Name       string `json:"name"`
+	UserID     int    `json:"user_id"`
+}
+
+// PasswordChange is a new password, and the current one.
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ProfilePicUpload is a profile picture sent as JSON.
+type ProfilePicUpload struct {
+	// The image, base64 encoded.
+	Content []byte `json:"content"`
+	// Name of the file; it is stored with the extension of the type of its content.
+	FileName *string `json:"file_name,omitempty"`
+}
+
+// PublicKeyCredentialCreationOptions is the options of navigator.credentials.create, with binary fields base64url encoded.
+type PublicKeyCredentialCreationOptions struct {
+	Attestation            string                         `json:"attestation"`
+	AuthenticatorSelection AuthenticatorSelectionCriteria `json:"authenticatorSelection"`
+	Challenge              string                         `json:"challenge"`
+	// The passkeys the user already has, which cannot be registered again.
+	ExcludeCredentials []PublicKeyCredentialDescriptor `json:"excludeCredentials"`
+	PubKeyCredParams   []PublicKeyCredentialParameters `json:"pubKeyCredParams"`
+	Rp                 PublicKeyCredentialRpEntity     `json:"rp"`
+	// Milliseconds the user has to answer.
+	Timeout int                           `json:"timeout"`
+	User    PublicKeyCredentialUserEntity `json:"user"`
+}
+
+// PublicKeyCredentialDescriptor is a passkey, by its credential id.
+type PublicKeyCredentialDescriptor struct {
+	// The credential id.
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// PublicKeyCredentialParameters is a kind of key accepted.
+type PublicKeyCredentialParameters struct {
+	// A COSE algorithm, such as -7 for ES256.
+	Alg  int    `json:"alg"`
+	Type string `json:"type"`
+}
+
+// PublicKeyCredentialRequestOptions is the options of navigator.credentials.get, with binary fields base64url encoded.
+type PublicKeyCredentialRequestOptions struct {
+	AllowCredentials []PublicKeyCredentialDescriptor `json:"allowCredentials"`
+	Challenge        string                          `json:"challenge"`
+	RpId             string                          `json:"rpId"`
+	// Milliseconds the user has to answer.
+	Timeout          int    `json:"timeout"`
+	UserVerification string `json:"userVerification"`
+}
+
+// PublicKeyCredentialRpEntity is the site passkeys are registered with.
+type PublicKeyCredentialRpEntity struct {
+	// The domain passkeys are bound to.
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// PublicKeyCredentialUserEntity is the user a passkey is registered for.
+type PublicKeyCredentialUserEntity struct {
+	DisplayName string `json:"displayName"`
+	// The user handle, which authenticators store with the passkey.
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// RegistrationResponse is the passkey navigator.credentials.create made, as PublicKeyCredential.toJSON writes it.
+type RegistrationResponse struct {
+	AuthenticatorAttachment *string                          `json:"authenticatorAttachment,omitempty"`
+	ClientExtensionResults  map[string]any                   `json:"clientExtensionResults"`
+	ID                      string                           `json:"id"`
+	RawId                   string                           `json:"rawId"`
+	Response                AuthenticatorAttestationResponse `json:"response"`
+	Type                    string                           `json:"type"`
+}
+
+// TokenPairs is a short lived access token and the refresh token to renew it.
+type TokenPairs struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// User is a user of the application.
+type User struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	ID        int    `json:"id"`
+	IsAdmin   int    `json:"is_admin"`
+	LastName  string `json:"last_name"`
+	// Preferred language, e.g. pt-BR; empty to follow Accept-Language.
+	Locale string `json:"locale"`
+	// Where the profile picture is served, if the user has one; set with PUT /v1/users/{userID}/profile-pic.
+	ProfilePicURL *string `json:"profile_pic_url,omitempty"`
+}
+
+// UserInfo is the claims about a user the granted scopes let a client see.
+type UserInfo struct {
+	Email         *string `json:"email,omitempty"`
+	EmailVerified *bool   `json:"email_verified,omitempty"`
+	FamilyName    *string `json:"family_name,omitempty"`
+	GivenName     *string `json:"given_name,omitempty"`
+	Locale        *string `json:"locale,omitempty"`
+	Name          *string `json:"name,omitempty"`
+	Sub           string  `json:"sub"`
+}
+
+// UserPatch is changes to some fields of a user.
+type UserPatch struct {
+	Email     *string `json:"email,omitempty"`
+	FirstName *string `json:"first_name,omitempty"`
+	IsAdmin   *int    `json:"is_admin,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	// Preferred language, e.g. pt-BR; empty to follow Accept-Language.
+	Locale *string `json:"locale,omitempty"`
+}
+
+// Authenticate calls POST /v1/auth: log in with an email address and password.
+func (c *Client) Authenticate(ctx context.Context, body Credentials) (TokenPairs, error) {
+	var out TokenPairs
+	err := c.do(ctx, request{method: "POST", path: "/v1/auth", json: body}, &out)
+	return out, err
+}
+
+// AuthenticateExternal calls POST /v1/auth/providers/{provider}: log in with an external OpenID Connect provider.
+func (c *Client) AuthenticateExternal(ctx context.Context, provider string, body ExternalLogin) (TokenPairs, error) {
+	var out TokenPairs
+	err := c.do(ctx, request{method: "POST", path: "/v1/auth/providers/" + url.PathEscape(fmt.Sprint(provider)), json: body}, &out)
+	return out, err
+}
+
+// AuthenticatePasskey calls POST /v1/auth/passkey: log in with a passkey.
+func (c *Client) AuthenticatePasskey(ctx context.Context, body AuthenticationResponse) (TokenPairs, error) {
+	var out TokenPairs
+	err := c.do(ctx, request{method: "POST", path: "/v1/auth/passkey", json: body}, &out)
+	return out, err
+}
+
+// ChangePassword calls POST /v1/me/password: change your password.
+func (c *Client) ChangePassword(ctx context.Context, body PasswordChange) error {
+	return c.do(ctx, request{method: "POST", path: "/v1/me/password", json: body}, nil)
+}
+
+// CreateAPIKey calls POST /v1/me/api-keys: create an API key.
+func (c *Client) CreateAPIKey(ctx context.Context, body NewAPIKey) (CreatedAPIKey, error) {
+	var out CreatedAPIKey
+	err := c.do(ctx, request{method: "POST", path: "/v1/me/api-keys", json: body}, &out)
+	return out, err
+}
+
+// CreatePasskey calls POST /v1/me/passkeys: register a passkey.
+func (c *Client) CreatePasskey(ctx context.Context, body NewPasskey) (Passkey, error) {
+	var out Passkey
+	err := c.do(ctx, request{method: "POST", path: "/v1/me/passkeys", json: body}, &out)
+	return out, err
+}
+
+// CreateUser calls POST /v1/users: create a user.
+func (c *Client) CreateUser(ctx context.Context, body User) (User, error) {
+	var out User
+	err := c.do(ctx, request{method: "POST", path: "/v1/users", json: body}, &out)
+	return out, err
+}
+
+// DeleteMe calls DELETE /v1/me: delete your account.
+func (c *Client) DeleteMe(ctx context.Context) error {
+	return c.do(ctx, request{method: "DELETE", path: "/v1/me"}, nil)
+}
+
+// DeletePasskey calls DELETE /v1/me/passkeys/{passkeyID}: delete a passkey.
+func (c *Client) DeletePasskey(ctx context.Context, passkeyID int) error {
+	return c.do(ctx, request{method: "DELETE", path: "/v1/me/passkeys/" + url.PathEscape(fmt.Sprint(passkeyID))}, nil)
+}
+
+// DeleteProfilePic calls DELETE /v1/users/{userID}/profile-pic: delete the profile picture of a user.
+func (c *Client) DeleteProfilePic(ctx context.Context, userID int) error {
+	return c.do(ctx, request{method: "DELETE", path: "/v1/users/" + url.PathEscape(fmt.Sprint(userID)) + "/profile-pic"}, nil)
+}
+
+// DeleteUser calls DELETE /v1/users/{userID}: delete one user.
+func (c *Client) DeleteUser(ctx context.Context, userID int) error {
+	return c.do(ctx, request{method: "DELETE", path: "/v1/users/" + url.PathEscape(fmt.Sprint(userID))}, nil)
+}
+
+// GetMe calls GET /v1/me: get the account the token was issued to.
+func (c *Client) GetMe(ctx context.Context) (User, error) {
+	var out User
+	err := c.do(ctx, request{method: "GET", path: "/v1/me"}, &out)
+	return out, err
+}
+
+// GetProfilePic calls GET /v1/users/{userID}/profile-pic: download the profile picture of a user.
+func (c *Client) GetProfilePic(ctx context.Context, userID int) ([]byte, error) {
+	var out []byte
+	err := c.do(ctx, request{method: "GET", path: "/v1/users/" + url.PathEscape(fmt.Sprint(userID)) + "/profile-pic"}, &out)
+	return out, err
+}
+
+// GetUser calls GET /v1/users/{userID}: get one user.
+func (c *Client) GetUser(ctx context.Context, userID int) (User, error) {
+	var out User
+	err := c.do(ctx, request{method: "GET", path: "/v1/users/" + url.PathEscape(fmt.Sprint(userID))}, &out)
+	return out, err
+}
+
+// ListAPIKeys calls GET /v1/me/api-keys: list your API keys.
+func (c *Client) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	var out []APIKey
+	err := c.do(ctx, request{method: "GET", path: "/v1/me/api-keys"}, &out)
+	return out, err
+}
+
+// ListIdentityProviders calls GET /v1/auth/providers: list the external OpenID Connect providers users may log in with.
+func (c *Client) ListIdentityProviders(ctx context.Context) ([]IdentityProvider, error) {
+	var out []IdentityProvider
+	err := c.do(ctx, request{method: "GET", path: "/v1/auth/providers"}, &out)
+	return out, err
+}
+
+// ListPasskeys calls GET /v1/me/passkeys: list your passkeys.
+func (c *Client) ListPasskeys(ctx context.Context) ([]Passkey, error) {
+	var out []Passkey
+	err := c.do(ctx, request{method: "GET", path: "/v1/me/passkeys"}, &out)
+	return out, err
+}
+
+// ListUsers calls GET /v1/users: list all users.
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	var out []User
+	err := c.do(ctx, request{method: "GET", path: "/v1/users"}, &out)
+	return out, err
+}
+
+// Live calls GET /healthz: liveness probe.
+func (c *Client) Live(ctx context.Context) (Health, error) {
+	var out Health
+	err := c.do(ctx, request{method: "GET", path: "/healthz"}, &out)
+	return out, err
+}
+
+// Metrics calls GET /metrics: metrics in the Prometheus text format.
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	var out string
+	err := c.do(ctx, request{method: "GET", path: "/metrics"}, &out)
+	return out, err
+}
+
+// OidcDiscovery calls GET /.well-known/openid-configuration: the discovery document of the OpenID Connect provider.
+func (c *Client) OidcDiscovery(ctx context.Context) (OIDCMetadata, error) {
+	var out OIDCMetadata
+	err := c.do(ctx, request{method: "GET", path: "/.well-known/openid-configuration"}, &out)
+	return out, err
+}
+
+// OidcIntrospect calls POST /oauth/introspect: tell whether an access token of the calling client is active.
+func (c *Client) OidcIntrospect(ctx context.Context, clientID string, clientSecret string, token string) (OIDCIntrospection, error) {
+	var out OIDCIntrospection
+	err := c.do(ctx, request{method: "POST", path: "/oauth/introspect", form: url.Values{"client_id": {clientID}, "client_secret": {clientSecret}, "token": {token}}}, &out)
+	return out, err
+}
+
+// OidcKeys calls GET /oauth/jwks: the keys ID tokens are signed with.
+func (c *Client) OidcKeys(ctx context.Context) (JWKS, error) {
+	var out JWKS
+	err := c.do(ctx, request{method: "GET", path: "/oauth/jwks"}, &out)
+	return out, err
+}
+
+// OidcRevoke calls POST /oauth/revoke: revoke an access token of the calling client.
+func (c *Client) OidcRevoke(ctx context.Context, clientID string, clientSecret string, token string) error {
+	return c.do(ctx, request{method: "POST", path: "/oauth/revoke", form: url.Values{"client_id": {clientID}, "client_secret": {clientSecret}, "token": {token}}}, nil)
+}
+
+// OidcToken calls POST /oauth/token: exchange an authorization code for an access token and an ID token.
+func (c *Client) OidcToken(ctx context.Context, clientID string, clientSecret string, code string, codeVerifier string, grantType string, redirectUri string) (OIDCTokens, error) {
+	var out OIDCTokens
+	err := c.do(ctx, request{method: "POST", path: "/oauth/token", form: url.Values{"client_id": {clientID}, "client_secret": {clientSecret}, "code": {code}, "code_verifier": {codeVerifier}, "grant_type": {grantType}, "redirect_uri": {redirectUri}}}, &out)
+	return out, err
+}
+
+// OidcUserInfo calls GET /oauth/userinfo: the claims about the user an access token was issued for.
+func (c *Client) OidcUserInfo(ctx context.Context) (UserInfo, error) {
+	var out UserInfo
+	err := c.do(ctx, request{method: "GET", path: "/oauth/userinfo"}, &out)
+	return out, err
+}
+
+// OidcUserInfoPost calls POST /oauth/userinfo: the claims about the user an access token was issued for.
+func (c *Client) OidcUserInfoPost(ctx context.Context) (UserInfo, error) {
+	var out UserInfo
+	err := c.do(ctx, request{method: "POST", path: "/oauth/userinfo"}, &out)
+	return out, err
+}
+
+// OpenAPI calls GET /openapi.json: this document.
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.do(ctx, request{method: "GET", path: "/openapi.json"}, &out)
+	return out, err
+}
+
+// PasskeyLoginOptions calls GET /v1/auth/passkey/options: start logging in with a passkey.
+func (c *Client) PasskeyLoginOptions(ctx context.Context) (PublicKeyCredentialRequestOptions, error) {
+	var out PublicKeyCredentialRequestOptions
+	err := c.do(ctx, request{method: "GET", path: "/v1/auth/passkey/options"}, &out)
+	return out, err
+}
+
+// PasskeyOptions calls GET /v1/me/passkeys/options: start registering a passkey.
+func (c *Client) PasskeyOptions(ctx context.Context) (PublicKeyCredentialCreationOptions, error) {
+	var out PublicKeyCredentialCreationOptions
+	err := c.do(ctx, request{method: "GET", path: "/v1/me/passkeys/options"}, &out)
+	return out, err
+}
+
+// Ready calls GET /readyz: readiness probe, checking the database and upload directory.
+func (c *Client) Ready(ctx context.Context) (Health, error) {
+	var out Health
+	err := c.do(ctx, request{method: "GET", path: "/readyz"}, &out)
+	return out, err
+}
+
+// Refresh calls POST /v1/refresh-token: trade a refresh token which is about to expire for a new token pair.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (TokenPairs, error) {
+	var out TokenPairs
+	err := c.do(ctx, request{method: "POST", path: "/v1/refresh-token", form: url.Values{"refresh_token": {refreshToken}}}, &out)
+	return out, err
+}
+
+// ReplaceUser calls PUT /v1/users/{userID}: replace every field of a user; fields left out are reset.
+func (c *Client) ReplaceUser(ctx context.Context, userID int, body User) (User, error) {
+	var out User
+	err := c.do(ctx, request{method: "PUT", path: "/v1/users/" + url.PathEscape(fmt.Sprint(userID)), json: body}, &out)
+	return out, err
+}
+
+// RevokeAPIKey calls DELETE /v1/me/api-keys/{keyID}: revoke an API key.
+func (c *Client) RevokeAPIKey(ctx context.Context, keyID int) error {
+	return c.do(ctx, request{method: "DELETE", path: "/v1/me/api-keys/" + url.PathEscape(fmt.Sprint(keyID))}, nil)
+}
+
+// UpdateMe calls PATCH /v1/me: change some fields of your account.
+func (c *Client) UpdateMe(ctx context.Context, body UserPatch) (User, error) {
+	var out User
+	err := c.do(ctx, request{method: "PATCH", path: "/v1/me", json: body, contentType: "application/merge-patch+json"}, &out)
+	return out, err
+}
+
+// UpdateProfilePic calls PUT /v1/users/{userID}/profile-pic: replace the profile picture of a user, sent as multipart or base64 encoded JSON.
+func (c *Client) UpdateProfilePic(ctx context.Context, userID int, body ProfilePicUpload) (User, error) {
+	var out User
+	err := c.do(ctx, request{method: "PUT", path: "/v1/users/" + url.PathEscape(fmt.Sprint(userID)) + "/profile-pic", json: body}, &out)
+	return out, err
+}
+
+// UpdateUser calls PATCH /v1/users/{userID}: change some fields of a user.
+func (c *Client) UpdateUser(ctx context.Context, userID int, body UserPatch) (User, error) {
+	var out User
+	err := c.do(ctx, request{method: "PATCH", path: "/v1/users/" + url.PathEscape(fmt.Sprint(userID)), json: body, contentType: "application/merge-patch+json"}, &out)
+	return out, err
+}
+
+// WebAuthenticate calls POST /v1/web/auth: log in, also setting the refresh token cookie.
+func (c *Client) WebAuthenticate(ctx context.Context, body Credentials) (TokenPairs, error) {
+	var out TokenPairs
+	err := c.do(ctx, request{method: "POST", path: "/v1/web/auth", json: body}, &out)
+	return out, err
+}
+
+// WebLogout calls GET /v1/web/logout: remove the refresh token cookie.
+func (c *Client) WebLogout(ctx context.Context) error {
+	return c.do(ctx, request{method: "GET", path: "/v1/web/logout"}, nil)
+}
+
+// WebRefresh calls GET /v1/web/refresh-token: get a new token pair with the refresh token cookie.
+func (c *Client) WebRefresh(ctx context.Context) (TokenPairs, error) {
+	var out TokenPairs
+	err := c.do(ctx, request{method: "GET", path: "/v1/web/refresh-token"}, &out)
+	return out, err
+}
@@ -0,0 +1,149 @@
+// Package apiclient is a Go client for the api. The types and methods are
+// generated from the OpenAPI document in package openapi; run go generate
+// after changing it.
+package apiclient
+
+//go:generate go run ./gen -o client.gen.go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the api at BaseURL.
+type Client struct {
+	// BaseURL is where the api is served, e.g. "https://api.example.com".
+	BaseURL string
+	// HTTPClient sends the requests. Give it a cookie jar to use the /web
+	// endpoints, which keep the refresh token in a cookie.
+	HTTPClient *http.Client
+	// Token is the access token sent with every request, if set.
+	Token string
+	// APIKey is a personal API key sent with every request instead of
+	// Token, if set.
+	APIKey string
+	// Language is sent as Accept-Language, for error messages in that
+	// language.
+	Language string
+}
+
+// New returns a client for the api at baseURL, using http.DefaultClient.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+// ResponseError is returned when the api answers with an error status.
+type ResponseError struct {
+	StatusCode int
+	// Body is the error the api reported, which is empty for responses
+	// without one, such as 429 Too Many Requests.
+	Body Error
+}
+
+func (e *ResponseError) Error() string {
+	if e.Body.Code == "" {
+		return fmt.Sprintf("apiclient: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("apiclient: %d %s: %s", e.StatusCode, e.Body.Code, e.Body.Message)
+}
+
+// ErrorCode returns the code of the api error in err, or "" if err is not a
+// *ResponseError.
+func ErrorCode(err error) string {
+	var re *ResponseError
+	if errors.As(err, &re) {
+		return re.Body.Code
+	}
+	return ""
+}
+
+// request is a call to the api, built by the generated methods.
+type request struct {
+	method string
+	path   string
+	// json is marshalled as the body when set, and form encoded when that
+	// is set.
+	json any
+	form url.Values
+	// contentType of a JSON body, when it is not application/json.
+	contentType string
+}
+
+// do sends req and decodes a successful response into out, which is a
+// pointer to the documented type, a *string for text, a *[]byte for other
+// content such as images, or nil when the response has no body.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	var body io.Reader
+	var contentType string
+	switch {
+	case req.json != nil:
+		b, err := json.Marshal(req.json)
+		if err != nil {
+			return err
+		}
+		body, contentType = strings.NewReader(string(b)), "application/json"
+		if req.contentType != "" {
+			contentType = req.contentType
+		}
+	case req.form != nil:
+		body, contentType = strings.NewReader(req.form.Encode()), "application/x-www-form-urlencoded"
+	}
+
+	r, err := http.NewRequestWithContext(ctx, req.method, c.BaseURL+req.path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	r.Header.Set("Accept", "application/json")
+	switch {
+	case c.APIKey != "":
+		r.Header.Set("X-API-Key", c.APIKey)
+	case c.Token != "":
+		r.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.Language != "" {
+		r.Header.Set("Accept-Language", c.Language)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		re := &ResponseError{StatusCode: resp.StatusCode}
+		var errResp ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil {
+			re.Body = errResp.Error
+		}
+		return re
+	}
+
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *string:
+		b, err := io.ReadAll(resp.Body)
+		*out = string(b)
+		return err
+	case *[]byte:
+		b, err := io.ReadAll(resp.Body)
+		*out = b
+		return err
+	default:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+}
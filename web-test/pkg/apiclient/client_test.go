@@ -0,0 +1,71 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got, gotBody = r, string(b)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/auth":
+			_, _ = w.Write([]byte(`{"access_token":"a","refresh_token":"r"}`))
+		case "/v1/users/7":
+			_, _ = w.Write([]byte(`{"id":7,"first_name":"Jack","last_name":"Smith","email":"jack@example.com","is_admin":0,"locale":""}`))
+		case "/v1/users":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"error":{"code":"validation_failed","message":"validation failed","fields":{"email":["Enter a valid email address"]}}}`))
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL + "/")
+	ctx := context.Background()
+
+	tokens, err := c.Authenticate(ctx, Credentials{Email: "admin@example.com", Password: "secret"})
+	if err != nil || tokens.AccessToken != "a" || tokens.RefreshToken != "r" {
+		t.Errorf("authenticate: got %+v, %v", tokens, err)
+	}
+	if got.Method != "POST" || got.Header.Get("Content-Type") != "application/json" || gotBody != `{"email":"admin@example.com","password":"secret"}` {
+		t.Errorf("authenticate: sent %s with %q and body %s", got.Method, got.Header.Get("Content-Type"), gotBody)
+	}
+
+	c.Token = tokens.AccessToken
+	c.Language = "pt-BR"
+	user, err := c.GetUser(ctx, 7)
+	if err != nil || user.ID != 7 || user.FirstName != "Jack" {
+		t.Errorf("get user: got %+v, %v", user, err)
+	}
+	if got.Header.Get("Authorization") != "Bearer a" || got.Header.Get("Accept-Language") != "pt-BR" {
+		t.Errorf("get user: expected the token and language to be sent, got %v", got.Header)
+	}
+
+	_, err = c.CreateUser(ctx, User{Email: "jack"})
+	var re *ResponseError
+	if !errors.As(err, &re) || re.StatusCode != http.StatusUnprocessableEntity || ErrorCode(err) != "validation_failed" {
+		t.Fatalf("create user: expected a validation error, got %v", err)
+	}
+	if re.Body.Fields["email"][0] != "Enter a valid email address" {
+		t.Errorf("create user: expected the field errors, got %v", re.Body.Fields)
+	}
+
+	_, err = c.Refresh(ctx, "r")
+	if !errors.As(err, &re) || re.StatusCode != http.StatusTooManyRequests || ErrorCode(err) != "" {
+		t.Errorf("refresh: expected a 429 without a body, got %v", err)
+	}
+	if got.Header.Get("Content-Type") != "application/x-www-form-urlencoded" || gotBody != "refresh_token=r" {
+		t.Errorf("refresh: sent %q with body %s", got.Header.Get("Content-Type"), gotBody)
+	}
+}
@@ -0,0 +1,450 @@
+// Command gen writes the types and methods of package apiclient from the
+// OpenAPI document of the api. It only knows the parts of OpenAPI the
+// document uses; it fails on anything else rather than guess.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"webapp/openapi"
+)
+
+func main() {
+	out := flag.String("o", "client.gen.go", "file to write")
+	flag.Parse()
+
+	src, err := generate(openapi.Spec())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type document struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]*schema   `json:"schemas"`
+		Responses map[string]*response `json:"responses"`
+	} `json:"components"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 any                `json:"type"`
+	Description          string             `json:"description"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties any                `json:"additionalProperties"`
+	ContentEncoding      string             `json:"contentEncoding"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type response struct {
+	Ref     string                `json:"$ref"`
+	Content map[string]*mediaType `json:"content"`
+}
+
+type operation struct {
+	OperationID string      `json:"operationId"`
+	Summary     string      `json:"summary"`
+	Deprecated  bool        `json:"deprecated"`
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]*mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]*response `json:"responses"`
+
+	method string
+	path   string
+}
+
+// methods are the HTTP methods of a path item; its other keys, such as
+// parameters, apply to all of them.
+var methods = []string{"get", "put", "post", "patch", "delete"}
+
+func generate(spec []byte) ([]byte, error) {
+	var doc document
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := writeType(&b, name, doc.Components.Schemas[name]); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+
+	ops, err := operations(doc)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if err := writeMethod(&b, doc, op); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", op.method, op.path, err)
+		}
+	}
+
+	// import only the packages the methods use
+	var src bytes.Buffer
+	src.WriteString("// Code generated by gen from the OpenAPI document; DO NOT EDIT.\n\n")
+	src.WriteString("package apiclient\n\nimport (\n")
+	for _, pkg := range []string{"context", "encoding/json", "fmt", "net/url"} {
+		if strings.Contains(b.String(), path.Base(pkg)+".") {
+			fmt.Fprintf(&src, "%q\n", pkg)
+		}
+	}
+	src.WriteString(")\n\n")
+	src.Write(b.Bytes())
+
+	return format.Source(src.Bytes())
+}
+
+func operations(doc document) ([]*operation, error) {
+	var ops []*operation
+	for path, item := range doc.Paths {
+		var shared []parameter
+		if raw, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(raw, &shared); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+
+		for _, method := range methods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+
+			op := &operation{method: strings.ToUpper(method), path: path}
+			if err := json.Unmarshal(raw, op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+			if op.OperationID == "" {
+				return nil, fmt.Errorf("%s %s has no operationId", method, path)
+			}
+			// new clients have no use for deprecated routes
+			if op.Deprecated {
+				continue
+			}
+			op.Parameters = append(append([]parameter{}, shared...), op.Parameters...)
+			ops = append(ops, op)
+		}
+	}
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].OperationID < ops[j].OperationID })
+	return ops, nil
+}
+
+func writeType(b *bytes.Buffer, name string, s *schema) error {
+	if s.Description != "" {
+		fmt.Fprintf(b, "// %s is %s.\n", name, lowerFirst(strings.TrimSuffix(s.Description, ".")))
+	}
+
+	if s.Properties == nil {
+		t, err := goType(s)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "type %s %s\n\n", name, t)
+		return nil
+	}
+
+	props := make([]string, 0, len(s.Properties))
+	for prop := range s.Properties {
+		props = append(props, prop)
+	}
+	sort.Strings(props)
+
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, prop := range props {
+		p := s.Properties[prop]
+		t, err := goType(p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", prop, err)
+		}
+
+		tag := prop
+		if !contains(s.Required, prop) {
+			tag += ",omitempty"
+			// so that zero values can be sent too
+			if !strings.HasPrefix(t, "[]") && !strings.HasPrefix(t, "map[") && t != "any" {
+				t = "*" + t
+			}
+		}
+		if p.Description != "" {
+			fmt.Fprintf(b, "// %s\n", strings.TrimSuffix(p.Description, ".")+".")
+		}
+		fmt.Fprintf(b, "%s %s `json:%q`\n", exported(prop), t, tag)
+	}
+	b.WriteString("}\n\n")
+	return nil
+}
+
+func goType(s *schema) (string, error) {
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok {
+			return "", fmt.Errorf("unsupported $ref %s", s.Ref)
+		}
+		return name, nil
+	}
+
+	// a nullable type is ["type", "null"]; nil is its zero value in Go for
+	// the types used
+	typ, _ := s.Type.(string)
+	if types, ok := s.Type.([]any); ok {
+		for _, t := range types {
+			if t != "null" {
+				typ, _ = t.(string)
+			}
+		}
+	}
+
+	switch typ {
+	case "":
+		// a schema without a type allows any value
+		return "any", nil
+	case "string":
+		// encoding/json sends []byte base64 encoded
+		if s.ContentEncoding == "base64" {
+			return "[]byte", nil
+		}
+		return "string", nil
+	case "integer":
+		return "int", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		if s.Items == nil {
+			return "", fmt.Errorf("array without items")
+		}
+		t, err := goType(s.Items)
+		return "[]" + t, err
+	case "object":
+		if s.Properties != nil {
+			return "", fmt.Errorf("inline objects are not supported, use a component schema")
+		}
+		values, ok := s.AdditionalProperties.(map[string]any)
+		if !ok {
+			return "map[string]any", nil
+		}
+		raw, _ := json.Marshal(values)
+		var v schema
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return "", err
+		}
+		t, err := goType(&v)
+		return "map[string]" + t, err
+	}
+	return "", fmt.Errorf("unsupported type %v", s.Type)
+}
+
+func writeMethod(b *bytes.Buffer, doc document, op *operation) error {
+	name := exported(op.OperationID)
+	args := []string{"ctx context.Context"}
+	req := fmt.Sprintf("method: %q, path: %s", op.method, pathExpr(op.path))
+
+	for _, p := range op.Parameters {
+		if p.In != "path" {
+			return fmt.Errorf("parameters in %s are not supported", p.In)
+		}
+		t, err := goType(p.Schema)
+		if err != nil {
+			return err
+		}
+		args = append(args, fmt.Sprintf("%s %s", p.Name, t))
+	}
+
+	if op.RequestBody != nil {
+		if ctype, mt := jsonBody(op.RequestBody.Content); mt != nil {
+			t, err := goType(mt.Schema)
+			if err != nil {
+				return err
+			}
+			args = append(args, "body "+t)
+			req += ", json: body"
+			if ctype != "application/json" {
+				req += fmt.Sprintf(", contentType: %q", ctype)
+			}
+		} else if mt, ok := op.RequestBody.Content["application/x-www-form-urlencoded"]; ok {
+			var fields []string
+			for field := range mt.Schema.Properties {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+
+			var values []string
+			for _, field := range fields {
+				arg := lowerFirst(exported(field))
+				args = append(args, arg+" string")
+				values = append(values, fmt.Sprintf("%q: {%s}", field, arg))
+			}
+			req += ", form: url.Values{" + strings.Join(values, ", ") + "}"
+		} else {
+			return fmt.Errorf("unsupported request body")
+		}
+	}
+
+	result, err := successType(doc, op)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b, "// %s calls %s %s: %s.\n", name, op.method, op.path, lowerFirst(op.Summary))
+	if result == "" {
+		fmt.Fprintf(b, "func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+		fmt.Fprintf(b, "return c.do(ctx, request{%s}, nil)\n}\n\n", req)
+		return nil
+	}
+
+	fmt.Fprintf(b, "func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), result)
+	fmt.Fprintf(b, "var out %s\n", result)
+	fmt.Fprintf(b, "err := c.do(ctx, request{%s}, &out)\n", req)
+	b.WriteString("return out, err\n}\n\n")
+	return nil
+}
+
+// jsonBodyTypes are the media types of JSON request bodies the client can
+// send, in order of preference.
+var jsonBodyTypes = []string{"application/json", "application/merge-patch+json"}
+
+// jsonBody returns the JSON media type of content the client sends.
+func jsonBody(content map[string]*mediaType) (string, *mediaType) {
+	for _, ctype := range jsonBodyTypes {
+		if mt, ok := content[ctype]; ok {
+			return ctype, mt
+		}
+	}
+	return "", nil
+}
+
+// successType returns the Go type of the body of the first 2xx response of
+// op, or "" if it has none.
+func successType(doc document, op *operation) (string, error) {
+	var codes []string
+	for code := range op.Responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return "", fmt.Errorf("no success response")
+	}
+	sort.Strings(codes)
+
+	resp := op.Responses[codes[0]]
+	if resp.Ref != "" {
+		name, _ := strings.CutPrefix(resp.Ref, "#/components/responses/")
+		if resp = doc.Components.Responses[name]; resp == nil {
+			return "", fmt.Errorf("unknown response %s", name)
+		}
+	}
+
+	if mt, ok := resp.Content["application/json"]; ok {
+		if mt.Schema == nil {
+			return "json.RawMessage", nil
+		}
+		return goType(mt.Schema)
+	}
+	if _, ok := resp.Content["text/plain"]; ok {
+		return "string", nil
+	}
+	if len(resp.Content) > 0 {
+		// anything else, such as an image, is returned as it is
+		return "[]byte", nil
+	}
+	return "", nil
+}
+
+// pathExpr returns a Go expression for path, with its parameters filled in
+// from the arguments of the same name.
+func pathExpr(path string) string {
+	if !strings.Contains(path, "{") {
+		return fmt.Sprintf("%q", path)
+	}
+
+	var parts []string
+	for path != "" {
+		before, rest, ok := strings.Cut(path, "{")
+		if before != "" {
+			parts = append(parts, fmt.Sprintf("%q", before))
+		}
+		if !ok {
+			break
+		}
+		param, after, _ := strings.Cut(rest, "}")
+		parts = append(parts, fmt.Sprintf("url.PathEscape(fmt.Sprint(%s))", param))
+		path = after
+	}
+	return strings.Join(parts, " + ")
+}
+
+// initialisms are written in upper case in Go names.
+var initialisms = map[string]bool{"id": true, "api": true, "url": true, "json": true, "http": true}
+
+// exported turns a snake_case or camelCase name into an exported Go name.
+func exported(name string) string {
+	var b strings.Builder
+	for _, word := range strings.Split(name, "_") {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		if word != "" {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	// keep initialisms such as "ID" whole
+	n := 1
+	for n < len(s) && s[n] >= 'A' && s[n] <= 'Z' && (n+1 == len(s) || s[n+1] >= 'A' && s[n+1] <= 'Z') {
+		n++
+	}
+	return strings.ToLower(s[:n]) + s[n:]
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
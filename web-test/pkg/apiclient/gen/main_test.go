@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"webapp/openapi"
+)
+
+func Test_generateIsUpToDate(t *testing.T) {
+	want, err := generate(openapi.Spec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile("../client.gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Error("client.gen.go is out of date with the OpenAPI document; run go generate ./pkg/apiclient")
+	}
+}
+
+func Test_pathExpr(t *testing.T) {
+	var tests = []struct {
+		path     string
+		expected string
+	}{
+		{"/users/", `"/users/"`},
+		{"/users/{userID}", `"/users/" + url.PathEscape(fmt.Sprint(userID))`},
+		{"/a/{x}/b/{y}", `"/a/" + url.PathEscape(fmt.Sprint(x)) + "/b/" + url.PathEscape(fmt.Sprint(y))`},
+	}
+
+	for _, e := range tests {
+		if got := pathExpr(e.path); got != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.path, e.expected, got)
+		}
+	}
+}
+
+func Test_exported(t *testing.T) {
+	var tests = []struct {
+		name     string
+		expected string
+	}{
+		{"first_name", "FirstName"},
+		{"id", "ID"},
+		{"is_admin", "IsAdmin"},
+		{"listUsers", "ListUsers"},
+		{"refresh_token", "RefreshToken"},
+	}
+
+	for _, e := range tests {
+		if got := exported(e.name); got != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, got)
+		}
+	}
+}
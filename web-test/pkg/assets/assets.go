@@ -0,0 +1,234 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// immutable is the Cache-Control value for content-hashed names, which
+// never change their contents.
+const immutable = "public, max-age=31536000, immutable"
+
+// Options configures Assets.
+type Options struct {
+	// Prefix is the URL path the files are served under, e.g. "/static".
+	Prefix string
+	// Disk serves files as they are on every request, without hashed names,
+	// compression or caching, so edits show up straight away. Meant for
+	// development, with fsys pointing at a directory on disk.
+	Disk bool
+}
+
+type file struct {
+	hash    string
+	ctype   string
+	content []byte
+	gzip    []byte
+	brotli  []byte
+}
+
+// Assets serves a set of static files, usually embedded in the binary. Every
+// file can be requested under its own name, which browsers must revalidate,
+// or under a name containing a hash of its contents, which they may cache
+// for a year. Compressible files are compressed with gzip and brotli once,
+// when Assets is created.
+type Assets struct {
+	opts   Options
+	files  map[string]*file
+	hashed map[string]*file
+	disk   http.Handler
+}
+
+// New reads every file in fsys.
+func New(fsys fs.FS, opts Options) (*Assets, error) {
+	opts.Prefix = strings.TrimSuffix(opts.Prefix, "/")
+
+	a := &Assets{
+		opts:   opts,
+		files:  make(map[string]*file),
+		hashed: make(map[string]*file),
+	}
+
+	if opts.Disk {
+		a.disk = http.FileServer(http.FS(fsys))
+		return a, nil
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		f, err := newFile(name, content)
+		if err != nil {
+			return err
+		}
+
+		a.files[name] = f
+		a.hashed[hashedName(name, f.hash)] = f
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func newFile(name string, content []byte) (*file, error) {
+	sum := sha256.Sum256(content)
+
+	f := &file{
+		hash:    hex.EncodeToString(sum[:5]),
+		ctype:   mime.TypeByExtension(path.Ext(name)),
+		content: content,
+	}
+	if f.ctype == "" {
+		f.ctype = http.DetectContentType(content)
+	}
+
+	if !compressible(f.ctype) {
+		return f, nil
+	}
+
+	var gz bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	var br bytes.Buffer
+	bw := brotli.NewWriterLevel(&br, brotli.BestCompression)
+	if _, err := bw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := bw.Close(); err != nil {
+		return nil, err
+	}
+
+	// only keep encodings which are worth it
+	if gz.Len() < len(content)*9/10 {
+		f.gzip = gz.Bytes()
+	}
+	if br.Len() < len(content)*9/10 {
+		f.brotli = br.Bytes()
+	}
+
+	return f, nil
+}
+
+func compressible(ctype string) bool {
+	ctype, _, _ = strings.Cut(ctype, ";")
+	switch {
+	case strings.HasPrefix(ctype, "text/"):
+		return true
+	case strings.HasSuffix(ctype, "+xml"), strings.HasSuffix(ctype, "/json"), strings.HasSuffix(ctype, "/javascript"):
+		return true
+	}
+	return false
+}
+
+// hashedName puts hash in front of the extension of name: css/app.css
+// becomes css/app.1a2b3c4d5e.css.
+func hashedName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// Path returns the URL of the file name. Known files get their content-hashed
+// name; anything else is linked as it is.
+func (a *Assets) Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+
+	if f, ok := a.files[name]; ok {
+		return a.opts.Prefix + "/" + hashedName(name, f.hash)
+	}
+
+	return a.opts.Prefix + "/" + name
+}
+
+// ServeHTTP serves the file named by the request path, which must already
+// have the prefix stripped. A path ending in a slash serves its index.html.
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.disk != nil {
+		w.Header().Set("Cache-Control", "no-cache")
+		a.disk.ServeHTTP(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+
+	h := w.Header()
+	f, ok := a.hashed[name]
+	if ok {
+		h.Set("Cache-Control", immutable)
+	} else if f, ok = a.files[name]; ok {
+		h.Set("Cache-Control", "no-cache")
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, etag := f.content, f.hash
+	if f.gzip != nil || f.brotli != nil {
+		h.Add("Vary", "Accept-Encoding")
+		switch encoding := acceptedEncoding(r, f); encoding {
+		case "br":
+			content, etag = f.brotli, etag+"-br"
+			h.Set("Content-Encoding", encoding)
+		case "gzip":
+			content, etag = f.gzip, etag+"-gz"
+			h.Set("Content-Encoding", encoding)
+		}
+	}
+
+	h.Set("Content-Type", f.ctype)
+	h.Set("ETag", `"`+etag+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+}
+
+// acceptedEncoding picks brotli over gzip when the client accepts both.
+func acceptedEncoding(r *http.Request, f *file) string {
+	var br, gz bool
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(params, " ", "") == "q=0" {
+			continue
+		}
+		switch strings.ToLower(coding) {
+		case "br":
+			br = true
+		case "gzip":
+			gz = true
+		}
+	}
+
+	switch {
+	case br && f.brotli != nil:
+		return "br"
+	case gz && f.gzip != nil:
+		return "gzip"
+	}
+	return ""
+}
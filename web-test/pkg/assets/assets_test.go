@@ -0,0 +1,135 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andybalholm/brotli"
+)
+
+var css = strings.Repeat("body { margin: 0; padding: 0; }\n", 50)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"css/app.css": {Data: []byte(css)},
+		"img/dot.png": {Data: []byte("\x89PNG\r\n\x1a\n")},
+		"index.html":  {Data: []byte("<!DOCTYPE html><title>app</title>")},
+	}
+}
+
+func TestAssets_ServeHTTP(t *testing.T) {
+	a, err := New(testFS(), Options{Prefix: "/static/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashed := strings.TrimPrefix(a.Path("/css/app.css"), "/static")
+	if hashed == "/css/app.css" || !strings.HasPrefix(hashed, "/css/app.") || !strings.HasSuffix(hashed, ".css") {
+		t.Fatalf("expected a content-hashed name, got %s", hashed)
+	}
+
+	if got := a.Path("missing.js"); got != "/static/missing.js" {
+		t.Errorf("expected unknown files to be linked as they are, got %s", got)
+	}
+
+	var tests = []struct {
+		name             string
+		path             string
+		acceptEncoding   string
+		expectedStatus   int
+		expectedCache    string
+		expectedEncoding string
+	}{
+		{"hashed name", hashed, "", http.StatusOK, immutable, ""},
+		{"plain name", "/css/app.css", "", http.StatusOK, "no-cache", ""},
+		{"gzip", hashed, "gzip, deflate", http.StatusOK, immutable, "gzip"},
+		{"brotli preferred", hashed, "gzip, deflate, br", http.StatusOK, immutable, "br"},
+		{"brotli refused", hashed, "gzip, br;q=0", http.StatusOK, immutable, "gzip"},
+		{"not compressible", "/img/dot.png", "gzip, br", http.StatusOK, "no-cache", ""},
+		{"index", "/", "", http.StatusOK, "no-cache", ""},
+		{"missing", "/css/other.css", "", http.StatusNotFound, "", ""},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.path, nil)
+		if e.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", e.acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+
+		a.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, rr.Code)
+			continue
+		}
+		if rr.Header().Get("Cache-Control") != e.expectedCache {
+			t.Errorf("%s: expected Cache-Control %q but got %q", e.name, e.expectedCache, rr.Header().Get("Cache-Control"))
+		}
+		if rr.Header().Get("Content-Encoding") != e.expectedEncoding {
+			t.Errorf("%s: expected Content-Encoding %q but got %q", e.name, e.expectedEncoding, rr.Header().Get("Content-Encoding"))
+		}
+		if e.expectedStatus == http.StatusOK && e.path == hashed && decode(t, rr) != css {
+			t.Errorf("%s: served content does not match the file", e.name)
+		}
+	}
+}
+
+func TestAssets_notModified(t *testing.T) {
+	a, _ := New(testFS(), Options{})
+
+	rr := httptest.NewRecorder()
+	a.ServeHTTP(rr, httptest.NewRequest("GET", "/css/app.css", nil))
+
+	req := httptest.NewRequest("GET", "/css/app.css", nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	a.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected status %d for a matching ETag, but got %d", http.StatusNotModified, rr.Code)
+	}
+}
+
+func TestAssets_disk(t *testing.T) {
+	a, _ := New(testFS(), Options{Prefix: "/static", Disk: true})
+
+	if got := a.Path("css/app.css"); got != "/static/css/app.css" {
+		t.Errorf("expected plain names when serving from disk, got %s", got)
+	}
+
+	rr := httptest.NewRecorder()
+	a.ServeHTTP(rr, httptest.NewRequest("GET", "/css/app.css", nil))
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("expected an uncached file, got status %d and Cache-Control %q", rr.Code, rr.Header().Get("Cache-Control"))
+	}
+}
+
+func decode(t *testing.T, rr *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var r io.Reader = bytes.NewReader(rr.Body.Bytes())
+	switch rr.Header().Get("Content-Encoding") {
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(r)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,190 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Unknown is returned when no address can be determined for a request.
+const Unknown = "unknown"
+
+// The headers a Resolver can read the client address from.
+const (
+	Forwarded     = "Forwarded"
+	XForwardedFor = "X-Forwarded-For"
+	XRealIP       = "X-Real-IP"
+)
+
+// Resolver works out the address of the client that made a request. The one
+// header our proxies set is only believed when the request reached us
+// through a proxy we trust; anything further to the left in a forwarding
+// chain is only believed while each hop is trusted. The other headers are
+// ignored, as a client can send them through a proxy which does not replace
+// them.
+type Resolver struct {
+	header  string
+	trusted []netip.Prefix
+}
+
+// NewResolver returns a Resolver reading header, one of Forwarded,
+// X-Forwarded-For or X-Real-IP, from the given proxies, each written as a
+// CIDR range or a single address. With no proxies, headers are ignored and
+// the peer address is always used.
+func NewResolver(header string, trustedProxies []string) (*Resolver, error) {
+	res := &Resolver{}
+
+	for _, h := range []string{Forwarded, XForwardedFor, XRealIP} {
+		if strings.EqualFold(header, h) {
+			res.header = h
+		}
+	}
+	if res.header == "" {
+		return nil, fmt.Errorf("client ip header %q must be %s, %s or %s", header, Forwarded, XForwardedFor, XRealIP)
+	}
+
+	for _, p := range trustedProxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", p, err)
+			}
+			addr = addr.Unmap()
+			res.trusted = append(res.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", p, err)
+		}
+		res.trusted = append(res.trusted, prefix.Masked())
+	}
+
+	return res, nil
+}
+
+// ClientIP returns the normalized address of the client, or Unknown.
+func (res *Resolver) ClientIP(r *http.Request) string {
+	peer, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return Unknown
+	}
+
+	if !res.isTrusted(peer) {
+		return peer.String()
+	}
+
+	// the chain is ordered from the original client to the last proxy
+	var chain []string
+	switch res.header {
+	case Forwarded:
+		chain, ok = forwardedFor(r.Header)
+	case XForwardedFor:
+		chain, ok = xForwardedFor(r.Header)
+	case XRealIP:
+		if real, found := parseAddr(r.Header.Get(XRealIP)); found {
+			return real.String()
+		}
+	}
+	if !ok {
+		return peer.String()
+	}
+
+	// walk from the right, skipping our own proxies; the first address we
+	// do not trust is the client
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(chain[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !res.isTrusted(addr) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+func (res *Resolver) isTrusted(addr netip.Addr) bool {
+	if res == nil {
+		return false
+	}
+
+	for _, p := range res.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwardedFor extracts the for= parameters of the RFC 7239 Forwarded header.
+func forwardedFor(h http.Header) ([]string, bool) {
+	values := h.Values(Forwarded)
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	var chain []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					chain = append(chain, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+
+	return chain, len(chain) > 0
+}
+
+func xForwardedFor(h http.Header) ([]string, bool) {
+	values := h.Values(XForwardedFor)
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	var chain []string
+	for _, v := range values {
+		for _, addr := range strings.Split(v, ",") {
+			chain = append(chain, strings.TrimSpace(addr))
+		}
+	}
+
+	return chain, len(chain) > 0
+}
+
+// parseAddr accepts an address with or without a port, including the
+// bracketed IPv6 forms used by Forwarded, and normalizes it: IPv4-mapped IPv6
+// addresses become IPv4, and zones are dropped.
+func parseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return netip.Addr{}, false
+	}
+
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap().WithZone(""), true
+}
@@ -0,0 +1,70 @@
+package clientip
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolver_ClientIP(t *testing.T) {
+	var tests = []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"direct client", XForwardedFor, "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"spoofed header from untrusted peer", XForwardedFor, "192.0.2.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "192.0.2.1"},
+		{"trusted proxy", XForwardedFor, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.5"}, "203.0.113.5"},
+		{"spoofed entry left of client", XForwardedFor, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.5, 10.0.0.2"}, "203.0.113.5"},
+		{"all hops trusted", XForwardedFor, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"garbage in chain", XForwardedFor, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "nonsense, 10.0.0.2"}, "10.0.0.2"},
+		{"forwarded header", Forwarded, "10.0.0.1:1234", map[string]string{"Forwarded": `for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"forwarded ignores x-forwarded-for", Forwarded, "10.0.0.1:1234", map[string]string{"Forwarded": "for=192.0.2.60", "X-Forwarded-For": "198.51.100.1"}, "192.0.2.60"},
+		{"forwarded without the header", Forwarded, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "10.0.0.1"},
+		{"x-forwarded-for ignores forwarded", XForwardedFor, "10.0.0.1:1234", map[string]string{"Forwarded": "for=192.0.2.60", "X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"x-forwarded-for ignores x-real-ip", XForwardedFor, "10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.7"}, "10.0.0.1"},
+		{"x-real-ip", XRealIP, "10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+		{"x-real-ip from untrusted peer", XRealIP, "192.0.2.1:1234", map[string]string{"X-Real-IP": "198.51.100.7"}, "192.0.2.1"},
+		{"x-real-ip ignores x-forwarded-for", XRealIP, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "10.0.0.1"},
+		{"ipv4 mapped ipv6", XForwardedFor, "[::ffff:192.0.2.9]:1234", nil, "192.0.2.9"},
+		{"ipv6 with zone", XForwardedFor, "[fe80::1%eth0]:1234", nil, "fe80::1"},
+		{"trusted single ipv6 proxy", XForwardedFor, "[2001:db8::1]:443", map[string]string{"X-Forwarded-For": "2001:DB8::2"}, "2001:db8::2"},
+		{"bad remote addr", XForwardedFor, "hello:world", nil, Unknown},
+		{"empty remote addr", XForwardedFor, "", nil, Unknown},
+	}
+
+	for _, e := range tests {
+		res, err := NewResolver(e.header, []string{"10.0.0.0/8", "2001:db8::1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+
+		if got := res.ClientIP(req); got != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestNewResolver_invalid(t *testing.T) {
+	for _, p := range []string{"10.0.0.0/33", "not-an-ip", "300.1.1.1"} {
+		if _, err := NewResolver(XForwardedFor, []string{p}); err == nil {
+			t.Errorf("%s: expected error, but did not get one", p)
+		}
+	}
+
+	for _, h := range []string{"", "X-Client-IP", "True-Client-IP"} {
+		if _, err := NewResolver(h, nil); err == nil {
+			t.Errorf("header %q: expected error, but did not get one", h)
+		}
+	}
+	if _, err := NewResolver("x-real-ip", nil); err != nil {
+		t.Errorf("expected header names in any case, got %v", err)
+	}
+}
@@ -0,0 +1,609 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"webapp/pkg/clientip"
+	"webapp/pkg/ratelimit"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// publicJWTSecrets are secrets anyone with the repository knows: the
+// placeholder of config.example.yml, and the one the .env file and the
+// flags once shipped with. Tokens signed with them can be forged, so they are
+// refused like a missing secret.
+var publicJWTSecrets = map[string]bool{
+	"change-me-to-a-random-secret-of-32-characters-or-more":            true,
+	"2dce505d96a53c5768052ee90f3df2055657518dad489160df9913f66042e160": true,
+}
+
+// Config holds every setting shared by the web and api binaries. Values are
+// resolved in this order, each step overriding the previous one:
+//
+//	defaults < config file (YAML or TOML) < .env file < environment < flags
+type Config struct {
+	Env       string          `yaml:"env" toml:"env"`
+	WebPort   int             `yaml:"web_port" toml:"web_port"`
+	APIPort   int             `yaml:"api_port" toml:"api_port"`
+	DSN       string          `yaml:"dsn" toml:"dsn"`
+	Domain    string          `yaml:"domain" toml:"domain"`
+	JWTSecret string          `yaml:"jwt_secret" toml:"jwt_secret"`
+	Cookie    CookieConfig    `yaml:"cookie" toml:"cookie"`
+	Session   SessionConfig   `yaml:"session" toml:"session"`
+	Tokens    TokenConfig     `yaml:"tokens" toml:"tokens"`
+	Upload    UploadConfig    `yaml:"upload" toml:"upload"`
+	Assets    AssetsConfig    `yaml:"assets" toml:"assets"`
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	TLS       TLSConfig       `yaml:"tls" toml:"tls"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	CORS      CORSConfig      `yaml:"cors" toml:"cors"`
+	OIDC      OIDCConfig      `yaml:"oidc" toml:"oidc"`
+	WebAuthn  WebAuthnConfig  `yaml:"webauthn" toml:"webauthn"`
+	Metrics   MetricsConfig   `yaml:"metrics" toml:"metrics"`
+
+	// IdentityProviders are the external OpenID Connect providers users can
+	// log in with, besides their password. They are only read from the
+	// config file.
+	IdentityProviders []IdentityProviderConfig `yaml:"identity_providers" toml:"identity_providers"`
+
+	// DefaultLocale is the language used when neither the user nor their
+	// browser asks for one we have a catalog for.
+	DefaultLocale string `yaml:"default_locale" toml:"default_locale"`
+
+	// TrustedProxies lists the CIDR ranges or addresses of reverse proxies
+	// whose forwarding headers are believed when working out client addresses.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+
+	// ClientIPHeader is the header the trusted proxies put the client address
+	// in: Forwarded, X-Forwarded-For or X-Real-IP. The others are ignored.
+	ClientIPHeader string `yaml:"client_ip_header" toml:"client_ip_header"`
+}
+
+// CookieConfig holds the attributes used for the session and refresh token cookies.
+type CookieConfig struct {
+	Domain   string `yaml:"domain" toml:"domain"`
+	Secure   bool   `yaml:"secure" toml:"secure"`
+	SameSite string `yaml:"same_site" toml:"same_site"`
+}
+
+// SameSiteMode converts the configured SameSite string into an http.SameSite value.
+func (c CookieConfig) SameSiteMode() http.SameSite {
+	switch strings.ToLower(c.SameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// SessionConfig holds the settings for the web application's sessions.
+type SessionConfig struct {
+	Lifetime Duration `yaml:"lifetime" toml:"lifetime"`
+	// Store is where sessions are kept: "postgres", so they survive
+	// restarts, or "memory".
+	Store string `yaml:"store" toml:"store"`
+	// CleanupInterval is how often expired sessions are removed from the
+	// store.
+	CleanupInterval Duration `yaml:"cleanup_interval" toml:"cleanup_interval"`
+	// UserCacheTTL is how long the logged in user is cached between
+	// requests; 0 loads it from the database on every request.
+	UserCacheTTL Duration `yaml:"user_cache_ttl" toml:"user_cache_ttl"`
+}
+
+// TokenConfig holds the lifetimes of the tokens issued by the api.
+type TokenConfig struct {
+	AccessTokenExpiry  Duration `yaml:"access_token_expiry" toml:"access_token_expiry"`
+	RefreshTokenExpiry Duration `yaml:"refresh_token_expiry" toml:"refresh_token_expiry"`
+}
+
+// AssetsConfig holds where templates and static files are read from. They
+// are embedded in the binaries; FromDisk reads them from the directories
+// below instead, so edits show up without a rebuild.
+type AssetsConfig struct {
+	FromDisk     bool   `yaml:"from_disk" toml:"from_disk"`
+	TemplatesDir string `yaml:"templates_dir" toml:"templates_dir"`
+	StaticDir    string `yaml:"static_dir" toml:"static_dir"`
+	HTMLDir      string `yaml:"html_dir" toml:"html_dir"`
+}
+
+// UploadConfig holds the limits and destination for uploaded files.
+type UploadConfig struct {
+	Dir     string `yaml:"dir" toml:"dir"`
+	MaxSize int64  `yaml:"max_size" toml:"max_size"`
+}
+
+// ServerConfig holds the timeouts used by the http servers.
+type ServerConfig struct {
+	ReadTimeout     Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout    Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout     Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// TLSConfig decides whether the servers speak https. Either a certificate and
+// key file are given, or a self-signed certificate is generated at startup for
+// development. When RedirectPort is set, a plain http listener on that port
+// redirects every request to https.
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile      string `yaml:"key_file" toml:"key_file"`
+	SelfSigned   bool   `yaml:"self_signed" toml:"self_signed"`
+	RedirectPort int    `yaml:"redirect_port" toml:"redirect_port"`
+}
+
+// Enabled reports whether the servers should use TLS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.SelfSigned
+}
+
+// LogConfig controls the structured logger: Format is "text" or "json", and
+// Level is one of debug, info, warn or error.
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`
+	Format string `yaml:"format" toml:"format"`
+}
+
+// RateLimitConfig holds the limits for each group of routes. Limits are
+// written as "requests/period", e.g. "10/1m".
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// Default applies to every route, per client address.
+	Default ratelimit.Limit `yaml:"default" toml:"default"`
+	// Auth applies to login and token endpoints, per client address.
+	Auth ratelimit.Limit `yaml:"auth" toml:"auth"`
+	// API applies to authenticated api routes, per user.
+	API ratelimit.Limit `yaml:"api" toml:"api"`
+	// Upload applies to file uploads, per user.
+	Upload ratelimit.Limit `yaml:"upload" toml:"upload"`
+}
+
+// CORSConfig holds the cross-origin policy of the api. Origins may be "*" or
+// contain a single wildcard, as in "https://*.example.com".
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins" toml:"allowed_origins"`
+	AllowedMethods   []string `yaml:"allowed_methods" toml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers" toml:"allowed_headers"`
+	ExposedHeaders   []string `yaml:"exposed_headers" toml:"exposed_headers"`
+	MaxAge           Duration `yaml:"max_age" toml:"max_age"`
+	AllowCredentials bool     `yaml:"allow_credentials" toml:"allow_credentials"`
+}
+
+// OIDCConfig holds the settings of the OpenID Connect provider. The api is
+// the issuer, serving the token endpoints, and the web application asks
+// users for their consent at AuthorizeURL. ID tokens are signed with the RSA
+// key in SigningKeyFile; without one a key is generated at startup, so
+// tokens stop verifying when the api restarts.
+type OIDCConfig struct {
+	Issuer         string `yaml:"issuer" toml:"issuer"`
+	AuthorizeURL   string `yaml:"authorize_url" toml:"authorize_url"`
+	SigningKeyFile string `yaml:"signing_key_file" toml:"signing_key_file"`
+}
+
+// WebAuthnConfig describes the site to passkeys. RPID is the domain
+// passkeys are bound to, so it must not change once users registered them;
+// RPName is what authenticators show. Origins are the pages allowed to use
+// them: the web application, and the clients of the api.
+type WebAuthnConfig struct {
+	RPID    string   `yaml:"rp_id" toml:"rp_id"`
+	RPName  string   `yaml:"rp_name" toml:"rp_name"`
+	Origins []string `yaml:"origins" toml:"origins"`
+}
+
+// MetricsConfig protects /metrics. Token is the bearer token Prometheus
+// scrapes with; without one, /metrics is not served.
+type MetricsConfig struct {
+	Token string `yaml:"token" toml:"token"`
+}
+
+// IdentityProviderConfig describes an external OpenID Connect provider.
+// Name identifies it in urls and in the identities linked to users, so it
+// must not change once users have logged in with it; Label is what the login
+// page shows. RedirectURL is the callback of the web application, which
+// must be registered with the provider.
+type IdentityProviderConfig struct {
+	Name         string `yaml:"name" toml:"name"`
+	Label        string `yaml:"label" toml:"label"`
+	Issuer       string `yaml:"issuer" toml:"issuer"`
+	ClientID     string `yaml:"client_id" toml:"client_id"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret"`
+	RedirectURL  string `yaml:"redirect_url" toml:"redirect_url"`
+	// TrustEmail links an identity seen for the first time to the user with
+	// its email address, if the provider says it verified the address. Only
+	// set it for providers whose users cannot have addresses they do not
+	// own, such as a company's; addresses here are not verified.
+	TrustEmail bool `yaml:"trust_email" toml:"trust_email"`
+}
+
+// identityProviderName is the shape of the name of an identity provider.
+var identityProviderName = regexp.MustCompile(`^[a-z0-9-]{1,64}$`)
+
+// Duration is a time.Duration that can be written as "15m" or "24h" in config files.
+type Duration time.Duration
+
+// UnmarshalText parses a duration string such as "15m".
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText writes the duration in time.Duration string format.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default returns a Config populated with development defaults. Secrets and
+// the database connection string are deliberately left empty.
+func Default() *Config {
+	return &Config{
+		Env:            "development",
+		WebPort:        8080,
+		APIPort:        8090,
+		Domain:         "example.com",
+		DefaultLocale:  "en",
+		ClientIPHeader: clientip.XForwardedFor,
+		Cookie: CookieConfig{
+			Domain:   "localhost",
+			Secure:   true,
+			SameSite: "lax",
+		},
+		Session: SessionConfig{
+			Lifetime:        Duration(24 * time.Hour),
+			Store:           "postgres",
+			CleanupInterval: Duration(5 * time.Minute),
+			UserCacheTTL:    Duration(5 * time.Second),
+		},
+		Tokens: TokenConfig{
+			AccessTokenExpiry:  Duration(15 * time.Minute),
+			RefreshTokenExpiry: Duration(24 * time.Hour),
+		},
+		Assets: AssetsConfig{
+			TemplatesDir: "./templates",
+			StaticDir:    "./static",
+			HTMLDir:      "./html",
+		},
+		Upload: UploadConfig{
+			Dir:     "./static/img",
+			MaxSize: 1024 * 1024 * 5,
+		},
+		Server: ServerConfig{
+			ReadTimeout:     Duration(10 * time.Second),
+			WriteTimeout:    Duration(30 * time.Second),
+			IdleTimeout:     Duration(time.Minute),
+			ShutdownTimeout: Duration(15 * time.Second),
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Default: ratelimit.Limit{Requests: 300, Period: time.Minute},
+			Auth:    ratelimit.Limit{Requests: 10, Period: time.Minute},
+			API:     ratelimit.Limit{Requests: 120, Period: time.Minute},
+			Upload:  ratelimit.Limit{Requests: 10, Period: time.Hour},
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   []string{"http://localhost:8090"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders:   []string{"Accept", "Content-Type", "X-CSRF-Token", "Authorization", "X-API-Key", "X-Request-ID"},
+			ExposedHeaders:   []string{"X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Deprecation", "Sunset", "Link"},
+			MaxAge:           Duration(10 * time.Minute),
+			AllowCredentials: true,
+		},
+		OIDC: OIDCConfig{
+			Issuer:       "http://localhost:8090",
+			AuthorizeURL: "http://localhost:8080/oauth/authorize",
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:    "localhost",
+			RPName:  "Web App",
+			Origins: []string{"http://localhost:8080", "http://localhost:8090"},
+		},
+	}
+}
+
+// IsProduction reports whether the application runs in production mode.
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// Load builds the configuration for the binary called name ("web" or "api")
+// from args, which are normally os.Args[1:].
+func Load(name string, args []string) (*Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to a YAML or TOML config file (env CONFIG_FILE)")
+	envFile := fs.String("env-file", ".env", "path to a .env file")
+	for _, s := range settings {
+		fs.String(s.key, "", fmt.Sprintf("%s (env %s)", s.usage, envName(s.key)))
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// collect the .env file first, and let the real environment override it
+	vars, err := readDotEnv(*envFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+
+	cfg := Default()
+
+	if *configFile == "" {
+		*configFile = vars["CONFIG_FILE"]
+	}
+	if *configFile != "" {
+		err = cfg.readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if dsn := dsnFromParts(vars); dsn != "" {
+		cfg.DSN = dsn
+	}
+
+	for _, s := range settings {
+		if v, ok := vars[envName(s.key)]; ok && v != "" {
+			if err := s.set(cfg, v); err != nil {
+				return nil, fmt.Errorf("env %s: %w", envName(s.key), err)
+			}
+		}
+	}
+
+	// only flags that were explicitly passed override the other sources
+	fs.Visit(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		for _, s := range settings {
+			if s.key == f.Name {
+				if setErr := s.set(cfg, f.Value.String()); setErr != nil {
+					err = fmt.Errorf("flag -%s: %w", f.Name, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Validate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate makes sure that the configuration is usable by the binary called name.
+func (c *Config) Validate(name string) error {
+	var problems []string
+
+	if c.DSN == "" {
+		problems = append(problems, "a database connection string is required (DSN or DATABASE_* variables)")
+	}
+
+	for _, p := range []struct {
+		name string
+		port int
+	}{{"web port", c.WebPort}, {"api port", c.APIPort}} {
+		if p.port < 1 || p.port > 65535 {
+			problems = append(problems, fmt.Sprintf("%s %d is out of range", p.name, p.port))
+		}
+	}
+
+	if c.Tokens.AccessTokenExpiry <= 0 || c.Tokens.RefreshTokenExpiry <= c.Tokens.AccessTokenExpiry {
+		problems = append(problems, "refresh token expiry must be longer than a positive access token expiry")
+	}
+
+	if c.Session.Lifetime <= 0 {
+		problems = append(problems, "session lifetime must be positive")
+	}
+
+	if c.Session.Store != "postgres" && c.Session.Store != "memory" {
+		problems = append(problems, fmt.Sprintf("session store %q must be postgres or memory", c.Session.Store))
+	}
+
+	if c.Session.CleanupInterval <= 0 {
+		problems = append(problems, "session cleanup interval must be positive")
+	}
+
+	if c.Session.UserCacheTTL < 0 {
+		problems = append(problems, "session user cache ttl must not be negative")
+	}
+
+	if c.Upload.MaxSize <= 0 {
+		problems = append(problems, "upload max size must be positive")
+	}
+
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server timeouts must be positive")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		problems = append(problems, "tls needs both a certificate and a key file")
+	}
+
+	for _, l := range []ratelimit.Limit{c.RateLimit.Default, c.RateLimit.Auth, c.RateLimit.API, c.RateLimit.Upload} {
+		if c.RateLimit.Enabled && (l.Requests < 1 || l.Period <= 0) {
+			problems = append(problems, fmt.Sprintf("rate limit %s must allow at least one request per positive period", l))
+		}
+	}
+
+	if c.CORS.AllowCredentials {
+		for _, o := range c.CORS.AllowedOrigins {
+			if strings.TrimSpace(o) == "*" {
+				problems = append(problems, "cors cannot allow credentials from any origin; list the origins instead")
+			}
+		}
+	}
+
+	for _, u := range []string{c.OIDC.Issuer, c.OIDC.AuthorizeURL} {
+		if parsed, err := url.Parse(u); err != nil || !parsed.IsAbs() || parsed.RawQuery != "" || parsed.Fragment != "" {
+			problems = append(problems, fmt.Sprintf("oidc url %q must be absolute, without a query or fragment", u))
+		}
+	}
+
+	if c.WebAuthn.RPID == "" || strings.ContainsAny(c.WebAuthn.RPID, ":/") {
+		problems = append(problems, fmt.Sprintf("webauthn rp id %q must be a domain, without a scheme or port", c.WebAuthn.RPID))
+	}
+	for _, o := range c.WebAuthn.Origins {
+		parsed, err := url.Parse(o)
+		if err != nil || !parsed.IsAbs() || (parsed.Hostname() != c.WebAuthn.RPID && !strings.HasSuffix(parsed.Hostname(), "."+c.WebAuthn.RPID)) {
+			problems = append(problems, fmt.Sprintf("webauthn origin %q must be an absolute url on the rp id or a subdomain of it", o))
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, p := range c.IdentityProviders {
+		if !identityProviderName.MatchString(p.Name) || seen[p.Name] {
+			problems = append(problems, fmt.Sprintf("identity provider name %q must be unique, and only lower case letters, digits and dashes", p.Name))
+		}
+		seen[p.Name] = true
+
+		if parsed, err := url.Parse(p.Issuer); err != nil || !parsed.IsAbs() {
+			problems = append(problems, fmt.Sprintf("identity provider %s needs an absolute issuer url", p.Name))
+		}
+		if p.ClientID == "" {
+			problems = append(problems, fmt.Sprintf("identity provider %s needs a client id", p.Name))
+		}
+		if parsed, err := url.Parse(p.RedirectURL); name == "web" && (err != nil || !parsed.IsAbs()) {
+			problems = append(problems, fmt.Sprintf("identity provider %s needs an absolute redirect url", p.Name))
+		}
+	}
+
+	if _, err := clientip.NewResolver(c.ClientIPHeader, c.TrustedProxies); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if c.TLS.RedirectPort < 0 || c.TLS.RedirectPort > 65535 {
+		problems = append(problems, fmt.Sprintf("redirect port %d is out of range", c.TLS.RedirectPort))
+	}
+
+	if name == "api" {
+		if c.Domain == "" {
+			problems = append(problems, "a domain is required to issue tokens")
+		}
+		if len(c.JWTSecret) < 32 {
+			problems = append(problems, "a jwt secret of at least 32 characters is required (JWT_SECRET)")
+		} else if publicJWTSecrets[c.JWTSecret] {
+			problems = append(problems, "the jwt secret is published in the repository, generate one of your own (JWT_SECRET)")
+		}
+		if c.IsProduction() && c.OIDC.SigningKeyFile == "" {
+			problems = append(problems, "an oidc signing key file is required in production (OIDC_SIGNING_KEY_FILE)")
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// readFile decodes a YAML or TOML file, chosen by extension, over the current values.
+func (c *Config) readFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(contents, c)
+	case ".toml":
+		err = toml.Unmarshal(contents, c)
+	default:
+		return fmt.Errorf("config file %s: unsupported format, use .yml, .yaml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// readDotEnv reads KEY=VALUE pairs from path. A missing file is not an error.
+func readDotEnv(path string) (map[string]string, error) {
+	vars := make(map[string]string)
+	if path == "" {
+		return vars, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return vars, nil
+		}
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		vars[strings.TrimSpace(k)] = v
+	}
+
+	return vars, nil
+}
+
+// dsnFromParts builds a Postgres connection string from the DATABASE_*
+// variables used by docker-compose, if they are present.
+func dsnFromParts(vars map[string]string) string {
+	if vars["DATABASE_NAME"] == "" || vars["DATABASE_USER"] == "" {
+		return ""
+	}
+
+	host := vars["DATABASE_HOST"]
+	if host == "" {
+		host = "localhost"
+	}
+	port := vars["DATABASE_PORT"]
+	if port == "" {
+		port = "5432"
+	}
+
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable timezone=UTC connect_timeout=5",
+		host, port, vars["DATABASE_USER"], vars["DATABASE_PASSWORD"], vars["DATABASE_NAME"])
+}
+
+// envName converts a flag name such as "jwt-secret" into its environment variable, JWT_SECRET.
+func envName(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "b7f0c1e29a4d5863f1e0a9c27d4b6e8f53a1c0d9e7f2b4a6c8d0e1f3a5b7c9d1"
+
+func writeFile(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoad_precedence(t *testing.T) {
+	dir := t.TempDir()
+	yml := writeFile(t, dir, "config.yml", "api_port: 9000\nweb_port: 9001\ndomain: file.com\ntokens:\n  access_token_expiry: 5m\n")
+	env := writeFile(t, dir, ".env", "DATABASE_NAME=\"web\"\nDATABASE_USER=web_user\n# comment\nAPI_PORT=9100\nDOMAIN=dotenv.com\n")
+
+	t.Setenv("DOMAIN", "env.com")
+	t.Setenv("JWT_SECRET", testSecret)
+
+	cfg, err := Load("api", []string{"-config", yml, "-env-file", env, "-domain", "flag.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.WebPort != 9001 {
+		t.Errorf("expected web port from file, got %d", cfg.WebPort)
+	}
+	if cfg.APIPort != 9100 {
+		t.Errorf("expected api port from .env, got %d", cfg.APIPort)
+	}
+	if cfg.Domain != "flag.com" {
+		t.Errorf("expected domain from flag, got %s", cfg.Domain)
+	}
+	if time.Duration(cfg.Tokens.AccessTokenExpiry) != 5*time.Minute {
+		t.Errorf("expected access token expiry from file, got %v", time.Duration(cfg.Tokens.AccessTokenExpiry))
+	}
+	if !strings.Contains(cfg.DSN, "dbname=web") || !strings.Contains(cfg.DSN, "user=web_user") {
+		t.Errorf("expected dsn built from DATABASE_* variables, got %s", cfg.DSN)
+	}
+}
+
+func TestLoad_toml(t *testing.T) {
+	dir := t.TempDir()
+	tml := writeFile(t, dir, "config.toml", "dsn = \"host=db\"\n[upload]\nmax_size = 1024\n")
+
+	cfg, err := Load("web", []string{"-config", tml, "-env-file", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Upload.MaxSize != 1024 || cfg.DSN != "host=db" {
+		t.Errorf("toml values not applied: %+v", cfg)
+	}
+}
+
+func TestLoad_invalid(t *testing.T) {
+	var tests = []struct {
+		name string
+		args []string
+	}{
+		{"missing secret", []string{"-dsn", "host=db"}},
+		{"short secret", []string{"-dsn", "host=db", "-jwt-secret", "short"}},
+		{"example secret", []string{"-dsn", "host=db", "-jwt-secret", "change-me-to-a-random-secret-of-32-characters-or-more"}},
+		{"secret once in the repository", []string{"-dsn", "host=db", "-jwt-secret", "2dce505d96a53c5768052ee90f3df2055657518dad489160df9913f66042e160"}},
+		{"missing dsn", []string{"-jwt-secret", testSecret}},
+		{"bad port", []string{"-dsn", "host=db", "-jwt-secret", testSecret, "-api-port", "70000"}},
+		{"bad duration", []string{"-dsn", "host=db", "-jwt-secret", testSecret, "-access-token-expiry", "soon"}},
+		{"refresh shorter than access", []string{"-dsn", "host=db", "-jwt-secret", testSecret, "-refresh-token-expiry", "1m"}},
+		{"unknown session store", []string{"-dsn", "host=db", "-jwt-secret", testSecret, "-session-store", "redis"}},
+		{"relative oidc issuer", []string{"-dsn", "host=db", "-jwt-secret", testSecret, "-oidc-issuer", "/api"}},
+		{"production without oidc key", []string{"-dsn", "host=db", "-jwt-secret", testSecret, "-env", "production"}},
+		{"webauthn origin on another domain", []string{"-dsn", "host=db", "-jwt-secret", testSecret, "-webauthn-rp-id", "example.com", "-webauthn-origins", "https://example.com,https://evil.example"}},
+		{"webauthn rp id with a port", []string{"-dsn", "host=db", "-jwt-secret", testSecret, "-webauthn-rp-id", "localhost:8080"}},
+		{"unknown client ip header", []string{"-dsn", "host=db", "-jwt-secret", testSecret, "-client-ip-header", "X-Client-IP"}},
+	}
+
+	for _, e := range tests {
+		_, err := Load("api", append([]string{"-env-file", ""}, e.args...))
+		if err == nil {
+			t.Errorf("%s: expected error, but did not get one", e.name)
+		}
+	}
+}
+
+func TestLoad_identityProviders(t *testing.T) {
+	provider := "  - name: %s\n    label: Example\n    issuer: %s\n    client_id: %s\n    redirect_url: http://localhost:8080/login/example/callback\n"
+	yml := func(providers ...string) string {
+		return "dsn: host=db\njwt_secret: " + testSecret + "\nidentity_providers:\n" + strings.Join(providers, "")
+	}
+
+	var tests = []struct {
+		name     string
+		contents string
+		valid    bool
+	}{
+		{"valid", yml(fmt.Sprintf(provider, "example", "https://id.example", "web")), true},
+		{"two providers", yml(fmt.Sprintf(provider, "example", "https://id.example", "web"), fmt.Sprintf(provider, "other", "https://other.example", "web")), true},
+		{"same name twice", yml(fmt.Sprintf(provider, "example", "https://id.example", "web"), fmt.Sprintf(provider, "example", "https://other.example", "web")), false},
+		{"name with spaces", yml(fmt.Sprintf(provider, "my provider", "https://id.example", "web")), false},
+		{"relative issuer", yml(fmt.Sprintf(provider, "example", "/id", "web")), false},
+		{"no client id", yml(fmt.Sprintf(provider, "example", "https://id.example", `""`)), false},
+	}
+
+	for _, e := range tests {
+		file := writeFile(t, t.TempDir(), "config.yml", e.contents)
+		cfg, err := Load("web", []string{"-env-file", "", "-config", file})
+		if e.valid != (err == nil) {
+			t.Errorf("%s: expected valid to be %v, got error %v", e.name, e.valid, err)
+		}
+		if err == nil && cfg.IdentityProviders[0].Label != "Example" {
+			t.Errorf("%s: providers not read: %+v", e.name, cfg.IdentityProviders)
+		}
+	}
+}
+
+func TestCookieConfig_SameSiteMode(t *testing.T) {
+	var tests = map[string]http.SameSite{
+		"strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+		"lax":    http.SameSiteLaxMode,
+		"":       http.SameSiteLaxMode,
+	}
+
+	for in, want := range tests {
+		if got := (CookieConfig{SameSite: in}).SameSiteMode(); got != want {
+			t.Errorf("%q: expected %d, got %d", in, want, got)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// setting describes a value that can be overridden by an environment variable
+// and a command line flag. The flag name is key, and the environment variable
+// is key upper-cased with dashes replaced by underscores.
+type setting struct {
+	key   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"env", "environment: development|production", func(c *Config, v string) error {
+		c.Env = v
+		return nil
+	}},
+	{"web-port", "port for the web application", func(c *Config, v string) error {
+		return setInt(&c.WebPort, v)
+	}},
+	{"api-port", "port for the api", func(c *Config, v string) error {
+		return setInt(&c.APIPort, v)
+	}},
+	{"dsn", "Postgres connection", func(c *Config, v string) error {
+		c.DSN = v
+		return nil
+	}},
+	{"domain", "domain for application, e.g. company.com", func(c *Config, v string) error {
+		c.Domain = v
+		return nil
+	}},
+	{"jwt-secret", "signing secret", func(c *Config, v string) error {
+		c.JWTSecret = v
+		return nil
+	}},
+	{"cookie-domain", "domain attribute for cookies", func(c *Config, v string) error {
+		c.Cookie.Domain = v
+		return nil
+	}},
+	{"cookie-secure", "mark cookies as secure", func(c *Config, v string) error {
+		return setBool(&c.Cookie.Secure, v)
+	}},
+	{"cookie-same-site", "SameSite mode for cookies: lax|strict|none", func(c *Config, v string) error {
+		c.Cookie.SameSite = v
+		return nil
+	}},
+	{"session-lifetime", "lifetime of a web session, e.g. 24h", func(c *Config, v string) error {
+		return c.Session.Lifetime.UnmarshalText([]byte(v))
+	}},
+	{"session-store", "where web sessions are kept: postgres|memory", func(c *Config, v string) error {
+		c.Session.Store = v
+		return nil
+	}},
+	{"session-cleanup-interval", "how often expired sessions are removed, e.g. 5m", func(c *Config, v string) error {
+		return c.Session.CleanupInterval.UnmarshalText([]byte(v))
+	}},
+	{"session-user-cache-ttl", "how long the logged in user is cached, e.g. 5s; 0 disables the cache", func(c *Config, v string) error {
+		return c.Session.UserCacheTTL.UnmarshalText([]byte(v))
+	}},
+	{"access-token-expiry", "lifetime of an access token, e.g. 15m", func(c *Config, v string) error {
+		return c.Tokens.AccessTokenExpiry.UnmarshalText([]byte(v))
+	}},
+	{"refresh-token-expiry", "lifetime of a refresh token, e.g. 24h", func(c *Config, v string) error {
+		return c.Tokens.RefreshTokenExpiry.UnmarshalText([]byte(v))
+	}},
+	{"assets-from-disk", "read templates and static files from disk instead of the binary", func(c *Config, v string) error {
+		return setBool(&c.Assets.FromDisk, v)
+	}},
+	{"templates-dir", "directory holding the web templates, with assets-from-disk", func(c *Config, v string) error {
+		c.Assets.TemplatesDir = v
+		return nil
+	}},
+	{"static-dir", "directory holding the web static files, with assets-from-disk", func(c *Config, v string) error {
+		c.Assets.StaticDir = v
+		return nil
+	}},
+	{"html-dir", "directory holding the api's index.html, with assets-from-disk", func(c *Config, v string) error {
+		c.Assets.HTMLDir = v
+		return nil
+	}},
+	{"upload-dir", "directory for uploaded files", func(c *Config, v string) error {
+		c.Upload.Dir = v
+		return nil
+	}},
+	{"upload-max-size", "maximum size of an upload in bytes", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		c.Upload.MaxSize = n
+		return nil
+	}},
+	{"read-timeout", "maximum duration for reading a request", func(c *Config, v string) error {
+		return c.Server.ReadTimeout.UnmarshalText([]byte(v))
+	}},
+	{"write-timeout", "maximum duration for writing a response", func(c *Config, v string) error {
+		return c.Server.WriteTimeout.UnmarshalText([]byte(v))
+	}},
+	{"idle-timeout", "how long keep-alive connections stay open", func(c *Config, v string) error {
+		return c.Server.IdleTimeout.UnmarshalText([]byte(v))
+	}},
+	{"shutdown-timeout", "how long to wait for in-flight requests on shutdown", func(c *Config, v string) error {
+		return c.Server.ShutdownTimeout.UnmarshalText([]byte(v))
+	}},
+	{"tls-cert", "path to a TLS certificate", func(c *Config, v string) error {
+		c.TLS.CertFile = v
+		return nil
+	}},
+	{"tls-key", "path to a TLS private key", func(c *Config, v string) error {
+		c.TLS.KeyFile = v
+		return nil
+	}},
+	{"tls-self-signed", "serve https with a generated self-signed certificate", func(c *Config, v string) error {
+		return setBool(&c.TLS.SelfSigned, v)
+	}},
+	{"tls-redirect-port", "port for an http listener that redirects to https", func(c *Config, v string) error {
+		return setInt(&c.TLS.RedirectPort, v)
+	}},
+	{"default-locale", "language used when the user and browser ask for none we support, e.g. en", func(c *Config, v string) error {
+		c.DefaultLocale = v
+		return nil
+	}},
+	{"trusted-proxies", "comma separated CIDR ranges of trusted reverse proxies", func(c *Config, v string) error {
+		c.TrustedProxies = strings.Split(v, ",")
+		return nil
+	}},
+	{"client-ip-header", "header trusted proxies set the client address in: Forwarded|X-Forwarded-For|X-Real-IP", func(c *Config, v string) error {
+		c.ClientIPHeader = v
+		return nil
+	}},
+	{"rate-limit", "enable rate limiting", func(c *Config, v string) error {
+		return setBool(&c.RateLimit.Enabled, v)
+	}},
+	{"rate-limit-default", "limit for every route per client, e.g. 300/1m", func(c *Config, v string) error {
+		return c.RateLimit.Default.UnmarshalText([]byte(v))
+	}},
+	{"rate-limit-auth", "limit for login and token routes per client, e.g. 10/1m", func(c *Config, v string) error {
+		return c.RateLimit.Auth.UnmarshalText([]byte(v))
+	}},
+	{"rate-limit-api", "limit for authenticated api routes per user, e.g. 120/1m", func(c *Config, v string) error {
+		return c.RateLimit.API.UnmarshalText([]byte(v))
+	}},
+	{"rate-limit-upload", "limit for uploads per user, e.g. 10/1h", func(c *Config, v string) error {
+		return c.RateLimit.Upload.UnmarshalText([]byte(v))
+	}},
+	{"cors-allowed-origins", "comma separated origins allowed to call the api", func(c *Config, v string) error {
+		c.CORS.AllowedOrigins = strings.Split(v, ",")
+		return nil
+	}},
+	{"cors-allow-credentials", "allow cross-origin requests with credentials", func(c *Config, v string) error {
+		return setBool(&c.CORS.AllowCredentials, v)
+	}},
+	{"oidc-issuer", "url of the api as an OpenID Connect issuer, e.g. https://api.example.com", func(c *Config, v string) error {
+		c.OIDC.Issuer = v
+		return nil
+	}},
+	{"oidc-authorize-url", "url of the authorize page of the web application", func(c *Config, v string) error {
+		c.OIDC.AuthorizeURL = v
+		return nil
+	}},
+	{"oidc-signing-key-file", "path to the PEM encoded RSA key signing ID tokens", func(c *Config, v string) error {
+		c.OIDC.SigningKeyFile = v
+		return nil
+	}},
+	{"webauthn-rp-id", "domain passkeys are bound to, e.g. example.com", func(c *Config, v string) error {
+		c.WebAuthn.RPID = v
+		return nil
+	}},
+	{"webauthn-rp-name", "name of the site authenticators show", func(c *Config, v string) error {
+		c.WebAuthn.RPName = v
+		return nil
+	}},
+	{"webauthn-origins", "comma separated origins of the pages allowed to use passkeys", func(c *Config, v string) error {
+		c.WebAuthn.Origins = strings.Split(v, ",")
+		return nil
+	}},
+	{"metrics-token", "bearer token required to scrape /metrics, which is off without one", func(c *Config, v string) error {
+		c.Metrics.Token = v
+		return nil
+	}},
+	{"log-level", "log level: debug|info|warn|error", func(c *Config, v string) error {
+		c.Log.Level = v
+		return nil
+	}},
+	{"log-format", "log format: text|json", func(c *Config, v string) error {
+		c.Log.Format = v
+		return nil
+	}},
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*dst = b
+	return nil
+}
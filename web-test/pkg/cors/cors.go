@@ -0,0 +1,215 @@
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Options configures a CORS policy.
+type Options struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin
+	// requests. An entry may be "*" for any origin, or contain one "*"
+	// wildcard, as in "https://*.example.com".
+	AllowedOrigins []string
+	// AllowedMethods lists the methods allowed in cross-origin requests.
+	AllowedMethods []string
+	// AllowedHeaders lists the request headers a client may send.
+	AllowedHeaders []string
+	// ExposedHeaders lists the response headers scripts may read.
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+	// AllowCredentials lets browsers send cookies and authorization headers.
+	AllowCredentials bool
+	// Match, if set, reports whether a route exists for the path of r and
+	// method. Preflight requests are only approved for methods the route
+	// accepts.
+	Match func(r *http.Request, method string) bool
+}
+
+// CORS applies a cross-origin resource sharing policy to requests.
+type CORS struct {
+	opts    Options
+	any     bool
+	exact   map[string]bool
+	globs   [][2]string
+	methods map[string]bool
+	headers map[string]bool
+}
+
+// New returns a CORS policy built from opts.
+func New(opts Options) *CORS {
+	c := &CORS{
+		opts:    opts,
+		exact:   make(map[string]bool),
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+
+	for _, o := range opts.AllowedOrigins {
+		o = strings.ToLower(strings.TrimSpace(o))
+		switch {
+		case o == "*":
+			c.any = true
+		case strings.Contains(o, "*"):
+			prefix, suffix, _ := strings.Cut(o, "*")
+			c.globs = append(c.globs, [2]string{prefix, suffix})
+		case o != "":
+			c.exact[o] = true
+		}
+	}
+
+	for _, m := range opts.AllowedMethods {
+		c.methods[strings.ToUpper(strings.TrimSpace(m))] = true
+	}
+
+	for _, h := range opts.AllowedHeaders {
+		c.headers[http.CanonicalHeaderKey(strings.TrimSpace(h))] = true
+	}
+
+	return c
+}
+
+// Handler applies the policy. Requests without an Origin header are not
+// cross-origin and pass through untouched; preflight requests are answered
+// here; anything else gets the CORS response headers and reaches next.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			c.preflight(w, r, origin)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if origin != "" && c.originAllowed(origin) {
+			c.setOrigin(w, origin)
+			if len(c.opts.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.opts.ExposedHeaders, ", "))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CORS) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if origin == "" || !c.originAllowed(origin) || !c.methods[method] || !c.headersAllowed(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if c.opts.Match != nil && !c.opts.Match(r, method) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c.setOrigin(w, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(c.routeMethods(r), ", "))
+	if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		h.Set("Access-Control-Allow-Headers", requested)
+	}
+	if c.opts.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.opts.MaxAge.Seconds())))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOrigin echoes the origin, or answers "*" for public, credential-less policies.
+func (c *CORS) setOrigin(w http.ResponseWriter, origin string) {
+	if c.any && !c.opts.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.opts.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *CORS) originAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if c.any || c.exact[origin] {
+		return true
+	}
+
+	for _, g := range c.globs {
+		if len(origin) > len(g[0])+len(g[1]) && strings.HasPrefix(origin, g[0]) && strings.HasSuffix(origin, g[1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *CORS) headersAllowed(r *http.Request) bool {
+	requested := r.Header.Get("Access-Control-Request-Headers")
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" && !c.headers[http.CanonicalHeaderKey(h)] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// routeMethods lists the allowed methods that the requested route accepts.
+func (c *CORS) routeMethods(r *http.Request) []string {
+	var methods []string
+	for _, m := range c.opts.AllowedMethods {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if c.opts.Match == nil || c.opts.Match(r, m) {
+			methods = append(methods, m)
+		}
+	}
+
+	return methods
+}
+
+// flattened caches, per router, a copy of its routes without sub-routers.
+var flattened sync.Map
+
+// MatchChiRoute reports whether the chi router handling r has a route for the
+// request path and method. Outside of a chi router every route matches.
+func MatchChiRoute(r *http.Request, method string) bool {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return true
+	}
+
+	return flatten(rctx.Routes).Match(chi.NewRouteContext(), method, r.URL.Path)
+}
+
+// flatten registers every route of routes on a single router. chi matches
+// any method on the bare path of a mounted sub-router, so Match cannot be
+// asked directly.
+func flatten(routes chi.Routes) *chi.Mux {
+	if flat, ok := flattened.Load(routes); ok {
+		return flat.(*chi.Mux)
+	}
+
+	flat := chi.NewRouter()
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	_ = chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		flat.Method(method, route, noop)
+		return nil
+	})
+
+	flattened.Store(routes, flat)
+	return flat
+}
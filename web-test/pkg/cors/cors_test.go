@@ -0,0 +1,62 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS_origins(t *testing.T) {
+	var tests = []struct {
+		name           string
+		opts           Options
+		origin         string
+		expectedOrigin string
+	}{
+		{"exact", Options{AllowedOrigins: []string{"https://app.example.com"}}, "https://app.example.com", "https://app.example.com"},
+		{"exact is case insensitive", Options{AllowedOrigins: []string{"https://App.example.com"}}, "https://app.EXAMPLE.com", "https://app.EXAMPLE.com"},
+		{"wildcard subdomain", Options{AllowedOrigins: []string{"https://*.example.com"}}, "https://a.example.com", "https://a.example.com"},
+		{"wildcard needs a subdomain", Options{AllowedOrigins: []string{"https://*.example.com"}}, "https://.example.com", ""},
+		{"wildcard other domain", Options{AllowedOrigins: []string{"https://*.example.com"}}, "https://example.org", ""},
+		{"any origin without credentials", Options{AllowedOrigins: []string{"*"}}, "https://x.test", "*"},
+		{"any origin with credentials echoes", Options{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "https://x.test", "https://x.test"},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Origin", e.origin)
+		rr := httptest.NewRecorder()
+
+		New(e.opts).Handler(next).ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != e.expectedOrigin {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expectedOrigin, got)
+		}
+	}
+}
+
+func TestCORS_preflightMaxAge(t *testing.T) {
+	c := New(Options{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		MaxAge:         10 * time.Minute,
+	})
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr := httptest.NewRecorder()
+
+	c.Handler(http.NotFoundHandler()).ServeHTTP(rr, req)
+
+	if rr.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("expected max age of 600, got %q", rr.Header().Get("Access-Control-Max-Age"))
+	}
+
+	if rr.Header().Get("Access-Control-Allow-Methods") != "GET, POST" {
+		t.Errorf("expected allowed methods, got %q", rr.Header().Get("Access-Control-Allow-Methods"))
+	}
+}
@@ -0,0 +1,104 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes an API key may be given. Keys with only the read scope may not
+// change anything.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// APIKeyScopes lists every scope.
+var APIKeyScopes = []string{ScopeRead, ScopeWrite}
+
+// How many days API keys last when the user does not choose, and at most.
+const (
+	DefaultAPIKeyDays = 90
+	MaxAPIKeyDays     = 365
+)
+
+// apiKeyMark starts every API key, so they are easy to recognise, e.g. by
+// secret scanners.
+const apiKeyMark = "wtk_"
+
+// APIKey is a long lived credential a user creates for scripts and other
+// programs to call the api as them. The key itself is only shown when it is
+// created; what is stored is its prefix, to find it, and a hash of it.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       []byte     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NewAPIKey makes a key for userID, returning the key to hand to the user,
+// and the APIKey to store.
+func NewAPIKey(userID int, name string, scopes []string, expiresAt time.Time) (string, APIKey, error) {
+	b := make([]byte, 6+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", APIKey{}, err
+	}
+
+	prefix := hex.EncodeToString(b[:6])
+	key := apiKeyMark + prefix + "_" + base64.RawURLEncoding.EncodeToString(b[6:])
+
+	return key, APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      hashAPIKey(key),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// APIKeyPrefix returns the prefix of key, by which it is looked up, and
+// false if key is not shaped like an API key.
+func APIKeyPrefix(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyMark)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 12 || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// Matches reports whether key is this API key.
+func (k *APIKey) Matches(key string) bool {
+	return subtle.ConstantTimeCompare(hashAPIKey(key), k.Hash) == 1
+}
+
+// Expired reports whether the key can no longer be used at now.
+func (k *APIKey) Expired(now time.Time) bool {
+	return !now.Before(k.ExpiresAt)
+}
+
+// HasScope reports whether the key was given scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// The key is random and long, so a fast hash is enough to keep it secret;
+// unlike with passwords there is nothing to guess.
+func hashAPIKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
@@ -0,0 +1,16 @@
+package data
+
+import "time"
+
+// UserIdentity links a user to their account at an external OpenID Connect
+// provider, so they can log in with it. Subject is the id the provider
+// knows them by; Email is the address it vouched for when the identity was
+// linked.
+type UserIdentity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
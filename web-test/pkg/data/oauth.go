@@ -0,0 +1,121 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"time"
+)
+
+// OAuthClient is an application registered to log users in with the OpenID
+// Connect provider. Confidential clients authenticate with a secret, of
+// which only a hash is stored; public clients, such as single page
+// applications, have none and rely on PKCE alone.
+type OAuthClient struct {
+	ID           string    `json:"client_id"`
+	Name         string    `json:"name"`
+	SecretHash   []byte    `json:"-"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NewOAuthClient returns a new client with a random id. Confidential
+// clients get a secret too, which is returned to be shown once; public
+// clients get none.
+func NewOAuthClient(name string, redirectURIs []string, public bool) (OAuthClient, string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return OAuthClient{}, "", err
+	}
+
+	c := OAuthClient{
+		ID:           hex.EncodeToString(b),
+		Name:         name,
+		RedirectURIs: redirectURIs,
+	}
+	if public {
+		return c, "", nil
+	}
+
+	secret, hash, err := NewOAuthSecret()
+	if err != nil {
+		return OAuthClient{}, "", err
+	}
+	c.SecretHash = hash
+	return c, secret, nil
+}
+
+// Public reports whether the client has no secret.
+func (c *OAuthClient) Public() bool {
+	return len(c.SecretHash) == 0
+}
+
+// SecretMatches reports whether secret is the secret of the client. It is
+// always false for public clients.
+func (c *OAuthClient) SecretMatches(secret string) bool {
+	if c.Public() {
+		return false
+	}
+	return subtle.ConstantTimeCompare(HashOAuthSecret(secret), c.SecretHash) == 1
+}
+
+// AllowsRedirect reports whether uri is one of the registered redirect
+// uris. They are compared exactly, as OAuth 2.0 security best practice asks.
+func (c *OAuthClient) AllowsRedirect(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AuthCode is an authorization code, handed to a client through the
+// browser after the user consented, and exchanged once for tokens. Only a
+// hash of the code is stored.
+type AuthCode struct {
+	Hash          []byte
+	ClientID      string
+	UserID        int
+	RedirectURI   string
+	Scopes        []string
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
+
+// OAuthToken is an access token issued to a client for a user. The token is
+// opaque to the client, and only a hash of it is stored, so it can be
+// looked up, introspected and revoked.
+type OAuthToken struct {
+	ID        int
+	Hash      []byte
+	ClientID  string
+	UserID    int
+	Scopes    []string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// Expired reports whether the token can no longer be used at now.
+func (t *OAuthToken) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// NewOAuthSecret returns a random secret, for client secrets, codes and
+// tokens, and the hash to store.
+func NewOAuthSecret() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	return secret, HashOAuthSecret(secret), nil
+}
+
+// HashOAuthSecret returns the hash under which secret is stored. Like API
+// keys, secrets are random and long, so a fast hash is enough.
+func HashOAuthSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
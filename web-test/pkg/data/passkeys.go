@@ -0,0 +1,19 @@
+package data
+
+import "time"
+
+// Passkey is a WebAuthn credential a user registered to log in without a
+// password. CredentialID is how the authenticator names it, and PublicKey
+// is the COSE encoded key its assertions are verified with. SignCount is
+// the counter the authenticator sent last; a counter that goes backwards
+// means the credential was cloned.
+type Passkey struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	Name         string     `json:"name"`
+	CredentialID []byte     `json:"-"`
+	PublicKey    []byte     `json:"-"`
+	SignCount    uint32     `json:"-"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
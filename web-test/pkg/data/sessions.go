@@ -0,0 +1,48 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Keys under which the web application records who a session belongs to and
+// where it is used from. Session stores read them to list a user's sessions.
+const (
+	SessionUserIDKey    = "user_id"
+	SessionUserAgentKey = "session_user_agent"
+	SessionIPKey        = "session_ip"
+	SessionLastSeenKey  = "session_last_seen"
+)
+
+// Session describes one active login of a user.
+type Session struct {
+	Token     string    `json:"-"`
+	UserID    int       `json:"user_id"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	LastSeen  time.Time `json:"last_seen"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+// ID identifies the session without giving away its token, so it can be
+// shown in pages and forms.
+func (s *Session) ID() string {
+	return SessionID(s.Token)
+}
+
+// SessionID returns the public identifier of the session with token.
+func SessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:12])
+}
+
+// SessionFromValues builds a Session from the values stored in it.
+func SessionFromValues(token string, expiry time.Time, values map[string]any) Session {
+	s := Session{Token: token, Expiry: expiry}
+	s.UserID, _ = values[SessionUserIDKey].(int)
+	s.UserAgent, _ = values[SessionUserAgentKey].(string)
+	s.IP, _ = values[SessionIPKey].(string)
+	s.LastSeen, _ = values[SessionLastSeenKey].(time.Time)
+	return s
+}
@@ -14,9 +14,13 @@ type User struct {
 	Email      string    `json:"email"`
 	Password   string    `json:"-"`
 	IsAdmin    int       `json:"is_admin"`
+	Locale     string    `json:"locale"`
 	CreatedAt  time.Time `json:"-"`
 	UpdatedAt  time.Time `json:"-"`
 	ProfilePic UserImage `json:"-"`
+	// ProfilePicURL is where the api serves the profile picture, if the
+	// user has one. The api sets it; it is not stored.
+	ProfilePicURL string `json:"profile_pic_url,omitempty"`
 }
 
 func (u *User) PasswordMatches(plainText string) (bool, error) {
@@ -32,3 +36,70 @@ func (u *User) PasswordMatches(plainText string) (bool, error) {
 
 	return true, nil
 }
+
+// noUserPassword is the hash, at the cost passwords are stored with, of a
+// random password no one was told.
+const noUserPassword = "$2a$12$sFyeUHsKxPp63ZfGdOAKYeEf7cnnm9ol2VGEjNDWu9k1QvsKrnLBW"
+
+// ComparePasswordOfNoUser checks plainText against a password no user has,
+// taking as long as PasswordMatches does. Logins call it when there is no
+// user with the email given, so they do not answer an unknown email faster
+// than a wrong password.
+func ComparePasswordOfNoUser(plainText string) {
+	_ = bcrypt.CompareHashAndPassword([]byte(noUserPassword), []byte(plainText))
+}
+
+// UserPatch holds changes to some fields of a user. Fields which are nil are
+// left as they are.
+type UserPatch struct {
+	FirstName *string
+	LastName  *string
+	Email     *string
+	IsAdmin   *int
+	Locale    *string
+}
+
+// Empty reports whether p changes nothing.
+func (p UserPatch) Empty() bool {
+	return p == UserPatch{}
+}
+
+// Apply makes the changes of p to u.
+func (p UserPatch) Apply(u *User) {
+	if p.FirstName != nil {
+		u.FirstName = *p.FirstName
+	}
+	if p.LastName != nil {
+		u.LastName = *p.LastName
+	}
+	if p.Email != nil {
+		u.Email = *p.Email
+	}
+	if p.IsAdmin != nil {
+		u.IsAdmin = *p.IsAdmin
+	}
+	if p.Locale != nil {
+		u.Locale = *p.Locale
+	}
+}
+
+// UserChanges returns the patch which turns before into after.
+func UserChanges(before, after User) UserPatch {
+	var p UserPatch
+	if after.FirstName != before.FirstName {
+		p.FirstName = &after.FirstName
+	}
+	if after.LastName != before.LastName {
+		p.LastName = &after.LastName
+	}
+	if after.Email != before.Email {
+		p.Email = &after.Email
+	}
+	if after.IsAdmin != before.IsAdmin {
+		p.IsAdmin = &after.IsAdmin
+	}
+	if after.Locale != before.Locale {
+		p.Locale = &after.Locale
+	}
+	return p
+}
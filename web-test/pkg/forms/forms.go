@@ -0,0 +1,290 @@
+// Package forms validates submitted data, from HTML forms or JSON bodies,
+// and collects an error message per field.
+package forms
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors holds the error messages of a form, by field.
+type Errors map[string][]string
+
+// Get returns the first error message for field, or "".
+func (e Errors) Get(field string) string {
+	errorSlice := e[field]
+	if len(errorSlice) == 0 {
+		return ""
+	}
+
+	return errorSlice[0]
+}
+
+// Add adds an error message for a given form field.
+func (e Errors) Add(field, message string) {
+	e[field] = append(e[field], message)
+}
+
+// Form is the type used to instantiate form validation. Rules other than
+// Required and FileRequired pass for empty fields, so optional fields can
+// use them too.
+type Form struct {
+	Data   url.Values
+	Files  map[string][]*multipart.FileHeader
+	Errors Errors
+	// Messages holds the text of the errors added by the rules; rules
+	// missing from it fall back to English.
+	Messages Messages
+}
+
+// New initializes a form struct
+func New(data url.Values) *Form {
+	return &Form{
+		Data:     data,
+		Errors:   Errors{},
+		Messages: English,
+	}
+}
+
+// FromMultipart returns a form for the values and files of a parsed
+// multipart request.
+func FromMultipart(mf *multipart.Form) *Form {
+	if mf == nil {
+		return New(url.Values{})
+	}
+
+	f := New(url.Values(mf.Value))
+	f.Files = mf.File
+	return f
+}
+
+// FromStruct returns a form for a decoded JSON body, with a field for every
+// JSON field of v, so errors are reported under the names clients use.
+func FromStruct(v any) (*Form, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, fmt.Errorf("forms: %T is not a JSON object", v)
+	}
+
+	data := url.Values{}
+	for name, value := range fields {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			data.Set(name, value)
+		case []any:
+			for _, item := range value {
+				data.Add(name, fmt.Sprint(item))
+			}
+		default:
+			data.Set(name, fmt.Sprint(value))
+		}
+	}
+
+	return New(data), nil
+}
+
+// Has checks to see if the form has a given field
+func (f *Form) Has(field string) bool {
+	return f.Data.Get(field) != ""
+}
+
+// Value returns the submitted value of field, for filling a form in again.
+func (f *Form) Value(field string) string {
+	return f.Data.Get(field)
+}
+
+// Invalid reports whether field has an error, so templates can mark it.
+func (f *Form) Invalid(field string) bool {
+	return len(f.Errors[field]) > 0
+}
+
+// Valid returns true if there are no errors, otherwise false
+func (f *Form) Valid() bool {
+	return len(f.Errors) == 0
+}
+
+// Check is a generic validation check. We can pass any expression
+// that evaluates as a boolean as the first parameter.
+func (f *Form) Check(ok bool, key, message string) {
+	if !ok {
+		f.Errors.Add(key, message)
+	}
+}
+
+// fail adds the message of rule, filled in with args, to field.
+func (f *Form) fail(field, rule string, args ...any) {
+	f.Errors.Add(field, f.Messages.format(rule, args...))
+}
+
+// value returns the trimmed value of field, and whether there is one.
+func (f *Form) value(field string) (string, bool) {
+	v := strings.TrimSpace(f.Data.Get(field))
+	return v, v != ""
+}
+
+// Required checks for required fields
+func (f *Form) Required(fields ...string) {
+	for _, field := range fields {
+		if _, ok := f.value(field); !ok {
+			f.fail(field, RuleRequired)
+		}
+	}
+}
+
+// Email checks that field holds a single plain email address.
+func (f *Form) Email(field string) {
+	v, ok := f.value(field)
+	if !ok {
+		return
+	}
+
+	addr, err := mail.ParseAddress(v)
+	if err != nil || addr.Address != v || !strings.Contains(v[strings.LastIndex(v, "@"):], ".") {
+		f.fail(field, RuleEmail)
+	}
+}
+
+// MinLength checks that field is at least n characters long.
+func (f *Form) MinLength(field string, n int) {
+	if v, ok := f.value(field); ok && utf8.RuneCountInString(v) < n {
+		f.fail(field, RuleMinLength, n)
+	}
+}
+
+// MaxLength checks that field is at most n characters long.
+func (f *Form) MaxLength(field string, n int) {
+	if v, ok := f.value(field); ok && utf8.RuneCountInString(v) > n {
+		f.fail(field, RuleMaxLength, n)
+	}
+}
+
+// Matches checks that all of field matches re.
+func (f *Form) Matches(field string, re *regexp.Regexp) {
+	v, ok := f.value(field)
+	if !ok {
+		return
+	}
+
+	if loc := re.FindStringIndex(v); loc == nil || loc[0] != 0 || loc[1] != len(v) {
+		f.fail(field, RuleMatches)
+	}
+}
+
+// Range checks that field is a number from min to max, inclusive.
+func (f *Form) Range(field string, min, max float64) {
+	v, ok := f.value(field)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	switch {
+	case err != nil:
+		f.fail(field, RuleNumber)
+	case n < min || n > max:
+		f.fail(field, RuleRange, min, max)
+	}
+}
+
+// Equal checks that field has the same value as other, as a password
+// confirmation must.
+func (f *Form) Equal(field, other string) {
+	if f.Data.Get(field) != f.Data.Get(other) {
+		f.fail(field, RuleEqual, other)
+	}
+}
+
+// OneOf checks that field is one of allowed. A field with several values,
+// such as a group of checkboxes, must only have allowed ones.
+func (f *Form) OneOf(field string, allowed ...string) {
+	for _, v := range f.Data[field] {
+		v = strings.TrimSpace(v)
+		if v != "" && !slices.Contains(allowed, v) {
+			f.fail(field, RuleOneOf, strings.Join(allowed, ", "))
+			return
+		}
+	}
+}
+
+// Unique checks field with taken, usually a lookup in the database, which
+// reports whether someone else already uses the value.
+func (f *Form) Unique(field string, taken func(value string) bool) {
+	if v, ok := f.value(field); ok && taken(v) {
+		f.fail(field, RuleUnique)
+	}
+}
+
+// FileRequired checks that at least one file was uploaded as field.
+func (f *Form) FileRequired(field string) {
+	if len(f.Files[field]) == 0 {
+		f.fail(field, RuleFileRequired)
+	}
+}
+
+// MaxFileSize checks that no file uploaded as field is larger than size bytes.
+func (f *Form) MaxFileSize(field string, size int64) {
+	for _, hdr := range f.Files[field] {
+		if hdr.Size > size {
+			f.fail(field, RuleFileSize, size)
+			return
+		}
+	}
+}
+
+// FileType checks the content of the files uploaded as field, not the
+// content type the client claims, against the MIME types allowed. A type
+// may end in a wildcard, e.g. "image/*".
+func (f *Form) FileType(field string, allowed ...string) {
+	for _, hdr := range f.Files[field] {
+		ctype, err := sniff(hdr)
+		if err != nil || !mimeAllowed(ctype, allowed) {
+			f.fail(field, RuleFileType, strings.Join(allowed, ", "))
+			return
+		}
+	}
+}
+
+// sniff detects the content type of an uploaded file from its first bytes.
+func sniff(hdr *multipart.FileHeader) (string, error) {
+	file, err := hdr.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 512)
+	n, err := file.Read(buf)
+	if err != nil && n == 0 {
+		return "", err
+	}
+
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func mimeAllowed(ctype string, allowed []string) bool {
+	ctype, _, _ = strings.Cut(ctype, ";")
+	for _, a := range allowed {
+		if a == ctype {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "*"); ok && strings.HasPrefix(ctype, prefix) {
+			return true
+		}
+	}
+	return false
+}
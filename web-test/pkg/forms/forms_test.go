@@ -0,0 +1,212 @@
+package forms
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestForm_Has(t *testing.T) {
+	form := New(nil)
+
+	has := form.Has("whatever")
+	if has {
+		t.Error("form shows has field when it should not")
+	}
+
+	postedData := url.Values{}
+	postedData.Add("a", "a")
+	form = New(postedData)
+
+	has = form.Has("a")
+	if !has {
+		t.Error("shows form does not have field when it should")
+	}
+}
+
+func TestForm_Required(t *testing.T) {
+	r := httptest.NewRequest("POST", "/whatever", nil)
+	form := New(r.PostForm)
+
+	form.Required("a", "b", "c")
+
+	if form.Valid() {
+		t.Error("form shows valid when required fields are missing")
+	}
+
+	postedData := url.Values{}
+	postedData.Add("a", "a")
+	postedData.Add("b", "b")
+	postedData.Add("c", "c")
+
+	r, _ = http.NewRequest("POST", "/whatever", nil)
+	r.PostForm = postedData
+
+	form = New(r.PostForm)
+	form.Required("a", "b", "c")
+	if !form.Valid() {
+		t.Error("shows post does not have required fields, when it does")
+	}
+}
+
+func TestForm_Check(t *testing.T) {
+	form := New(nil)
+
+	form.Check(false, "password", "password is required")
+	if form.Valid() {
+		t.Error("Valid() returns false, and it should be true when calling Check()")
+	}
+}
+
+func TestForm_ErrorGet(t *testing.T) {
+	form := New(nil)
+	form.Check(false, "password", "password is required")
+	s := form.Errors.Get("password")
+
+	if len(s) == 0 {
+		t.Error("should have an error returned from Get, but do not")
+	}
+
+	s = form.Errors.Get("whatever")
+	if len(s) != 0 {
+		t.Error("should not have an error, but got one")
+	}
+}
+func TestForm_ValueAndInvalid(t *testing.T) {
+	form := New(url.Values{"email": {"me@here.com"}})
+	form.Required("email", "password")
+
+	if form.Value("email") != "me@here.com" {
+		t.Errorf("expected the submitted email, got %q", form.Value("email"))
+	}
+	if form.Invalid("email") {
+		t.Error("email should not be invalid")
+	}
+	if !form.Invalid("password") {
+		t.Error("missing password should be invalid")
+	}
+}
+
+func TestForm_Rules(t *testing.T) {
+	var tests = []struct {
+		name  string
+		data  url.Values
+		rule  func(f *Form)
+		valid bool
+	}{
+		{"email", url.Values{"e": {"me@here.com"}}, func(f *Form) { f.Email("e") }, true},
+		{"email without domain", url.Values{"e": {"me@here"}}, func(f *Form) { f.Email("e") }, false},
+		{"email with name", url.Values{"e": {"Me <me@here.com>"}}, func(f *Form) { f.Email("e") }, false},
+		{"empty email", url.Values{}, func(f *Form) { f.Email("e") }, true},
+		{"min length", url.Values{"p": {"héllo"}}, func(f *Form) { f.MinLength("p", 5) }, true},
+		{"too short", url.Values{"p": {"hi"}}, func(f *Form) { f.MinLength("p", 5) }, false},
+		{"too long", url.Values{"p": {"hello"}}, func(f *Form) { f.MaxLength("p", 4) }, false},
+		{"matches", url.Values{"z": {"12345"}}, func(f *Form) { f.Matches("z", regexp.MustCompile(`\d{5}`)) }, true},
+		{"partial match", url.Values{"z": {"123456"}}, func(f *Form) { f.Matches("z", regexp.MustCompile(`\d{5}`)) }, false},
+		{"in range", url.Values{"n": {"2.5"}}, func(f *Form) { f.Range("n", 1, 3) }, true},
+		{"out of range", url.Values{"n": {"4"}}, func(f *Form) { f.Range("n", 1, 3) }, false},
+		{"not a number", url.Values{"n": {"two"}}, func(f *Form) { f.Range("n", 1, 3) }, false},
+		{"equal", url.Values{"a": {"x"}, "b": {"x"}}, func(f *Form) { f.Equal("b", "a") }, true},
+		{"not equal", url.Values{"a": {"x"}, "b": {"y"}}, func(f *Form) { f.Equal("b", "a") }, false},
+		{"one of", url.Values{"c": {"red"}}, func(f *Form) { f.OneOf("c", "red", "blue") }, true},
+		{"not one of", url.Values{"c": {"green"}}, func(f *Form) { f.OneOf("c", "red", "blue") }, false},
+		{"all of several one of", url.Values{"c": {"red", "blue"}}, func(f *Form) { f.OneOf("c", "red", "blue") }, true},
+		{"one of several not one of", url.Values{"c": {"red", "green"}}, func(f *Form) { f.OneOf("c", "red", "blue") }, false},
+		{"unique", url.Values{"e": {"new@here.com"}}, func(f *Form) { f.Unique("e", func(string) bool { return false }) }, true},
+		{"taken", url.Values{"e": {"old@here.com"}}, func(f *Form) { f.Unique("e", func(string) bool { return true }) }, false},
+	}
+
+	for _, e := range tests {
+		form := New(e.data)
+		e.rule(form)
+		if form.Valid() != e.valid {
+			t.Errorf("%s: expected valid to be %t, errors %v", e.name, e.valid, form.Errors)
+		}
+	}
+}
+
+func TestForm_Messages(t *testing.T) {
+	form := New(url.Values{"p": {"hi"}})
+	form.MinLength("p", 8)
+	if got := form.Errors.Get("p"); got != "This field must be at least 8 characters long" {
+		t.Errorf("unexpected message %q", got)
+	}
+
+	form = New(url.Values{"p": {"hi"}})
+	form.Messages = Messages{RuleMinLength: "Mindestens %d Zeichen"}
+	form.MinLength("p", 8)
+	form.Required("q")
+	if got := form.Errors.Get("p"); got != "Mindestens 8 Zeichen" {
+		t.Errorf("expected the translated message, got %q", got)
+	}
+	if got := form.Errors.Get("q"); got != English[RuleRequired] {
+		t.Errorf("expected missing translations to fall back to English, got %q", got)
+	}
+}
+
+func TestForm_Files(t *testing.T) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	w, _ := mw.CreateFormFile("image", "dot.png")
+	_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	w, _ = mw.CreateFormFile("doc", "dot.png")
+	_, _ = w.Write([]byte("plain text"))
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name  string
+		rule  func(f *Form)
+		valid bool
+	}{
+		{"present", func(f *Form) { f.FileRequired("image") }, true},
+		{"missing", func(f *Form) { f.FileRequired("other") }, false},
+		{"small enough", func(f *Form) { f.MaxFileSize("image", 1024) }, true},
+		{"too big", func(f *Form) { f.MaxFileSize("image", 4) }, false},
+		{"image", func(f *Form) { f.FileType("image", "image/png") }, true},
+		{"wildcard", func(f *Form) { f.FileType("image", "image/*") }, true},
+		{"text named like an image", func(f *Form) { f.FileType("doc", "image/*") }, false},
+	}
+
+	for _, e := range tests {
+		form := FromMultipart(r.MultipartForm)
+		e.rule(form)
+		if form.Valid() != e.valid {
+			t.Errorf("%s: expected valid to be %t, errors %v", e.name, e.valid, form.Errors)
+		}
+	}
+}
+
+func TestFromStruct(t *testing.T) {
+	type dto struct {
+		Email   string   `json:"email"`
+		Age     int      `json:"age"`
+		Tags    []string `json:"tags"`
+		Skipped string   `json:"-"`
+	}
+
+	form, err := FromStruct(dto{Email: "me@here.com", Age: 42, Tags: []string{"a", "b"}, Skipped: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if form.Value("email") != "me@here.com" || form.Value("age") != "42" || len(form.Data["tags"]) != 2 {
+		t.Errorf("unexpected form data %v", form.Data)
+	}
+	if form.Has("Skipped") {
+		t.Error("fields left out of JSON should not be in the form")
+	}
+
+	if _, err := FromStruct([]string{"a"}); err == nil {
+		t.Error("expected an error for a value which is not a JSON object")
+	}
+}
@@ -0,0 +1,54 @@
+package forms
+
+import "fmt"
+
+// The rules a Form checks, which are also the keys of their messages.
+const (
+	RuleRequired     = "required"
+	RuleEmail        = "email"
+	RuleMinLength    = "min_length"
+	RuleMaxLength    = "max_length"
+	RuleMatches      = "matches"
+	RuleNumber       = "number"
+	RuleRange        = "range"
+	RuleEqual        = "equal"
+	RuleOneOf        = "one_of"
+	RuleUnique       = "unique"
+	RuleFileRequired = "file_required"
+	RuleFileSize     = "file_size"
+	RuleFileType     = "file_type"
+)
+
+// Messages maps rules to the text of their errors. The text is a fmt format
+// for the arguments of the rule, e.g. the length for RuleMinLength.
+// Translations only need the rules they change; the others fall back to
+// English.
+type Messages map[string]string
+
+// English holds the messages forms use by default.
+var English = Messages{
+	RuleRequired:     "This field cannot be blank",
+	RuleEmail:        "Enter a valid email address",
+	RuleMinLength:    "This field must be at least %d characters long",
+	RuleMaxLength:    "This field must be at most %d characters long",
+	RuleMatches:      "This field is not in the right format",
+	RuleNumber:       "This field must be a number",
+	RuleRange:        "This field must be between %v and %v",
+	RuleEqual:        "This field must match %s",
+	RuleOneOf:        "This field must be one of %s",
+	RuleUnique:       "This value is already in use",
+	RuleFileRequired: "Choose a file to upload",
+	RuleFileSize:     "The file must be at most %d bytes",
+	RuleFileType:     "The file must be one of %s",
+}
+
+func (m Messages) format(rule string, args ...any) string {
+	text, ok := m[rule]
+	if !ok {
+		text = English[rule]
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
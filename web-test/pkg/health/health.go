@@ -0,0 +1,91 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// Check reports whether one dependency of the application is usable.
+type Check func(ctx context.Context) error
+
+// checkTimeout bounds how long a readiness probe may take.
+const checkTimeout = 2 * time.Second
+
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Live answers liveness probes; if the process can serve it, it is alive.
+func Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, response{Status: "ok"})
+}
+
+// Ready returns a handler that runs every check and answers 200 if all of
+// them pass, or 503 listing the ones that failed.
+func Ready(checks map[string]Check) http.HandlerFunc {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		resp := response{Status: "ok", Checks: make(map[string]string)}
+		status := http.StatusOK
+
+		for _, name := range names {
+			if err := checks[name](ctx); err != nil {
+				resp.Checks[name] = err.Error()
+				resp.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			resp.Checks[name] = "ok"
+		}
+
+		writeJSON(w, status, resp)
+	}
+}
+
+// Database checks the connection returned by conn with a ping. conn is
+// usually the Connection method of a repository.DatabaseRepo.
+func Database(conn func() *sql.DB) Check {
+	return func(ctx context.Context) error {
+		db := conn()
+		if db == nil {
+			return errors.New("no database connection")
+		}
+		return db.PingContext(ctx)
+	}
+}
+
+// WritableDir checks that a file can be created in dir.
+func WritableDir(dir string) Check {
+	return func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+		name := f.Name()
+		_ = f.Close()
+
+		return os.Remove(name)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
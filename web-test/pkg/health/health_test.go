@@ -0,0 +1,46 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestReady(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("down") }
+
+	var tests = []struct {
+		name           string
+		checks         map[string]Check
+		expectedStatus int
+	}{
+		{"all passing", map[string]Check{"a": ok, "b": ok}, http.StatusOK},
+		{"one failing", map[string]Check{"a": ok, "b": failing}, http.StatusServiceUnavailable},
+		{"no database", map[string]Check{"database": Database(func() *sql.DB { return nil })}, http.StatusServiceUnavailable},
+		{"writable dir", map[string]Check{"storage": WritableDir(t.TempDir())}, http.StatusOK},
+		{"missing dir", map[string]Check{"storage": WritableDir(filepath.Join(t.TempDir(), "nope"))}, http.StatusServiceUnavailable},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		Ready(e.checks).ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+	}
+}
+
+func TestLive(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Live(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200 but got %d", rr.Code)
+	}
+}
@@ -0,0 +1,290 @@
+// Package i18n loads message catalogs, one per locale, picks the locale for a
+// request and translates messages by key.
+//
+// Catalogs are TOML or JSON files named after their locale, e.g. en.toml or
+// pt-BR.json. Nested tables are flattened, so
+//
+//	[flash]
+//	login_first = "Log in first!"
+//
+// defines the key "flash.login_first". Messages are fmt formats for the
+// arguments given when translating.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"webapp/pkg/forms"
+
+	"github.com/BurntSushi/toml"
+)
+
+//go:embed locales
+var locales embed.FS
+
+// Catalogs holds the catalogs shipped with the binaries.
+var Catalogs, _ = fs.Sub(locales, "locales")
+
+// Bundle holds the catalogs of every supported locale.
+type Bundle struct {
+	fallback string
+	tags     []string
+	catalogs map[string]map[string]string
+}
+
+// New reads the catalogs in the top directory of fsys. Messages missing from
+// a catalog are taken from the one for fallback, which must exist.
+func New(fsys fs.FS, fallback string) (*Bundle, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{fallback: fallback, catalogs: make(map[string]map[string]string)}
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".toml" && ext != ".json") {
+			continue
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		var tree map[string]any
+		if ext == ".toml" {
+			err = toml.Unmarshal(content, &tree)
+		} else {
+			err = json.Unmarshal(content, &tree)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", entry.Name(), err)
+		}
+
+		tag := strings.TrimSuffix(entry.Name(), ext)
+		catalog := make(map[string]string)
+		if err := flatten(catalog, "", tree); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", entry.Name(), err)
+		}
+		b.catalogs[tag] = catalog
+		b.tags = append(b.tags, tag)
+	}
+
+	if _, ok := b.catalogs[fallback]; !ok {
+		return nil, fmt.Errorf("i18n: there is no catalog for the default locale %q", fallback)
+	}
+	sort.Strings(b.tags)
+
+	return b, nil
+}
+
+func flatten(catalog map[string]string, prefix string, tree map[string]any) error {
+	for key, value := range tree {
+		switch value := value.(type) {
+		case string:
+			catalog[prefix+key] = value
+		case map[string]any:
+			if err := flatten(catalog, prefix+key+".", value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s%s is not a message", prefix, key)
+		}
+	}
+	return nil
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultBundle *Bundle
+)
+
+// Default returns the bundle of the shipped catalogs, with English as the
+// fallback. It is used where no bundle was set up, such as in tests.
+func Default() *Bundle {
+	defaultOnce.Do(func() {
+		var err error
+		defaultBundle, err = New(Catalogs, "en")
+		if err != nil {
+			panic(err)
+		}
+	})
+	return defaultBundle
+}
+
+// Locales returns the locales there is a catalog for, sorted.
+func (b *Bundle) Locales() []string {
+	return b.tags
+}
+
+// Match returns the first of the locales asked for that there is a catalog
+// for, or the fallback. A locale matches a catalog for the same language when
+// there is none for its region: "pt-PT" is served by "pt-BR", and "pt" by
+// "pt-BR" as well.
+func (b *Bundle) Match(wanted ...string) string {
+	for _, w := range wanted {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+
+		for _, tag := range b.tags {
+			if strings.EqualFold(tag, w) {
+				return tag
+			}
+		}
+
+		lang, _, _ := strings.Cut(w, "-")
+		for _, tag := range b.tags {
+			tagLang, _, _ := strings.Cut(tag, "-")
+			if strings.EqualFold(tagLang, lang) {
+				return tag
+			}
+		}
+	}
+
+	return b.fallback
+}
+
+// ParseAcceptLanguage returns the languages of an Accept-Language header,
+// most preferred first. Languages with q=0, and the wildcard, are left out.
+func ParseAcceptLanguage(header string) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+
+	var langs []lang
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		langs = append(langs, lang{tag, q})
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+// Translator translates messages into one locale.
+type Translator struct {
+	locale   string
+	catalog  map[string]string
+	fallback map[string]string
+}
+
+// Translator returns the translator for locale, which should come from Match.
+func (b *Bundle) Translator(locale string) *Translator {
+	catalog, ok := b.catalogs[locale]
+	if !ok {
+		locale, catalog = b.fallback, b.catalogs[b.fallback]
+	}
+
+	return &Translator{locale: locale, catalog: catalog, fallback: b.catalogs[b.fallback]}
+}
+
+// Locale returns the locale t translates into.
+func (t *Translator) Locale() string {
+	return t.locale
+}
+
+// T translates the message key, filled in with args. A key missing from the
+// catalog is taken from the fallback catalog, and a key missing from both is
+// returned as it is, so it shows up clearly on the page.
+func (t *Translator) T(key string, args ...any) string {
+	msg, ok := t.catalog[key]
+	if !ok {
+		if msg, ok = t.fallback[key]; !ok {
+			return key
+		}
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// FormMessages returns the form error messages of the catalog, which are the
+// keys under "form", e.g. "form.required". Rules the catalog has no message
+// for use the English of package forms.
+func (t *Translator) FormMessages() forms.Messages {
+	messages := forms.Messages{}
+	for key, msg := range t.catalog {
+		if rule, ok := strings.CutPrefix(key, "form."); ok {
+			messages[rule] = msg
+		}
+	}
+	return messages
+}
+
+// Middleware stores a translator in the context of each request, for the
+// locale preferred returns or, when that is "", the best match for the
+// Accept-Language header. preferred may be nil.
+func (b *Bundle) Middleware(preferred func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var wanted []string
+			if preferred != nil {
+				wanted = append(wanted, preferred(r))
+			}
+			wanted = append(wanted, ParseAcceptLanguage(r.Header.Get("Accept-Language"))...)
+
+			t := b.Translator(b.Match(wanted...))
+			w.Header().Add("Vary", "Accept-Language")
+			w.Header().Set("Content-Language", t.Locale())
+
+			next.ServeHTTP(w, r.WithContext(WithTranslator(r.Context(), t)))
+		})
+	}
+}
+
+type contextKey struct{}
+
+// WithTranslator returns a copy of ctx carrying t.
+func WithTranslator(ctx context.Context, t *Translator) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the translator stored in ctx, or one for the default
+// locale of the Default bundle.
+func FromContext(ctx context.Context) *Translator {
+	if t, ok := ctx.Value(contextKey{}).(*Translator); ok {
+		return t
+	}
+	return Default().Translator(Default().fallback)
+}
+
+// T translates key with the translator of ctx.
+func T(ctx context.Context, key string, args ...any) string {
+	return FromContext(ctx).T(key, args...)
+}
@@ -0,0 +1,165 @@
+package i18n
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"webapp/pkg/forms"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"en.toml":    {Data: []byte("[greeting]\nhello = \"Hello, %s!\"\nbye = \"Bye\"\n")},
+		"pt-BR.json": {Data: []byte(`{"greeting": {"hello": "Olá, %s!"}, "form": {"required": "Obrigatório"}}`)},
+		"README.md":  {Data: []byte("not a catalog")},
+	}
+}
+
+func TestBundle_Match(t *testing.T) {
+	b, err := New(testFS(), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(b.Locales(), []string{"en", "pt-BR"}) {
+		t.Errorf("unexpected locales %v", b.Locales())
+	}
+
+	var tests = []struct {
+		wanted   []string
+		expected string
+	}{
+		{nil, "en"},
+		{[]string{"pt-BR"}, "pt-BR"},
+		{[]string{"pt-br"}, "pt-BR"},
+		{[]string{"pt"}, "pt-BR"},
+		{[]string{"pt-PT"}, "pt-BR"},
+		{[]string{"", "de", "en-GB"}, "en"},
+		{[]string{"fr"}, "en"},
+	}
+
+	for _, e := range tests {
+		if got := b.Match(e.wanted...); got != e.expected {
+			t.Errorf("%v: expected %s but got %s", e.wanted, e.expected, got)
+		}
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	var tests = []struct {
+		header   string
+		expected []string
+	}{
+		{"", []string{}},
+		{"pt-BR", []string{"pt-BR"}},
+		{"en;q=0.5, pt-BR, pt;q=0.8", []string{"pt-BR", "pt", "en"}},
+		{"fr;q=0, de, *;q=0.1", []string{"de"}},
+		{"en;q=bad, de", []string{"de"}},
+	}
+
+	for _, e := range tests {
+		if got := ParseAcceptLanguage(e.header); !reflect.DeepEqual(got, e.expected) {
+			t.Errorf("%q: expected %v but got %v", e.header, e.expected, got)
+		}
+	}
+}
+
+func TestTranslator_T(t *testing.T) {
+	b, _ := New(testFS(), "en")
+	pt := b.Translator("pt-BR")
+
+	if got := pt.T("greeting.hello", "Ana"); got != "Olá, Ana!" {
+		t.Errorf("unexpected translation %q", got)
+	}
+	if got := pt.T("greeting.bye"); got != "Bye" {
+		t.Errorf("expected the fallback message, got %q", got)
+	}
+	if got := pt.T("greeting.missing"); got != "greeting.missing" {
+		t.Errorf("expected a missing key to be returned as it is, got %q", got)
+	}
+	if got := b.Translator("de").Locale(); got != "en" {
+		t.Errorf("expected an unknown locale to use the fallback, got %s", got)
+	}
+	if got := pt.FormMessages(); !reflect.DeepEqual(got, forms.Messages{forms.RuleRequired: "Obrigatório"}) {
+		t.Errorf("unexpected form messages %v", got)
+	}
+}
+
+func TestNew_errors(t *testing.T) {
+	if _, err := New(testFS(), "de"); err == nil {
+		t.Error("expected an error for a fallback without a catalog")
+	}
+
+	fsys := testFS()
+	fsys["de.toml"] = &fstest.MapFile{Data: []byte("count = 3\n")}
+	if _, err := New(fsys, "en"); err == nil {
+		t.Error("expected an error for a value which is not a message")
+	}
+}
+
+// TestCatalogs checks the shipped catalogs: every key of a translation must
+// exist in English, and form messages must belong to a rule.
+func TestCatalogs(t *testing.T) {
+	b := Default()
+	en := b.catalogs["en"]
+
+	for _, tag := range b.Locales() {
+		if b.Translator(tag).T("locale.name") == "locale.name" {
+			t.Errorf("%s: locale.name is missing", tag)
+		}
+
+		for key := range b.catalogs[tag] {
+			if rule, ok := strings.CutPrefix(key, "form."); ok {
+				if _, known := forms.English[rule]; !known {
+					t.Errorf("%s: %s is not a form rule", tag, key)
+				}
+				continue
+			}
+			if _, ok := en[key]; !ok {
+				t.Errorf("%s: %s is not in the English catalog", tag, key)
+			}
+		}
+	}
+}
+
+func TestBundle_Middleware(t *testing.T) {
+	b, _ := New(testFS(), "en")
+
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context()).Locale()
+	})
+
+	var tests = []struct {
+		name           string
+		preferred      string
+		acceptLanguage string
+		expected       string
+	}{
+		{"nothing asked", "", "", "en"},
+		{"browser", "", "pt-BR,en;q=0.8", "pt-BR"},
+		{"user preference wins", "en", "pt-BR", "en"},
+	}
+
+	for _, e := range tests {
+		h := b.Middleware(func(r *http.Request) string { return e.preferred })(next)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", e.acceptLanguage)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if got != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, got)
+		}
+		if rr.Header().Get("Content-Language") != e.expected {
+			t.Errorf("%s: expected Content-Language %s but got %s", e.name, e.expected, rr.Header().Get("Content-Language"))
+		}
+	}
+
+	if FromContext(httptest.NewRequest("GET", "/", nil).Context()).Locale() != "en" {
+		t.Error("expected English without a translator in the context")
+	}
+}
@@ -0,0 +1,133 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// the examples of RFC 7396, appendix A
+	var tests = []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"id":12345678901234567890}`, `{"name":"x"}`, `{"id":12345678901234567890,"name":"x"}`},
+	}
+
+	for _, e := range tests {
+		got, err := MergePatch([]byte(e.doc), []byte(e.patch))
+		if err != nil {
+			t.Errorf("%s + %s: %s", e.doc, e.patch, err)
+			continue
+		}
+		if !sameJSON(t, got, e.expected) {
+			t.Errorf("%s + %s: expected %s but got %s", e.doc, e.patch, e.expected, got)
+		}
+	}
+
+	if _, err := MergePatch([]byte(`{}`), []byte(`{"a":`)); err == nil {
+		t.Error("expected an error for a patch which is not JSON")
+	}
+}
+
+func TestApply(t *testing.T) {
+	// mostly the examples of RFC 6902, appendix A
+	var tests = []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add to array", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append to array", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"add to nested array", `{"a":[[1,2]]}`, `[{"op":"add","path":"/a/0/1","value":9}]`, `{"a":[[1,9,2]]}`},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove from array", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"replace with null", `{"baz":"qux"}`, `[{"op":"replace","path":"/baz","value":null}]`, `{"baz":null}`},
+		{"move", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"move in array", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"test passes", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{"escaped pointer", `{"a/b":1,"m~n":2}`, `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`, `{"a/b":3}`},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+
+	for _, e := range tests {
+		got, err := Apply([]byte(e.doc), []byte(e.patch))
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+		if !sameJSON(t, got, e.expected) {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	var tests = []struct {
+		name       string
+		doc        string
+		patch      string
+		testFailed bool
+	}{
+		{"test fails", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, true},
+		{"test of missing member", `{}`, `[{"op":"test","path":"/baz","value":"bar"}]`, true},
+		{"missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, false},
+		{"remove missing member", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, false},
+		{"replace missing member", `{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`, false},
+		{"index out of range", `{"foo":[1]}`, `[{"op":"add","path":"/foo/2","value":1}]`, false},
+		{"leading zero index", `{"foo":[1,2]}`, `[{"op":"remove","path":"/foo/01"}]`, false},
+		{"missing value", `{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, false},
+		{"unknown op", `{"foo":"bar"}`, `[{"op":"frobnicate","path":"/foo"}]`, false},
+		{"bad pointer", `{"foo":"bar"}`, `[{"op":"remove","path":"foo"}]`, false},
+		{"move into itself", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, false},
+		{"not a list", `{}`, `{"op":"remove","path":"/foo"}`, false},
+	}
+
+	for _, e := range tests {
+		_, err := Apply([]byte(e.doc), []byte(e.patch))
+		if err == nil {
+			t.Errorf("%s: expected an error", e.name)
+			continue
+		}
+		if errors.Is(err, ErrTestFailed) != e.testFailed {
+			t.Errorf("%s: expected ErrTestFailed to be %v, got %s", e.name, e.testFailed, err)
+		}
+	}
+}
+
+func sameJSON(t *testing.T, got []byte, expected string) bool {
+	t.Helper()
+
+	var a, b any
+	if err := json.Unmarshal(got, &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(expected), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	ga, _ := json.Marshal(a)
+	gb, _ := json.Marshal(b)
+	return string(ga) == string(gb)
+}
@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader is the header used to receive and return the correlation id of a request.
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey string
+
+const requestContextKey contextKey = "request_info"
+
+// requestInfo is stored in the request context by RequestID. Handlers deeper
+// in the chain fill in what they learn, so the access log written on the way
+// out can report it.
+type requestInfo struct {
+	mu     sync.Mutex
+	id     string
+	userID string
+}
+
+// New returns a logger writing to w. format is "json" or "text"; level is one
+// of debug, info, warn or error.
+func New(w io.Writer, format, level string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	if strings.EqualFold(format, "json") {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Discard returns a logger that drops everything, for tests.
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// RequestID makes sure every request has a correlation id. A well formed
+// X-Request-ID sent by the client or a proxy is kept, otherwise a new one is
+// generated. The id is echoed in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validID(id) {
+			id = newID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestContextKey, &requestInfo{id: id})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// IDFromContext returns the request id, or an empty string outside of RequestID.
+func IDFromContext(ctx context.Context) string {
+	info, ok := ctx.Value(requestContextKey).(*requestInfo)
+	if !ok {
+		return ""
+	}
+
+	return info.id
+}
+
+// SetUserID records the authenticated user for the access log.
+func SetUserID(ctx context.Context, userID string) {
+	info, ok := ctx.Value(requestContextKey).(*requestInfo)
+	if !ok {
+		return
+	}
+
+	info.mu.Lock()
+	info.userID = userID
+	info.mu.Unlock()
+}
+
+// FromContext returns logger annotated with the request id, if there is one.
+func FromContext(ctx context.Context, logger *slog.Logger) *slog.Logger {
+	if id := IDFromContext(ctx); id != "" {
+		return logger.With("request_id", id)
+	}
+
+	return logger
+}
+
+// AccessLog returns middleware that writes one line per request. clientIP
+// resolves the address of the client from the request as seen by the middleware.
+func AccessLog(logger *slog.Logger, clientIP func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r)
+
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			var userID string
+			if info, ok := r.Context().Value(requestContextKey).(*requestInfo); ok {
+				info.mu.Lock()
+				userID = info.userID
+				info.mu.Unlock()
+			}
+
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			FromContext(r.Context(), logger).LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", route),
+				slog.Int("status", status),
+				slog.Duration("latency", time.Since(start)),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.String("user_id", userID),
+				slog.String("ip", clientIP(r)),
+			)
+		})
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validID accepts ids of a reasonable length made of characters that are
+// safe to put in logs and headers.
+func validID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRequestID(t *testing.T) {
+	var tests = []struct {
+		name       string
+		incoming   string
+		expectSame bool
+	}{
+		{"no header", "", false},
+		{"valid header", "abc-123", true},
+		{"header with bad characters", "abc 123\n", false},
+	}
+
+	for _, e := range tests {
+		var seen string
+		handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = IDFromContext(r.Context())
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.incoming != "" {
+			req.Header.Set(RequestIDHeader, e.incoming)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if seen == "" || rr.Header().Get(RequestIDHeader) != seen {
+			t.Errorf("%s: expected request id in context and response, got %q and %q", e.name, seen, rr.Header().Get(RequestIDHeader))
+		}
+
+		if e.expectSame && seen != e.incoming {
+			t.Errorf("%s: expected incoming id to be kept, got %q", e.name, seen)
+		}
+
+		if !e.expectSame && seen == e.incoming {
+			t.Errorf("%s: expected a new id, got %q", e.name, seen)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "json", "info")
+
+	mux := chi.NewRouter()
+	mux.Use(RequestID)
+	mux.Use(AccessLog(logger, func(r *http.Request) string { return "192.0.2.1" }))
+	mux.Get("/users/{userID}", func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), "7")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	req := httptest.NewRequest("GET", "/users/7", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected one json log line, got %q: %s", buf.String(), err)
+	}
+
+	expected := map[string]any{
+		"request_id": "req-1",
+		"method":     "GET",
+		"route":      "/users/{userID}",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(5),
+		"user_id":    "7",
+		"ip":         "192.0.2.1",
+	}
+	for k, v := range expected {
+		if line[k] != v {
+			t.Errorf("expected %s to be %v, got %v", k, v, line[k])
+		}
+	}
+}
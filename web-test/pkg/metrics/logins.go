@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"log/slog"
+	"net/http"
+
+	"webapp/pkg/logging"
+)
+
+// CountLogin records the outcome of an attempt to log in, in logins_total,
+// and leaves an audit trail with the address ip the attempt came from. The
+// email tried is not logged: it is personal data, and often enough a
+// password typed in the wrong field.
+func (r *Registry) CountLogin(req *http.Request, logger *slog.Logger, ip string, success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+
+	logging.FromContext(req.Context(), logger).Info("login attempt", "result", result, "ip", ip)
+
+	r.Counter("logins_total", "Number of login attempts by result.", "result").Inc(result)
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRegistry_Middleware(t *testing.T) {
+	reg := New()
+
+	mux := chi.NewRouter()
+	mux.Use(reg.Middleware)
+	mux.Get("/users/{userID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/nothing"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if v := reg.requests.Value("GET", "/users/{userID}", "418"); v != 2 {
+		t.Errorf("expected 2 requests for route pattern, got %v", v)
+	}
+
+	if v := reg.requests.Value("GET", "unmatched", "404"); v != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", v)
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	reg := New()
+	reg.Counter("logins_total", "Number of login attempts by result.", "result").Inc("success")
+	reg.GaugeFunc("answer", "The answer.", func() float64 { return 42 })
+	reg.latency.Observe(0.02, "GET", "/")
+
+	rr := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rr.Body.String()
+	for _, expected := range []string{
+		"# TYPE logins_total counter",
+		`logins_total{result="success"} 1`,
+		"# TYPE answer gauge",
+		"answer 42",
+		`http_request_duration_seconds_bucket{method="GET",route="/",le="0.025"} 1`,
+		`http_request_duration_seconds_bucket{method="GET",route="/",le="0.01"} 0`,
+		`http_request_duration_seconds_count{method="GET",route="/"} 1`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in metrics output:\n%s", expected, body)
+		}
+	}
+}
+
+func TestFormatLabel(t *testing.T) {
+	var tests = []struct {
+		value    string
+		expected string
+	}{
+		{"plain", `name="plain"`},
+		{`back\slash`, `name="back\\slash"`},
+		{`say "hi"`, `name="say \"hi\""`},
+		{"two\nlines", `name="two\nlines"`},
+		{"tab\there", "name=\"tab\there\""},
+		{"café", `name="café"`},
+	}
+
+	for _, e := range tests {
+		if got := formatLabel("name", e.value); got != e.expected {
+			t.Errorf("%q: expected %s but got %s", e.value, e.expected, got)
+		}
+	}
+}
+
+func TestRegistry_CountLogin(t *testing.T) {
+	reg := New()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	req := httptest.NewRequest("POST", "/login", nil)
+	reg.CountLogin(req, logger, "192.0.2.1", false)
+	reg.CountLogin(req, logger, "192.0.2.1", true)
+
+	counter := reg.Counter("logins_total", "Number of login attempts by result.", "result")
+	if counter.Value("failure") != 1 || counter.Value("success") != 1 {
+		t.Errorf("expected one login of each result, got %v and %v", counter.Value("failure"), counter.Value("success"))
+	}
+	if !strings.Contains(buf.String(), "ip=192.0.2.1") || strings.Contains(buf.String(), "email") {
+		t.Errorf("expected the address and no email in the log, got %s", buf.String())
+	}
+}
+
+func TestRegistry_ProtectedHandler(t *testing.T) {
+	reg := New()
+
+	var tests = []struct {
+		name           string
+		token          string
+		authorization  string
+		expectedStatus int
+	}{
+		{"no token configured", "", "Bearer ", http.StatusNotFound},
+		{"no credentials", "scrape-token", "", http.StatusUnauthorized},
+		{"wrong token", "scrape-token", "Bearer other-token", http.StatusUnauthorized},
+		{"basic auth", "scrape-token", "Basic c2NyYXBlLXRva2Vu", http.StatusUnauthorized},
+		{"right token", "scrape-token", "Bearer scrape-token", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if e.authorization != "" {
+			req.Header.Set("Authorization", e.authorization)
+		}
+		rr := httptest.NewRecorder()
+		reg.ProtectedHandler(e.token).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+		if rr.Code == http.StatusOK && !strings.Contains(rr.Body.String(), "# TYPE http_requests_total counter") {
+			t.Errorf("%s: expected the metrics, got %s", e.name, rr.Body)
+		}
+	}
+}
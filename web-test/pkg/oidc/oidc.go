@@ -0,0 +1,218 @@
+// Package oidc holds what the api and the web application share to act as a
+// minimal OpenID Connect provider: the scopes and endpoints it supports,
+// checking authorization requests, PKCE, and signing ID tokens.
+//
+// Only the authorization code flow is supported, and every client must use
+// PKCE with S256. The web application asks the user for consent and hands
+// out the code; the api exchanges it for an opaque access token and an ID
+// token, and serves userinfo, revocation and introspection.
+package oidc
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/repository"
+)
+
+// Scopes clients may ask for. openid is required; profile adds the name and
+// locale of the user to the claims, and email their email address.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// Scopes lists every supported scope.
+var Scopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// Paths of the endpoints served by the api, below the issuer.
+const (
+	DiscoveryPath     = "/.well-known/openid-configuration"
+	JWKSPath          = "/oauth/jwks"
+	TokenPath         = "/oauth/token"
+	UserInfoPath      = "/oauth/userinfo"
+	RevocationPath    = "/oauth/revoke"
+	IntrospectionPath = "/oauth/introspect"
+)
+
+// CodeLifetime is how long an authorization code can be exchanged for
+// tokens after the user consented.
+const CodeLifetime = time.Minute
+
+// Error codes of OAuth 2.0 and OpenID Connect used by the provider.
+const (
+	ErrInvalidRequest          = "invalid_request"
+	ErrInvalidClient           = "invalid_client"
+	ErrInvalidGrant            = "invalid_grant"
+	ErrInvalidScope            = "invalid_scope"
+	ErrInvalidToken            = "invalid_token"
+	ErrAccessDenied            = "access_denied"
+	ErrUnsupportedGrantType    = "unsupported_grant_type"
+	ErrUnsupportedResponseType = "unsupported_response_type"
+	ErrServerError             = "server_error"
+)
+
+// Error is an error reported to the client, as JSON from the api or in the
+// query of the redirect uri.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("oidc: %s: %s", e.Code, e.Description)
+}
+
+// Errors of authorization requests which cannot be sent back to the client,
+// since it is not known where to, and must be shown to the user instead.
+var (
+	ErrUnknownClient  = errors.New("oidc: unknown client")
+	ErrBadRedirectURI = errors.New("oidc: redirect uri is not registered for the client")
+)
+
+// AuthRequest is an authorization request of a client, asking the user to
+// let it log them in.
+type AuthRequest struct {
+	ClientID      string
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	Nonce         string
+	CodeChallenge string
+}
+
+// ParseAuthRequest checks the parameters of an authorization request q
+// against the registered clients. ErrUnknownClient and ErrBadRedirectURI
+// must be shown to the user; an *Error is sent back to the client with
+// ErrorURL of the returned request.
+func ParseAuthRequest(db repository.DatabaseRepo, q url.Values) (*AuthRequest, *data.OAuthClient, error) {
+	client, err := db.GetOAuthClient(q.Get("client_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrUnknownClient
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := &AuthRequest{
+		ClientID:      client.ID,
+		RedirectURI:   q.Get("redirect_uri"),
+		State:         q.Get("state"),
+		Nonce:         q.Get("nonce"),
+		CodeChallenge: q.Get("code_challenge"),
+	}
+	if !client.AllowsRedirect(req.RedirectURI) {
+		return nil, nil, ErrBadRedirectURI
+	}
+
+	// scopes we do not know are left out, as OpenID Connect asks
+	for _, s := range strings.Fields(q.Get("scope")) {
+		if slices.Contains(Scopes, s) && !slices.Contains(req.Scopes, s) {
+			req.Scopes = append(req.Scopes, s)
+		}
+	}
+
+	switch {
+	case q.Get("response_type") != "code":
+		err = &Error{ErrUnsupportedResponseType, "only the code response type is supported"}
+	case !slices.Contains(req.Scopes, ScopeOpenID):
+		err = &Error{ErrInvalidScope, "the openid scope is required"}
+	case !validChallenge(req.CodeChallenge):
+		err = &Error{ErrInvalidRequest, "a PKCE code challenge is required"}
+	case q.Get("code_challenge_method") != "S256":
+		err = &Error{ErrInvalidRequest, "the code challenge method must be S256"}
+	}
+
+	return req, client, err
+}
+
+// ErrorURL returns the redirect uri of the request, reporting e.
+func (a *AuthRequest) ErrorURL(e *Error) string {
+	return a.redirectURL(url.Values{"error": {e.Code}, "error_description": {e.Description}})
+}
+
+// CodeURL returns the redirect uri of the request, handing code to the
+// client.
+func (a *AuthRequest) CodeURL(code string) string {
+	return a.redirectURL(url.Values{"code": {code}})
+}
+
+// Params returns the parameters of the request, to send them along with
+// the consent form.
+func (a *AuthRequest) Params() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {a.ClientID},
+		"redirect_uri":          {a.RedirectURI},
+		"scope":                 {strings.Join(a.Scopes, " ")},
+		"state":                 {a.State},
+		"nonce":                 {a.Nonce},
+		"code_challenge":        {a.CodeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func (a *AuthRequest) redirectURL(params url.Values) string {
+	// registered redirect uris are absolute, and may have a query of their
+	// own
+	u, _ := url.Parse(a.RedirectURI)
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if a.State != "" {
+		q.Set("state", a.State)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// Metadata is the discovery document of the provider.
+type Metadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// NewMetadata returns the discovery document of the provider whose api is
+// at issuer, and whose authorize page is at authorizeURL.
+func NewMetadata(issuer, authorizeURL string) Metadata {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	return Metadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             authorizeURL,
+		TokenEndpoint:                     issuer + TokenPath,
+		UserInfoEndpoint:                  issuer + UserInfoPath,
+		JWKSURI:                           issuer + JWKSPath,
+		RevocationEndpoint:                issuer + RevocationPath,
+		IntrospectionEndpoint:             issuer + IntrospectionPath,
+		ScopesSupported:                   Scopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "nonce", "name", "given_name", "family_name", "locale", "email"},
+	}
+}
@@ -0,0 +1,196 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"webapp/pkg/data"
+	"webapp/pkg/repository/dbrepo"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func TestS256Challenge(t *testing.T) {
+	// the example of RFC 7636 appendix B
+	if got := S256Challenge(verifier); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("wrong challenge %s", got)
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	challenge := S256Challenge(verifier)
+
+	var tests = []struct {
+		name     string
+		verifier string
+		expected bool
+	}{
+		{"matches", verifier, true},
+		{"other verifier", strings.Repeat("a", 43), false},
+		{"too short", verifier[:42], false},
+		{"bad characters", verifier[:42] + "+", false},
+		{"empty", "", false},
+	}
+
+	for _, e := range tests {
+		if got := VerifyPKCE(e.verifier, challenge); got != e.expected {
+			t.Errorf("%s: expected %v but got %v", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestParseAuthRequest(t *testing.T) {
+	db := &dbrepo.TestDBRepo{}
+	_ = db.InsertOAuthClient(data.OAuthClient{ID: "app", Name: "App", RedirectURIs: []string{"https://app.example/cb?x=1"}})
+
+	valid := func() url.Values {
+		return url.Values{
+			"client_id":             {"app"},
+			"redirect_uri":          {"https://app.example/cb?x=1"},
+			"response_type":         {"code"},
+			"scope":                 {"openid email unknown email"},
+			"state":                 {"xyz"},
+			"nonce":                 {"n-0S6"},
+			"code_challenge":        {S256Challenge(verifier)},
+			"code_challenge_method": {"S256"},
+		}
+	}
+
+	var tests = []struct {
+		name     string
+		change   func(q url.Values)
+		expected string
+	}{
+		{"valid", func(q url.Values) {}, ""},
+		{"unknown client", func(q url.Values) { q.Set("client_id", "other") }, "unknown client"},
+		{"other redirect uri", func(q url.Values) { q.Set("redirect_uri", "https://evil.example/cb") }, "redirect uri"},
+		{"redirect uri prefix", func(q url.Values) { q.Set("redirect_uri", "https://app.example/cb") }, "redirect uri"},
+		{"token response type", func(q url.Values) { q.Set("response_type", "token") }, ErrUnsupportedResponseType},
+		{"no openid scope", func(q url.Values) { q.Set("scope", "email") }, ErrInvalidScope},
+		{"no challenge", func(q url.Values) { q.Del("code_challenge") }, ErrInvalidRequest},
+		{"plain challenge", func(q url.Values) { q.Set("code_challenge_method", "plain") }, ErrInvalidRequest},
+	}
+
+	for _, e := range tests {
+		q := valid()
+		e.change(q)
+		req, _, err := ParseAuthRequest(db, q)
+
+		var oauthErr *Error
+		switch {
+		case e.expected == "":
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", e.name, err)
+			}
+		case errors.As(err, &oauthErr):
+			if oauthErr.Code != e.expected {
+				t.Errorf("%s: expected %s but got %s", e.name, e.expected, oauthErr.Code)
+			}
+			// errors the client is told about keep its state
+			u, _ := url.Parse(req.ErrorURL(oauthErr))
+			if u.Query().Get("state") != "xyz" || u.Query().Get("error") != e.expected {
+				t.Errorf("%s: wrong error url %s", e.name, u)
+			}
+		case err == nil || !strings.Contains(err.Error(), e.expected):
+			t.Errorf("%s: expected an error about %s but got %v", e.name, e.expected, err)
+		}
+	}
+
+	req, client, _ := ParseAuthRequest(db, valid())
+	if client.Name != "App" || !slices.Equal(req.Scopes, []string{"openid", "email"}) {
+		t.Errorf("wrong request %+v", req)
+	}
+
+	u, _ := url.Parse(req.CodeURL("abc"))
+	if u.Host != "app.example" || u.Query().Get("x") != "1" || u.Query().Get("code") != "abc" || u.Query().Get("state") != "xyz" {
+		t.Errorf("wrong code url %s", u)
+	}
+
+	// the parameters sent along with the consent form give the same request
+	again, _, err := ParseAuthRequest(db, req.Params())
+	if err != nil || again.Nonce != req.Nonce || !slices.Equal(again.Scopes, req.Scopes) {
+		t.Errorf("params do not round trip: %+v, %v", again, err)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a key in either PEM form is the same signer
+	dir := t.TempDir()
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	files := map[string]*pem.Block{
+		"pkcs1.pem": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		"pkcs8.pem": {Type: "PRIVATE KEY", Bytes: pkcs8},
+	}
+	signer := NewSigner(key)
+	for name, block := range files {
+		file := filepath.Join(dir, name)
+		_ = os.WriteFile(file, pem.EncodeToMemory(block), 0o600)
+
+		loaded, err := LoadSigner(file)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if loaded.JWKS().Keys[0] != signer.JWKS().Keys[0] {
+			t.Errorf("%s: loaded a different key", name)
+		}
+	}
+	_ = os.WriteFile(filepath.Join(dir, "bad.pem"), []byte("not a key"), 0o600)
+	if _, err := LoadSigner(filepath.Join(dir, "bad.pem")); err == nil {
+		t.Error("expected an error for a file without a key")
+	}
+
+	user := &data.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@example.com", Locale: "pt-BR"}
+	token, err := signer.Sign(IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+		Nonce:      "n-0S6",
+		UserClaims: ClaimsFor(user, []string{ScopeOpenID, ScopeEmail}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims IDTokenClaims
+	if err := signer.Verify(token, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Nonce != "n-0S6" || claims.Email != "admin@example.com" || claims.Name != "" {
+		t.Errorf("wrong claims %+v", claims)
+	}
+
+	other, _ := GenerateSigner()
+	if err := other.Verify(token, &IDTokenClaims{}); err == nil {
+		t.Error("expected a token of another key not to verify")
+	}
+}
+
+func TestClaimsFor(t *testing.T) {
+	user := &data.User{FirstName: "Admin", LastName: "User", Email: "admin@example.com", Locale: "pt-BR"}
+
+	c := ClaimsFor(user, []string{ScopeOpenID, ScopeProfile})
+	if c.Name != "Admin User" || c.GivenName != "Admin" || c.FamilyName != "User" || c.Locale != "pt-BR" || c.Email != "" {
+		t.Errorf("wrong profile claims %+v", c)
+	}
+
+	if c := ClaimsFor(user, []string{ScopeOpenID}); c != (UserClaims{}) {
+		t.Errorf("expected no claims for openid alone, got %+v", c)
+	}
+}
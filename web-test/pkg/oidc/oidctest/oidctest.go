@@ -0,0 +1,206 @@
+// Package oidctest provides a fake OpenID Connect provider, so logging in
+// with an external provider can be tested without the network.
+package oidctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+	"webapp/pkg/config"
+	"webapp/pkg/oidc"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Provider is a fake provider, serving discovery, keys, authorization and
+// tokens like a real one. Everyone who visits its authorization endpoint is
+// logged in at once as the person described by its fields, which tests may
+// change between logins.
+type Provider struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	// who the provider logs in
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+
+	signer *oidc.Signer
+	mu     sync.Mutex
+	codes  map[string]grant
+}
+
+// grant is what the provider remembers about a code it handed out.
+type grant struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	claims      oidc.UserClaims
+	subject     string
+}
+
+// NewProvider starts a provider, which is closed when the test ends. It
+// logs in a verified admin@example.com.
+func NewProvider(t testing.TB) *Provider {
+	t.Helper()
+
+	signer, err := oidc.GenerateSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Provider{
+		ClientID:      "webapp",
+		ClientSecret:  "fake-secret",
+		Subject:       "248289761001",
+		Email:         "admin@example.com",
+		EmailVerified: true,
+		Name:          "Admin User",
+		signer:        signer,
+		codes:         map[string]grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidc.DiscoveryPath, p.discovery)
+	mux.HandleFunc(oidc.JWKSPath, p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc(oidc.TokenPath, p.token)
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// Config returns the configuration of the provider as an identity provider
+// called name, coming back to redirectURL.
+func (p *Provider) Config(name, redirectURL string) config.IdentityProviderConfig {
+	return config.IdentityProviderConfig{
+		Name:         name,
+		Label:        "Fake " + name,
+		Issuer:       p.URL,
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// Login follows authURL, as a browser sent to the provider would, and
+// returns where the provider sends the browser back to.
+func (p *Provider) Login(t testing.TB, authURL string) *url.URL {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("the fake provider did not redirect back: %d %v", resp.StatusCode, err)
+	}
+	return back
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.NewMetadata(p.URL, p.URL+"/authorize"))
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.signer.JWKS())
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	back, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || q.Get("client_id") != p.ClientID || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.mu.Lock()
+	p.codes[code] = grant{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		subject:     p.Subject,
+		claims:      oidc.UserClaims{Name: p.Name, Email: p.Email, EmailVerified: p.EmailVerified},
+	}
+	p.mu.Unlock()
+
+	params := back.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	back.RawQuery = params.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if id != p.ClientID || secret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, oidc.Error{Code: oidc.ErrInvalidClient})
+		return
+	}
+
+	code := r.PostFormValue("code")
+	p.mu.Lock()
+	g, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	if !ok || g.clientID != id || g.redirectURI != r.PostFormValue("redirect_uri") || !oidc.VerifyPKCE(r.PostFormValue("code_verifier"), g.challenge) {
+		writeJSON(w, http.StatusBadRequest, oidc.Error{Code: oidc.ErrInvalidGrant})
+		return
+	}
+
+	now := time.Now()
+	idToken, err := p.signer.Sign(oidc.IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.URL,
+			Subject:   g.subject,
+			Audience:  jwt.ClaimStrings{g.clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Nonce:      g.nonce,
+		UserClaims: g.claims,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, oidc.Error{Code: oidc.ErrServerError})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "fake-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
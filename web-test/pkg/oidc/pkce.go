@@ -0,0 +1,33 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// codeVerifier is the shape of a PKCE code verifier, RFC 7636 section 4.1.
+var codeVerifier = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// S256Challenge returns the S256 code challenge of verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE reports whether verifier is the one challenge was made from
+// with the S256 method.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !codeVerifier.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(S256Challenge(verifier)), []byte(challenge)) == 1
+}
+
+// validChallenge reports whether challenge can be an S256 code challenge,
+// the base64url encoding of a SHA-256 hash.
+func validChallenge(challenge string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(b) == sha256.Size
+}
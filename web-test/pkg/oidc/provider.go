@@ -0,0 +1,307 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"webapp/pkg/config"
+	"webapp/pkg/data"
+	"webapp/pkg/repository"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Provider is an external OpenID Connect provider users can log in with.
+// Its discovery document and keys are fetched when first needed, so an
+// unreachable provider does not stop the application from starting.
+type Provider struct {
+	config.IdentityProviderConfig
+
+	// Client makes the requests to the provider.
+	Client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     map[string]*rsa.PublicKey
+}
+
+// NewProviders returns the providers configured in cfgs. A provider without
+// a label is labelled with its name.
+func NewProviders(cfgs []config.IdentityProviderConfig) []*Provider {
+	var providers []*Provider
+	for _, c := range cfgs {
+		if c.Label == "" {
+			c.Label = c.Name
+		}
+		providers = append(providers, &Provider{
+			IdentityProviderConfig: c,
+			Client:                 &http.Client{Timeout: 10 * time.Second},
+		})
+	}
+	return providers
+}
+
+// FindProvider returns the provider in providers called name, or nil.
+func FindProvider(providers []*Provider, name string) *Provider {
+	for _, p := range providers {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// RandomString returns a random string fit for a state, a nonce or a PKCE
+// code verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Metadata returns the discovery document of the provider.
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var meta Metadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+DiscoveryPath, &meta); err != nil {
+		return nil, err
+	}
+	// the issuer must be the one configured, or anyone who can answer at
+	// its address could issue tokens for it
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return nil, fmt.Errorf("oidc: %s: discovery document is for issuer %s", p.Name, meta.Issuer)
+	}
+
+	p.metadata = &meta
+	return p.metadata, nil
+}
+
+// AuthURL returns where to send the user to log in at the provider, to
+// come back to redirectURI with a code.
+func (p *Provider) AuthURL(ctx context.Context, redirectURI, state, nonce, verifier string) (string, error) {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("scope", strings.Join(Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", S256Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange trades a code the provider handed out for its ID token, and
+// returns the claims of the token once it checked its signature, issuer,
+// audience, expiry and nonce.
+func (p *Provider) Exchange(ctx context.Context, code, redirectURI, verifier, nonce string) (*IDTokenClaims, error) {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		IDToken string `json:"id_token"`
+		Error
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("oidc: %s: token response: %w", p.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &answer.Error
+	}
+
+	var claims IDTokenClaims
+	_, err = jwt.ParseWithClaims(answer.IDToken, &claims, func(t *jwt.Token) (any, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, errors.New("oidc: unexpected signing method")
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, meta.JWKSURI, kid)
+	})
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("oidc: %s: id token: %w", p.Name, err)
+	case !claims.VerifyIssuer(meta.Issuer, true):
+		return nil, fmt.Errorf("oidc: %s: id token of issuer %s", p.Name, claims.Issuer)
+	case !claims.VerifyAudience(p.ClientID, true):
+		return nil, fmt.Errorf("oidc: %s: id token for another client", p.Name)
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("oidc: %s: id token without expiry", p.Name)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("oidc: %s: id token with the wrong nonce", p.Name)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("oidc: %s: id token without subject", p.Name)
+	}
+
+	return &claims, nil
+}
+
+// key returns the key with kid from the key set of the provider, fetching
+// the set again if it does not know the key, since providers rotate them.
+func (p *Provider) key(ctx context.Context, jwksURI, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set JWKS
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, err
+	}
+	p.keys = map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("oidc: %s: unknown key %q", p.Name, kid)
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s: %s answered %s", p.Name, u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// ErrNoAccount is returned by UserFor when an identity is not linked to a
+// user.
+var ErrNoAccount = errors.New("oidc: no account for the identity")
+
+// ErrIdentityTaken is returned by Link when an identity is already linked
+// to another user.
+var ErrIdentityTaken = errors.New("oidc: identity is linked to another user")
+
+// UserFor returns the user who logs in with claims from p: the one the
+// identity was linked to. An identity seen for the first time is linked to
+// the user with its email address only if p is trusted with TrustEmail and
+// verified the address; identities of other providers are linked by their
+// users from their profile, with Link.
+func UserFor(db repository.DatabaseRepo, p *Provider, claims *IDTokenClaims) (*data.User, error) {
+	identity, err := db.GetUserIdentity(p.Name, claims.Subject)
+	if err == nil {
+		return db.GetUser(identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if !p.TrustEmail || claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrNoAccount
+	}
+	user, err := db.GetUserByEmail(claims.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Link(db, p.Name, claims, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Link links the identity in claims from provider to user, who must be
+// logged in already, so they can log in with it from then on. Linking an
+// identity to the user it is linked to already does nothing.
+func Link(db repository.DatabaseRepo, provider string, claims *IDTokenClaims, user *data.User) error {
+	identity, err := db.GetUserIdentity(provider, claims.Subject)
+	switch {
+	case err == nil && identity.UserID == user.ID:
+		return nil
+	case err == nil:
+		return ErrIdentityTaken
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	_, err = db.InsertUserIdentity(data.UserIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	return err
+}
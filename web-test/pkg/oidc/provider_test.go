@@ -0,0 +1,213 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"webapp/pkg/config"
+	"webapp/pkg/oidc"
+	"webapp/pkg/oidc/oidctest"
+	"webapp/pkg/repository/dbrepo"
+)
+
+const callback = "http://localhost:8080/login/fake/callback"
+
+func newProvider(cfg config.IdentityProviderConfig) *oidc.Provider {
+	return oidc.NewProviders([]config.IdentityProviderConfig{cfg})[0]
+}
+
+// login runs the whole flow of p against fake, letting change alter what
+// is sent to the token endpoint, and returns the claims of the ID token.
+func login(t *testing.T, p *oidc.Provider, fake *oidctest.Provider, change func(code, nonce, verifier *string)) (*oidc.IDTokenClaims, error) {
+	t.Helper()
+
+	state, _ := oidc.RandomString()
+	nonce, _ := oidc.RandomString()
+	verifier, _ := oidc.RandomString()
+
+	authURL, err := p.AuthURL(context.Background(), callback, state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := fake.Login(t, authURL)
+	if back.Query().Get("state") != state {
+		t.Fatalf("the state did not come back: %s", back)
+	}
+
+	code := back.Query().Get("code")
+	if change != nil {
+		change(&code, &nonce, &verifier)
+	}
+	return p.Exchange(context.Background(), code, callback, verifier, nonce)
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	fake := oidctest.NewProvider(t)
+
+	wrongSecret := fake.Config("fake", callback)
+	wrongSecret.ClientSecret = "guess"
+	otherClient := fake.Config("fake", callback)
+	otherClient.ClientID = "other"
+
+	var tests = []struct {
+		name   string
+		cfg    config.IdentityProviderConfig
+		change func(code, nonce, verifier *string)
+		ok     bool
+	}{
+		{"valid", fake.Config("fake", callback), nil, true},
+		{"wrong nonce", fake.Config("fake", callback), func(code, nonce, verifier *string) { *nonce = "other" }, false},
+		{"wrong verifier", fake.Config("fake", callback), func(code, nonce, verifier *string) { *verifier = *nonce }, false},
+		{"unknown code", fake.Config("fake", callback), func(code, nonce, verifier *string) { *code = "guess" }, false},
+		{"wrong secret", wrongSecret, nil, false},
+	}
+
+	for _, e := range tests {
+		claims, err := login(t, newProvider(e.cfg), fake, e.change)
+		if e.ok != (err == nil) {
+			t.Errorf("%s: expected ok to be %v, got error %v", e.name, e.ok, err)
+			continue
+		}
+		if err == nil && (claims.Subject != fake.Subject || claims.Email != fake.Email || !claims.EmailVerified) {
+			t.Errorf("%s: wrong claims %+v", e.name, claims)
+		}
+	}
+
+	// the fake provider turns away clients it does not know
+	p := newProvider(otherClient)
+	authURL, err := p.AuthURL(context.Background(), callback, "s", "n", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := fake.Client().Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected an unknown client to be refused, got %d", resp.StatusCode)
+	}
+}
+
+func TestProvider_Metadata(t *testing.T) {
+	fake := oidctest.NewProvider(t)
+	other := oidctest.NewProvider(t)
+
+	// a trailing slash on the issuer configured does not matter
+	cfg := fake.Config("fake", callback)
+	cfg.Issuer = fake.URL + "/"
+	if _, err := newProvider(cfg).Metadata(context.Background()); err != nil {
+		t.Errorf("expected the metadata of the issuer, got %v", err)
+	}
+
+	// a discovery document of another issuer is refused
+	p := newProvider(fake.Config("fake", callback))
+	p.Issuer = other.URL
+	p.Client = &http.Client{Transport: rewrite{to: fake.URL}}
+	if _, err := p.Metadata(context.Background()); err == nil {
+		t.Error("expected the discovery document of another issuer to be refused")
+	}
+}
+
+// rewrite sends every request to the server at to.
+type rewrite struct{ to string }
+
+func (r rewrite) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(r.to)
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestUserFor(t *testing.T) {
+	fake := oidctest.NewProvider(t)
+	p := newProvider(fake.Config("fake", callback))
+	db := &dbrepo.TestDBRepo{}
+
+	admin, _ := db.GetUser(1)
+	fake.Subject, fake.Email, fake.EmailVerified = "alice", "alice@example.org", true
+	claims, err := login(t, p, fake, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oidc.Link(db, "fake", claims, admin); err != nil {
+		t.Fatal(err)
+	}
+
+	corp := fake.Config("corp", callback)
+	corp.TrustEmail = true
+	trusted := newProvider(corp)
+
+	var tests = []struct {
+		name     string
+		provider *oidc.Provider
+		subject  string
+		email    string
+		verified bool
+		userID   int
+		err      error
+	}{
+		{"linked identity", p, "alice", "alice@example.org", true, 1, nil},
+		{"linked identity, email changed", p, "alice", "someone@example.com", false, 1, nil},
+		// the address of an account is whatever its owner, or an admin,
+		// typed in; matching it would let the identity of a provider which
+		// does not vouch for its addresses in
+		{"verified email of an account", p, "mallory", "user@example.com", true, 0, oidc.ErrNoAccount},
+		{"trusted verified email", trusted, "carol", "user@example.com", true, 2, nil},
+		{"trusted identity linked, email changed", trusted, "carol", "carol@example.org", false, 2, nil},
+		{"trusted unverified email", trusted, "dave", "admin@example.com", false, 0, oidc.ErrNoAccount},
+		{"trusted unknown email", trusted, "erin", "nobody@example.com", true, 0, oidc.ErrNoAccount},
+		{"trusted without email", trusted, "frank", "", true, 0, oidc.ErrNoAccount},
+	}
+
+	for _, e := range tests {
+		fake.Subject, fake.Email, fake.EmailVerified = e.subject, e.email, e.verified
+
+		claims, err := login(t, e.provider, fake, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		user, err := oidc.UserFor(db, e.provider, claims)
+		if !errors.Is(err, e.err) {
+			t.Errorf("%s: expected error %v but got %v", e.name, e.err, err)
+			continue
+		}
+		if err == nil && user.ID != e.userID {
+			t.Errorf("%s: expected user %d but got %d", e.name, e.userID, user.ID)
+		}
+	}
+
+	identities, _ := db.UserIdentities(2)
+	if len(identities) != 1 || identities[0].Provider != "corp" || identities[0].Subject != "carol" {
+		t.Errorf("expected only the identity of the trusted provider linked by email, got %+v", identities)
+	}
+}
+
+func TestLink(t *testing.T) {
+	db := &dbrepo.TestDBRepo{}
+	admin, _ := db.GetUser(1)
+	user, _ := db.GetUser(2)
+	claims := &oidc.IDTokenClaims{UserClaims: oidc.UserClaims{Email: "alice@example.org"}}
+	claims.Subject = "alice"
+
+	if err := oidc.Link(db, "fake", claims, admin); err != nil {
+		t.Fatal(err)
+	}
+	if err := oidc.Link(db, "fake", claims, admin); err != nil {
+		t.Errorf("expected linking the identity again to do nothing, got %v", err)
+	}
+	if err := oidc.Link(db, "fake", claims, user); !errors.Is(err, oidc.ErrIdentityTaken) {
+		t.Errorf("expected %v linking the identity to another user, got %v", oidc.ErrIdentityTaken, err)
+	}
+	if err := oidc.Link(db, "other", claims, user); err != nil {
+		t.Errorf("expected the same subject at another provider to be linked, got %v", err)
+	}
+
+	identities, _ := db.UserIdentities(1)
+	if len(identities) != 1 || identities[0].Subject != "alice" || identities[0].Email != "alice@example.org" {
+		t.Errorf("expected one identity linked, got %+v", identities)
+	}
+}
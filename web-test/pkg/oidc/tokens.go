@@ -0,0 +1,173 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"webapp/pkg/data"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Signer signs ID tokens with an RSA key, and publishes the public key as a
+// JSON Web Key Set so clients can verify them.
+type Signer struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// NewSigner returns a Signer using key. Its key id is the RFC 7638
+// thumbprint of the public key.
+func NewSigner(key *rsa.PrivateKey) *Signer {
+	s := &Signer{key: key}
+	jwk := s.jwk()
+	// the members required for an RSA key, in lexicographic order
+	thumbprint, _ := json.Marshal(map[string]string{"e": jwk.E, "kty": jwk.Kty, "n": jwk.N})
+	sum := sha256.Sum256(thumbprint)
+	s.kid = base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return s
+}
+
+// GenerateSigner returns a Signer with a new 2048 bit key.
+func GenerateSigner() (*Signer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(key), nil
+}
+
+// LoadSigner returns a Signer with the PEM encoded RSA key in file, in
+// PKCS #1 or PKCS #8 form.
+func LoadSigner(file string) (*Signer, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("oidc: %s holds no PEM encoded key", file)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return NewSigner(key), nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: %s: %w", file, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("oidc: %s holds no RSA key", file)
+	}
+	return NewSigner(key), nil
+}
+
+// PublicKey returns the key which verifies the tokens of s.
+func (s *Signer) PublicKey() crypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+// Sign returns claims as a token signed with RS256.
+func (s *Signer) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	return token.SignedString(s.key)
+}
+
+// Verify parses a token signed by s into claims, checking its signature and
+// expiry.
+func (s *Signer) Verify(token string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, errors.New("oidc: unexpected signing method")
+		}
+		return &s.key.PublicKey, nil
+	})
+	return err
+}
+
+// JWK is a public key in JSON Web Key form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the key set clients verify ID tokens with.
+func (s *Signer) JWKS() JWKS {
+	return JWKS{Keys: []JWK{s.jwk()}}
+}
+
+func (s *Signer) jwk() JWK {
+	pub := s.key.PublicKey
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: s.kid,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// UserClaims are the claims about a user the granted scopes let a client
+// see, in ID tokens and from the userinfo endpoint.
+type UserClaims struct {
+	Name       string `json:"name,omitempty"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+	Locale     string `json:"locale,omitempty"`
+	Email      string `json:"email,omitempty"`
+	// EmailVerified is only set by external providers; this one does not
+	// check addresses.
+	EmailVerified bool `json:"email_verified,omitempty"`
+}
+
+// ClaimsFor returns the claims about user that scopes allow.
+func ClaimsFor(user *data.User, scopes []string) UserClaims {
+	var c UserClaims
+	if slices.Contains(scopes, ScopeProfile) {
+		c.Name = user.FirstName + " " + user.LastName
+		c.GivenName = user.FirstName
+		c.FamilyName = user.LastName
+		c.Locale = user.Locale
+	}
+	if slices.Contains(scopes, ScopeEmail) {
+		c.Email = user.Email
+	}
+	return c
+}
+
+// IDTokenClaims are the claims of an ID token.
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce string `json:"nonce,omitempty"`
+	UserClaims
+}
+
+// UserInfo is the answer of the userinfo endpoint.
+type UserInfo struct {
+	Subject string `json:"sub"`
+	UserClaims
+}
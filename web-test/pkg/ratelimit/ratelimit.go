@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests requests every Period, with bursts of up to Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit reads a limit written as "requests/period", for example "10/1m".
+func ParseLimit(s string) (Limit, error) {
+	n, p, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q: expected requests/period, e.g. 10/1m", s)
+	}
+
+	requests, err := strconv.Atoi(strings.TrimSpace(n))
+	if err != nil || requests < 1 {
+		return Limit{}, fmt.Errorf("rate limit %q: requests must be a positive number", s)
+	}
+
+	period, err := time.ParseDuration(strings.TrimSpace(p))
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: period must be a positive duration", s)
+	}
+
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+// String writes the limit in the format accepted by ParseLimit.
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// UnmarshalText lets a Limit be read from config files.
+func (l *Limit) UnmarshalText(text []byte) error {
+	v, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+// MarshalText writes the limit in the format accepted by ParseLimit.
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// rate returns the number of tokens added to a bucket per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// Store keeps the token buckets. MemoryStore keeps them in the process; a
+// store backed by something shared, such as Redis, lets several instances of
+// an application enforce the same limits.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// KeyFunc identifies who a request is charged to. An empty key means the
+// request is not limited.
+type KeyFunc func(r *http.Request) string
+
+// Limiter enforces one limit for one group of routes.
+type Limiter struct {
+	Store  Store
+	Name   string
+	Limit  Limit
+	Key    KeyFunc
+	Logger *slog.Logger
+}
+
+// Middleware rejects requests over the limit with 429 Too Many Requests. The
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers are set on
+// every response, and Retry-After on rejections. If the store fails, requests
+// are let through rather than taking the application down with it.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := l.Key(r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res, err := l.Store.Take(r.Context(), l.Name+":"+key, l.Limit, time.Now())
+		if err != nil {
+			if l.Logger != nil {
+				l.Logger.Error("rate limit store failed", "limiter", l.Name, "error", err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(l.Limit.Requests))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// seconds rounds d up to whole seconds, as the rate limit headers expect.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	var tests = []struct {
+		in       string
+		expected Limit
+		isError  bool
+	}{
+		{"10/1m", Limit{10, time.Minute}, false},
+		{" 5 / 1h ", Limit{5, time.Hour}, false},
+		{"10", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"10/never", Limit{}, true},
+		{"10/-1s", Limit{}, true},
+	}
+
+	for _, e := range tests {
+		l, err := ParseLimit(e.in)
+		if e.isError != (err != nil) {
+			t.Errorf("%q: expected error %t, got %v", e.in, e.isError, err)
+		}
+		if l != e.expected {
+			t.Errorf("%q: expected %v, got %v", e.in, e.expected, l)
+		}
+	}
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Period: 2 * time.Second}
+	now := time.Now()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		res, _ := store.Take(ctx, "a", limit, now)
+		if !res.Allowed {
+			t.Fatalf("request %d: expected to be allowed", i)
+		}
+	}
+
+	res, _ := store.Take(ctx, "a", limit, now)
+	if res.Allowed {
+		t.Error("expected third request to be rejected")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("expected retry after 1s, got %v", res.RetryAfter)
+	}
+
+	res, _ = store.Take(ctx, "b", limit, now)
+	if !res.Allowed {
+		t.Error("expected other key to have its own bucket")
+	}
+
+	res, _ = store.Take(ctx, "a", limit, now.Add(time.Second))
+	if !res.Allowed {
+		t.Error("expected a token to be refilled after one second")
+	}
+}
+
+func TestMemoryStore_sweep(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 1, Period: time.Second}
+	now := time.Now()
+
+	_, _ = store.Take(context.Background(), "a", limit, now)
+	_, _ = store.Take(context.Background(), "b", limit, now.Add(2*sweepInterval))
+
+	if _, ok := store.buckets["a"]; ok {
+		t.Error("expected idle bucket to be swept")
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	return Result{}, errors.New("store down")
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		name           string
+		store          Store
+		key            string
+		requests       int
+		expectedStatus int
+		expectHeaders  bool
+	}{
+		{"under limit", NewMemoryStore(), "client", 2, http.StatusOK, true},
+		{"over limit", NewMemoryStore(), "client", 3, http.StatusTooManyRequests, true},
+		{"no key", NewMemoryStore(), "", 3, http.StatusOK, false},
+		{"store failure", failingStore{}, "client", 3, http.StatusOK, false},
+	}
+
+	for _, e := range tests {
+		l := &Limiter{
+			Store: e.store,
+			Name:  "test",
+			Limit: Limit{Requests: 2, Period: time.Minute},
+			Key:   func(r *http.Request) string { return e.key },
+		}
+		handler := l.Middleware(next)
+
+		var rr *httptest.ResponseRecorder
+		for i := 0; i < e.requests; i++ {
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		}
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected status %d but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+
+		if e.expectHeaders && rr.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("%s: expected RateLimit-Limit header", e.name)
+		}
+
+		if e.expectedStatus == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "30" {
+			t.Errorf("%s: expected Retry-After of 30, got %q", e.name, rr.Header().Get("Retry-After"))
+		}
+	}
+}
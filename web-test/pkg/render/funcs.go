@@ -0,0 +1,83 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Funcs returns the functions every Engine makes available to templates:
+//
+//	formatDate  formats a time with a Go layout; the zero time gives ""
+//	humanDate   formats a time for people, e.g. "02 Jan 2006 at 15:04 UTC"
+//	url         builds a path with a query, e.g. url "/users" "page" 2
+//	dict        builds a map to pass to a partial, e.g. dict "Name" "email"
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"formatDate": FormatDate,
+		"humanDate":  HumanDate,
+		"url":        URL,
+		"dict":       Dict,
+	}
+}
+
+// FormatDate formats t with layout, or returns "" for the zero time.
+func FormatDate(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
+
+// HumanDate formats t for people to read.
+func HumanDate(t time.Time) string {
+	return FormatDate(t, "02 Jan 2006 at 15:04 MST")
+}
+
+// URL adds the query parameters given as name, value pairs to path. Empty
+// values are left out.
+func URL(path string, pairs ...any) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("url %s: query parameters must come in name, value pairs", path)
+	}
+
+	q := url.Values{}
+	for i := 0; i < len(pairs); i += 2 {
+		name := fmt.Sprint(pairs[i])
+		if value := fmt.Sprint(pairs[i+1]); value != "" {
+			q.Add(name, value)
+		}
+	}
+
+	if len(q) == 0 {
+		return path, nil
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	return path + sep + q.Encode(), nil
+}
+
+// Dict builds a map from name, value pairs, so that a template can pass
+// several values to another.
+func Dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: values must come in name, value pairs")
+	}
+
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		name, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: name %v is not a string", pairs[i])
+		}
+		m[name] = pairs[i+1]
+	}
+
+	return m, nil
+}
@@ -0,0 +1,137 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Template files are recognised by their suffix. Every page is parsed
+// together with all layouts and partials, so a page picks its layout by
+// naming it, as in {{template "base" .}}.
+const (
+	pageGlob    = "*.page.gohtml"
+	layoutGlob  = "*.layout.gohtml"
+	partialGlob = "*.partial.gohtml"
+)
+
+// Options configures an Engine.
+type Options struct {
+	// Funcs are made available to every template, in addition to the
+	// functions returned by Funcs.
+	Funcs template.FuncMap
+	// Reload parses templates again on every render, so edits show up
+	// without a restart. Meant for development.
+	Reload bool
+}
+
+// Engine renders the templates found in a file system, which may be a
+// directory on disk (os.DirFS) or files embedded in the binary (embed.FS).
+type Engine struct {
+	fsys   fs.FS
+	funcs  template.FuncMap
+	reload bool
+
+	mu    sync.RWMutex
+	cache map[string]*template.Template
+}
+
+// New returns an Engine reading templates from fsys. Call Load to parse them
+// up front and fail early on errors.
+func New(fsys fs.FS, opts Options) *Engine {
+	funcs := Funcs()
+	for name, fn := range opts.Funcs {
+		funcs[name] = fn
+	}
+
+	return &Engine{
+		fsys:   fsys,
+		funcs:  funcs,
+		reload: opts.Reload,
+		cache:  make(map[string]*template.Template),
+	}
+}
+
+// Load parses every page, replacing the cached templates.
+func (e *Engine) Load() error {
+	pages, err := fs.Glob(e.fsys, pageGlob)
+	if err != nil {
+		return err
+	}
+
+	cache := make(map[string]*template.Template, len(pages))
+	for _, page := range pages {
+		t, err := e.parse(page)
+		if err != nil {
+			return err
+		}
+		cache[path.Base(page)] = t
+	}
+
+	e.mu.Lock()
+	e.cache = cache
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Render executes the page called name with data and writes the result to w.
+// The page is rendered into a buffer first, so nothing is written if it
+// fails and the caller can still send an error page.
+func (e *Engine) Render(w io.Writer, name string, data any) error {
+	t, err := e.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Errorf("render %s: %w", name, err)
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func (e *Engine) lookup(name string) (*template.Template, error) {
+	if e.reload {
+		return e.parse(name)
+	}
+
+	e.mu.RLock()
+	t, ok := e.cache[name]
+	e.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("render: template %s does not exist", name)
+	}
+
+	return t, nil
+}
+
+// parse parses a page together with all layouts and partials.
+func (e *Engine) parse(page string) (*template.Template, error) {
+	if !strings.HasSuffix(page, ".page.gohtml") {
+		return nil, fmt.Errorf("render: %s is not a page", page)
+	}
+
+	files := []string{page}
+	for _, glob := range []string{layoutGlob, partialGlob} {
+		matches, err := fs.Glob(e.fsys, glob)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	t, err := template.New(path.Base(page)).Funcs(e.funcs).ParseFS(e.fsys, files...)
+	if err != nil {
+		return nil, fmt.Errorf("render: %w", err)
+	}
+
+	return t, nil
+}
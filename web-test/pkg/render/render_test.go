@@ -0,0 +1,120 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"base.layout.gohtml":      {Data: []byte(`{{define "base"}}<main>{{block "content" .}}{{end}}</main>{{end}}`)},
+		"admin.layout.gohtml":     {Data: []byte(`{{define "admin"}}<nav>admin</nav>{{block "content" .}}{{end}}{{end}}`)},
+		"greeting.partial.gohtml": {Data: []byte(`{{define "greeting"}}Hello, {{.}}!{{end}}`)},
+		"home.page.gohtml":        {Data: []byte(`{{template "base" .}}{{define "content"}}{{template "greeting" .Name}}{{end}}`)},
+		"users.page.gohtml":       {Data: []byte(`{{template "admin" .}}{{define "content"}}{{url "/users" "page" .Page}}{{end}}`)},
+		"field.page.gohtml":       {Data: []byte(`{{template "base" .}}{{define "content"}}{{template "greeting" (dict "Name" .Name).Name}}{{end}}`)},
+		"date.page.gohtml":        {Data: []byte(`{{template "base" .}}{{define "content"}}{{humanDate .When}}{{end}}`)},
+		"broken.page.gohtml":      {Data: []byte(`{{template "base" .}}{{define "content"}}{{.Missing.Field}}{{end}}`)},
+	}
+}
+
+func TestEngine_Render(t *testing.T) {
+	engine := New(testFS(), Options{})
+	if err := engine.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		page     string
+		data     any
+		expected string
+	}{
+		{"layout and partial", "home.page.gohtml", map[string]any{"Name": "Ada"}, "<main>Hello, Ada!</main>"},
+		{"second layout", "users.page.gohtml", map[string]any{"Page": 2}, "<nav>admin</nav>/users?page=2"},
+		{"dict", "field.page.gohtml", map[string]any{"Name": "Ada"}, "<main>Hello, Ada!</main>"},
+		{"date", "date.page.gohtml", map[string]any{"When": time.Date(2023, 1, 2, 15, 4, 0, 0, time.UTC)}, "<main>02 Jan 2023 at 15:04 UTC</main>"},
+	}
+
+	for _, e := range tests {
+		var buf bytes.Buffer
+		if err := engine.Render(&buf, e.page, e.data); err != nil {
+			t.Errorf("%s: unexpected error %s", e.name, err)
+			continue
+		}
+		if buf.String() != e.expected {
+			t.Errorf("%s: expected %q but got %q", e.name, e.expected, buf.String())
+		}
+	}
+}
+
+func TestEngine_RenderErrors(t *testing.T) {
+	e := New(testFS(), Options{})
+	if err := e.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := e.Render(&buf, "broken.page.gohtml", struct{}{}); err == nil {
+		t.Error("expected an error executing a broken template")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be written when rendering fails, got %q", buf.String())
+	}
+
+	if err := e.Render(&buf, "missing.page.gohtml", nil); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+
+	fsys := testFS()
+	fsys["bad.page.gohtml"] = &fstest.MapFile{Data: []byte(`{{template "base" .}}{{$undefined}}`)}
+	if err := New(fsys, Options{}).Load(); err == nil {
+		t.Error("expected Load to fail on a template which does not parse")
+	}
+}
+
+func TestEngine_Reload(t *testing.T) {
+	fsys := testFS()
+	e := New(fsys, Options{Reload: true})
+
+	var buf bytes.Buffer
+	_ = e.Render(&buf, "home.page.gohtml", map[string]any{"Name": "Ada"})
+
+	fsys["greeting.partial.gohtml"] = &fstest.MapFile{Data: []byte(`{{define "greeting"}}Bye, {{.}}!{{end}}`)}
+
+	buf.Reset()
+	_ = e.Render(&buf, "home.page.gohtml", map[string]any{"Name": "Ada"})
+	if !strings.Contains(buf.String(), "Bye, Ada!") {
+		t.Errorf("expected the changed partial to be used, got %q", buf.String())
+	}
+}
+
+func TestURL(t *testing.T) {
+	var tests = []struct {
+		path     string
+		pairs    []any
+		expected string
+	}{
+		{"/users", nil, "/users"},
+		{"/users", []any{"page", 2, "q", "a b"}, "/users?page=2&q=a+b"},
+		{"/users", []any{"q", ""}, "/users"},
+		{"/users?sort=name", []any{"page", 3}, "/users?sort=name&page=3"},
+	}
+
+	for _, e := range tests {
+		got, err := URL(e.path, e.pairs...)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", e.expected, err)
+		}
+		if got != e.expected {
+			t.Errorf("expected %q but got %q", e.expected, got)
+		}
+	}
+
+	if _, err := URL("/users", "page"); err == nil {
+		t.Error("expected an error for an odd number of query arguments")
+	}
+}
@@ -0,0 +1,66 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"time"
+
+	"webapp/pkg/data"
+)
+
+func (m *TestDBRepo) InsertAPIKey(k data.APIKey) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k.ID = len(m.apiKeys) + 1
+	k.CreatedAt = time.Now()
+	m.apiKeys = append(m.apiKeys, k)
+	return k.ID, nil
+}
+
+func (m *TestDBRepo) UserAPIKeys(userID int) ([]data.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []data.APIKey
+	for i := len(m.apiKeys) - 1; i >= 0; i-- {
+		if k := m.apiKeys[i]; k.ID != 0 && k.UserID == userID {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (m *TestDBRepo) GetAPIKeyByPrefix(prefix string) (*data.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range m.apiKeys {
+		if k.ID != 0 && k.Prefix == prefix {
+			return &k, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *TestDBRepo) TouchAPIKey(id int, usedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id >= 1 && id <= len(m.apiKeys) {
+		m.apiKeys[id-1].LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+// DeleteAPIKey keeps the place of the key, zeroing its id, so ids are not
+// reused.
+func (m *TestDBRepo) DeleteAPIKey(userID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.apiKeys) || m.apiKeys[id-1].ID == 0 || m.apiKeys[id-1].UserID != userID {
+		return sql.ErrNoRows
+	}
+	m.apiKeys[id-1] = data.APIKey{}
+	return nil
+}
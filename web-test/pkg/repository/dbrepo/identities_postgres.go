@@ -0,0 +1,86 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+
+	"webapp/pkg/data"
+)
+
+func (m *PostgresDBRepo) GetUserIdentity(provider, subject string) (*data.UserIdentity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, provider, subject, email, created_at
+		from user_identities where provider = $1 and subject = $2`
+
+	var i data.UserIdentity
+	err := m.DB.QueryRowContext(ctx, query, provider, subject).Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (m *PostgresDBRepo) InsertUserIdentity(i data.UserIdentity) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into user_identities (user_id, provider, subject, email, created_at)
+		values ($1, $2, $3, $4, $5) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		i.UserID,
+		i.Provider,
+		i.Subject,
+		i.Email,
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *PostgresDBRepo) UserIdentities(userID int) ([]data.UserIdentity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, provider, subject, email, created_at
+		from user_identities where user_id = $1 order by created_at, id`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []data.UserIdentity
+	for rows.Next() {
+		var i data.UserIdentity
+		err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Provider,
+			&i.Subject,
+			&i.Email,
+			&i.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+
+	return identities, rows.Err()
+}
@@ -0,0 +1,52 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"webapp/pkg/data"
+)
+
+func (m *TestDBRepo) GetUserIdentity(provider, subject string) (*data.UserIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, i := range m.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return &i, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// InsertUserIdentity refuses a second identity with the same subject at a
+// provider, as the unique constraint does in Postgres.
+func (m *TestDBRepo) InsertUserIdentity(i data.UserIdentity) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.identities {
+		if existing.Provider == i.Provider && existing.Subject == i.Subject {
+			return 0, errors.New("duplicate user identity")
+		}
+	}
+
+	i.ID = len(m.identities) + 1
+	i.CreatedAt = time.Now()
+	m.identities = append(m.identities, i)
+	return i.ID, nil
+}
+
+func (m *TestDBRepo) UserIdentities(userID int) ([]data.UserIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var identities []data.UserIdentity
+	for _, i := range m.identities {
+		if i.UserID == userID {
+			identities = append(identities, i)
+		}
+	}
+	return identities, nil
+}
@@ -0,0 +1,222 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"webapp/pkg/data"
+)
+
+// Redirect uris and scopes are kept in one column each, separated by
+// spaces, which neither may contain.
+
+func (m *PostgresDBRepo) InsertOAuthClient(c data.OAuthClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into oauth_clients (id, name, secret_hash, redirect_uris, created_at)
+		values ($1, $2, $3, $4, $5)`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		c.ID,
+		c.Name,
+		c.SecretHash,
+		strings.Join(c.RedirectURIs, " "),
+		time.Now(),
+	)
+	return err
+}
+
+const oauthClientColumns = `id, name, secret_hash, redirect_uris, created_at`
+
+func scanOAuthClient(row scanner) (*data.OAuthClient, error) {
+	var c data.OAuthClient
+	var uris string
+
+	err := row.Scan(
+		&c.ID,
+		&c.Name,
+		&c.SecretHash,
+		&uris,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	c.RedirectURIs = strings.Fields(uris)
+	return &c, nil
+}
+
+func (m *PostgresDBRepo) AllOAuthClients() ([]data.OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select ` + oauthClientColumns + ` from oauth_clients order by name, id`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []data.OAuthClient
+	for rows.Next() {
+		c, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *c)
+	}
+
+	return clients, rows.Err()
+}
+
+func (m *PostgresDBRepo) GetOAuthClient(id string) (*data.OAuthClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select ` + oauthClientColumns + ` from oauth_clients where id = $1`
+
+	return scanOAuthClient(m.DB.QueryRowContext(ctx, query, id))
+}
+
+func (m *PostgresDBRepo) DeleteOAuthClient(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `delete from oauth_clients where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *PostgresDBRepo) InsertAuthCode(c data.AuthCode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into oauth_codes (code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, expires_at, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		c.Hash,
+		c.ClientID,
+		c.UserID,
+		c.RedirectURI,
+		strings.Join(c.Scopes, " "),
+		c.Nonce,
+		c.CodeChallenge,
+		c.ExpiresAt,
+		time.Now(),
+	)
+	return err
+}
+
+func (m *PostgresDBRepo) TakeAuthCode(hash []byte) (*data.AuthCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// deleting the code as it is read makes sure two requests racing with
+	// the same code cannot both get it
+	query := `delete from oauth_codes where code_hash = $1
+		returning code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, expires_at, created_at`
+
+	var c data.AuthCode
+	var scopes string
+	err := m.DB.QueryRowContext(ctx, query, hash).Scan(
+		&c.Hash,
+		&c.ClientID,
+		&c.UserID,
+		&c.RedirectURI,
+		&scopes,
+		&c.Nonce,
+		&c.CodeChallenge,
+		&c.ExpiresAt,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Scopes = strings.Fields(scopes)
+	return &c, nil
+}
+
+func (m *PostgresDBRepo) InsertOAuthToken(t data.OAuthToken) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into oauth_tokens (token_hash, client_id, user_id, scopes, expires_at, created_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		t.Hash,
+		t.ClientID,
+		t.UserID,
+		strings.Join(t.Scopes, " "),
+		t.ExpiresAt,
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *PostgresDBRepo) GetOAuthToken(hash []byte) (*data.OAuthToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, token_hash, client_id, user_id, scopes, expires_at, created_at
+		from oauth_tokens where token_hash = $1`
+
+	var t data.OAuthToken
+	var scopes string
+	err := m.DB.QueryRowContext(ctx, query, hash).Scan(
+		&t.ID,
+		&t.Hash,
+		&t.ClientID,
+		&t.UserID,
+		&scopes,
+		&t.ExpiresAt,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Scopes = strings.Fields(scopes)
+	return &t, nil
+}
+
+func (m *PostgresDBRepo) DeleteOAuthToken(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `delete from oauth_tokens where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
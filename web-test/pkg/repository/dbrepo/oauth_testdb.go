@@ -0,0 +1,116 @@
+package dbrepo
+
+import (
+	"bytes"
+	"database/sql"
+	"slices"
+	"time"
+
+	"webapp/pkg/data"
+)
+
+func (m *TestDBRepo) InsertOAuthClient(c data.OAuthClient) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.CreatedAt = time.Now()
+	m.oauthClients = append(m.oauthClients, c)
+	return nil
+}
+
+func (m *TestDBRepo) AllOAuthClients() ([]data.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.oauthClients), nil
+}
+
+func (m *TestDBRepo) GetOAuthClient(id string) (*data.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.oauthClients {
+		if c.ID == id {
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// DeleteOAuthClient removes the codes and tokens of the client too, as the
+// foreign keys do in Postgres.
+func (m *TestDBRepo) DeleteOAuthClient(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.oauthClients)
+	m.oauthClients = slices.DeleteFunc(m.oauthClients, func(c data.OAuthClient) bool { return c.ID == id })
+	if len(m.oauthClients) == n {
+		return sql.ErrNoRows
+	}
+
+	m.authCodes = slices.DeleteFunc(m.authCodes, func(c data.AuthCode) bool { return c.ClientID == id })
+	for i, t := range m.oauthTokens {
+		if t.ClientID == id {
+			m.oauthTokens[i] = data.OAuthToken{}
+		}
+	}
+	return nil
+}
+
+func (m *TestDBRepo) InsertAuthCode(c data.AuthCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.CreatedAt = time.Now()
+	m.authCodes = append(m.authCodes, c)
+	return nil
+}
+
+func (m *TestDBRepo) TakeAuthCode(hash []byte) (*data.AuthCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, c := range m.authCodes {
+		if bytes.Equal(c.Hash, hash) {
+			m.authCodes = slices.Delete(m.authCodes, i, i+1)
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// InsertOAuthToken numbers tokens like InsertAPIKey numbers keys; revoked
+// tokens keep their place, with a zero id.
+func (m *TestDBRepo) InsertOAuthToken(t data.OAuthToken) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.ID = len(m.oauthTokens) + 1
+	t.CreatedAt = time.Now()
+	m.oauthTokens = append(m.oauthTokens, t)
+	return t.ID, nil
+}
+
+func (m *TestDBRepo) GetOAuthToken(hash []byte) (*data.OAuthToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.oauthTokens {
+		if t.ID != 0 && bytes.Equal(t.Hash, hash) {
+			return &t, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *TestDBRepo) DeleteOAuthToken(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.oauthTokens) || m.oauthTokens[id-1].ID == 0 {
+		return sql.ErrNoRows
+	}
+	m.oauthTokens[id-1] = data.OAuthToken{}
+	return nil
+}
@@ -0,0 +1,147 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"webapp/pkg/data"
+)
+
+func (m *PostgresDBRepo) InsertPasskey(p data.Passkey) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into passkeys (user_id, name, credential_id, public_key, sign_count, created_at)
+		values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		p.UserID,
+		p.Name,
+		p.CredentialID,
+		p.PublicKey,
+		int64(p.SignCount),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (m *PostgresDBRepo) UserPasskeys(userID int) ([]data.Passkey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select ` + passkeyColumns + ` from passkeys where user_id = $1 order by created_at, id`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var passkeys []data.Passkey
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, *p)
+	}
+
+	return passkeys, rows.Err()
+}
+
+func (m *PostgresDBRepo) GetPasskeyByCredentialID(credentialID []byte) (*data.Passkey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select ` + passkeyColumns + ` from passkeys where credential_id = $1`
+
+	return scanPasskey(m.DB.QueryRowContext(ctx, query, credentialID))
+}
+
+func (m *PostgresDBRepo) UsePasskey(id int, signCount uint32, usedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update passkeys set sign_count = $1, last_used_at = $2 where id = $3`
+	_, err := m.DB.ExecContext(ctx, stmt, int64(signCount), usedAt, id)
+	return err
+}
+
+func (m *PostgresDBRepo) DeletePasskey(userID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from passkeys where id = $1 and user_id = $2`
+	res, err := m.DB.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const passkeyColumns = `id, user_id, name, credential_id, public_key, sign_count, last_used_at, created_at`
+
+func scanPasskey(row scanner) (*data.Passkey, error) {
+	var p data.Passkey
+	var signCount int64
+	var lastUsed sql.NullTime
+
+	err := row.Scan(
+		&p.ID,
+		&p.UserID,
+		&p.Name,
+		&p.CredentialID,
+		&p.PublicKey,
+		&signCount,
+		&lastUsed,
+		&p.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.SignCount = uint32(signCount)
+	if lastUsed.Valid {
+		p.LastUsedAt = &lastUsed.Time
+	}
+
+	return &p, nil
+}
+
+func (m *PostgresDBRepo) UseChallenge(nonce []byte, expiresAt time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// expired challenges are refused before they are looked up, so their
+	// nonces need not be kept
+	if _, err := m.DB.ExecContext(ctx, `delete from webauthn_challenges where expires_at < $1`, time.Now()); err != nil {
+		return false, err
+	}
+
+	// the primary key makes sure two requests racing with the same
+	// challenge cannot both record it
+	res, err := m.DB.ExecContext(ctx, `insert into webauthn_challenges (nonce, expires_at) values ($1, $2)
+		on conflict (nonce) do nothing`, nonce, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 0, nil
+}
@@ -0,0 +1,100 @@
+package dbrepo
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"time"
+
+	"webapp/pkg/data"
+)
+
+// InsertPasskey refuses a second passkey with the same credential id, as
+// the unique constraint does in Postgres.
+func (m *TestDBRepo) InsertPasskey(p data.Passkey) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.passkeys {
+		if existing.ID != 0 && bytes.Equal(existing.CredentialID, p.CredentialID) {
+			return 0, errors.New("duplicate passkey")
+		}
+	}
+
+	p.ID = len(m.passkeys) + 1
+	p.CreatedAt = time.Now()
+	m.passkeys = append(m.passkeys, p)
+	return p.ID, nil
+}
+
+func (m *TestDBRepo) UserPasskeys(userID int) ([]data.Passkey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var passkeys []data.Passkey
+	for _, p := range m.passkeys {
+		if p.ID != 0 && p.UserID == userID {
+			passkeys = append(passkeys, p)
+		}
+	}
+	return passkeys, nil
+}
+
+func (m *TestDBRepo) GetPasskeyByCredentialID(credentialID []byte) (*data.Passkey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.passkeys {
+		if p.ID != 0 && bytes.Equal(p.CredentialID, credentialID) {
+			return &p, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *TestDBRepo) UsePasskey(id int, signCount uint32, usedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id >= 1 && id <= len(m.passkeys) {
+		m.passkeys[id-1].SignCount = signCount
+		m.passkeys[id-1].LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+// DeletePasskey keeps the place of the passkey, zeroing its id, so ids are
+// not reused.
+func (m *TestDBRepo) DeletePasskey(userID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id < 1 || id > len(m.passkeys) || m.passkeys[id-1].ID == 0 || m.passkeys[id-1].UserID != userID {
+		return sql.ErrNoRows
+	}
+	m.passkeys[id-1] = data.Passkey{}
+	return nil
+}
+
+// UseChallenge forgets nonces once they have expired, as the Postgres
+// repository does.
+func (m *TestDBRepo) UseChallenge(nonce []byte, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for n, expiry := range m.challenges {
+		if expiry.Before(now) {
+			delete(m.challenges, n)
+		}
+	}
+
+	if _, ok := m.challenges[string(nonce)]; ok {
+		return true, nil
+	}
+	if m.challenges == nil {
+		m.challenges = make(map[string]time.Time)
+	}
+	m.challenges[string(nonce)] = expiresAt
+	return false, nil
+}
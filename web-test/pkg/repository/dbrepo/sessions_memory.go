@@ -0,0 +1,199 @@
+package dbrepo
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+
+	"webapp/pkg/data"
+)
+
+// MemorySessionStore is an scs session store keeping sessions in memory, for
+// running the web application without a sessions table. Sessions are lost
+// when it stops. Besides the session data it indexes sessions by their
+// owner, so users can still list and revoke their sessions.
+type MemorySessionStore struct {
+	// Codec must match the codec of the session manager; it defaults to
+	// scs.GobCodec.
+	Codec scs.Codec
+
+	store *memstore.MemStore
+
+	mu sync.Mutex
+	// sessions holds the expiry and owner of every session in store, and
+	// tokens the sessions of each user.
+	sessions map[string]memorySession
+	tokens   map[int]map[string]bool
+
+	stop chan struct{}
+}
+
+type memorySession struct {
+	userID int
+	expiry time.Time
+}
+
+// NewMemorySessionStore returns an empty MemorySessionStore which removes
+// expired sessions every cleanupInterval until StopCleanup is called.
+func NewMemorySessionStore(cleanupInterval time.Duration) *MemorySessionStore {
+	m := &MemorySessionStore{
+		// the cleanup of the memstore cannot be stopped safely right after
+		// it starts, so expired sessions are removed by the loop below
+		store:    memstore.NewWithCleanupInterval(0),
+		sessions: make(map[string]memorySession),
+		tokens:   make(map[int]map[string]bool),
+		stop:     make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.deleteExpired()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+
+	return m
+}
+
+// StopCleanup stops removing expired sessions.
+func (m *MemorySessionStore) StopCleanup() {
+	close(m.stop)
+}
+
+func (m *MemorySessionStore) codec() scs.Codec {
+	if m.Codec == nil {
+		return scs.GobCodec{}
+	}
+	return m.Codec
+}
+
+// Find returns the data of an unexpired session.
+func (m *MemorySessionStore) Find(token string) ([]byte, bool, error) {
+	return m.store.Find(token)
+}
+
+// FindCtx returns the data of an unexpired session.
+func (m *MemorySessionStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	return m.Find(token)
+}
+
+// Commit saves a session, indexed by the owner found in its data.
+func (m *MemorySessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	var userID int
+	if _, values, err := m.codec().Decode(b); err == nil {
+		userID = data.SessionFromValues(token, expiry, values).UserID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.store.Commit(token, b, expiry); err != nil {
+		return err
+	}
+
+	m.unindex(token)
+	m.sessions[token] = memorySession{userID: userID, expiry: expiry}
+	if userID != 0 {
+		if m.tokens[userID] == nil {
+			m.tokens[userID] = make(map[string]bool)
+		}
+		m.tokens[userID][token] = true
+	}
+
+	return nil
+}
+
+// CommitCtx saves a session, indexed by the owner found in its data.
+func (m *MemorySessionStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	return m.Commit(token, b, expiry)
+}
+
+// Delete removes a session.
+func (m *MemorySessionStore) Delete(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.unindex(token)
+	return m.store.Delete(token)
+}
+
+// DeleteCtx removes a session.
+func (m *MemorySessionStore) DeleteCtx(ctx context.Context, token string) error {
+	return m.Delete(token)
+}
+
+// UserSessions returns the unexpired sessions of a user, most recently used first.
+func (m *MemorySessionStore) UserSessions(ctx context.Context, userID int) ([]data.Session, error) {
+	m.mu.Lock()
+	tokens := make([]string, 0, len(m.tokens[userID]))
+	for token := range m.tokens[userID] {
+		tokens = append(tokens, token)
+	}
+	m.mu.Unlock()
+
+	var sessions []data.Session
+	for _, token := range tokens {
+		b, ok, err := m.store.Find(token)
+		if err != nil || !ok {
+			continue
+		}
+
+		expiry, values, err := m.codec().Decode(b)
+		if err != nil {
+			continue
+		}
+
+		session := data.SessionFromValues(token, expiry, values)
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+
+	return sessions, nil
+}
+
+// deleteExpired removes the sessions which have expired.
+func (m *MemorySessionStore) deleteExpired() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for token, s := range m.sessions {
+		if now.After(s.expiry) {
+			m.unindex(token)
+			_ = m.store.Delete(token)
+		}
+	}
+}
+
+// unindex forgets the expiry and owner of token. m.mu must be held.
+func (m *MemorySessionStore) unindex(token string) {
+	s, ok := m.sessions[token]
+	if !ok {
+		return
+	}
+
+	delete(m.sessions, token)
+	if s.userID == 0 {
+		return
+	}
+	delete(m.tokens[s.userID], token)
+	if len(m.tokens[s.userID]) == 0 {
+		delete(m.tokens, s.userID)
+	}
+}
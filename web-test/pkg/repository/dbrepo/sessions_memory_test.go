@@ -0,0 +1,71 @@
+package dbrepo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+
+	"webapp/pkg/data"
+)
+
+func encodeSession(t *testing.T, expiry time.Time, values map[string]any) []byte {
+	t.Helper()
+	b, err := scs.GobCodec{}.Encode(expiry, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	store := NewMemorySessionStore(time.Hour)
+	defer store.StopCleanup()
+	ctx := context.Background()
+
+	expiry := time.Now().Add(time.Hour)
+	_ = store.CommitCtx(ctx, "first", encodeSession(t, expiry, map[string]any{data.SessionUserIDKey: 1}), expiry)
+	_ = store.CommitCtx(ctx, "second", encodeSession(t, expiry, map[string]any{data.SessionUserIDKey: 1}), expiry)
+	_ = store.CommitCtx(ctx, "other", encodeSession(t, expiry, map[string]any{data.SessionUserIDKey: 2}), expiry)
+	_ = store.CommitCtx(ctx, "anonymous", encodeSession(t, expiry, map[string]any{}), expiry)
+
+	if sessions, _ := store.UserSessions(ctx, 1); len(sessions) != 2 {
+		t.Errorf("expected 2 sessions for user 1, got %d", len(sessions))
+	}
+
+	// logging out keeps the session, without its owner
+	_ = store.CommitCtx(ctx, "second", encodeSession(t, expiry, map[string]any{}), expiry)
+	if sessions, _ := store.UserSessions(ctx, 1); len(sessions) != 1 || sessions[0].Token != "first" {
+		t.Errorf("expected only the first session for user 1, got %+v", sessions)
+	}
+	if _, ok, _ := store.FindCtx(ctx, "second"); !ok {
+		t.Error("expected the logged out session to be kept")
+	}
+
+	_ = store.DeleteCtx(ctx, "first")
+	if sessions, _ := store.UserSessions(ctx, 1); len(sessions) != 0 {
+		t.Errorf("expected no sessions for user 1, got %d", len(sessions))
+	}
+
+	// expired sessions are neither found nor listed, and are removed on
+	// cleanup
+	past := time.Now().Add(-time.Minute)
+	_ = store.CommitCtx(ctx, "expired", encodeSession(t, past, map[string]any{data.SessionUserIDKey: 3}), past)
+	if _, ok, _ := store.FindCtx(ctx, "expired"); ok {
+		t.Error("expected the expired session not to be found")
+	}
+	if sessions, _ := store.UserSessions(ctx, 3); len(sessions) != 0 {
+		t.Errorf("expected no sessions for user 3, got %d", len(sessions))
+	}
+	store.deleteExpired()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.sessions["expired"]; ok || len(store.sessions) != 3 {
+		t.Errorf("expected the expired session to be removed, got %v", store.sessions)
+	}
+	if len(store.tokens) != 1 || !store.tokens[2]["other"] {
+		t.Errorf("expected only the session of user 2 to be indexed, got %v", store.tokens)
+	}
+}
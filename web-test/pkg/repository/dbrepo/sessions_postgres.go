@@ -0,0 +1,178 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+
+	"webapp/pkg/data"
+)
+
+// PostgresSessionStore is an scs session store keeping sessions in the
+// sessions table, so they survive restarts. Besides the session data it
+// records who each session belongs to and where it was last used from.
+type PostgresSessionStore struct {
+	DB *sql.DB
+	// Codec must match the codec of the session manager; it defaults to
+	// scs.GobCodec.
+	Codec scs.Codec
+}
+
+func (m *PostgresSessionStore) codec() scs.Codec {
+	if m.Codec == nil {
+		return scs.GobCodec{}
+	}
+	return m.Codec
+}
+
+// Find returns the data of an unexpired session.
+func (m *PostgresSessionStore) Find(token string) ([]byte, bool, error) {
+	return m.FindCtx(context.Background(), token)
+}
+
+// FindCtx returns the data of an unexpired session.
+func (m *PostgresSessionStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var b []byte
+	query := `select data from sessions where token = $1 and expiry > now()`
+
+	err := m.DB.QueryRowContext(ctx, query, token).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit saves a session, along with the owner and device found in its data.
+func (m *PostgresSessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	return m.CommitCtx(context.Background(), token, b, expiry)
+}
+
+// CommitCtx saves a session, along with the owner and device found in its data.
+func (m *PostgresSessionStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var s data.Session
+	if _, values, err := m.codec().Decode(b); err == nil {
+		s = data.SessionFromValues(token, expiry, values)
+	}
+
+	stmt := `
+		insert into sessions (token, data, expiry, user_id, user_agent, ip, last_seen)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict (token) do update set
+			data = excluded.data,
+			expiry = excluded.expiry,
+			user_id = excluded.user_id,
+			user_agent = excluded.user_agent,
+			ip = excluded.ip,
+			last_seen = excluded.last_seen`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		token,
+		b,
+		expiry.UTC(),
+		nullInt(s.UserID),
+		s.UserAgent,
+		s.IP,
+		nullTime(s.LastSeen),
+	)
+
+	return err
+}
+
+// Delete removes a session.
+func (m *PostgresSessionStore) Delete(token string) error {
+	return m.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx removes a session.
+func (m *PostgresSessionStore) DeleteCtx(ctx context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from sessions where token = $1`, token)
+	return err
+}
+
+// UserSessions returns the unexpired sessions of a user, most recently used first.
+func (m *PostgresSessionStore) UserSessions(ctx context.Context, userID int) ([]data.Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	query := `
+		select token, user_id, user_agent, ip, coalesce(last_seen, to_timestamp(0)), expiry
+		from sessions
+		where user_id = $1 and expiry > now()
+		order by last_seen desc nulls last`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []data.Session
+	for rows.Next() {
+		var s data.Session
+		err := rows.Scan(&s.Token, &s.UserID, &s.UserAgent, &s.IP, &s.LastSeen, &s.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteExpired removes the sessions which have expired.
+func (m *PostgresSessionStore) DeleteExpired(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from sessions where expiry < now()`)
+	return err
+}
+
+// StartCleanup removes expired sessions every interval until the returned
+// function is called, logging failures to logger.
+func (m *PostgresSessionStore) StartCleanup(interval time.Duration, logger *slog.Logger) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.DeleteExpired(ctx); err != nil && ctx.Err() == nil {
+					logger.Error("could not remove expired sessions", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return cancel
+}
+
+func nullInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v != 0}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
@@ -0,0 +1,96 @@
+package dbrepo
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+
+	"webapp/pkg/data"
+)
+
+type testSession struct {
+	data   []byte
+	expiry time.Time
+}
+
+// TestSessionStore keeps sessions in memory for tests. It never removes
+// expired sessions; MemorySessionStore is the one to run with.
+type TestSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]testSession
+}
+
+func (m *TestSessionStore) Find(token string) ([]byte, bool, error) {
+	return m.FindCtx(context.Background(), token)
+}
+
+func (m *TestSessionStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[token]
+	if !ok || time.Now().After(s.expiry) {
+		return nil, false, nil
+	}
+
+	return s.data, true, nil
+}
+
+func (m *TestSessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	return m.CommitCtx(context.Background(), token, b, expiry)
+}
+
+func (m *TestSessionStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions == nil {
+		m.sessions = make(map[string]testSession)
+	}
+	m.sessions[token] = testSession{data: b, expiry: expiry}
+
+	return nil
+}
+
+func (m *TestSessionStore) Delete(token string) error {
+	return m.DeleteCtx(context.Background(), token)
+}
+
+func (m *TestSessionStore) DeleteCtx(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, token)
+	return nil
+}
+
+func (m *TestSessionStore) UserSessions(ctx context.Context, userID int) ([]data.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []data.Session
+	for token, s := range m.sessions {
+		if time.Now().After(s.expiry) {
+			continue
+		}
+
+		_, values, err := scs.GobCodec{}.Decode(s.data)
+		if err != nil {
+			continue
+		}
+
+		session := data.SessionFromValues(token, s.expiry, values)
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+
+	return sessions, nil
+}
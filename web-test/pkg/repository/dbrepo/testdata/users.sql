@@ -36,6 +36,7 @@ CREATE TABLE
         email character varying(255),
         password character varying(60),
         is_admin integer,
+        locale character varying(16) DEFAULT ''::character varying NOT NULL,
         created_at timestamp without time zone,
         updated_at timestamp without time zone
     );
@@ -91,4 +92,235 @@ ADD
 
 -- PostgreSQL database dump complete
 
---
\ No newline at end of file
+--
+
+--
+
+-- Name: sessions; Type: TABLE; Schema: public; Owner: -
+
+--
+
+CREATE TABLE
+    public.sessions (
+        token text NOT NULL,
+        data bytea NOT NULL,
+        expiry timestamp with time zone NOT NULL,
+        user_id integer,
+        user_agent text NOT NULL DEFAULT '',
+        ip character varying(64) NOT NULL DEFAULT '',
+        last_seen timestamp with time zone
+    );
+
+ALTER TABLE ONLY public.sessions
+ADD
+    CONSTRAINT sessions_pkey PRIMARY KEY (token);
+
+ALTER TABLE
+    ONLY public.sessions
+ADD
+    CONSTRAINT sessions_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+CREATE INDEX sessions_expiry_idx ON public.sessions (expiry);
+
+CREATE INDEX sessions_user_id_idx ON public.sessions (user_id);
+
+--
+
+-- Name: api_keys; Type: TABLE; Schema: public; Owner: -
+
+--
+
+CREATE TABLE
+    public.api_keys (
+        id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+        user_id integer NOT NULL,
+        name character varying(255) NOT NULL,
+        prefix character varying(32) NOT NULL,
+        key_hash bytea NOT NULL,
+        scopes text NOT NULL DEFAULT '',
+        expires_at timestamp with time zone NOT NULL,
+        last_used_at timestamp with time zone,
+        created_at timestamp with time zone NOT NULL DEFAULT now()
+    );
+
+ALTER TABLE ONLY public.api_keys
+ADD
+    CONSTRAINT api_keys_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.api_keys
+ADD
+    CONSTRAINT api_keys_prefix_key UNIQUE (prefix);
+
+ALTER TABLE
+    ONLY public.api_keys
+ADD
+    CONSTRAINT api_keys_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+CREATE INDEX api_keys_user_id_idx ON public.api_keys (user_id);
+
+--
+
+-- Name: oauth_clients; Type: TABLE; Schema: public; Owner: -
+
+--
+
+CREATE TABLE
+    public.oauth_clients (
+        id character varying(64) NOT NULL,
+        name character varying(255) NOT NULL,
+        secret_hash bytea,
+        redirect_uris text NOT NULL,
+        created_at timestamp with time zone NOT NULL DEFAULT now()
+    );
+
+ALTER TABLE ONLY public.oauth_clients
+ADD
+    CONSTRAINT oauth_clients_pkey PRIMARY KEY (id);
+
+--
+
+-- Name: oauth_codes; Type: TABLE; Schema: public; Owner: -
+
+--
+
+CREATE TABLE
+    public.oauth_codes (
+        code_hash bytea NOT NULL,
+        client_id character varying(64) NOT NULL,
+        user_id integer NOT NULL,
+        redirect_uri text NOT NULL,
+        scopes text NOT NULL DEFAULT '',
+        nonce text NOT NULL DEFAULT '',
+        code_challenge character varying(128) NOT NULL,
+        expires_at timestamp with time zone NOT NULL,
+        created_at timestamp with time zone NOT NULL DEFAULT now()
+    );
+
+ALTER TABLE ONLY public.oauth_codes
+ADD
+    CONSTRAINT oauth_codes_pkey PRIMARY KEY (code_hash);
+
+ALTER TABLE
+    ONLY public.oauth_codes
+ADD
+    CONSTRAINT oauth_codes_client_id_fkey FOREIGN KEY (client_id) REFERENCES public.oauth_clients(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE
+    ONLY public.oauth_codes
+ADD
+    CONSTRAINT oauth_codes_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+--
+
+-- Name: oauth_tokens; Type: TABLE; Schema: public; Owner: -
+
+--
+
+CREATE TABLE
+    public.oauth_tokens (
+        id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+        token_hash bytea NOT NULL,
+        client_id character varying(64) NOT NULL,
+        user_id integer NOT NULL,
+        scopes text NOT NULL DEFAULT '',
+        expires_at timestamp with time zone NOT NULL,
+        created_at timestamp with time zone NOT NULL DEFAULT now()
+    );
+
+ALTER TABLE ONLY public.oauth_tokens
+ADD
+    CONSTRAINT oauth_tokens_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.oauth_tokens
+ADD
+    CONSTRAINT oauth_tokens_token_hash_key UNIQUE (token_hash);
+
+ALTER TABLE
+    ONLY public.oauth_tokens
+ADD
+    CONSTRAINT oauth_tokens_client_id_fkey FOREIGN KEY (client_id) REFERENCES public.oauth_clients(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE
+    ONLY public.oauth_tokens
+ADD
+    CONSTRAINT oauth_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+--
+
+-- Name: user_identities; Type: TABLE; Schema: public; Owner: -
+
+--
+
+CREATE TABLE
+    public.user_identities (
+        id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+        user_id integer NOT NULL,
+        provider character varying(64) NOT NULL,
+        subject character varying(255) NOT NULL,
+        email character varying(255) NOT NULL DEFAULT '',
+        created_at timestamp with time zone NOT NULL DEFAULT now()
+    );
+
+ALTER TABLE ONLY public.user_identities
+ADD
+    CONSTRAINT user_identities_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.user_identities
+ADD
+    CONSTRAINT user_identities_provider_subject_key UNIQUE (provider, subject);
+
+ALTER TABLE
+    ONLY public.user_identities
+ADD
+    CONSTRAINT user_identities_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+--
+
+-- Name: passkeys; Type: TABLE; Schema: public; Owner: -
+
+--
+
+CREATE TABLE
+    public.passkeys (
+        id integer NOT NULL GENERATED ALWAYS AS IDENTITY,
+        user_id integer NOT NULL,
+        name character varying(255) NOT NULL,
+        credential_id bytea NOT NULL,
+        public_key bytea NOT NULL,
+        sign_count bigint NOT NULL DEFAULT 0,
+        last_used_at timestamp with time zone,
+        created_at timestamp with time zone NOT NULL DEFAULT now()
+    );
+
+ALTER TABLE ONLY public.passkeys
+ADD
+    CONSTRAINT passkeys_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.passkeys
+ADD
+    CONSTRAINT passkeys_credential_id_key UNIQUE (credential_id);
+
+ALTER TABLE
+    ONLY public.passkeys
+ADD
+    CONSTRAINT passkeys_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+CREATE INDEX passkeys_user_id_idx ON public.passkeys (user_id);
+
+--
+
+-- Name: webauthn_challenges; Type: TABLE; Schema: public; Owner: -
+
+--
+
+CREATE TABLE
+    public.webauthn_challenges (
+        nonce bytea NOT NULL,
+        expires_at timestamp with time zone NOT NULL
+    );
+
+ALTER TABLE ONLY public.webauthn_challenges
+ADD
+    CONSTRAINT webauthn_challenges_pkey PRIMARY KEY (nonce);
+
+CREATE INDEX webauthn_challenges_expires_at_idx ON public.webauthn_challenges (expires_at);
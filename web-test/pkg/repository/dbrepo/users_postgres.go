@@ -3,7 +3,9 @@ package dbrepo
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -25,8 +27,11 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, is_admin, created_at, updated_at
-	from users order by last_name`
+	query := `select u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.locale, u.created_at, u.updated_at,
+		coalesce(ui.file_name,'')
+	from users u
+		left join user_images ui on (ui.user_id = u.id)
+	order by u.last_name`
 
 	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
@@ -45,8 +50,10 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 			&user.LastName,
 			&user.Password,
 			&user.IsAdmin,
+			&user.Locale,
 			&user.CreatedAt,
 			&user.UpdatedAt,
+			&user.ProfilePic.FileName,
 		)
 		if err != nil {
 			log.Println("Error scanning", err)
@@ -59,13 +66,66 @@ func (m *PostgresDBRepo) AllUsers() ([]*data.User, error) {
 	return users, nil
 }
 
+// SearchUsers returns one page of the users whose name or email contains
+// query, ignoring case, along with the number of users matching. Pages start
+// at 1; an empty query matches everyone.
+func (m *PostgresDBRepo) SearchUsers(query string, page, pageSize int) ([]*data.User, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if page < 1 {
+		page = 1
+	}
+
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+	where := `where email ilike $1 or first_name ilike $1 or last_name ilike $1
+		or (first_name || ' ' || last_name) ilike $1`
+
+	var total int
+	err := m.DB.QueryRowContext(ctx, `select count(*) from users `+where, pattern).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `select id, email, first_name, last_name, is_admin, locale, created_at, updated_at
+		from users `+where+`
+		order by last_name, first_name, id
+		limit $2 offset $3`, pattern, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*data.User
+	for rows.Next() {
+		var user data.User
+		err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.IsAdmin,
+			&user.Locale,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		users = append(users, &user)
+	}
+
+	return users, total, rows.Err()
+}
+
 func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	query := `
 		select 
-			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.created_at, u.updated_at,
+			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.locale, u.created_at, u.updated_at,
 			coalesce(ui.file_name,'')
 		from 
 			users u
@@ -83,6 +143,7 @@ func (m *PostgresDBRepo) GetUser(id int) (*data.User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.IsAdmin,
+		&user.Locale,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.ProfilePic.FileName,
@@ -101,7 +162,7 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*data.User, error) {
 
 	query := `
 		select 
-			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.created_at, u.updated_at,
+			u.id, u.email, u.first_name, u.last_name, u.password, u.is_admin, u.locale, u.created_at, u.updated_at,
 			coalesce(ui.file_name,'')
 		from 
 			users u
@@ -119,6 +180,7 @@ func (m *PostgresDBRepo) GetUserByEmail(email string) (*data.User, error) {
 		&user.LastName,
 		&user.Password,
 		&user.IsAdmin,
+		&user.Locale,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.ProfilePic.FileName,
@@ -140,8 +202,9 @@ func (m *PostgresDBRepo) UpdateUser(u data.User) error {
 		first_name = $2,
 		last_name = $3,
 		is_admin = $4,
-		updated_at = $5
-		where id = $6
+		locale = $5,
+		updated_at = $6
+		where id = $7
 	`
 
 	_, err := m.DB.ExecContext(ctx, stmt,
@@ -149,6 +212,7 @@ func (m *PostgresDBRepo) UpdateUser(u data.User) error {
 		u.FirstName,
 		u.LastName,
 		u.IsAdmin,
+		u.Locale,
 		time.Now(),
 		u.ID,
 	)
@@ -160,6 +224,55 @@ func (m *PostgresDBRepo) UpdateUser(u data.User) error {
 	return nil
 }
 
+// PatchUser updates only the columns of the fields set in p, so concurrent
+// changes to other fields are not overwritten.
+func (m *PostgresDBRepo) PatchUser(id int, p data.UserPatch) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var sets []string
+	var args []any
+	column := func(name string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", name, len(args)))
+	}
+
+	if p.FirstName != nil {
+		column("first_name", *p.FirstName)
+	}
+	if p.LastName != nil {
+		column("last_name", *p.LastName)
+	}
+	if p.Email != nil {
+		column("email", *p.Email)
+	}
+	if p.IsAdmin != nil {
+		column("is_admin", *p.IsAdmin)
+	}
+	if p.Locale != nil {
+		column("locale", *p.Locale)
+	}
+	column("updated_at", time.Now())
+
+	args = append(args, id)
+	stmt := fmt.Sprintf(`update users set %s where id = $%d`, strings.Join(sets, ", "), len(args))
+
+	result, err := m.DB.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 func (m *PostgresDBRepo) DeleteUser(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
@@ -184,8 +297,8 @@ func (m *PostgresDBRepo) InsertUser(user data.User) (int, error) {
 	}
 
 	var newID int
-	stmt := `insert into users (email, first_name, last_name, password, is_admin, created_at, updated_at)
-		values ($1, $2, $3, $4, $5, $6, $7) returning id`
+	stmt := `insert into users (email, first_name, last_name, password, is_admin, locale, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
 
 	err = m.DB.QueryRowContext(ctx, stmt,
 		user.Email,
@@ -193,6 +306,7 @@ func (m *PostgresDBRepo) InsertUser(user data.User) (int, error) {
 		user.LastName,
 		hashedPassword,
 		user.IsAdmin,
+		user.Locale,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -250,3 +364,12 @@ func (m *PostgresDBRepo) InsertUserImage(i data.UserImage) (int, error) {
 
 	return newID, nil
 }
+
+func (m *PostgresDBRepo) DeleteUserImage(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from user_images where user_id = $1`
+	_, err := m.DB.ExecContext(ctx, stmt, userID)
+	return err
+}
@@ -3,7 +3,9 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -13,6 +15,7 @@ import (
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
 	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/alexedwards/scs/v2"
 	dockertest "github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
 
@@ -221,6 +224,29 @@ func TestPostgresDBRepoUpdateUser(t *testing.T) {
 	}
 }
 
+func TestPostgresDBRepoPatchUser(t *testing.T) {
+	before, _ := testRepo.GetUser(1)
+
+	lastName := "Patched"
+	err := testRepo.PatchUser(1, data.UserPatch{LastName: &lastName})
+	if err != nil {
+		t.Errorf("error patching user 1: %s", err)
+	}
+
+	after, _ := testRepo.GetUser(1)
+	if after.LastName != "Patched" {
+		t.Errorf("expected last name Patched, but got %s", after.LastName)
+	}
+	if after.FirstName != before.FirstName || after.Email != before.Email || after.IsAdmin != before.IsAdmin {
+		t.Errorf("expected the other fields to be unchanged, but got %+v", after)
+	}
+
+	err = testRepo.PatchUser(100, data.UserPatch{LastName: &lastName})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown user, but got %v", err)
+	}
+}
+
 func TestPostgresDBRepoDeleteUser(t *testing.T) {
 	err := testRepo.DeleteUser(2)
 
@@ -274,3 +300,341 @@ func TestPostgresDBRepoInsertUserImage(t *testing.T) {
 		t.Error("should be got error when try insert user image with none user id")
 	}
 }
+
+func TestPostgresDBRepoDeleteUserImage(t *testing.T) {
+	users, err := testRepo.AllUsers()
+	if err != nil {
+		t.Fatal("all users failed:", err)
+	}
+	for _, u := range users {
+		if u.ID == 1 && u.ProfilePic.FileName != "test.jpg" {
+			t.Errorf("expected all users to include the profile picture, got %q", u.ProfilePic.FileName)
+		}
+	}
+
+	if err := testRepo.DeleteUserImage(1); err != nil {
+		t.Error("delete user image failed:", err)
+	}
+
+	user, _ := testRepo.GetUser(1)
+	if user.ProfilePic.FileName != "" {
+		t.Errorf("expected no profile picture after deleting it, got %q", user.ProfilePic.FileName)
+	}
+
+	// deleting a picture which is not there is not an error
+	if err := testRepo.DeleteUserImage(1); err != nil {
+		t.Error("deleting a missing user image failed:", err)
+	}
+}
+
+func TestPostgresDBRepoAPIKeys(t *testing.T) {
+	key, k, err := data.NewAPIKey(1, "deploy", []string{data.ScopeRead}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := testRepo.InsertAPIKey(k)
+	if err != nil {
+		t.Fatal("insert api key failed:", err)
+	}
+
+	prefix, _ := data.APIKeyPrefix(key)
+	found, err := testRepo.GetAPIKeyByPrefix(prefix)
+	if err != nil {
+		t.Fatal("get api key failed:", err)
+	}
+	if found.ID != id || found.Name != "deploy" || !found.Matches(key) || !found.HasScope(data.ScopeRead) || found.LastUsedAt != nil {
+		t.Errorf("unexpected api key %+v", found)
+	}
+
+	usedAt := time.Now().Truncate(time.Second)
+	if err := testRepo.TouchAPIKey(id, usedAt); err != nil {
+		t.Error("touch api key failed:", err)
+	}
+
+	keys, err := testRepo.UserAPIKeys(1)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("expected one api key, got %v %v", keys, err)
+	}
+	if keys[0].LastUsedAt == nil || !keys[0].LastUsedAt.Equal(usedAt) {
+		t.Errorf("expected last used at %v, got %v", usedAt, keys[0].LastUsedAt)
+	}
+
+	if err := testRepo.DeleteAPIKey(2, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows revoking the key of another user, got %v", err)
+	}
+	if err := testRepo.DeleteAPIKey(1, id); err != nil {
+		t.Error("delete api key failed:", err)
+	}
+	if _, err := testRepo.GetAPIKeyByPrefix(prefix); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a revoked key, got %v", err)
+	}
+}
+
+func TestPostgresDBRepoOAuth(t *testing.T) {
+	secret, hash, _ := data.NewOAuthSecret()
+	client := data.OAuthClient{ID: "test-client", Name: "Test", SecretHash: hash, RedirectURIs: []string{"https://app.example.com/cb", "http://localhost:3000/cb"}}
+	if err := testRepo.InsertOAuthClient(client); err != nil {
+		t.Fatal("insert oauth client failed:", err)
+	}
+
+	found, err := testRepo.GetOAuthClient("test-client")
+	if err != nil {
+		t.Fatal("get oauth client failed:", err)
+	}
+	if !found.SecretMatches(secret) || !found.AllowsRedirect("http://localhost:3000/cb") || found.Public() {
+		t.Errorf("unexpected oauth client %+v", found)
+	}
+	if clients, err := testRepo.AllOAuthClients(); err != nil || len(clients) != 1 {
+		t.Errorf("expected one oauth client, got %v %v", clients, err)
+	}
+
+	code, codeHash, _ := data.NewOAuthSecret()
+	err = testRepo.InsertAuthCode(data.AuthCode{
+		Hash:          codeHash,
+		ClientID:      "test-client",
+		UserID:        1,
+		RedirectURI:   "https://app.example.com/cb",
+		Scopes:        []string{"openid", "email"},
+		Nonce:         "n",
+		CodeChallenge: "challenge",
+		ExpiresAt:     time.Now().Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal("insert auth code failed:", err)
+	}
+
+	taken, err := testRepo.TakeAuthCode(data.HashOAuthSecret(code))
+	if err != nil {
+		t.Fatal("take auth code failed:", err)
+	}
+	if taken.UserID != 1 || taken.Nonce != "n" || len(taken.Scopes) != 2 {
+		t.Errorf("unexpected auth code %+v", taken)
+	}
+	if _, err := testRepo.TakeAuthCode(codeHash); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows taking a code twice, got %v", err)
+	}
+
+	_, tokenHash, _ := data.NewOAuthSecret()
+	id, err := testRepo.InsertOAuthToken(data.OAuthToken{Hash: tokenHash, ClientID: "test-client", UserID: 1, Scopes: []string{"openid"}, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal("insert oauth token failed:", err)
+	}
+	if token, err := testRepo.GetOAuthToken(tokenHash); err != nil || token.ID != id || token.ClientID != "test-client" {
+		t.Errorf("unexpected oauth token %+v %v", token, err)
+	}
+	if err := testRepo.DeleteOAuthToken(id); err != nil {
+		t.Error("delete oauth token failed:", err)
+	}
+	if err := testRepo.DeleteOAuthToken(id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows revoking a token twice, got %v", err)
+	}
+
+	// deleting the client takes its tokens with it
+	_, tokenHash, _ = data.NewOAuthSecret()
+	_, _ = testRepo.InsertOAuthToken(data.OAuthToken{Hash: tokenHash, ClientID: "test-client", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)})
+	if err := testRepo.DeleteOAuthClient("test-client"); err != nil {
+		t.Error("delete oauth client failed:", err)
+	}
+	if _, err := testRepo.GetOAuthToken(tokenHash); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the tokens of a deleted client to be gone, got %v", err)
+	}
+}
+
+func TestPostgresDBRepoUserIdentities(t *testing.T) {
+	id, err := testRepo.InsertUserIdentity(data.UserIdentity{UserID: 1, Provider: "example", Subject: "248289761001", Email: "admin@example.com"})
+	if err != nil {
+		t.Fatal("insert user identity failed:", err)
+	}
+
+	found, err := testRepo.GetUserIdentity("example", "248289761001")
+	if err != nil {
+		t.Fatal("get user identity failed:", err)
+	}
+	if found.ID != id || found.UserID != 1 || found.Email != "admin@example.com" {
+		t.Errorf("unexpected user identity %+v", found)
+	}
+	if _, err := testRepo.GetUserIdentity("other", "248289761001"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a subject at another provider, got %v", err)
+	}
+
+	// a subject can only be linked once per provider
+	if _, err := testRepo.InsertUserIdentity(data.UserIdentity{UserID: 1, Provider: "example", Subject: "248289761001"}); err == nil {
+		t.Error("expected linking the same identity twice to fail")
+	}
+
+	identities, err := testRepo.UserIdentities(1)
+	if err != nil || len(identities) != 1 || identities[0].Provider != "example" {
+		t.Errorf("unexpected identities %+v %v", identities, err)
+	}
+}
+
+func TestPostgresDBRepoPasskeys(t *testing.T) {
+	p := data.Passkey{UserID: 1, Name: "laptop", CredentialID: []byte{1, 2, 3, 4}, PublicKey: []byte{0xa5, 0x01, 0x02}, SignCount: 7}
+	id, err := testRepo.InsertPasskey(p)
+	if err != nil {
+		t.Fatal("insert passkey failed:", err)
+	}
+
+	// a credential can only be registered once
+	if _, err := testRepo.InsertPasskey(p); err == nil {
+		t.Error("expected registering the same credential twice to fail")
+	}
+
+	usedAt := time.Now().Truncate(time.Second)
+	if err := testRepo.UsePasskey(id, 8, usedAt); err != nil {
+		t.Fatal("use passkey failed:", err)
+	}
+
+	found, err := testRepo.GetPasskeyByCredentialID([]byte{1, 2, 3, 4})
+	if err != nil {
+		t.Fatal("get passkey failed:", err)
+	}
+	if found.ID != id || found.UserID != 1 || found.SignCount != 8 || found.LastUsedAt == nil || !found.LastUsedAt.Equal(usedAt) {
+		t.Errorf("unexpected passkey %+v", found)
+	}
+	if _, err := testRepo.GetPasskeyByCredentialID([]byte{4, 3, 2, 1}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown credential, got %v", err)
+	}
+
+	passkeys, err := testRepo.UserPasskeys(1)
+	if err != nil || len(passkeys) != 1 || passkeys[0].Name != "laptop" {
+		t.Errorf("unexpected passkeys %+v %v", passkeys, err)
+	}
+
+	// only its owner can delete it
+	if err := testRepo.DeletePasskey(2, id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows deleting another user's passkey, got %v", err)
+	}
+	if err := testRepo.DeletePasskey(1, id); err != nil {
+		t.Fatal("delete passkey failed:", err)
+	}
+	if passkeys, _ := testRepo.UserPasskeys(1); len(passkeys) != 0 {
+		t.Errorf("expected the passkey to be deleted, got %+v", passkeys)
+	}
+}
+
+func TestPostgresDBRepoUseChallenge(t *testing.T) {
+	expiresAt := time.Now().Add(time.Minute)
+
+	if used, err := testRepo.UseChallenge([]byte{1, 2, 3}, expiresAt); err != nil || used {
+		t.Fatalf("expected a new challenge, got %v %v", used, err)
+	}
+	if used, err := testRepo.UseChallenge([]byte{1, 2, 3}, expiresAt); err != nil || !used {
+		t.Errorf("expected the challenge to be used already, got %v %v", used, err)
+	}
+
+	// expired challenges are forgotten
+	if _, err := testRepo.UseChallenge([]byte{4, 5, 6}, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if used, err := testRepo.UseChallenge([]byte{7, 8, 9}, expiresAt); err != nil || used {
+		t.Fatalf("expected a new challenge, got %v %v", used, err)
+	}
+	var n int
+	if err := testDB.QueryRow(`select count(*) from webauthn_challenges where nonce = $1`, []byte{4, 5, 6}).Scan(&n); err != nil || n != 0 {
+		t.Errorf("expected the expired challenge to be removed, got %d %v", n, err)
+	}
+}
+
+func TestPostgresSessionStore(t *testing.T) {
+	store := &PostgresSessionStore{DB: testDB}
+	ctx := context.Background()
+
+	lastSeen := time.Now().Truncate(time.Second)
+	b, _ := scs.GobCodec{}.Encode(time.Now().Add(time.Hour), map[string]interface{}{
+		data.SessionUserIDKey:    1,
+		data.SessionUserAgentKey: "test agent",
+		data.SessionIPKey:        "127.0.0.1",
+		data.SessionLastSeenKey:  lastSeen,
+	})
+
+	err := store.CommitCtx(ctx, "token-one", b, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal("commit session failed:", err)
+	}
+
+	// committing again overwrites the session
+	err = store.CommitCtx(ctx, "token-one", b, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal("second commit of session failed:", err)
+	}
+
+	err = store.CommitCtx(ctx, "expired", b, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal("commit expired session failed:", err)
+	}
+
+	found, ok, err := store.FindCtx(ctx, "token-one")
+	if err != nil || !ok {
+		t.Fatalf("expected to find session, got %v %v", ok, err)
+	}
+	if string(found) != string(b) {
+		t.Error("found session data differs from committed data")
+	}
+
+	if _, ok, _ := store.FindCtx(ctx, "expired"); ok {
+		t.Error("expired session should not be found")
+	}
+
+	sessions, err := store.UserSessions(ctx, 1)
+	if err != nil {
+		t.Fatal("listing sessions failed:", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 session but got %d", len(sessions))
+	}
+	if sessions[0].UserAgent != "test agent" || sessions[0].IP != "127.0.0.1" || !sessions[0].LastSeen.Equal(lastSeen) {
+		t.Errorf("unexpected session details %+v", sessions[0])
+	}
+
+	if err := store.DeleteExpired(ctx); err != nil {
+		t.Error("delete expired sessions failed:", err)
+	}
+
+	if err := store.DeleteCtx(ctx, "token-one"); err != nil {
+		t.Error("delete session failed:", err)
+	}
+	if _, ok, _ := store.FindCtx(ctx, "token-one"); ok {
+		t.Error("deleted session should not be found")
+	}
+}
+
+func TestPostgresDBRepoSearchUsers(t *testing.T) {
+	for _, u := range []data.User{
+		{FirstName: "Jane", LastName: "Smith", Email: "jane@example.com", Password: "secret"},
+		{FirstName: "John", LastName: "Smith", Email: "john@example.com", Password: "secret"},
+		{FirstName: "Percent", LastName: "Sign", Email: "100%@example.com", Password: "secret"},
+	} {
+		if _, err := testRepo.InsertUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		name          string
+		query         string
+		page          int
+		pageSize      int
+		expectedCount int
+		expectedTotal int
+	}{
+		{"by last name", "smith", 1, 10, 2, 2},
+		{"by full name", "jane smith", 1, 10, 1, 1},
+		{"by email", "JOHN@", 1, 10, 1, 1},
+		{"wildcards are literal", "%", 1, 10, 1, 1},
+		{"second page", "smith", 2, 1, 1, 2},
+		{"past the end", "smith", 3, 1, 0, 2},
+	}
+
+	for _, e := range tests {
+		users, total, err := testRepo.SearchUsers(e.query, e.page, e.pageSize)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", e.name, err)
+			continue
+		}
+		if len(users) != e.expectedCount || total != e.expectedTotal {
+			t.Errorf("%s: expected %d of %d users, got %d of %d", e.name, e.expectedCount, e.expectedTotal, len(users), total)
+		}
+	}
+}
@@ -3,12 +3,30 @@ package dbrepo
 import (
 	"database/sql"
 	"errors"
+	"strings"
+	"sync"
 	"time"
 
 	"webapp/pkg/data"
 )
 
-type TestDBRepo struct{}
+type TestDBRepo struct {
+	mu sync.Mutex
+	// the profile pictures set with InsertUserImage, by user id
+	images map[int]string
+	// the API keys inserted, in order
+	apiKeys []data.APIKey
+	// the OpenID Connect clients, codes and tokens inserted
+	oauthClients []data.OAuthClient
+	authCodes    []data.AuthCode
+	oauthTokens  []data.OAuthToken
+	// the identities at external providers linked to users
+	identities []data.UserIdentity
+	// the passkeys registered, in order
+	passkeys []data.Passkey
+	// the nonces of the challenges answered
+	challenges map[string]time.Time
+}
 
 func (m *TestDBRepo) Connection() *sql.DB {
 	return nil
@@ -20,6 +38,29 @@ func (m *TestDBRepo) AllUsers() ([]*data.User, error) {
 	return users, nil
 }
 
+func (m *TestDBRepo) SearchUsers(query string, page, pageSize int) ([]*data.User, int, error) {
+	var users []*data.User
+	for id := 1; id <= 2; id++ {
+		user, _ := m.GetUser(id)
+		text := strings.ToLower(user.FirstName + " " + user.LastName + " " + user.Email)
+		if strings.Contains(text, strings.ToLower(query)) {
+			users = append(users, user)
+		}
+	}
+
+	total := len(users)
+	start := (page - 1) * pageSize
+	if start < 0 || start >= total {
+		return nil, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	return users[start:end], total, nil
+}
+
 func (m *TestDBRepo) GetUser(id int) (*data.User, error) {
 	if id == 1 {
 
@@ -28,10 +69,24 @@ func (m *TestDBRepo) GetUser(id int) (*data.User, error) {
 			FirstName: "Admin",
 			LastName:  "User",
 			Email:     "admin@example.com",
+			Password:  "$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK",
+			IsAdmin:   1,
+		}
+		user.ProfilePic.FileName = m.image(id)
+		return &user, nil
+	}
+	if id == 2 {
+		user := data.User{
+			ID:        2,
+			FirstName: "Regular",
+			LastName:  "User",
+			Email:     "user@example.com",
+			Password:  "$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK",
 		}
+		user.ProfilePic.FileName = m.image(id)
 		return &user, nil
 	}
-	return nil, errors.New("user not found")
+	return nil, sql.ErrNoRows
 }
 
 func (m *TestDBRepo) GetUserByEmail(email string) (*data.User, error) {
@@ -48,18 +103,39 @@ func (m *TestDBRepo) GetUserByEmail(email string) (*data.User, error) {
 		}
 		return &user, nil
 	}
+	if email == "user@example.com" {
+		user := data.User{
+			ID:        2,
+			FirstName: "regular",
+			LastName:  "user",
+			Email:     "user@example.com",
+			Password:  "$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK",
+			IsAdmin:   0,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		return &user, nil
+	}
 
-	return nil, errors.New("not found")
+	return nil, sql.ErrNoRows
 }
 
 func (m *TestDBRepo) UpdateUser(u data.User) error {
-	if u.ID == 1 {
+	if u.ID == 1 || u.ID == 2 {
 		return nil
 	}
 
 	return errors.New("update failed - no user found")
 }
 
+func (m *TestDBRepo) PatchUser(id int, p data.UserPatch) error {
+	if id == 1 || id == 2 {
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
 func (m *TestDBRepo) DeleteUser(id int) error {
 	return nil
 }
@@ -73,5 +149,27 @@ func (m *TestDBRepo) ResetPassword(id int, password string) error {
 }
 
 func (m *TestDBRepo) InsertUserImage(i data.UserImage) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.images == nil {
+		m.images = make(map[int]string)
+	}
+	m.images[i.UserID] = i.FileName
 	return 1, nil
 }
+
+func (m *TestDBRepo) DeleteUserImage(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.images, userID)
+	return nil
+}
+
+func (m *TestDBRepo) image(userID int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.images[userID]
+}
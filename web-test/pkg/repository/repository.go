@@ -1,7 +1,11 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
 
 	"webapp/pkg/data"
 )
@@ -9,11 +13,76 @@ import (
 type DatabaseRepo interface {
 	Connection() *sql.DB
 	AllUsers() ([]*data.User, error)
+	SearchUsers(query string, page, pageSize int) ([]*data.User, int, error)
 	GetUser(id int) (*data.User, error)
 	GetUserByEmail(email string) (*data.User, error)
 	UpdateUser(u data.User) error
+	// PatchUser changes only the fields set in p, returning sql.ErrNoRows
+	// if there is no user with id.
+	PatchUser(id int, p data.UserPatch) error
 	DeleteUser(id int) error
 	InsertUser(u data.User) (int, error)
 	ResetPassword(id int, password string) error
 	InsertUserImage(i data.UserImage) (int, error)
+	// DeleteUserImage removes the profile picture of a user, if they have
+	// one.
+	DeleteUserImage(userID int) error
+
+	InsertAPIKey(k data.APIKey) (int, error)
+	// UserAPIKeys lists the API keys of a user, newest first.
+	UserAPIKeys(userID int) ([]data.APIKey, error)
+	// GetAPIKeyByPrefix returns the API key with prefix, or sql.ErrNoRows.
+	GetAPIKeyByPrefix(prefix string) (*data.APIKey, error)
+	// TouchAPIKey records when an API key was last used.
+	TouchAPIKey(id int, usedAt time.Time) error
+	// DeleteAPIKey revokes an API key of a user, returning sql.ErrNoRows if
+	// the user has no key with id.
+	DeleteAPIKey(userID, id int) error
+
+	InsertOAuthClient(c data.OAuthClient) error
+	AllOAuthClients() ([]data.OAuthClient, error)
+	// GetOAuthClient returns the client with id, or sql.ErrNoRows.
+	GetOAuthClient(id string) (*data.OAuthClient, error)
+	// DeleteOAuthClient removes a client with its codes and tokens,
+	// returning sql.ErrNoRows if there is no client with id.
+	DeleteOAuthClient(id string) error
+	InsertAuthCode(c data.AuthCode) error
+	// TakeAuthCode removes the authorization code with hash and returns
+	// it, so it can only be used once, or returns sql.ErrNoRows.
+	TakeAuthCode(hash []byte) (*data.AuthCode, error)
+	InsertOAuthToken(t data.OAuthToken) (int, error)
+	// GetOAuthToken returns the token with hash, or sql.ErrNoRows.
+	GetOAuthToken(hash []byte) (*data.OAuthToken, error)
+	// DeleteOAuthToken revokes a token, returning sql.ErrNoRows if there is
+	// no token with id.
+	DeleteOAuthToken(id int) error
+
+	// GetUserIdentity returns the identity with subject at the external
+	// provider, or sql.ErrNoRows.
+	GetUserIdentity(provider, subject string) (*data.UserIdentity, error)
+	InsertUserIdentity(i data.UserIdentity) (int, error)
+	// UserIdentities lists the identities linked to a user, oldest first.
+	UserIdentities(userID int) ([]data.UserIdentity, error)
+
+	InsertPasskey(p data.Passkey) (int, error)
+	// UserPasskeys lists the passkeys of a user, oldest first.
+	UserPasskeys(userID int) ([]data.Passkey, error)
+	// GetPasskeyByCredentialID returns the passkey with the credential id
+	// an authenticator sent, or sql.ErrNoRows.
+	GetPasskeyByCredentialID(credentialID []byte) (*data.Passkey, error)
+	// UsePasskey records the sign count of a passkey which was just used.
+	UsePasskey(id int, signCount uint32, usedAt time.Time) error
+	// DeletePasskey removes a passkey of a user, returning sql.ErrNoRows if
+	// the user has no passkey with id.
+	DeletePasskey(userID, id int) error
+	// UseChallenge records that the challenge with nonce, valid until
+	// expiresAt, was answered, and reports whether it was answered before.
+	UseChallenge(nonce []byte, expiresAt time.Time) (used bool, err error)
+}
+
+// SessionStore keeps the web application's sessions, and can list the
+// sessions of a user so they can be reviewed and revoked.
+type SessionStore interface {
+	scs.CtxStore
+	UserSessions(ctx context.Context, userID int) ([]data.Session, error)
 }
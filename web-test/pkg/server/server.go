@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"webapp/pkg/config"
+)
+
+// Server wraps an http.Server with the timeouts, TLS settings and graceful
+// shutdown behaviour shared by the web and api binaries.
+type Server struct {
+	HTTP     *http.Server
+	Redirect *http.Server
+
+	cfg *config.Config
+}
+
+// New returns a Server listening on port and serving handler, configured from cfg.
+func New(cfg *config.Config, port int, handler http.Handler) *Server {
+	s := &Server{
+		cfg: cfg,
+		HTTP: &http.Server{
+			Addr:              fmt.Sprintf(":%d", port),
+			Handler:           handler,
+			ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+			ReadHeaderTimeout: time.Duration(cfg.Server.ReadTimeout),
+			WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+			IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+		},
+	}
+
+	if cfg.TLS.Enabled() && cfg.TLS.RedirectPort > 0 {
+		s.Redirect = &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.TLS.RedirectPort),
+			Handler:           RedirectToHTTPS(port),
+			ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+			ReadHeaderTimeout: time.Duration(cfg.Server.ReadTimeout),
+			WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+			IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+		}
+	}
+
+	return s
+}
+
+// Run serves until SIGINT or SIGTERM is received, then waits for in-flight
+// requests to finish before returning.
+func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return s.RunContext(ctx)
+}
+
+// RunContext serves until ctx is cancelled, then shuts down gracefully.
+func (s *Server) RunContext(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.HTTP.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until ctx is cancelled, then shuts down gracefully.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	if s.cfg.TLS.Enabled() {
+		tlsConfig, err := s.tlsConfig()
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		s.HTTP.TLSConfig = tlsConfig
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	errs := make(chan error, 2)
+
+	go func() {
+		errs <- s.HTTP.Serve(ln)
+	}()
+
+	if s.Redirect != nil {
+		go func() {
+			errs <- s.Redirect.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, http.ErrServerClosed) {
+			_ = s.shutdown()
+			return err
+		}
+	case <-ctx.Done():
+		slog.Info("shutting down, waiting for in-flight requests")
+	}
+
+	return s.shutdown()
+}
+
+func (s *Server) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.Server.ShutdownTimeout))
+	defer cancel()
+
+	if s.Redirect != nil {
+		_ = s.Redirect.Shutdown(ctx)
+	}
+
+	return s.HTTP.Shutdown(ctx)
+}
+
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+
+	if s.cfg.TLS.CertFile != "" {
+		cert, err = tls.LoadX509KeyPair(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
+	} else {
+		cert, err = SelfSignedCertificate("localhost", "127.0.0.1", "::1", s.cfg.Domain)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// RedirectToHTTPS returns a handler which sends every request to the same
+// host and path over https on httpsPort.
+func RedirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"webapp/pkg/config"
+)
+
+func startServer(t *testing.T, cfg *config.Config, handler http.Handler) (string, context.CancelFunc, chan error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := New(cfg, 0, handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx, ln)
+	}()
+
+	return ln.Addr().String(), cancel, done
+}
+
+func TestServer_drainsInFlightRequests(t *testing.T) {
+	cfg := config.Default()
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	})
+
+	addr, cancel, done := startServer(t, cfg, handler)
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		result <- string(body)
+	}()
+
+	<-started
+	cancel()
+
+	if got := <-result; got != "done" {
+		t.Errorf("expected in-flight request to complete, got %q", got)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("expected clean shutdown, got %s", err)
+	}
+}
+
+func TestServer_selfSignedTLS(t *testing.T) {
+	cfg := config.Default()
+	cfg.TLS.SelfSigned = true
+
+	addr, cancel, done := startServer(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		t.Fatal("expected a tls connection")
+	}
+
+	if err := resp.TLS.PeerCertificates[0].VerifyHostname("localhost"); err != nil {
+		t.Errorf("certificate not valid for localhost: %s", err)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	var tests = []struct {
+		name     string
+		port     int
+		target   string
+		expected string
+	}{
+		{"default port", 443, "http://example.com:8080/user/profile?a=b", "https://example.com/user/profile?a=b"},
+		{"custom port", 8443, "http://example.com/", "https://example.com:8443/"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.target, nil)
+		rr := httptest.NewRecorder()
+
+		RedirectToHTTPS(e.port).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusPermanentRedirect {
+			t.Errorf("%s: expected status %d but got %d", e.name, http.StatusPermanentRedirect, rr.Code)
+		}
+
+		if loc := rr.Header().Get("Location"); loc != e.expected {
+			t.Errorf("%s: expected location %s but got %s", e.name, e.expected, loc)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package uploads stores the files users upload, for both the web
+// application and the api, so they are checked and kept the same way.
+//
+// Files are stored under a new random name, so uploads with the same name
+// never overwrite each other. The extension is that of the type found in
+// their content, not the one the client gave, so a file is never served as
+// something other than what it is.
+package uploads
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"webapp/pkg/data"
+	"webapp/pkg/forms"
+	"webapp/pkg/repository"
+)
+
+// ImageTypes are the kinds of image accepted as profile pictures.
+var ImageTypes = []string{"image/gif", "image/jpeg", "image/png"}
+
+// imageExtensions are the extensions files of ImageTypes are stored with.
+// Other files are stored without one.
+var imageExtensions = map[string]string{
+	"image/gif":  ".gif",
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// File is an uploaded file which was stored.
+type File struct {
+	// OriginalFileName is the name the client gave the file.
+	OriginalFileName string
+	// FileName is the name it is stored under, in the upload directory.
+	FileName string
+	FileSize int64
+}
+
+// SaveAll stores every file of a parsed multipart form in dir.
+func SaveAll(dir string, files map[string][]*multipart.FileHeader) ([]*File, error) {
+	var stored []*File
+	for _, headers := range files {
+		for _, hdr := range headers {
+			f, err := Save(dir, hdr)
+			if err != nil {
+				return stored, err
+			}
+			stored = append(stored, f)
+		}
+	}
+	return stored, nil
+}
+
+// Save stores the uploaded file in dir.
+func Save(dir string, hdr *multipart.FileHeader) (*File, error) {
+	in, err := hdr.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	// the type is found from the first bytes, as FileType finds it
+	head := make([]byte, 512)
+	n, err := io.ReadFull(in, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	name, err := newFileName(http.DetectContentType(head))
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	size, err := io.Copy(out, io.MultiReader(bytes.NewReader(head), in))
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return nil, err
+	}
+
+	return &File{OriginalFileName: hdr.Filename, FileName: name, FileSize: size}, nil
+}
+
+// storedName matches the names Save gives files, and gave them when it
+// kept the extension the client sent.
+var storedName = regexp.MustCompile(`^[0-9a-f]{32}(\.[0-9a-z]+)?$`)
+
+// newFileName returns a random name for a file of contentType.
+func newFileName(contentType string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b) + imageExtensions[contentType], nil
+}
+
+// ContentType returns the type to serve the stored file fileName as: the
+// image type of its extension, or application/octet-stream for anything
+// else, such as files stored before Save chose the extension.
+func ContentType(fileName string) string {
+	ext := filepath.Ext(fileName)
+	for contentType, e := range imageExtensions {
+		if e == ext {
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// Serve serves the files stored in dir, each as the type ContentType gives
+// it, and tells browsers not to guess another. Directories are not found,
+// so the files stored cannot be listed.
+func Serve(dir string) http.Handler {
+	root := http.Dir(dir)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		f, err := root.Open(r.URL.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentType(info.Name()))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	})
+}
+
+// Remove deletes a file stored by Save. Names Save did not make, such as
+// those of files uploaded before it existed, which other users may share,
+// are left alone, as is a file which is already gone.
+func Remove(dir, fileName string) error {
+	if !storedName.MatchString(fileName) {
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(dir, fileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// FileHeader wraps content, e.g. sent base64 encoded in a JSON body, as an
+// uploaded file, so it can be checked and saved like one sent as multipart.
+func FileHeader(field, fileName string, content []byte) (*multipart.FileHeader, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, field, filepath.Base(fileName)))
+	h.Set("Content-Type", "application/octet-stream")
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(content); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	mf, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(int64(len(content)) + 1024)
+	if err != nil {
+		return nil, err
+	}
+	return mf.File[field][0], nil
+}
+
+// CheckImage checks that an image of at most maxSize bytes was uploaded as
+// field of form, looking at its content rather than its name.
+func CheckImage(form *forms.Form, field string, maxSize int64) {
+	form.FileRequired(field)
+	form.MaxFileSize(field, maxSize)
+	form.FileType(field, ImageTypes...)
+}
+
+// SetProfilePic stores the uploaded image in dir and makes it the profile
+// picture of user, removing the picture it replaces. user is updated too.
+func SetProfilePic(db repository.DatabaseRepo, dir string, user *data.User, hdr *multipart.FileHeader) error {
+	f, err := Save(dir, hdr)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.InsertUserImage(data.UserImage{UserID: user.ID, FileName: f.FileName}); err != nil {
+		_ = Remove(dir, f.FileName)
+		return err
+	}
+
+	old := user.ProfilePic.FileName
+	user.ProfilePic = data.UserImage{UserID: user.ID, FileName: f.FileName}
+	return Remove(dir, old)
+}
+
+// DeleteProfilePic removes the profile picture of user, which is updated
+// too.
+func DeleteProfilePic(db repository.DatabaseRepo, dir string, user *data.User) error {
+	if err := db.DeleteUserImage(user.ID); err != nil {
+		return err
+	}
+
+	old := user.ProfilePic.FileName
+	user.ProfilePic = data.UserImage{}
+	return Remove(dir, old)
+}
@@ -0,0 +1,240 @@
+package uploads
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"webapp/pkg/forms"
+	"webapp/pkg/repository/dbrepo"
+)
+
+func pngBytes(t *testing.T) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestSave(t *testing.T) {
+	dir := t.TempDir()
+
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	var jpg, gf bytes.Buffer
+	if err := jpeg.Encode(&jpg, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.Encode(&gf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	html := []byte("<html><script>alert(1)</script></html>")
+
+	var tests = []struct {
+		name    string
+		content []byte
+		fileExt string
+	}{
+		{"img.png", pngBytes(t), ".png"},
+		{"Photo.JPG", jpg.Bytes(), ".jpg"},
+		{"anim.gif", gf.Bytes(), ".gif"},
+		{"no-extension", pngBytes(t), ".png"},
+		{"../../escape.png", pngBytes(t), ".png"},
+		{"page.html", html, ""},
+		{"page.png", html, ""},
+		{"picture.html", pngBytes(t), ".png"},
+		{"empty.png", []byte{}, ""},
+	}
+
+	for _, e := range tests {
+		hdr, err := FileHeader("image", e.name, e.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := Save(dir, hdr)
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if !storedName.MatchString(f.FileName) || filepath.Ext(f.FileName) != e.fileExt {
+			t.Errorf("%s: expected extension %q but got name %q", e.name, e.fileExt, f.FileName)
+		}
+		if f.FileSize != int64(len(e.content)) {
+			t.Errorf("%s: expected size %d but got %d", e.name, len(e.content), f.FileSize)
+		}
+		if b, err := os.ReadFile(filepath.Join(dir, f.FileName)); err != nil || !bytes.Equal(b, e.content) {
+			t.Errorf("%s: file not stored: %v", e.name, err)
+		}
+	}
+
+	// the same name twice gives two files
+	a, _ := FileHeader("image", "img.png", []byte("a"))
+	b, _ := FileHeader("image", "img.png", []byte("b"))
+	fa, _ := Save(dir, a)
+	fb, _ := Save(dir, b)
+	if fa.FileName == fb.FileName {
+		t.Error("expected uploads with the same name to be stored apart")
+	}
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+
+	hdr, _ := FileHeader("image", "img.png", pngBytes(t))
+	f, _ := Save(dir, hdr)
+	// stored before the extension was found from the content
+	if err := os.WriteFile(filepath.Join(dir, "0123456789abcdef0123456789abcdef.html"), []byte("<html><script>alert(1)</script></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name         string
+		path         string
+		expectedType string
+	}{
+		{"image", "/" + f.FileName, "image/png"},
+		{"html", "/0123456789abcdef0123456789abcdef.html", "application/octet-stream"},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		Serve(dir).ServeHTTP(rr, httptest.NewRequest("GET", e.path, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200 but got %d", e.name, rr.Code)
+		}
+		if rr.Header().Get("Content-Type") != e.expectedType {
+			t.Errorf("%s: expected type %s but got %s", e.name, e.expectedType, rr.Header().Get("Content-Type"))
+		}
+		if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("%s: expected nosniff", e.name)
+		}
+	}
+}
+
+func TestServe_notFound(t *testing.T) {
+	dir := t.TempDir()
+
+	hdr, _ := FileHeader("image", "img.png", pngBytes(t))
+	f, _ := Save(dir, hdr)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// none of these may list the files stored, or send the browser elsewhere
+	for _, path := range []string{"/", "/sub", "/sub/", "/" + f.FileName + "/", "/index.html", "/missing.png", "/../" + f.FileName + "x"} {
+		rr := httptest.NewRecorder()
+		Serve(dir).ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404 but got %d", path, rr.Code)
+		}
+		if strings.Contains(rr.Body.String(), f.FileName) {
+			t.Errorf("%s: expected the stored files not to be listed", path)
+		}
+		if rr.Header().Get("Content-Type") == "application/octet-stream" {
+			t.Errorf("%s: expected the error not to be served as a file", path)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	dir := t.TempDir()
+
+	hdr, _ := FileHeader("image", "img.png", []byte("content"))
+	f, _ := Save(dir, hdr)
+	if err := os.WriteFile(filepath.Join(dir, "legacy.png"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{f.FileName, f.FileName, "legacy.png", ""} {
+		if err := Remove(dir, name); err != nil {
+			t.Errorf("remove %q: %v", name, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, f.FileName)); !os.IsNotExist(err) {
+		t.Error("expected the stored file to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "legacy.png")); err != nil {
+		t.Error("expected a file Save did not name to be kept")
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content []byte
+		maxSize int64
+		valid   bool
+	}{
+		{"png", pngBytes(t), 1024, true},
+		{"too big", pngBytes(t), 10, false},
+		{"not an image", []byte("just some text"), 1024, false},
+		{"missing", nil, 1024, false},
+	}
+
+	for _, e := range tests {
+		mf := &multipart.Form{File: map[string][]*multipart.FileHeader{}}
+		if e.content != nil {
+			hdr, err := FileHeader("image", "img.png", e.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mf.File["image"] = []*multipart.FileHeader{hdr}
+		}
+
+		form := forms.FromMultipart(mf)
+		CheckImage(form, "image", e.maxSize)
+		if form.Valid() != e.valid {
+			t.Errorf("%s: expected valid to be %v, errors %v", e.name, e.valid, form.Errors)
+		}
+	}
+}
+
+func TestSetProfilePic(t *testing.T) {
+	dir := t.TempDir()
+	db := &dbrepo.TestDBRepo{}
+	user, _ := db.GetUser(2)
+
+	first, _ := FileHeader("image", "first.png", pngBytes(t))
+	if err := SetProfilePic(db, dir, user, first); err != nil {
+		t.Fatal(err)
+	}
+	old := user.ProfilePic.FileName
+	if saved, _ := db.GetUser(2); saved.ProfilePic.FileName != old || old == "" {
+		t.Errorf("expected the picture %q to be saved, got %q", old, saved.ProfilePic.FileName)
+	}
+
+	second, _ := FileHeader("image", "second.png", pngBytes(t))
+	if err := SetProfilePic(db, dir, user, second); err != nil {
+		t.Fatal(err)
+	}
+	if user.ProfilePic.FileName == old {
+		t.Error("expected a new picture")
+	}
+	if _, err := os.Stat(filepath.Join(dir, old)); !os.IsNotExist(err) {
+		t.Error("expected the replaced picture to be removed")
+	}
+
+	current := user.ProfilePic.FileName
+	if err := DeleteProfilePic(db, dir, user); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := db.GetUser(2); saved.ProfilePic.FileName != "" || user.ProfilePic.FileName != "" {
+		t.Error("expected the picture to be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, current)); !os.IsNotExist(err) {
+		t.Error("expected the deleted picture to be removed")
+	}
+}
@@ -0,0 +1,147 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Authenticators encode attestation objects and public keys in CBOR (RFC
+// 8949). This is just enough of a decoder for them: definite lengths, and
+// integers, byte and text strings, arrays, maps and simple values. Maps
+// decode to map[any]any with int64 or string keys.
+
+// maxCBORDepth limits how deeply arrays and maps may nest.
+const maxCBORDepth = 8
+
+var errCBOR = errors.New("webauthn: malformed CBOR")
+
+// decodeCBOR decodes the data item at the start of b, and returns it with
+// the bytes following it.
+func decodeCBOR(b []byte) (any, []byte, error) {
+	d := cborDecoder{b: b}
+	v, err := d.item(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, d.b, nil
+}
+
+type cborDecoder struct {
+	b []byte
+}
+
+func (d *cborDecoder) item(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", errCBOR)
+	}
+
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer out of range", errCBOR)
+		}
+		return int64(n), nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer out of range", errCBOR)
+		}
+		return -1 - int64(n), nil
+	case 2, 3:
+		s, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(s), nil
+		}
+		return s, nil
+	case 4:
+		// every item takes at least a byte, which bounds what is allocated
+		if n > uint64(len(d.b)) {
+			return nil, fmt.Errorf("%w: truncated array", errCBOR)
+		}
+		a := make([]any, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case 5:
+		if n > uint64(len(d.b)) {
+			return nil, fmt.Errorf("%w: truncated map", errCBOR)
+		}
+		m := make(map[any]any, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: map key of type %T", errCBOR, k)
+			}
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case 7:
+		switch n {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unsupported item of major type %d", errCBOR, major)
+}
+
+// head reads the initial byte of an item and its argument.
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if len(d.b) == 0 {
+		return 0, 0, fmt.Errorf("%w: truncated", errCBOR)
+	}
+	major, info := d.b[0]>>5, d.b[0]&0x1f
+	d.b = d.b[1:]
+
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		// indefinite lengths, and the reserved values
+		return 0, 0, fmt.Errorf("%w: unsupported additional information %d", errCBOR, info)
+	}
+
+	size := 1 << (info - 24)
+	arg, err := d.take(uint64(size))
+	if err != nil {
+		return 0, 0, err
+	}
+	var buf [8]byte
+	copy(buf[8-size:], arg)
+	return major, binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.b)) {
+		return nil, fmt.Errorf("%w: truncated", errCBOR)
+	}
+	s := d.b[:n]
+	d.b = d.b[n:]
+	return s, nil
+}
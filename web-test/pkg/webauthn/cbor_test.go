@@ -0,0 +1,46 @@
+package webauthn
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	var tests = []struct {
+		name     string
+		in       []byte
+		expected any
+		rest     int
+		err      bool
+	}{
+		{"small integer", []byte{0x17}, int64(23), 0, false},
+		{"two byte integer", []byte{0x19, 0x01, 0x00}, int64(256), 0, false},
+		{"negative integer", []byte{0x38, 0x63}, int64(-100), 0, false},
+		{"byte string", []byte{0x42, 0x01, 0x02}, []byte{1, 2}, 0, false},
+		{"text string", []byte{0x62, 'h', 'i'}, "hi", 0, false},
+		{"array", []byte{0x82, 0x01, 0xf5}, []any{int64(1), true}, 0, false},
+		{"map", []byte{0xa2, 0x01, 0x02, 0x61, 'a', 0xf6}, map[any]any{int64(1): int64(2), "a": nil}, 0, false},
+		{"trailing bytes", []byte{0x01, 0x02, 0x03}, int64(1), 2, false},
+		{"truncated string", []byte{0x45, 0x01}, nil, 0, true},
+		{"truncated head", []byte{0x19, 0x01}, nil, 0, true},
+		{"huge array", []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, nil, 0, true},
+		{"indefinite length", []byte{0x5f, 0x41, 0x01, 0xff}, nil, 0, true},
+		{"array key", []byte{0xa1, 0x80, 0x01}, nil, 0, true},
+		{"float", []byte{0xf9, 0x3c, 0x00}, nil, 0, true},
+		{"nested too deeply", []byte{0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81}, nil, 0, true},
+	}
+
+	for _, e := range tests {
+		v, rest, err := decodeCBOR(e.in)
+		if e.err {
+			if !errors.Is(err, errCBOR) {
+				t.Errorf("%s: expected malformed CBOR but got %v %v", e.name, v, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(v, e.expected) || len(rest) != e.rest {
+			t.Errorf("%s: expected %v with %d bytes left but got %v with %d, %v", e.name, e.expected, e.rest, v, len(rest), err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package webauthn
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"time"
+	"webapp/pkg/repository"
+)
+
+// ErrChallenge is returned when a challenge was not issued by Challenges,
+// was issued for something else, or has expired.
+var ErrChallenge = errors.New("webauthn: invalid or expired challenge")
+
+// Challenges issues challenges which carry their own expiry, purpose and
+// user, sealed with a key, for servers which keep no session to remember
+// them in, such as the api.
+//
+// Issuing a challenge stores nothing. Take records the nonce of each
+// challenge answered until it expires, so a challenge can only be answered
+// once, as one popped from a session.
+type Challenges struct {
+	key []byte
+
+	// now is time.Now, but for tests
+	now func() time.Time
+}
+
+// NewChallenges returns Challenges sealed with a key derived from secret,
+// so that a challenge is never mistaken for anything else signed with it.
+func NewChallenges(secret string) *Challenges {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("webauthn challenge"))
+	return &Challenges{key: mac.Sum(nil), now: time.Now}
+}
+
+const (
+	challengeNonceSize = 16
+	challengeSize      = challengeNonceSize + 8 + 8 + sha256.Size
+)
+
+// New returns a challenge for purpose, such as "login", which is valid for
+// Timeout. userID is the user expected to answer, or 0 for anyone.
+func (c *Challenges) New(purpose string, userID int) ([]byte, error) {
+	b := make([]byte, challengeNonceSize, challengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	b = binary.BigEndian.AppendUint64(b, uint64(c.now().Add(Timeout).Unix()))
+	b = binary.BigEndian.AppendUint64(b, uint64(userID))
+	return append(b, c.mac(b, purpose)...), nil
+}
+
+// Check checks challenge was issued for purpose and has not expired, and
+// returns the user expected to answer it.
+func (c *Challenges) Check(challenge []byte, purpose string) (int, error) {
+	if len(challenge) != challengeSize {
+		return 0, ErrChallenge
+	}
+	payload, sum := challenge[:challengeSize-sha256.Size], challenge[challengeSize-sha256.Size:]
+	if !hmac.Equal(sum, c.mac(payload, purpose)) {
+		return 0, ErrChallenge
+	}
+	expiry := int64(binary.BigEndian.Uint64(payload[challengeNonceSize:]))
+	if c.now().Unix() >= expiry {
+		return 0, ErrChallenge
+	}
+	return int(binary.BigEndian.Uint64(payload[challengeNonceSize+8:])), nil
+}
+
+// Take checks challenge as Check does, and records in db that it was
+// answered, so it cannot be answered again. The challenge is used up even
+// if what the authenticator answered turns out to be wrong.
+func (c *Challenges) Take(db repository.DatabaseRepo, challenge []byte, purpose string) (int, error) {
+	userID, err := c.Check(challenge, purpose)
+	if err != nil {
+		return 0, err
+	}
+
+	expiry := int64(binary.BigEndian.Uint64(challenge[challengeNonceSize:]))
+	used, err := db.UseChallenge(challenge[:challengeNonceSize], time.Unix(expiry, 0))
+	if err != nil {
+		return 0, err
+	}
+	if used {
+		return 0, ErrChallenge
+	}
+	return userID, nil
+}
+
+func (c *Challenges) mac(payload []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
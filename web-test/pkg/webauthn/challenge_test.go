@@ -0,0 +1,69 @@
+package webauthn
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"webapp/pkg/repository/dbrepo"
+)
+
+func TestChallenges(t *testing.T) {
+	challenges := NewChallenges("secret")
+
+	c, err := challenges.New("login", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, err := challenges.Check(c, "login"); err != nil || userID != 7 {
+		t.Errorf("expected user 7 but got %d %v", userID, err)
+	}
+
+	altered := append([]byte(nil), c...)
+	altered[0] ^= 1
+
+	later := NewChallenges("secret")
+	later.now = func() time.Time { return time.Now().Add(Timeout) }
+
+	var tests = []struct {
+		name       string
+		challenges *Challenges
+		challenge  []byte
+		purpose    string
+	}{
+		{"other purpose", challenges, c, "register"},
+		{"other secret", NewChallenges("other"), c, "login"},
+		{"altered", challenges, altered, "login"},
+		{"truncated", challenges, c[:10], "login"},
+		{"expired", later, c, "login"},
+	}
+
+	for _, e := range tests {
+		if _, err := e.challenges.Check(e.challenge, e.purpose); !errors.Is(err, ErrChallenge) {
+			t.Errorf("%s: expected an invalid challenge but got %v", e.name, err)
+		}
+	}
+}
+
+func TestChallenges_Take(t *testing.T) {
+	challenges := NewChallenges("secret")
+	db := &dbrepo.TestDBRepo{}
+
+	c, err := challenges.New("register", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := challenges.New("register", 7)
+
+	if _, err := challenges.Take(db, c, "login"); !errors.Is(err, ErrChallenge) {
+		t.Errorf("expected a challenge for something else to be refused but got %v", err)
+	}
+	if userID, err := challenges.Take(db, c, "register"); err != nil || userID != 7 {
+		t.Errorf("expected user 7 but got %d %v", userID, err)
+	}
+	if _, err := challenges.Take(db, c, "register"); !errors.Is(err, ErrChallenge) {
+		t.Errorf("expected a challenge answered twice to be refused but got %v", err)
+	}
+	if _, err := challenges.Take(db, other, "register"); err != nil {
+		t.Errorf("expected another challenge to be good but got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms (RFC 9053) of the keys passkeys may have, most preferred
+// first.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Algorithms lists the algorithms asked for when registering a passkey.
+var Algorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key types and parameters, by their labels.
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	// of EC2 and OKP keys
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	// of RSA keys
+	coseN = -1
+	coseE = -2
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// minRSABits is the smallest RSA key accepted.
+const minRSABits = 2048
+
+// publicKey is the public key of a passkey, with the algorithm its
+// signatures are made with.
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE encoded key, which must be the whole of b.
+func parsePublicKey(b []byte) (*publicKey, error) {
+	v, rest, err := decodeCBOR(b)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[any]any)
+	if !ok || len(rest) != 0 {
+		return nil, errors.New("webauthn: public key is not a COSE key")
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+	crv, _ := m[int64(coseCrv)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256 && crv == crvP256:
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("webauthn: malformed P-256 key")
+		}
+		// parsing the uncompressed point checks it is on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("webauthn: %w", err)
+		}
+		return &publicKey{alg: alg, key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA && crv == crvEd25519:
+		x, _ := m[int64(coseX)].([]byte)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("webauthn: malformed Ed25519 key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseN)].([]byte)
+		e, _ := m[int64(coseE)].([]byte)
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSABits || len(e) == 0 || len(e) > 4 || key.E < 3 || key.E%2 == 0 {
+			return nil, errors.New("webauthn: unacceptable RSA key")
+		}
+		return &publicKey{alg: alg, key: key}, nil
+	}
+
+	return nil, fmt.Errorf("webauthn: unsupported key type %d with algorithm %d", kty, alg)
+}
+
+// verify checks sig is a signature of signed made with the key.
+func (k *publicKey) verify(signed, sig []byte) error {
+	ok := false
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		ok = ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, signed, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !ok {
+		return errors.New("webauthn: wrong signature")
+	}
+	return nil
+}
@@ -0,0 +1,467 @@
+// Package webauthn lets users log in with passkeys (Web Authentication,
+// https://www.w3.org/TR/webauthn-3/). The site hands the browser options
+// for navigator.credentials.create or get, and verifies what the
+// authenticator answers: at registration its new public key, and at login a
+// signature of the challenge made with it.
+//
+// Attestation is not asked for, so any authenticator may be registered;
+// passkeys are trusted on the word of the user who registers them, as
+// passwords are.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"webapp/pkg/config"
+	"webapp/pkg/data"
+	"webapp/pkg/repository"
+)
+
+// Timeout is how long users have to answer a challenge.
+const Timeout = 5 * time.Minute
+
+// ErrInvalid is returned, wrapped, when what an authenticator answered
+// does not verify, or names a passkey which is not registered.
+var ErrInvalid = errors.New("webauthn: invalid credential")
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrInvalid}, args...)...)
+}
+
+// RelyingParty is the site passkeys are registered with.
+type RelyingParty struct {
+	config.WebAuthnConfig
+}
+
+// New returns the relying party described by cfg.
+func New(cfg config.WebAuthnConfig) *RelyingParty {
+	return &RelyingParty{WebAuthnConfig: cfg}
+}
+
+// Bytes are binary values, which WebAuthn JSON writes in unpadded base64url.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON accepts padded base64url too, since some browser libraries
+// pad.
+func (b *Bytes) UnmarshalJSON(in []byte) error {
+	var s string
+	if err := json.Unmarshal(in, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// NewChallenge returns a random challenge.
+func NewChallenge() ([]byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// UserHandle returns the handle passkeys of the user with userID carry. It
+// is their id, which says nothing about them.
+func UserHandle(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
+
+// The options of the ceremonies, in the JSON form of
+// PublicKeyCredentialCreationOptions and PublicKeyCredentialRequestOptions.
+type (
+	CreationOptions struct {
+		Challenge              Bytes                  `json:"challenge"`
+		RP                     RPEntity               `json:"rp"`
+		User                   UserEntity             `json:"user"`
+		PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+		Timeout                int64                  `json:"timeout"`
+		ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+		AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+		Attestation            string                 `json:"attestation"`
+	}
+
+	RequestOptions struct {
+		Challenge        Bytes                  `json:"challenge"`
+		Timeout          int64                  `json:"timeout"`
+		RPID             string                 `json:"rpId"`
+		AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+		UserVerification string                 `json:"userVerification"`
+	}
+
+	RPEntity struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	UserEntity struct {
+		ID          Bytes  `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	}
+
+	CredentialParameter struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	}
+
+	CredentialDescriptor struct {
+		Type string `json:"type"`
+		ID   Bytes  `json:"id"`
+	}
+
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	}
+)
+
+// CreationOptions returns the options to register a passkey of user, who
+// already has the passkeys in existing.
+func (rp *RelyingParty) CreationOptions(user *data.User, challenge []byte, existing []data.Passkey) CreationOptions {
+	opts := CreationOptions{
+		Challenge: challenge,
+		RP:        RPEntity{ID: rp.RPID, Name: rp.RPName},
+		User: UserEntity{
+			ID:          UserHandle(user.ID),
+			Name:        user.Email,
+			DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+		},
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: []CredentialDescriptor{},
+		// passkeys are discoverable credentials, so users can log in without
+		// typing who they are
+		AuthenticatorSelection: AuthenticatorSelection{ResidentKey: "required", UserVerification: "preferred"},
+		Attestation:            "none",
+	}
+	for _, alg := range Algorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	// the same authenticator cannot be registered twice
+	for _, p := range existing {
+		opts.ExcludeCredentials = append(opts.ExcludeCredentials, CredentialDescriptor{Type: "public-key", ID: p.CredentialID})
+	}
+	return opts
+}
+
+// RequestOptions returns the options to log in with any passkey of the site.
+func (rp *RelyingParty) RequestOptions(challenge []byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RPID:             rp.RPID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "preferred",
+	}
+}
+
+// The answers of authenticators, in the JSON form of PublicKeyCredential
+// browsers give with toJSON.
+type (
+	RegistrationResponse struct {
+		ID                      string                       `json:"id"`
+		RawID                   Bytes                        `json:"rawId"`
+		Type                    string                       `json:"type"`
+		AuthenticatorAttachment string                       `json:"authenticatorAttachment,omitempty"`
+		ClientExtensionResults  map[string]any               `json:"clientExtensionResults"`
+		Response                AuthenticatorAttestationData `json:"response"`
+	}
+
+	AuthenticatorAttestationData struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AttestationObject Bytes `json:"attestationObject"`
+
+		// what browsers also extract from the attestation object
+		AuthenticatorData  Bytes    `json:"authenticatorData,omitempty"`
+		Transports         []string `json:"transports,omitempty"`
+		PublicKey          Bytes    `json:"publicKey,omitempty"`
+		PublicKeyAlgorithm int      `json:"publicKeyAlgorithm,omitempty"`
+	}
+
+	AssertionResponse struct {
+		ID                      string                     `json:"id"`
+		RawID                   Bytes                      `json:"rawId"`
+		Type                    string                     `json:"type"`
+		AuthenticatorAttachment string                     `json:"authenticatorAttachment,omitempty"`
+		ClientExtensionResults  map[string]any             `json:"clientExtensionResults"`
+		Response                AuthenticatorAssertionData `json:"response"`
+	}
+
+	AuthenticatorAssertionData struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle,omitempty"`
+	}
+)
+
+// clientData is what the browser says about the ceremony, which the
+// authenticator signs.
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   Bytes  `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func parseClientData(b []byte) (*clientData, error) {
+	var c clientData
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, invalid("client data: %v", err)
+	}
+	return &c, nil
+}
+
+// Challenge returns the challenge r answers, without checking anything.
+func (r *RegistrationResponse) Challenge() ([]byte, error) {
+	c, err := parseClientData(r.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	return c.Challenge, nil
+}
+
+// Challenge returns the challenge r answers, without checking anything.
+func (r *AssertionResponse) Challenge() ([]byte, error) {
+	c, err := parseClientData(r.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	return c.Challenge, nil
+}
+
+// checkClientData checks the client data of a ceremony of typ was made by
+// one of our pages, for challenge.
+func (rp *RelyingParty) checkClientData(b []byte, typ string, challenge []byte) error {
+	c, err := parseClientData(b)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c.Type != typ:
+		return invalid("ceremony %q instead of %q", c.Type, typ)
+	case len(challenge) == 0 || subtle.ConstantTimeCompare(c.Challenge, challenge) != 1:
+		return invalid("wrong challenge")
+	case !slices.Contains(rp.Origins, c.Origin):
+		return invalid("unexpected origin %q", c.Origin)
+	case c.CrossOrigin:
+		return invalid("made in a cross-origin frame")
+	}
+	return nil
+}
+
+// Flags of authenticator data.
+const (
+	flagUserPresent      = 0x01
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+// authenticatorData is what the authenticator says about the ceremony.
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	// of registrations, the new credential
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < 37 {
+		return nil, invalid("authenticator data too short")
+	}
+	ad := &authenticatorData{
+		rpIDHash:  b[:32],
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	rest := b[37:]
+
+	if ad.flags&flagAttestedCredData != 0 {
+		// the AAGUID of the authenticator model, then the credential
+		if len(rest) < 18 {
+			return nil, invalid("attested credential data too short")
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n == 0 || n > 1023 || len(rest) < n {
+			return nil, invalid("malformed credential id")
+		}
+		ad.credentialID, rest = rest[:n], rest[n:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, invalid("public key: %v", err)
+		}
+		ad.publicKey, rest = rest[:len(rest)-len(after)], after
+	}
+
+	// extensions are not asked for, and are ignored
+	if ad.flags&flagExtensionData == 0 && len(rest) != 0 {
+		return nil, invalid("trailing authenticator data")
+	}
+	return ad, nil
+}
+
+// checkAuthenticatorData checks the authenticator made b for our site, and
+// the user was there.
+func (rp *RelyingParty) checkAuthenticatorData(b []byte) (*authenticatorData, error) {
+	ad, err := parseAuthenticatorData(b)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(rp.RPID))
+	if !bytes.Equal(ad.rpIDHash, hash[:]) {
+		return nil, invalid("made for another relying party")
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return nil, invalid("user not present")
+	}
+	return ad, nil
+}
+
+// VerifyRegistration checks r registers a new passkey for challenge, and
+// returns it, without its user and name.
+func (rp *RelyingParty) VerifyRegistration(r RegistrationResponse, challenge []byte) (*data.Passkey, error) {
+	if r.Type != "public-key" {
+		return nil, invalid("credential of type %q", r.Type)
+	}
+	if err := rp.checkClientData(r.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	v, _, err := decodeCBOR(r.Response.AttestationObject)
+	if err != nil {
+		return nil, invalid("attestation object: %v", err)
+	}
+	attestation, _ := v.(map[any]any)
+	authData, _ := attestation["authData"].([]byte)
+
+	ad, err := rp.checkAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, invalid("no credential")
+	}
+	if !bytes.Equal(ad.credentialID, r.RawID) {
+		return nil, invalid("credential id does not match")
+	}
+	if _, err := parsePublicKey(ad.publicKey); err != nil {
+		return nil, invalid("%v", err)
+	}
+
+	return &data.Passkey{
+		CredentialID: ad.credentialID,
+		PublicKey:    ad.publicKey,
+		SignCount:    ad.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks r is a login with passkey p for challenge, and
+// returns the sign count of the authenticator.
+func (rp *RelyingParty) VerifyAssertion(r AssertionResponse, challenge []byte, p *data.Passkey) (uint32, error) {
+	if r.Type != "public-key" {
+		return 0, invalid("credential of type %q", r.Type)
+	}
+	if !bytes.Equal(r.RawID, p.CredentialID) {
+		return 0, invalid("another credential")
+	}
+	if len(r.Response.UserHandle) != 0 && !bytes.Equal(r.Response.UserHandle, UserHandle(p.UserID)) {
+		return 0, invalid("credential of another user")
+	}
+	if err := rp.checkClientData(r.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	ad, err := rp.checkAuthenticatorData(r.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(p.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(r.Response.ClientDataJSON)
+	signed := append(slices.Clip(r.Response.AuthenticatorData), clientDataHash[:]...)
+	if err := key.verify(signed, r.Response.Signature); err != nil {
+		return 0, invalid("%v", err)
+	}
+
+	// authenticators which count count up; one which does not has been
+	// cloned, or its answer replayed
+	if (ad.signCount != 0 || p.SignCount != 0) && ad.signCount <= p.SignCount {
+		return 0, invalid("sign count %d is not above %d", ad.signCount, p.SignCount)
+	}
+	return ad.signCount, nil
+}
+
+// Register verifies r, and stores the passkey it registers for user, called
+// name.
+func (rp *RelyingParty) Register(db repository.DatabaseRepo, user *data.User, name string, r RegistrationResponse, challenge []byte) (*data.Passkey, error) {
+	p, err := rp.VerifyRegistration(r, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.GetPasskeyByCredentialID(p.CredentialID)
+	if err == nil {
+		return nil, invalid("passkey already registered")
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	p.UserID = user.ID
+	p.Name = name
+	p.ID, err = db.InsertPasskey(*p)
+	if err != nil {
+		return nil, err
+	}
+	p.CreatedAt = time.Now()
+	return p, nil
+}
+
+// Login verifies r, records that its passkey was used, and returns the user
+// it belongs to.
+func (rp *RelyingParty) Login(db repository.DatabaseRepo, r AssertionResponse, challenge []byte) (*data.User, error) {
+	p, err := db.GetPasskeyByCredentialID(r.RawID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, invalid("unknown passkey")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signCount, err := rp.VerifyAssertion(r, challenge, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.UsePasskey(p.ID, signCount, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return db.GetUser(p.UserID)
+}
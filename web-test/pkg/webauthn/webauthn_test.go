@@ -0,0 +1,200 @@
+package webauthn_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"webapp/pkg/config"
+	"webapp/pkg/data"
+	"webapp/pkg/repository/dbrepo"
+	"webapp/pkg/webauthn"
+	"webapp/pkg/webauthn/webauthntest"
+)
+
+const origin = "https://app.example.com"
+
+func newRP() *webauthn.RelyingParty {
+	return webauthn.New(config.WebAuthnConfig{RPID: "example.com", RPName: "Web App", Origins: []string{origin}})
+}
+
+func challenge(t *testing.T) []byte {
+	t.Helper()
+	c, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// register registers a passkey of the authenticator for the user with id 1.
+func register(t *testing.T, rp *webauthn.RelyingParty, db *dbrepo.TestDBRepo, a *webauthntest.Authenticator) *data.Passkey {
+	t.Helper()
+
+	user, _ := db.GetUser(1)
+	c := challenge(t)
+	p, err := rp.Register(db, user, "Laptop", a.Create(rp.CreationOptions(user, c, nil)), c)
+	if err != nil {
+		t.Fatalf("registering: %v", err)
+	}
+	return p
+}
+
+func TestRelyingParty_Register(t *testing.T) {
+	rp := newRP()
+	user := &data.User{ID: 1, Email: "admin@example.com", FirstName: "Admin", LastName: "User"}
+
+	var tests = []struct {
+		name   string
+		change func(opts *webauthn.CreationOptions, a *webauthntest.Authenticator)
+		valid  bool
+	}{
+		{"valid", func(*webauthn.CreationOptions, *webauthntest.Authenticator) {}, true},
+		{"other origin", func(_ *webauthn.CreationOptions, a *webauthntest.Authenticator) {
+			a.Origin = "https://evil.example.com"
+		}, false},
+		{"other challenge", func(opts *webauthn.CreationOptions, _ *webauthntest.Authenticator) { opts.Challenge = []byte("other") }, false},
+		{"other relying party", func(opts *webauthn.CreationOptions, _ *webauthntest.Authenticator) { opts.RP.ID = "evil.example.com" }, false},
+	}
+
+	for _, e := range tests {
+		db := &dbrepo.TestDBRepo{}
+		a := webauthntest.New(t, origin)
+		c := challenge(t)
+		opts := rp.CreationOptions(user, c, nil)
+		e.change(&opts, a)
+
+		p, err := rp.Register(db, user, "Laptop", a.Create(opts), c)
+		if !e.valid {
+			if !errors.Is(err, webauthn.ErrInvalid) {
+				t.Errorf("%s: expected an invalid credential but got %v", e.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+
+		stored, err := db.GetPasskeyByCredentialID(a.CredentialID)
+		if err != nil || stored.ID != p.ID || stored.UserID != 1 || stored.Name != "Laptop" {
+			t.Errorf("%s: passkey not stored: %+v %v", e.name, stored, err)
+		}
+	}
+}
+
+func TestRelyingParty_Register_twice(t *testing.T) {
+	rp := newRP()
+	db := &dbrepo.TestDBRepo{}
+	a := webauthntest.New(t, origin)
+	register(t, rp, db, a)
+
+	user, _ := db.GetUser(1)
+	existing, _ := db.UserPasskeys(1)
+	c := challenge(t)
+	opts := rp.CreationOptions(user, c, existing)
+	if len(opts.ExcludeCredentials) != 1 || string(opts.ExcludeCredentials[0].ID) != string(a.CredentialID) {
+		t.Errorf("the registered passkey is not excluded: %+v", opts.ExcludeCredentials)
+	}
+
+	// an authenticator ignoring the exclusion
+	if _, err := rp.Register(db, user, "Again", a.Create(opts), c); !errors.Is(err, webauthn.ErrInvalid) {
+		t.Errorf("expected an invalid credential but got %v", err)
+	}
+}
+
+func TestRelyingParty_Login(t *testing.T) {
+	rp := newRP()
+
+	var tests = []struct {
+		name    string
+		options func(opts *webauthn.RequestOptions)
+		answer  func(r *webauthn.AssertionResponse)
+		valid   bool
+	}{
+		{"valid", nil, nil, true},
+		{"other challenge", func(opts *webauthn.RequestOptions) { opts.Challenge = []byte("other") }, nil, false},
+		{"other relying party", func(opts *webauthn.RequestOptions) { opts.RPID = "evil.example.com" }, nil, false},
+		{"other user", nil, func(r *webauthn.AssertionResponse) { r.Response.UserHandle = webauthn.UserHandle(2) }, false},
+		{"bad signature", nil, func(r *webauthn.AssertionResponse) { r.Response.Signature[10] ^= 1 }, false},
+		{"unknown passkey", nil, func(r *webauthn.AssertionResponse) { r.RawID = []byte("unknown") }, false},
+	}
+
+	for _, e := range tests {
+		db := &dbrepo.TestDBRepo{}
+		a := webauthntest.New(t, origin)
+		p := register(t, rp, db, a)
+
+		c := challenge(t)
+		opts := rp.RequestOptions(c)
+		if e.options != nil {
+			e.options(&opts)
+		}
+		r := a.Get(opts)
+		if e.answer != nil {
+			e.answer(&r)
+		}
+
+		user, err := rp.Login(db, r, c)
+		if !e.valid {
+			if !errors.Is(err, webauthn.ErrInvalid) {
+				t.Errorf("%s: expected an invalid credential but got %v", e.name, err)
+			}
+			continue
+		}
+		if err != nil || user.ID != 1 {
+			t.Errorf("%s: expected user 1 but got %v %v", e.name, user, err)
+			continue
+		}
+
+		stored, _ := db.GetPasskeyByCredentialID(p.CredentialID)
+		if stored.SignCount != 1 || stored.LastUsedAt == nil {
+			t.Errorf("%s: use not recorded: %+v", e.name, stored)
+		}
+	}
+}
+
+func TestRelyingParty_Login_cloned(t *testing.T) {
+	rp := newRP()
+	db := &dbrepo.TestDBRepo{}
+	a := webauthntest.New(t, origin)
+	register(t, rp, db, a)
+	clone := a.Clone()
+
+	c := challenge(t)
+	if _, err := rp.Login(db, a.Get(rp.RequestOptions(c)), c); err != nil {
+		t.Fatal(err)
+	}
+
+	// the clone counts from where the authenticator was when copied
+	c = challenge(t)
+	if _, err := rp.Login(db, clone.Get(rp.RequestOptions(c)), c); !errors.Is(err, webauthn.ErrInvalid) {
+		t.Errorf("expected a cloned authenticator to be refused but got %v", err)
+	}
+
+	// as is a replayed answer
+	c = challenge(t)
+	r := a.Get(rp.RequestOptions(c))
+	if _, err := rp.Login(db, r, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.Login(db, r, c); !errors.Is(err, webauthn.ErrInvalid) {
+		t.Errorf("expected a replayed answer to be refused but got %v", err)
+	}
+}
+
+func TestBytes_JSON(t *testing.T) {
+	var b webauthn.Bytes
+	for _, in := range []string{`"AQID_w"`, `"AQID_w=="`} {
+		if err := json.Unmarshal([]byte(in), &b); err != nil || string(b) != "\x01\x02\x03\xff" {
+			t.Errorf("%s: got %x %v", in, b, err)
+		}
+	}
+	if err := json.Unmarshal([]byte(`"AQID+w"`), &b); err == nil {
+		t.Error("expected standard base64 to be refused")
+	}
+
+	out, _ := json.Marshal(webauthn.Bytes{1, 2, 3, 0xff})
+	if string(out) != `"AQID_w"` {
+		t.Errorf("expected unpadded base64url but got %s", out)
+	}
+}
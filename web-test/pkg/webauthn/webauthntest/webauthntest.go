@@ -0,0 +1,214 @@
+// Package webauthntest provides a software authenticator, so registering
+// and logging in with passkeys can be tested without a browser.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"slices"
+	"testing"
+	"webapp/pkg/webauthn"
+)
+
+// Authenticator is a software authenticator holding one ES256 passkey,
+// which it makes when Create is first called. It answers as a browser on
+// Origin would, and tests may change its fields between ceremonies.
+type Authenticator struct {
+	Origin string
+
+	// SignCount is the counter of signatures, incremented before each
+	// assertion.
+	SignCount uint32
+
+	// CredentialID and UserHandle are those of the passkey, once created.
+	CredentialID []byte
+	UserHandle   []byte
+
+	t   testing.TB
+	key *ecdsa.PrivateKey
+}
+
+// New returns an authenticator used from pages on origin.
+func New(t testing.TB, origin string) *Authenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Authenticator{Origin: origin, t: t, key: key}
+}
+
+// Clone returns an authenticator holding the same passkey, with the same
+// sign count, as a copied authenticator would.
+func (a *Authenticator) Clone() *Authenticator {
+	c := *a
+	c.CredentialID = slices.Clone(a.CredentialID)
+	c.UserHandle = slices.Clone(a.UserHandle)
+	return &c
+}
+
+// Create answers the options of navigator.credentials.create, making the
+// passkey.
+func (a *Authenticator) Create(opts webauthn.CreationOptions) webauthn.RegistrationResponse {
+	a.t.Helper()
+
+	if a.CredentialID == nil {
+		a.CredentialID = make([]byte, 16)
+		if _, err := rand.Read(a.CredentialID); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	a.UserHandle = opts.User.ID
+
+	clientData := a.clientData("webauthn.create", opts.Challenge)
+
+	// attested credential data: a zero AAGUID, the credential and its key
+	authData := a.authData(opts.RP.ID, flagUserPresent|flagUserVerified|flagBackupEligible|flagBackedUp|flagAttestedCredData)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.CredentialID)))
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, a.PublicKey()...)
+
+	// {"fmt": "none", "attStmt": {}, "authData": authData}
+	var attestation []byte
+	attestation = cborHead(attestation, 5, 3)
+	attestation = cborText(attestation, "fmt")
+	attestation = cborText(attestation, "none")
+	attestation = cborText(attestation, "attStmt")
+	attestation = cborHead(attestation, 5, 0)
+	attestation = cborText(attestation, "authData")
+	attestation = cborBytes(attestation, authData)
+
+	return webauthn.RegistrationResponse{
+		ID:                      base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		RawID:                   a.CredentialID,
+		Type:                    "public-key",
+		AuthenticatorAttachment: "platform",
+		ClientExtensionResults:  map[string]any{},
+		Response: webauthn.AuthenticatorAttestationData{
+			ClientDataJSON:     clientData,
+			AttestationObject:  attestation,
+			AuthenticatorData:  authData,
+			Transports:         []string{"internal"},
+			PublicKeyAlgorithm: webauthn.AlgES256,
+		},
+	}
+}
+
+// Get answers the options of navigator.credentials.get, signing with the
+// passkey.
+func (a *Authenticator) Get(opts webauthn.RequestOptions) webauthn.AssertionResponse {
+	a.t.Helper()
+
+	if a.CredentialID == nil {
+		a.t.Fatal("webauthntest: the authenticator has no passkey yet")
+	}
+	a.SignCount++
+
+	clientData := a.clientData("webauthn.get", opts.Challenge)
+	authData := a.authData(opts.RPID, flagUserPresent|flagUserVerified|flagBackupEligible|flagBackedUp)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(slices.Clip(authData), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return webauthn.AssertionResponse{
+		ID:                      base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		RawID:                   a.CredentialID,
+		Type:                    "public-key",
+		AuthenticatorAttachment: "platform",
+		ClientExtensionResults:  map[string]any{},
+		Response: webauthn.AuthenticatorAssertionData{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         sig,
+			UserHandle:        a.UserHandle,
+		},
+	}
+}
+
+// PublicKey returns the COSE encoded public key of the passkey.
+func (a *Authenticator) PublicKey() []byte {
+	x := a.key.X.FillBytes(make([]byte, 32))
+	y := a.key.Y.FillBytes(make([]byte, 32))
+
+	// {1: 2 (EC2), 3: -7 (ES256), -1: 1 (P-256), -2: x, -3: y}
+	var b []byte
+	b = cborHead(b, 5, 5)
+	b = cborInt(b, 1)
+	b = cborInt(b, 2)
+	b = cborInt(b, 3)
+	b = cborInt(b, webauthn.AlgES256)
+	b = cborInt(b, -1)
+	b = cborInt(b, 1)
+	b = cborInt(b, -2)
+	b = cborBytes(b, x)
+	b = cborInt(b, -3)
+	b = cborBytes(b, y)
+	return b
+}
+
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagBackupEligible   = 0x08
+	flagBackedUp         = 0x10
+	flagAttestedCredData = 0x40
+)
+
+func (a *Authenticator) clientData(typ string, challenge []byte) []byte {
+	b, err := json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return b
+}
+
+func (a *Authenticator) authData(rpID string, flags byte) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	b := append(hash[:], flags)
+	return binary.BigEndian.AppendUint32(b, a.SignCount)
+}
+
+// cborHead appends the head of a CBOR item of major type with argument n.
+func cborHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n <= 0xff:
+		return append(b, major<<5|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(n))
+	}
+}
+
+func cborInt(b []byte, n int) []byte {
+	if n < 0 {
+		return cborHead(b, 1, uint64(-1-n))
+	}
+	return cborHead(b, 0, uint64(n))
+}
+
+func cborBytes(b, s []byte) []byte {
+	return append(cborHead(b, 2, uint64(len(s))), s...)
+}
+
+func cborText(b []byte, s string) []byte {
+	return append(cborHead(b, 3, uint64(len(s))), s...)
+}
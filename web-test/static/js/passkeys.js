@@ -0,0 +1,108 @@
+// Registering and logging in with passkeys. Forms with data-passkey are
+// hidden until this script finds the browser supports passkeys. Submitting
+// one fetches the options at data-options, asks the authenticator, and posts
+// what it answers to the action of the form, as JSON.
+(function () {
+  "use strict";
+
+  if (!window.PublicKeyCredential || !navigator.credentials) {
+    return;
+  }
+
+  function toBytes(s) {
+    s = s.replace(/-/g, "+").replace(/_/g, "/");
+    const bin = atob(s + "===".slice((s.length + 3) % 4));
+    return Uint8Array.from(bin, (c) => c.charCodeAt(0));
+  }
+
+  function toBase64url(buf) {
+    const bin = String.fromCharCode(...new Uint8Array(buf));
+    return btoa(bin).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+  }
+
+  function creationOptions(o) {
+    o.challenge = toBytes(o.challenge);
+    o.user.id = toBytes(o.user.id);
+    o.excludeCredentials = o.excludeCredentials.map((c) => ({ ...c, id: toBytes(c.id) }));
+    return o;
+  }
+
+  function requestOptions(o) {
+    o.challenge = toBytes(o.challenge);
+    o.allowCredentials = o.allowCredentials.map((c) => ({ ...c, id: toBytes(c.id) }));
+    return o;
+  }
+
+  function credentialJSON(cred) {
+    const r = cred.response;
+    const json = {
+      id: cred.id,
+      rawId: toBase64url(cred.rawId),
+      type: cred.type,
+      authenticatorAttachment: cred.authenticatorAttachment || undefined,
+      clientExtensionResults: cred.getClientExtensionResults(),
+      response: { clientDataJSON: toBase64url(r.clientDataJSON) },
+    };
+    if (r.attestationObject) {
+      json.response.attestationObject = toBase64url(r.attestationObject);
+      if (r.getTransports) {
+        json.response.transports = r.getTransports();
+      }
+    } else {
+      json.response.authenticatorData = toBase64url(r.authenticatorData);
+      json.response.signature = toBase64url(r.signature);
+      if (r.userHandle) {
+        json.response.userHandle = toBase64url(r.userHandle);
+      }
+    }
+    return json;
+  }
+
+  async function post(form, url, body) {
+    const resp = await fetch(url, {
+      method: "POST",
+      credentials: "same-origin",
+      headers: {
+        "Content-Type": "application/json",
+        "X-CSRF-Token": form.elements.csrf_token.value,
+      },
+      body: JSON.stringify(body),
+    });
+    const json = await resp.json().catch(() => ({}));
+    if (!resp.ok) {
+      throw new Error(json.error || resp.statusText);
+    }
+    return json;
+  }
+
+  async function submit(form) {
+    const options = await post(form, form.dataset.options, {});
+    let body;
+    if (form.dataset.passkey === "register") {
+      const cred = await navigator.credentials.create({ publicKey: creationOptions(options) });
+      body = { name: form.elements.name.value, credential: credentialJSON(cred) };
+    } else {
+      const cred = await navigator.credentials.get({ publicKey: requestOptions(options) });
+      body = credentialJSON(cred);
+    }
+    const next = await post(form, form.action, body);
+    window.location.assign(next.redirect);
+  }
+
+  document.addEventListener("DOMContentLoaded", () => {
+    document.querySelectorAll("form[data-passkey]").forEach((form) => {
+      form.hidden = false;
+      form.addEventListener("submit", (event) => {
+        event.preventDefault();
+        const error = form.querySelector("[data-passkey-error]");
+        error.textContent = "";
+        submit(form).catch((err) => {
+          // users who cancel the prompt know why nothing happened
+          if (err.name !== "NotAllowedError") {
+            error.textContent = err.message;
+          }
+        });
+      });
+    });
+  });
+})();
@@ -0,0 +1,10 @@
+// Package static embeds the web application's static assets. Uploaded files,
+// kept in img, are not part of it and are always served from disk.
+package static
+
+import "embed"
+
+// FS holds the stylesheets and scripts.
+//
+//go:embed css js
+var FS embed.FS
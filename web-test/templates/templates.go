@@ -0,0 +1,9 @@
+// Package templates embeds the web application's templates.
+package templates
+
+import "embed"
+
+// FS holds the pages, layouts and partials.
+//
+//go:embed *.gohtml
+var FS embed.FS